@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -16,6 +17,11 @@ const (
 	Internal         Reason = "INTERNAL"
 	Locked           Reason = "LOCKED"
 	Conflict         Reason = "CONFLICT"
+	PaymentRequired  Reason = "PAYMENT_REQUIRED"
+	Unprocessable    Reason = "UNPROCESSABLE"
+	Unauthorized     Reason = "UNAUTHORIZED"
+	Forbidden        Reason = "FORBIDDEN"
+	TooManyRequests  Reason = "TOO_MANY_REQUESTS"
 )
 
 var (
@@ -47,13 +53,25 @@ func RespondError(w http.ResponseWriter, err Error) {
 }
 
 func RespondOK(w http.ResponseWriter, resp interface{}) {
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
+	Respond(w, http.StatusOK, resp)
+}
+
+// Respond writes resp as JSON with status, setting the content type itself for the handlers mounted outside
+// JSONResponseMiddleware.
+func Respond(w http.ResponseWriter, status int, resp interface{}) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(resp); err != nil {
 		RespondError(w, Error{
 			Err:        err,
 			HTTPStatus: http.StatusInternalServerError,
 			Reason:     Internal,
 		})
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body.Bytes())
 }
 
 func GetStringURLParam(r *http.Request, key string) (string, error) {
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"reby/domain/apikey"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyMiddleware authenticates the partners calling with an X-API-Key header. Requests without the header are left
+// to AuthMiddleware.
+func APIKeyMiddleware(manager apikey.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret := r.Header.Get(APIKeyHeader)
+			if secret == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			k, err := manager.Authenticate(r.Context(), secret)
+			if err != nil {
+				if errors.Is(err, apikey.ErrInvalidKey) {
+					RespondError(w, Error{
+						Err:        err,
+						HTTPStatus: http.StatusUnauthorized,
+						Reason:     Unauthorized,
+					})
+					return
+				}
+				RespondError(w, Error{
+					Err:        err,
+					HTTPStatus: http.StatusInternalServerError,
+					Reason:     Internal,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), Principal{
+				Role:      RolePartner,
+				PartnerID: k.PartnerID,
+				APIKeyID:  k.ID,
+				Scopes:    k.Scopes,
+			})))
+		})
+	}
+}
+
+// RequireScope only lets through the partners whose key has scope. It does not restrict the other callers, use
+// RequireRoles for them.
+func RequireScope(scope apikey.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFrom(r.Context())
+			if !ok || principal.Role != RolePartner {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, s := range principal.Scopes {
+				if s == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			RespondError(w, Error{
+				Err:        ErrForbidden,
+				HTTPStatus: http.StatusForbidden,
+				Reason:     Forbidden,
+			})
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"reby/api"
+	"reby/domain/apikey"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	testCases := []struct {
+		description       string
+		secret            string
+		key               *apikey.APIKey
+		authErr           error
+		expectedCode      int
+		expectedPrincipal *api.Principal
+	}{
+		{
+			description:  "valid key",
+			secret:       "rk_1",
+			key:          &apikey.APIKey{ID: "k_1", PartnerID: "p_1", Scopes: []apikey.Scope{apikey.ScopeRidesWrite}},
+			expectedCode: http.StatusOK,
+			expectedPrincipal: &api.Principal{
+				Role:      api.RolePartner,
+				PartnerID: "p_1",
+				APIKeyID:  "k_1",
+				Scopes:    []apikey.Scope{apikey.ScopeRidesWrite},
+			},
+		},
+		{
+			description:  "without key",
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "invalid key",
+			secret:       "rk_1",
+			authErr:      apikey.ErrInvalidKey,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description:  "internal",
+			secret:       "rk_1",
+			authErr:      errors.New("ERR_RANDOM"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			managerMock := apikey.NewManagerMock()
+			managerMock.On("Authenticate", tc.secret).Return(tc.key, tc.authErr)
+
+			var principal *api.Principal
+			h := api.APIKeyMiddleware(managerMock)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if p, ok := api.PrincipalFrom(r.Context()); ok {
+					principal = &p
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/rides", nil)
+			if tc.secret != "" {
+				req.Header.Set(api.APIKeyHeader, tc.secret)
+			}
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			assert.Equal(t, tc.expectedPrincipal, principal)
+			if tc.secret == "" {
+				managerMock.AssertNotCalled(t, "Authenticate", tc.secret)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	h := api.RequireScope(apikey.ScopeRidesWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		description  string
+		principal    api.Principal
+		expectedCode int
+	}{
+		{
+			description:  "partner with scope",
+			principal:    api.Principal{Role: api.RolePartner, Scopes: []apikey.Scope{apikey.ScopeRidesWrite}},
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "partner without scope",
+			principal:    api.Principal{Role: api.RolePartner, Scopes: []apikey.Scope{apikey.ScopeReceiptsRead}},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			description:  "not a partner",
+			principal:    api.Principal{UserID: "u_1", Role: api.RoleRider},
+			expectedCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/rides", nil)
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req.WithContext(api.WithPrincipal(req.Context(), tc.principal)))
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			if tc.expectedCode == http.StatusForbidden {
+				var errorDetail api.ErrorDetail
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+				assert.Equal(t, string(api.Forbidden), errorDetail.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"reby/domain/apikey"
+	"reby/pkg/jwt"
+)
+
+var (
+	ErrMissingToken = errors.New("ERR_MISSING_BEARER_TOKEN")
+	ErrForbidden    = errors.New("ERR_FORBIDDEN")
+	ErrInvalidRole  = errors.New("ERR_INVALID_ROLE")
+)
+
+type Role string
+
+const (
+	RoleRider    Role = "RIDER"
+	RoleOperator Role = "OPERATOR"
+	RoleSupport  Role = "SUPPORT"
+	RoleAdmin    Role = "ADMIN"
+	// RolePartner is the role of the calls authenticated with an API key.
+	RolePartner Role = "PARTNER"
+)
+
+// isTokenRole tells whether bearer tokens can carry the role. Partners only authenticate with API keys.
+func (r Role) isTokenRole() bool {
+	switch r {
+	case RoleRider, RoleOperator, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID string
+	Role   Role
+	// PartnerID, APIKeyID and Scopes are only set for partners.
+	PartnerID string
+	APIKeyID  string
+	Scopes    []apikey.Scope
+}
+
+type principalCtxKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+// PrincipalFrom returns the caller authenticated by AuthMiddleware.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return p, ok
+}
+
+// AuthMiddleware requires a valid JWT in the Authorization header and puts its subject into the request context as
+// the Principal. Requests already authenticated, by an API key, are let through, and tokens with a role that isn't
+// given to users get a 401.
+func AuthMiddleware(verifier jwt.Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := PrincipalFrom(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			authorization := r.Header.Get("Authorization")
+			token := strings.TrimPrefix(authorization, "Bearer ")
+			if !strings.HasPrefix(authorization, "Bearer ") || token == "" {
+				RespondError(w, Error{
+					Err:        ErrMissingToken,
+					HTTPStatus: http.StatusUnauthorized,
+					Reason:     Unauthorized,
+				})
+				return
+			}
+
+			claims, err := verifier.Verify(token)
+			if err != nil {
+				RespondError(w, Error{
+					Err:        err,
+					HTTPStatus: http.StatusUnauthorized,
+					Reason:     Unauthorized,
+				})
+				return
+			}
+
+			// Tokens without a role are issued to riders
+			role := Role(strings.ToUpper(claims.Role))
+			if role == "" {
+				role = RoleRider
+			}
+			if !role.isTokenRole() {
+				RespondError(w, Error{
+					Err:        ErrInvalidRole,
+					HTTPStatus: http.StatusUnauthorized,
+					Reason:     Unauthorized,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), Principal{UserID: claims.Subject, Role: role})))
+		})
+	}
+}
+
+// RequireRoles only lets through the callers with one of roles, the rest get a 403.
+func RequireRoles(roles ...Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFrom(r.Context())
+			if !ok {
+				RespondError(w, Error{
+					Err:        ErrMissingToken,
+					HTTPStatus: http.StatusUnauthorized,
+					Reason:     Unauthorized,
+				})
+				return
+			}
+
+			for _, role := range roles {
+				if principal.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			RespondError(w, Error{
+				Err:        ErrForbidden,
+				HTTPStatus: http.StatusForbidden,
+				Reason:     Forbidden,
+			})
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reby/api"
+	"reby/pkg/jwt"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	now := time.Now()
+	secret := []byte("secret")
+	verifier, err := jwt.NewVerifier(jwt.Keys{HMACSecret: secret}, "identity", "api", timenow.NewFixedTime(now))
+	require.NoError(t, err)
+
+	claims := jwt.Claims{
+		Subject:   "u_1",
+		Issuer:    "identity",
+		Audience:  jwt.Audience{"api"},
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+	valid, err := jwt.SignHS256(claims, secret)
+	require.NoError(t, err)
+	expiredClaims := claims
+	expiredClaims.ExpiresAt = now.Add(-time.Hour).Unix()
+	expired, err := jwt.SignHS256(expiredClaims, secret)
+	require.NoError(t, err)
+	supportClaims := claims
+	supportClaims.Role = "support"
+	support, err := jwt.SignHS256(supportClaims, secret)
+	require.NoError(t, err)
+	partnerClaims := claims
+	partnerClaims.Role = "PARTNER"
+	partner, err := jwt.SignHS256(partnerClaims, secret)
+	require.NoError(t, err)
+	unknownClaims := claims
+	unknownClaims.Role = "root"
+	unknown, err := jwt.SignHS256(unknownClaims, secret)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description       string
+		authorization     string
+		expectedCode      int
+		expectedDetail    string
+		expectedPrincipal api.Principal
+	}{
+		{
+			description:       "valid token is a rider by default",
+			authorization:     "Bearer " + valid,
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: api.Principal{UserID: "u_1", Role: api.RoleRider},
+		},
+		{
+			description:       "valid token with role",
+			authorization:     "Bearer " + support,
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: api.Principal{UserID: "u_1", Role: api.RoleSupport},
+		},
+		{
+			description:    "missing header",
+			authorization:  "",
+			expectedCode:   http.StatusUnauthorized,
+			expectedDetail: "ERR_MISSING_BEARER_TOKEN",
+		},
+		{
+			description:    "not a bearer token",
+			authorization:  "Basic dTpw",
+			expectedCode:   http.StatusUnauthorized,
+			expectedDetail: "ERR_MISSING_BEARER_TOKEN",
+		},
+		{
+			description:    "expired token",
+			authorization:  "Bearer " + expired,
+			expectedCode:   http.StatusUnauthorized,
+			expectedDetail: "ERR_TOKEN_EXPIRED",
+		},
+		{
+			description:    "partner role is only for API keys",
+			authorization:  "Bearer " + partner,
+			expectedCode:   http.StatusUnauthorized,
+			expectedDetail: "ERR_INVALID_ROLE",
+		},
+		{
+			description:    "unknown role",
+			authorization:  "Bearer " + unknown,
+			expectedCode:   http.StatusUnauthorized,
+			expectedDetail: "ERR_INVALID_ROLE",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var principal api.Principal
+			h := api.AuthMiddleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = api.PrincipalFrom(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/rides", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			if tc.expectedCode == http.StatusOK {
+				assert.Equal(t, tc.expectedPrincipal, principal)
+				return
+			}
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, string(api.Unauthorized), errorDetail.Reason)
+			assert.Equal(t, tc.expectedDetail, errorDetail.Detail)
+		})
+	}
+}
+
+func TestRequireRoles(t *testing.T) {
+	h := api.RequireRoles(api.RoleSupport, api.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		description    string
+		principal      *api.Principal
+		expectedCode   int
+		expectedReason string
+	}{
+		{
+			description:  "allowed role",
+			principal:    &api.Principal{UserID: "u_1", Role: api.RoleSupport},
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:    "other role",
+			principal:      &api.Principal{UserID: "u_1", Role: api.RoleRider},
+			expectedCode:   http.StatusForbidden,
+			expectedReason: string(api.Forbidden),
+		},
+		{
+			description:    "unknown role",
+			principal:      &api.Principal{UserID: "u_1", Role: "ROOT"},
+			expectedCode:   http.StatusForbidden,
+			expectedReason: string(api.Forbidden),
+		},
+		{
+			description:    "unauthenticated",
+			expectedCode:   http.StatusUnauthorized,
+			expectedReason: string(api.Unauthorized),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.principal != nil {
+				req = req.WithContext(api.WithPrincipal(req.Context(), *tc.principal))
+			}
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			if tc.expectedCode != http.StatusOK {
+				var errorDetail api.ErrorDetail
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+				assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+			}
+		})
+	}
+}
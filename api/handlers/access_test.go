@@ -0,0 +1,171 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reby/api"
+	"reby/api/handlers"
+	"reby/domain/apikey"
+	"reby/domain/money"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+	"reby/domain/wallet"
+	"reby/pkg/timenow"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointAccess(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mx := chi.NewRouter()
+	// Stands in for the auth middleware, the role comes from the test case
+	mx.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := api.Principal{UserID: "u_1", Role: api.Role(r.Header.Get("X-Role"))}
+			if p.Role == api.RolePartner {
+				// Scopes are checked on their own, partners here have all of them
+				p = api.Principal{
+					Role:      api.RolePartner,
+					PartnerID: "p_1",
+					Scopes:    []apikey.Scope{apikey.ScopeRidesWrite, apikey.ScopeReceiptsRead, apikey.ScopeWebhooksManage},
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(api.WithPrincipal(r.Context(), p)))
+		})
+	})
+	handlers.AddRideEndpoints(mx, handlers.RideHandlers{Start: ok, Finish: ok, History: ok, Adjust: ok, Settle: ok})
+	handlers.AddAdminRideEndpoints(mx, handlers.AdminRideHandlers{ForceFinish: ok, Cancel: ok})
+	handlers.AddWebhookEndpoints(mx, handlers.WebhookHandlers{
+		Subscribe:   ok,
+		List:        ok,
+		Unsubscribe: ok,
+		DeadLetters: ok,
+		Replay:      ok,
+	})
+	handlers.AddWalletEndpoints(mx, handlers.WalletHandlers{TopUp: ok, Balance: ok})
+	handlers.AddReceiptEndpoints(mx, handlers.ReceiptHandlers{Get: ok})
+	handlers.AddAPIKeyEndpoints(mx, handlers.APIKeyHandlers{Create: ok, List: ok, Rotate: ok, Revoke: ok})
+
+	roles := []api.Role{api.RoleRider, api.RoleOperator, api.RoleSupport, api.RoleAdmin, api.RolePartner}
+	testCases := []struct {
+		method  string
+		path    string
+		allowed []api.Role
+	}{
+		{http.MethodPost, "/rides", []api.Role{api.RoleRider, api.RolePartner}},
+		{http.MethodPost, "/rides/r_1/finish", []api.Role{api.RoleRider, api.RolePartner}},
+		{http.MethodGet, "/rides/r_1/history", []api.Role{api.RoleOperator, api.RoleSupport, api.RoleAdmin}},
+		{http.MethodPost, "/rides/r_1/adjustments", []api.Role{api.RoleSupport, api.RoleAdmin}},
+		{http.MethodPost, "/rides/r_1/settle", []api.Role{api.RoleRider, api.RoleAdmin}},
+		{http.MethodGet, "/rides/r_1/receipt", []api.Role{api.RoleRider, api.RolePartner, api.RoleSupport, api.RoleAdmin}},
+		{http.MethodPost, "/admin/rides/r_1/finish", []api.Role{api.RoleOperator, api.RoleAdmin}},
+		{http.MethodPost, "/admin/rides/r_1/cancel", []api.Role{api.RoleOperator, api.RoleSupport, api.RoleAdmin}},
+		{http.MethodPost, "/webhooks", []api.Role{api.RoleAdmin, api.RolePartner}},
+		{http.MethodGet, "/webhooks", []api.Role{api.RoleAdmin, api.RolePartner}},
+		{http.MethodDelete, "/webhooks/s_1", []api.Role{api.RoleAdmin, api.RolePartner}},
+		{http.MethodGet, "/webhooks/dead-letters", []api.Role{api.RoleAdmin}},
+		{http.MethodPost, "/webhooks/dead-letters/d_1/replay", []api.Role{api.RoleAdmin}},
+		{http.MethodPost, "/users/u_1/wallet/top-ups", []api.Role{api.RoleRider, api.RoleAdmin}},
+		{http.MethodGet, "/users/u_1/wallet", []api.Role{api.RoleRider, api.RoleSupport, api.RoleAdmin}},
+		{http.MethodPost, "/admin/api-keys", []api.Role{api.RoleAdmin}},
+		{http.MethodGet, "/admin/api-keys", []api.Role{api.RoleAdmin}},
+		{http.MethodPost, "/admin/api-keys/k_1/rotate", []api.Role{api.RoleAdmin}},
+		{http.MethodDelete, "/admin/api-keys/k_1", []api.Role{api.RoleAdmin}},
+	}
+	for _, tc := range testCases {
+		for _, role := range roles {
+			t.Run(tc.method+" "+tc.path+" as "+string(role), func(t *testing.T) {
+				req := httptest.NewRequest(tc.method, tc.path, nil)
+				req.Header.Set("X-Role", string(role))
+				resp := httptest.NewRecorder()
+				mx.ServeHTTP(resp, req)
+
+				expectedCode := http.StatusForbidden
+				for _, allowed := range tc.allowed {
+					if allowed == role {
+						expectedCode = http.StatusOK
+					}
+				}
+				assert.Equal(t, expectedCode, resp.Code)
+			})
+		}
+	}
+}
+
+func TestOwnerAccess(t *testing.T) {
+	mx := chi.NewRouter()
+	// Stands in for the auth middleware, the caller comes from the test case
+	mx.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := api.Principal{
+				UserID:    r.Header.Get("X-User"),
+				Role:      api.Role(r.Header.Get("X-Role")),
+				PartnerID: r.Header.Get("X-Partner"),
+				Scopes:    []apikey.Scope{apikey.ScopeReceiptsRead},
+			}
+			next.ServeHTTP(w, r.WithContext(api.WithPrincipal(r.Context(), p)))
+		})
+	})
+
+	walletManagerMock := wallet.NewManagerMock()
+	walletManagerMock.On("Get", "u_1").Return(&wallet.Wallet{UserID: "u_1"}, nil)
+	handlers.AddWalletEndpoints(mx, handlers.NewWalletHandlers(walletManagerMock))
+
+	// r_1 was started for u_1 by p_1
+	now := time.Now()
+	price := money.NewMoney(100, "EUR")
+	rideRepoMock := ride.NewRepoMock()
+	rideRepoMock.On("GetByID", "r_1").Return(&ride.Ride{
+		ID:         "r_1",
+		UserID:     "u_1",
+		PartnerID:  "p_1",
+		Status:     ride.StatusPaid,
+		StartedAt:  now.Add(-time.Minute),
+		FinishedAt: &now,
+		Price:      &price,
+	}, nil)
+	receiptRepoMock := receipt.NewRepoMock()
+	receiptRepoMock.On("Issue", "r_1", "ES", now).Return(&receipt.Issuance{RideID: "r_1", Country: "ES", Sequence: 1}, nil)
+	generator := receipt.NewGenerator(rideRepoMock, receiptRepoMock, timenow.NewFixedTime(now), "ES", 100, 18)
+	handlers.AddReceiptEndpoints(mx, handlers.NewReceiptHandlers(generator))
+
+	walletPath, topUpsPath, receiptPath := "/users/u_1/wallet", "/users/u_1/wallet/top-ups", "/rides/r_1/receipt"
+	testCases := []struct {
+		description  string
+		method       string
+		path         string
+		role         api.Role
+		userID       string
+		partnerID    string
+		expectedCode int
+	}{
+		{"own wallet", http.MethodGet, walletPath, api.RoleRider, "u_1", "", http.StatusOK},
+		{"wallet of another rider", http.MethodGet, walletPath, api.RoleRider, "u_2", "", http.StatusForbidden},
+		{"top up of another rider", http.MethodPost, topUpsPath, api.RoleRider, "u_2", "", http.StatusForbidden},
+		{"wallet as support", http.MethodGet, walletPath, api.RoleSupport, "s_1", "", http.StatusOK},
+		{"own receipt", http.MethodGet, receiptPath, api.RoleRider, "u_1", "", http.StatusOK},
+		{"receipt of another rider", http.MethodGet, receiptPath, api.RoleRider, "u_2", "", http.StatusForbidden},
+		{"receipt of the partner", http.MethodGet, receiptPath, api.RolePartner, "", "p_1", http.StatusOK},
+		{"receipt of another partner", http.MethodGet, receiptPath, api.RolePartner, "", "p_2", http.StatusForbidden},
+		{"receipt as support", http.MethodGet, receiptPath, api.RoleSupport, "s_1", "", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("X-Role", string(tc.role))
+			req.Header.Set("X-User", tc.userID)
+			req.Header.Set("X-Partner", tc.partnerID)
+			resp := httptest.NewRecorder()
+			mx.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+		})
+	}
+}
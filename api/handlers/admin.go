@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reby/api"
+	"reby/domain/ride"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminRideHandlers are the ride actions support performs on behalf of users.
+type AdminRideHandlers struct {
+	ForceFinish http.Handler
+	Cancel      http.Handler
+}
+
+func NewAdminRideHandlers(finisher ride.Finisher, canceller ride.Canceller) AdminRideHandlers {
+	return AdminRideHandlers{
+		ForceFinish: ForceFinish(finisher),
+		Cancel:      Cancel(canceller),
+	}
+}
+
+func AddAdminRideEndpoints(mx *chi.Mux, ah AdminRideHandlers) {
+	// Operators handle the fleet on the street, support handles the complaints of the riders
+	mx.With(api.RequireRoles(api.RoleOperator, api.RoleAdmin)).
+		Method(http.MethodPost, "/admin/rides/{rideID}/finish", ah.ForceFinish)
+	mx.With(api.RequireRoles(api.RoleOperator, api.RoleSupport, api.RoleAdmin)).
+		Method(http.MethodPost, "/admin/rides/{rideID}/cancel", ah.Cancel)
+}
+
+func ForceFinish(finisher ride.Finisher) http.Handler {
+	return finish(finisher, ride.FinishReasonOperator, ride.ActorOperator)
+}
+
+func Cancel(canceller ride.Canceller) http.Handler {
+	handleError := func(w http.ResponseWriter, err error) {
+		switch {
+		case errors.Is(err, ride.ErrNotFound):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusNotFound,
+				Reason:     api.InvalidParameter,
+			})
+		case errors.Is(err, ride.ErrInvalidCancelParams):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+		case errors.Is(err, ride.ErrAlreadyFinished) || errors.Is(err, ride.ErrAlreadyCancelled) ||
+			errors.Is(err, ride.ErrInvalidTransition) || errors.Is(err, ride.ErrMistakeWindowPassed):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusConflict,
+				Reason:     api.Conflict,
+			})
+		default:
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusInternalServerError,
+				Reason:     api.Internal,
+			})
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rideID, err := api.GetStringURLParam(r, "rideID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		req := struct {
+			Reason string `json:"reason"`
+		}{}
+
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidJSON,
+			})
+			return
+		}
+
+		cancelledRide, err := canceller.Cancel(r.Context(), ride.CancelParams{
+			RideID: rideID,
+			Reason: ride.CancelReason(req.Reason),
+			Actor:  ride.ActorOperator,
+		})
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		api.RespondOK(w, cancelledRide)
+	})
+}
@@ -0,0 +1,211 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reby/api"
+	"reby/api/handlers"
+	"reby/domain/ride"
+)
+
+func TestForceFinish(t *testing.T) {
+	var finisherMock *ride.FinisherMock
+	var hd handlers.AdminRideHandlers
+	rideID := "r_1"
+
+	setup := func() {
+		finisherMock = ride.NewFinisherMock()
+		hd = handlers.NewAdminRideHandlers(finisherMock, nil)
+	}
+
+	doReq := func() *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/admin/rides/%s/finish", rideID)
+		req, err := http.NewRequest(http.MethodPost, path, nil)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("rideID", rideID)
+
+		resp := httptest.NewRecorder()
+		hd.ForceFinish.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		return resp
+	}
+
+	params := ride.FinishParams{
+		RideID: rideID,
+		Reason: ride.FinishReasonOperator,
+		Actor:  ride.ActorOperator,
+	}
+
+	t.Run("ride cancelled", func(t *testing.T) {
+		setup()
+		finisherMock.On("Finish", params).Return(&ride.Ride{}, ride.ErrAlreadyCancelled)
+
+		resp := doReq()
+		assert.Equal(t, http.StatusConflict, resp.Code)
+
+		var errorDetail api.ErrorDetail
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+		assert.Equal(t, "ERR_ALREADY_CANCELLED", errorDetail.Detail)
+		assert.Equal(t, string(api.Conflict), errorDetail.Reason)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		now := time.Now()
+		reason := ride.FinishReasonOperator
+		actor := ride.ActorOperator
+		finishedRide := &ride.Ride{
+			ID:           rideID,
+			StartedAt:    now.Add(-5 * time.Minute),
+			FinishedAt:   &now,
+			FinishReason: &reason,
+			FinishedBy:   &actor,
+		}
+		finisherMock.On("Finish", params).Return(finishedRide, nil)
+
+		resp := doReq()
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var respRide *ride.Ride
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respRide))
+		assert.Equal(t, &reason, respRide.FinishReason)
+		assert.Equal(t, &actor, respRide.FinishedBy)
+	})
+}
+
+func TestCancel(t *testing.T) {
+	var cancellerMock *ride.CancellerMock
+	var hd handlers.AdminRideHandlers
+	rideID := "r_1"
+
+	setup := func() {
+		cancellerMock = ride.NewCancellerMock()
+		hd = handlers.NewAdminRideHandlers(nil, cancellerMock)
+	}
+
+	doReq := func(reason string) *httptest.ResponseRecorder {
+		body := struct {
+			Reason string `json:"reason"`
+		}{
+			Reason: reason,
+		}
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		path := fmt.Sprintf("/admin/rides/%s/cancel", rideID)
+		req, err := http.NewRequest(http.MethodPost, path, &buf)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("rideID", rideID)
+
+		resp := httptest.NewRecorder()
+		hd.Cancel.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		return resp
+	}
+
+	testCases := []struct {
+		description    string
+		cancellerErr   error
+		expectedCode   int
+		expectedReason string
+		expectedDetail string
+	}{
+		{
+			description:    "ride not found",
+			cancellerErr:   ride.ErrNotFound,
+			expectedCode:   http.StatusNotFound,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_RIDE_NOT_FOUND",
+		},
+		{
+			description:    "invalid reason",
+			cancellerErr:   ride.ErrInvalidCancelParams,
+			expectedCode:   http.StatusBadRequest,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_INVALID_CANCEL_PARAMS",
+		},
+		{
+			description:    "ride finished",
+			cancellerErr:   ride.ErrAlreadyFinished,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_ALREADY_FINISHED",
+		},
+		{
+			description:    "ride cancelled",
+			cancellerErr:   ride.ErrAlreadyCancelled,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_ALREADY_CANCELLED",
+		},
+		{
+			description:    "too old to be a mistake",
+			cancellerErr:   ride.ErrMistakeWindowPassed,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_MISTAKE_WINDOW_PASSED",
+		},
+		{
+			description:    "internal",
+			cancellerErr:   errors.New("ERR_RANDOM"),
+			expectedCode:   http.StatusInternalServerError,
+			expectedReason: string(api.Internal),
+			expectedDetail: "ERR_RANDOM",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			cancellerMock.On("Cancel", ride.CancelParams{
+				RideID: rideID,
+				Reason: ride.CancelReasonVehicleFaulty,
+				Actor:  ride.ActorOperator,
+			}).Return(&ride.Ride{}, tc.cancellerErr)
+
+			resp := doReq(string(ride.CancelReasonVehicleFaulty))
+			assert.Equal(t, tc.expectedCode, resp.Code)
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, tc.expectedDetail, errorDetail.Detail)
+			assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		now := time.Now()
+		cancelledRide := &ride.Ride{
+			ID:          rideID,
+			StartedAt:   now.Add(-30 * time.Second),
+			CancelledAt: &now,
+		}
+		cancellerMock.On("Cancel", ride.CancelParams{
+			RideID: rideID,
+			Reason: ride.CancelReasonMistake,
+			Actor:  ride.ActorOperator,
+		}).Return(cancelledRide, nil)
+
+		resp := doReq(string(ride.CancelReasonMistake))
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var respRide *ride.Ride
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respRide))
+		assert.NotNil(t, respRide.CancelledAt)
+	})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reby/api"
+	"reby/domain/apikey"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// APIKeyHandlers manage the API keys of the partner organisations.
+type APIKeyHandlers struct {
+	Create http.Handler
+	List   http.Handler
+	Rotate http.Handler
+	Revoke http.Handler
+}
+
+func NewAPIKeyHandlers(manager apikey.Manager) APIKeyHandlers {
+	return APIKeyHandlers{
+		Create: CreateAPIKey(manager),
+		List:   ListAPIKeys(manager),
+		Rotate: RotateAPIKey(manager),
+		Revoke: RevokeAPIKey(manager),
+	}
+}
+
+func AddAPIKeyEndpoints(mx *chi.Mux, kh APIKeyHandlers) {
+	admins := mx.With(api.RequireRoles(api.RoleAdmin))
+	admins.Method(http.MethodPost, "/admin/api-keys", kh.Create)
+	admins.Method(http.MethodGet, "/admin/api-keys", kh.List)
+	admins.Method(http.MethodPost, "/admin/api-keys/{keyID}/rotate", kh.Rotate)
+	admins.Method(http.MethodDelete, "/admin/api-keys/{keyID}", kh.Revoke)
+}
+
+func handleAPIKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, apikey.ErrNotFound):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusNotFound,
+			Reason:     api.InvalidParameter,
+		})
+	case errors.Is(err, apikey.ErrInvalidParams):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+			Reason:     api.InvalidParameter,
+		})
+	case errors.Is(err, apikey.ErrRevoked) || errors.Is(err, apikey.ErrAlreadyRotated):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusConflict,
+			Reason:     api.Conflict,
+		})
+	default:
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+			Reason:     api.Internal,
+		})
+	}
+}
+
+// CreateAPIKey issues a key for a partner. The response is the only one that includes the secret.
+func CreateAPIKey(manager apikey.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			PartnerID string         `json:"partner_id"`
+			Name      string         `json:"name"`
+			Scopes    []apikey.Scope `json:"scopes"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidJSON,
+			})
+			return
+		}
+
+		issued, err := manager.Create(r.Context(), apikey.CreateParams{
+			PartnerID: req.PartnerID,
+			Name:      req.Name,
+			Scopes:    req.Scopes,
+		})
+		if err != nil {
+			handleAPIKeyError(w, err)
+			return
+		}
+
+		api.RespondOK(w, issued)
+	})
+}
+
+// ListAPIKeys returns the keys of the partner in the partner_id query parameter, with their last-used timestamps.
+func ListAPIKeys(manager apikey.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		partnerID := r.URL.Query().Get("partner_id")
+		if partnerID == "" {
+			api.RespondError(w, api.Error{
+				Err:        apikey.ErrInvalidParams,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		keys, err := manager.List(r.Context(), partnerID)
+		if err != nil {
+			handleAPIKeyError(w, err)
+			return
+		}
+
+		api.RespondOK(w, keys)
+	})
+}
+
+func RotateAPIKey(manager apikey.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := api.GetStringURLParam(r, "keyID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		issued, err := manager.Rotate(r.Context(), keyID)
+		if err != nil {
+			handleAPIKeyError(w, err)
+			return
+		}
+
+		api.RespondOK(w, issued)
+	})
+}
+
+func RevokeAPIKey(manager apikey.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := api.GetStringURLParam(r, "keyID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		k, err := manager.Revoke(r.Context(), keyID)
+		if err != nil {
+			handleAPIKeyError(w, err)
+			return
+		}
+
+		api.RespondOK(w, k)
+	})
+}
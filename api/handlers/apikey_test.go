@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reby/api"
+	"reby/api/handlers"
+	"reby/domain/apikey"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	var managerMock *apikey.ManagerMock
+	var hd handlers.APIKeyHandlers
+	params := apikey.CreateParams{PartnerID: "p_1", Name: "expenses", Scopes: []apikey.Scope{apikey.ScopeRidesWrite}}
+
+	setup := func() {
+		managerMock = apikey.NewManagerMock()
+		hd = handlers.NewAPIKeyHandlers(managerMock)
+	}
+
+	doReq := func() *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(map[string]interface{}{
+			"partner_id": params.PartnerID,
+			"name":       params.Name,
+			"scopes":     params.Scopes,
+		}))
+		req, err := http.NewRequest(http.MethodPost, "/admin/api-keys", &buf)
+		require.NoError(t, err)
+
+		resp := httptest.NewRecorder()
+		hd.Create.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	testCases := []struct {
+		description    string
+		managerErr     error
+		expectedCode   int
+		expectedReason string
+		expectedDetail string
+	}{
+		{
+			description:    "invalid params",
+			managerErr:     apikey.ErrInvalidParams,
+			expectedCode:   http.StatusBadRequest,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_INVALID_API_KEY_PARAMS",
+		},
+		{
+			description:    "internal",
+			managerErr:     errors.New("ERR_RANDOM"),
+			expectedCode:   http.StatusInternalServerError,
+			expectedReason: string(api.Internal),
+			expectedDetail: "ERR_RANDOM",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			managerMock.On("Create", params).Return(&apikey.Issued{}, tc.managerErr)
+
+			resp := doReq()
+			assert.Equal(t, tc.expectedCode, resp.Code)
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, tc.expectedDetail, errorDetail.Detail)
+			assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		managerMock.On("Create", params).Return(&apikey.Issued{
+			APIKey: &apikey.APIKey{ID: "k_1", PartnerID: "p_1", Hash: "hash"},
+			Secret: "rk_secret",
+		}, nil)
+
+		resp := doReq()
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "k_1", body["id"])
+		assert.Equal(t, "rk_secret", body["secret"])
+		assert.NotContains(t, body, "hash")
+	})
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	var managerMock *apikey.ManagerMock
+	var hd handlers.APIKeyHandlers
+	keyID := "k_1"
+
+	setup := func() {
+		managerMock = apikey.NewManagerMock()
+		hd = handlers.NewAPIKeyHandlers(managerMock)
+	}
+
+	doReq := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/admin/api-keys/%s/rotate", keyID), nil)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("keyID", keyID)
+
+		resp := httptest.NewRecorder()
+		hd.Rotate.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		return resp
+	}
+
+	testCases := []struct {
+		description    string
+		managerErr     error
+		expectedCode   int
+		expectedReason string
+	}{
+		{
+			description:    "not found",
+			managerErr:     apikey.ErrNotFound,
+			expectedCode:   http.StatusNotFound,
+			expectedReason: string(api.InvalidParameter),
+		},
+		{
+			description:    "revoked",
+			managerErr:     apikey.ErrRevoked,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+		},
+		{
+			description:    "already rotated",
+			managerErr:     apikey.ErrAlreadyRotated,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			managerMock.On("Rotate", keyID).Return(&apikey.Issued{}, tc.managerErr)
+
+			resp := doReq()
+			assert.Equal(t, tc.expectedCode, resp.Code)
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+		})
+	}
+}
@@ -1,35 +1,97 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"reby/infra/pg"
 
 	_ "github.com/lib/pq" // Postgres driver
 
+	"reby/api"
 	"reby/app/config"
+	"reby/domain/apikey"
+	"reby/domain/receipt"
 	"reby/domain/ride"
 	"reby/domain/user"
 	"reby/domain/vehicle"
+	"reby/domain/wallet"
+	"reby/domain/webhook"
 	"reby/infra"
 	"reby/infra/mem"
+	"reby/infra/sqlite"
+	"reby/pkg/event"
+	"reby/pkg/health"
 	"reby/pkg/id"
+	"reby/pkg/idempotency"
+	"reby/pkg/jwt"
+	"reby/pkg/lifecycle"
+	"reby/pkg/ratelimit"
 	"reby/pkg/timenow"
+	"reby/pkg/txn"
+	"reby/pkg/worker"
 )
 
 type repos struct {
 	user    user.Repo
 	vehicle vehicle.Repo
 	ride    ride.Repo
+	outbox  event.Outbox
+	webhook webhook.Repo
+	wallet  wallet.Repo
+	receipt receipt.Repo
+	apiKey  apikey.Repo
+
+	idempotency idempotency.Store
+	rateLimit   ratelimit.Store
+
+	// txManager runs the calls of a service to several repos as a unit of work.
+	txManager txn.Manager
+
+	// db is the connection pool behind the repos, nil when they are in memory.
+	db *sql.DB
+	// memStore keeps the repos in memory across restarts, nil when it is not configured.
+	memStore *mem.Store
 }
 
 type services struct {
-	starter  ride.Starter
-	finisher ride.Finisher
+	starter       ride.Starter
+	finisher      ride.Finisher
+	canceller     ride.Canceller
+	expirer       ride.Expirer
+	historyGetter ride.HistoryGetter
+	adjuster      ride.Adjuster
+	debtSettler   ride.DebtSettler
+	receipts      receipt.Generator
+
+	walletManager wallet.Manager
+	apiKeys       apikey.Manager
+
+	webhookManager    webhook.Manager
+	webhookDispatcher event.Sink
+	webhookDeliverer  webhook.Deliverer
 }
 
 type Handlers struct {
-	Ride RideHandlers
+	// Auth authenticates the callers of every endpoint, partners by API key and everyone else by bearer token.
+	Auth func(http.Handler) http.Handler
+	// RateLimit applies the default rate limit to every endpoint. It goes before Auth, so it limits by client IP and
+	// also stops the floods of requests with bad credentials. The limits of each route go after Auth and limit by caller.
+	RateLimit func(http.Handler) http.Handler
+
+	Ride      RideHandlers
+	AdminRide AdminRideHandlers
+	Webhook   WebhookHandlers
+	Wallet    WalletHandlers
+	Receipt   ReceiptHandlers
+	APIKey    APIKeyHandlers
+	Health    HealthHandlers
+	Metrics   MetricsHandlers
 }
 
 func initRepos(conf *config.Config) repos {
@@ -40,12 +102,79 @@ func initRepos(conf *config.Config) repos {
 			user:    pg.NewUserDB(db),
 			vehicle: pg.NewVehicleDB(db),
 			ride:    pg.NewRideDB(db),
+			outbox:  pg.NewOutbox(db),
+			webhook: pg.NewWebhookDB(db),
+			wallet:  pg.NewWalletDB(db),
+			receipt: pg.NewReceiptDB(db),
+			apiKey:  pg.NewAPIKeyDB(db),
+
+			idempotency: pg.NewIdempotencyStore(db),
+			// There is no shared store yet, every instance limits on its own
+			rateLimit: mem.NewRateLimitStore(),
+
+			txManager: txn.NewSQLManager(db),
+
+			db: db,
+		}
+	case infra.SQLite:
+		db := sqlite.InitDB(conf)
+		return repos{
+			user:    sqlite.NewUserDB(db),
+			vehicle: sqlite.NewVehicleDB(db),
+			ride:    sqlite.NewRideDB(db),
+			outbox:  sqlite.NewOutbox(db),
+			wallet:  sqlite.NewWalletDB(db),
+			receipt: sqlite.NewReceiptDB(db),
+			apiKey:  sqlite.NewAPIKeyDB(db),
+			webhook: sqlite.NewWebhookDB(db),
+
+			idempotency: sqlite.NewIdempotencyStore(db),
+			// Like with Postgres, every instance limits on its own
+			rateLimit: mem.NewRateLimitStore(),
+
+			txManager: txn.NewSQLManager(db),
+
+			db: db,
 		}
 	case infra.InMemory:
+		if conf.DBMemPath != "" {
+			store := mem.InitStore(conf)
+			return repos{
+				user:    store.Users(),
+				vehicle: store.Vehicles(),
+				ride:    store.Rides(),
+				outbox:  store.Outbox(),
+				wallet:  store.Wallet(),
+				receipt: store.Receipts(),
+				apiKey:  store.APIKeys(),
+				webhook: store.Webhooks(),
+
+				idempotency: store.Idempotency(),
+				// Rate limits start over after a restart
+				rateLimit: mem.NewRateLimitStore(),
+
+				txManager: txn.NewMemoryManager(),
+
+				memStore: store,
+			}
+		}
+
+		outbox := mem.NewOutbox()
+		walletDB := mem.NewWalletDB()
 		return repos{
 			user:    mem.NewUserDB(),
 			vehicle: mem.NewVehicleDB(),
-			ride:    mem.NewRideDB(),
+			ride:    mem.NewRideDB(mem.WithOutbox(outbox), mem.WithWallet(walletDB)),
+			outbox:  outbox,
+			webhook: mem.NewWebhookDB(),
+			wallet:  walletDB,
+			receipt: mem.NewReceiptDB(),
+			apiKey:  mem.NewAPIKeyDB(),
+
+			idempotency: mem.NewIdempotencyStore(),
+			rateLimit:   mem.NewRateLimitStore(),
+
+			txManager: txn.NewMemoryManager(),
 		}
 	default:
 		log.Fatalf("unrecognized %s memory system", conf.DBType)
@@ -53,15 +182,23 @@ func initRepos(conf *config.Config) repos {
 	}
 }
 
-func initServices(repos repos) services {
+func initServices(conf *config.Config, repos repos) services {
 	idGenerator := id.NewUUIDGenerator()
 	time := timenow.NewRealTime()
+	// There is no real payment provider integrated yet, config validation only lets the fake one run with Postgres
+	// when payment_provider_allow_fake is set
+	paymentProvider := mem.NewPaymentProvider(idGenerator)
 	starter := ride.NewStarter(
 		repos.user,
 		repos.vehicle,
 		repos.ride,
+		repos.wallet,
+		repos.txManager,
+		paymentProvider,
 		idGenerator,
 		time,
+		ride.DefaultHoldValue,
+		ride.DefaultUnlockValue,
 	)
 
 	priceCalculator := ride.NewBasePriceCalculator(
@@ -72,20 +209,223 @@ func initServices(repos repos) services {
 
 	finisher := ride.NewFinisher(
 		repos.ride,
+		repos.txManager,
 		priceCalculator,
+		paymentProvider,
+		time,
+		ride.DefaultHoldValue,
+	)
+
+	canceller := ride.NewCanceller(
+		repos.ride,
+		repos.txManager,
+		paymentProvider,
+		time,
+		ride.DefaultMistakeWindow,
+	)
+
+	expirer := ride.NewExpirer(
+		repos.ride,
+		finisher,
 		time,
+		conf.RideMaxDuration,
 	)
 
 	return services{
-		starter:  starter,
-		finisher: finisher,
+		starter:       starter,
+		finisher:      finisher,
+		canceller:     canceller,
+		expirer:       expirer,
+		historyGetter: ride.NewHistoryGetter(repos.ride),
+		adjuster:      ride.NewAdjuster(repos.ride, repos.txManager, paymentProvider, idGenerator, time),
+		debtSettler:   ride.NewDebtSettler(repos.ride, repos.txManager, paymentProvider, time),
+		receipts: receipt.NewGenerator(
+			repos.ride,
+			repos.receipt,
+			time,
+			conf.Country,
+			ride.DefaultUnlockValue,
+			ride.DefaultMinuteValue,
+		),
+
+		walletManager: wallet.NewManager(repos.wallet, repos.user, paymentProvider, idGenerator, time),
+		apiKeys: apikey.NewManager(
+			repos.apiKey,
+			repos.txManager,
+			idGenerator,
+			id.NewSecretGenerator(apiKeySecretSize),
+			time,
+			conf.APIKeyRotationGrace,
+		),
+
+		webhookManager:    webhook.NewManager(repos.webhook, idGenerator, id.NewSecretGenerator(webhookSecretSize), time),
+		webhookDispatcher: webhook.NewDispatcher(repos.webhook, idGenerator, time),
+		webhookDeliverer: webhook.NewDeliverer(
+			repos.webhook,
+			webhook.NewClient(webhookTimeout),
+			time,
+			webhook.RetryPolicy{MaxAttempts: conf.WebhookMaxAttempts, BaseDelay: conf.WebhookRetryDelay},
+			webhookBatchSize,
+		),
+	}
+}
+
+func initWorkers(conf *config.Config, repos repos, svc services) []worker.Worker {
+	relay := event.NewRelay(repos.outbox, eventRelayBatchSize, initSinks(conf, svc)...)
+	type job struct {
+		name     string
+		interval time.Duration
+		job      func(ctx context.Context) error
+	}
+	jobs := []job{
+		{name: "ride_expirer", interval: conf.RideExpiryInterval, job: func(ctx context.Context) error {
+			expired, err := svc.expirer.Expire(ctx)
+			if expired > 0 {
+				log.Printf("finished %d rides: %s", expired, ride.FinishReasonMaxDuration)
+			}
+			return err
+		}},
+		{name: "event_relay", interval: conf.EventRelayInterval, job: func(ctx context.Context) error {
+			_, err := relay.Relay(ctx)
+			return err
+		}},
+		{name: "webhook_deliverer", interval: conf.WebhookDeliveryInterval, job: func(ctx context.Context) error {
+			_, err := svc.webhookDeliverer.Deliver(ctx)
+			return err
+		}},
+		{name: "idempotency_purger", interval: idempotencyPurgeInterval, job: func(ctx context.Context) error {
+			_, err := repos.idempotency.DeleteExpired(ctx, timenow.NewRealTime().Now())
+			return err
+		}},
 	}
+
+	if repos.memStore != nil {
+		jobs = append(jobs, job{name: "mem_checkpointer", interval: memCheckpointInterval, job: func(context.Context) error {
+			_, err := repos.memStore.Checkpoint()
+			return err
+		}})
+	}
+
+	workers := make([]worker.Worker, 0, len(jobs))
+	for _, j := range jobs {
+		w, err := worker.NewPeriodic(j.name, j.interval, j.job)
+		if err != nil {
+			log.Fatal(err)
+		}
+		workers = append(workers, w)
+	}
+
+	return workers
+}
+
+const (
+	eventRelayBatchSize = 100
+	webhookBatchSize    = 100
+	webhookSecretSize   = 32
+	webhookTimeout      = 5 * time.Second
+	apiKeySecretSize    = 32
+	readinessTimeout    = 2 * time.Second
+
+	idempotencyPurgeInterval = time.Hour
+	// memCheckpointInterval is how often the log of the memory store is checked against its limits
+	memCheckpointInterval = 10 * time.Second
+)
+
+// Names of the rate limits in the config.
+const (
+	rateLimitDefault    = "default"
+	rateLimitStartRide  = "start_ride"
+	rateLimitFinishRide = "finish_ride"
+	rateLimitTopUp      = "top_up"
+)
+
+func initVerifier(conf *config.Config) jwt.Verifier {
+	keys := jwt.Keys{HMACSecret: []byte(conf.JWTSecret)}
+	if conf.JWTPublicKeyFile != "" {
+		data, err := os.ReadFile(conf.JWTPublicKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if keys.RSAPublicKey, err = jwt.ParseRSAPublicKey(data); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	verifier, err := jwt.NewVerifier(keys, conf.JWTIssuer, conf.JWTAudience, timenow.NewRealTime())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return verifier
+}
+
+// chain applies middlewares in order, the first one being the outermost.
+func chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+func initSinks(conf *config.Config, svc services) []event.Sink {
+	sinks := []event.Sink{svc.webhookDispatcher}
+	if conf.EventWebhookURL != "" {
+		sinks = append(sinks, event.NewWebhookSink(conf.EventWebhookURL, &http.Client{Timeout: webhookTimeout}))
+	}
+	if conf.EventFilePath != "" {
+		sinks = append(sinks, event.NewFileSink(conf.EventFilePath))
+	}
+
+	return sinks
 }
 
-func InitHandlers(conf *config.Config) Handlers {
+// InitHandlers builds the HTTP handlers. The background workers that share their services and the resources they
+// use are registered in lc, to be stopped after the server.
+func InitHandlers(conf *config.Config, lc *lifecycle.Manager) Handlers {
 	r := initRepos(conf)
-	svc := initServices(r)
+	svc := initServices(conf, r)
+	// The memory backend has no dependencies to check, it is always ready
+	readiness := health.NewReadiness(readinessTimeout)
+	var dbStats func() sql.DBStats
+	if r.db != nil {
+		lc.OnStop(r.db)
+		readiness.Add(strings.ToLower(conf.DBType), r.db.PingContext)
+		dbStats = r.db.Stats
+	}
+	if r.memStore != nil {
+		lc.OnStop(r.memStore)
+	}
+	for _, w := range initWorkers(conf, r, svc) {
+		lc.Go(w)
+	}
+
+	rateLimited := func(route string) func(http.Handler) http.Handler {
+		l := conf.RateLimits[route]
+		limit := ratelimit.Limit{Requests: l.Requests, Per: l.Per, Burst: l.Burst}
+		return api.RateLimitMiddleware(r.rateLimit, route, limit, timenow.NewRealTime())
+	}
+
+	// Mobile clients retry starting and finishing rides on flaky networks
+	idempotent := api.IdempotencyMiddleware(r.idempotency, conf.IdempotencyTTL, timenow.NewRealTime())
+	rideHandlers := NewRideHandlers(svc.starter, svc.finisher, svc.historyGetter, svc.adjuster, svc.debtSettler)
+	rideHandlers.Start = chain(rateLimited(rateLimitStartRide), idempotent)(rideHandlers.Start)
+	rideHandlers.Finish = chain(rateLimited(rateLimitFinishRide), idempotent)(rideHandlers.Finish)
+	walletHandlers := NewWalletHandlers(svc.walletManager)
+	walletHandlers.TopUp = rateLimited(rateLimitTopUp)(walletHandlers.TopUp)
+
 	return Handlers{
-		Ride: NewRideHandlers(svc.starter, svc.finisher),
+		Auth:      chain(api.APIKeyMiddleware(svc.apiKeys), api.AuthMiddleware(initVerifier(conf))),
+		RateLimit: rateLimited(rateLimitDefault),
+
+		Ride:      rideHandlers,
+		AdminRide: NewAdminRideHandlers(svc.finisher, svc.canceller),
+		Webhook:   NewWebhookHandlers(svc.webhookManager),
+		Wallet:    walletHandlers,
+		Receipt:   NewReceiptHandlers(svc.receipts),
+		APIKey:    NewAPIKeyHandlers(svc.apiKeys),
+		Health:    NewHealthHandlers(readiness),
+		Metrics:   NewMetricsHandlers(dbStats),
 	}
 }
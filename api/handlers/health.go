@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"reby/api"
+	"reby/pkg/health"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type HealthHandlers struct {
+	Live  http.Handler
+	Ready http.Handler
+	// Readiness is drained on shutdown, to turn Ready down while the in-flight requests finish.
+	Readiness *health.Readiness
+}
+
+func NewHealthHandlers(readiness *health.Readiness) HealthHandlers {
+	return HealthHandlers{
+		Live:      Live(),
+		Ready:     Ready(readiness),
+		Readiness: readiness,
+	}
+}
+
+// AddHealthEndpoints adds the probes of the orchestrator. They go on the root router, around authentication and
+// rate limiting.
+func AddHealthEndpoints(mx *chi.Mux, hh HealthHandlers) {
+	mx.Method(http.MethodGet, "/healthz", hh.Live)
+	mx.Method(http.MethodGet, "/readyz", hh.Ready)
+}
+
+// Live responds while the process is able to serve HTTP at all, whatever the state of its dependencies.
+func Live() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.RespondOK(w, map[string]health.Status{"status": health.StatusUp})
+	})
+}
+
+// Ready responds with the readiness report, with a 503 when the process should not get requests.
+func Ready(readiness *health.Readiness) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := readiness.Check(r.Context())
+		status := http.StatusOK
+		if report.Status != health.StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+
+		api.Respond(w, status, report)
+	})
+}
@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reby/api/handlers"
+	"reby/pkg/health"
+)
+
+func TestLive(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	require.NoError(t, err)
+
+	resp := httptest.NewRecorder()
+	handlers.Live().ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"status":"UP"}`, resp.Body.String())
+}
+
+func TestReady(t *testing.T) {
+	var readiness *health.Readiness
+
+	doReq := func() (*httptest.ResponseRecorder, health.Report) {
+		req, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+		require.NoError(t, err)
+
+		resp := httptest.NewRecorder()
+		handlers.Ready(readiness).ServeHTTP(resp, req)
+
+		var report health.Report
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		return resp, report
+	}
+
+	testCases := []struct {
+		description    string
+		setup          func()
+		expectedCode   int
+		expectedReport health.Report
+	}{
+		{
+			description: "memory backend is always ready",
+			setup: func() {
+				readiness = health.NewReadiness(time.Second)
+			},
+			expectedCode:   http.StatusOK,
+			expectedReport: health.Report{Status: health.StatusUp, Checks: map[string]health.CheckResult{}},
+		},
+		{
+			description: "database up",
+			setup: func() {
+				readiness = health.NewReadiness(time.Second)
+				readiness.Add("postgres", func(ctx context.Context) error { return nil })
+			},
+			expectedCode: http.StatusOK,
+			expectedReport: health.Report{
+				Status: health.StatusUp,
+				Checks: map[string]health.CheckResult{"postgres": {Status: health.StatusUp}},
+			},
+		},
+		{
+			description: "database down",
+			setup: func() {
+				readiness = health.NewReadiness(time.Second)
+				readiness.Add("postgres", func(ctx context.Context) error { return errors.New("connection refused") })
+			},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedReport: health.Report{
+				Status: health.StatusDown,
+				Checks: map[string]health.CheckResult{
+					"postgres": {Status: health.StatusDown, Error: "connection refused"},
+				},
+			},
+		},
+		{
+			description: "draining",
+			setup: func() {
+				readiness = health.NewReadiness(time.Second)
+				readiness.Drain()
+			},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedReport: health.Report{
+				Status:   health.StatusDown,
+				Draining: true,
+				Checks:   map[string]health.CheckResult{},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.setup()
+
+			resp, report := doReq()
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expectedReport, report)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"reby/api"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type MetricsHandlers struct {
+	Get http.Handler
+}
+
+// NewMetricsHandlers reports the stats of the connection pool returned by dbStats, nil when there is no database.
+func NewMetricsHandlers(dbStats func() sql.DBStats) MetricsHandlers {
+	return MetricsHandlers{
+		Get: GetMetrics(dbStats),
+	}
+}
+
+// AddMetricsEndpoints adds the metrics scraped by the monitoring. Like the probes, they go on the root router.
+func AddMetricsEndpoints(mx *chi.Mux, mh MetricsHandlers) {
+	mx.Method(http.MethodGet, "/metrics", mh.Get)
+}
+
+type Metrics struct {
+	DB *DBMetrics `json:"db,omitempty"`
+}
+
+// DBMetrics are the sql.DBStats of the connection pool, with the durations in milliseconds.
+type DBMetrics struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+func toDBMetrics(s sql.DBStats) *DBMetrics {
+	return &DBMetrics{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+func GetMetrics(dbStats func() sql.DBStats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m Metrics
+		if dbStats != nil {
+			m.DB = toDBMetrics(dbStats())
+		}
+
+		api.RespondOK(w, m)
+	})
+}
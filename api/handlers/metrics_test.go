@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reby/api/handlers"
+)
+
+func TestGetMetrics(t *testing.T) {
+	doReq := func(dbStats func() sql.DBStats) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+		require.NoError(t, err)
+
+		resp := httptest.NewRecorder()
+		handlers.GetMetrics(dbStats).ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	t.Run("pool stats", func(t *testing.T) {
+		resp := doReq(func() sql.DBStats {
+			return sql.DBStats{
+				MaxOpenConnections: 25,
+				OpenConnections:    4,
+				InUse:              3,
+				Idle:               1,
+				WaitCount:          2,
+				WaitDuration:       1500 * time.Millisecond,
+				MaxLifetimeClosed:  7,
+			}
+		})
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"db": {
+			"max_open_connections": 25,
+			"open_connections": 4,
+			"in_use": 3,
+			"idle": 1,
+			"wait_count": 2,
+			"wait_duration_ms": 1500,
+			"max_idle_closed": 0,
+			"max_idle_time_closed": 0,
+			"max_lifetime_closed": 7
+		}}`, resp.Body.String())
+	})
+
+	t.Run("no database", func(t *testing.T) {
+		resp := doReq(nil)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{}`, resp.Body.String())
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"reby/api"
+	"reby/domain/apikey"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ReceiptHandlers struct {
+	Get http.Handler
+}
+
+func NewReceiptHandlers(generator receipt.Generator) ReceiptHandlers {
+	return ReceiptHandlers{
+		Get: GetReceipt(generator),
+	}
+}
+
+func AddReceiptEndpoints(mx *chi.Mux, rh ReceiptHandlers) {
+	mx.With(
+		api.RequireRoles(api.RoleRider, api.RolePartner, api.RoleSupport, api.RoleAdmin),
+		api.RequireScope(apikey.ScopeReceiptsRead),
+	).Method(http.MethodGet, "/rides/{rideID}/receipt", rh.Get)
+}
+
+// wantsHTML tells whether the receipt is requested as a document, with ?format=html or an Accept header.
+func wantsHTML(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "html"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// GetReceipt responds with the receipt of a paid ride, as JSON or as an HTML document. Riders only get the receipts
+// of their rides and partners the ones of the rides they started.
+func GetReceipt(generator receipt.Generator) http.Handler {
+	handleError := func(w http.ResponseWriter, err error) {
+		switch {
+		case errors.Is(err, ride.ErrNotFound):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusNotFound,
+				Reason:     api.InvalidParameter,
+			})
+		case errors.Is(err, ride.ErrNotRideOwner):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusForbidden,
+				Reason:     api.Forbidden,
+			})
+		case errors.Is(err, receipt.ErrRideNotFinished), errors.Is(err, receipt.ErrRideNotPaid):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusConflict,
+				Reason:     api.Conflict,
+			})
+		default:
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusInternalServerError,
+				Reason:     api.Internal,
+			})
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rideID, err := api.GetStringURLParam(r, "rideID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		principal, ok := api.PrincipalFrom(r.Context())
+		if !ok {
+			api.RespondError(w, api.Error{
+				Err:        api.ErrMissingToken,
+				HTTPStatus: http.StatusUnauthorized,
+				Reason:     api.Unauthorized,
+			})
+			return
+		}
+
+		params := receipt.GenerateParams{RideID: rideID}
+		switch principal.Role {
+		case api.RoleRider:
+			params.UserID = principal.UserID
+		case api.RolePartner:
+			params.PartnerID = principal.PartnerID
+		}
+
+		rec, err := generator.Generate(r.Context(), params)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		if !wantsHTML(r) {
+			api.RespondOK(w, rec)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err = rec.WriteHTML(w); err != nil {
+			handleError(w, err)
+		}
+	})
+}
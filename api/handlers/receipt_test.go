@@ -0,0 +1,174 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reby/api"
+	"reby/api/handlers"
+	"reby/domain/money"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+)
+
+func TestGetReceipt(t *testing.T) {
+	var generatorMock *receipt.GeneratorMock
+	var hd handlers.ReceiptHandlers
+	rideID := "r_1"
+
+	setup := func() {
+		generatorMock = receipt.NewGeneratorMock()
+		hd = handlers.NewReceiptHandlers(generatorMock)
+	}
+
+	support := api.Principal{UserID: "s_1", Role: api.RoleSupport}
+	doReq := func(principal api.Principal, query string, accept string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/rides/%s/receipt%s", rideID, query), nil)
+		require.NoError(t, err)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("rideID", rideID)
+
+		resp := httptest.NewRecorder()
+		ctx := api.WithPrincipal(context.WithValue(req.Context(), chi.RouteCtxKey, rctx), principal)
+		hd.Get.ServeHTTP(resp, req.WithContext(ctx))
+
+		return resp
+	}
+
+	testCases := []struct {
+		description    string
+		generatorErr   error
+		expectedCode   int
+		expectedReason string
+		expectedDetail string
+	}{
+		{
+			description:    "ride not found",
+			generatorErr:   ride.ErrNotFound,
+			expectedCode:   http.StatusNotFound,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_RIDE_NOT_FOUND",
+		},
+		{
+			description:    "someone else's ride",
+			generatorErr:   ride.ErrNotRideOwner,
+			expectedCode:   http.StatusForbidden,
+			expectedReason: string(api.Forbidden),
+			expectedDetail: "ERR_NOT_RIDE_OWNER",
+		},
+		{
+			description:    "ride not finished",
+			generatorErr:   receipt.ErrRideNotFinished,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_RECEIPT_RIDE_NOT_FINISHED",
+		},
+		{
+			description:    "ride not paid",
+			generatorErr:   receipt.ErrRideNotPaid,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_RECEIPT_RIDE_NOT_PAID",
+		},
+		{
+			description:    "internal",
+			generatorErr:   errors.New("ERR_RANDOM"),
+			expectedCode:   http.StatusInternalServerError,
+			expectedReason: string(api.Internal),
+			expectedDetail: "ERR_RANDOM",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			generatorMock.On("Generate", receipt.GenerateParams{RideID: rideID}).Return(&receipt.Receipt{}, tc.generatorErr)
+
+			resp := doReq(support, "", "")
+			assert.Equal(t, tc.expectedCode, resp.Code)
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, tc.expectedDetail, errorDetail.Detail)
+			assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+		})
+	}
+
+	rec := &receipt.Receipt{
+		Number:     "ES-00000001",
+		Country:    "ES",
+		RideID:     rideID,
+		IssuedAt:   time.Now(),
+		StartedAt:  time.Now().Add(-time.Hour),
+		FinishedAt: time.Now(),
+		Total:      money.NewMoney(121, "EUR"),
+	}
+
+	t.Run("json", func(t *testing.T) {
+		setup()
+		generatorMock.On("Generate", receipt.GenerateParams{RideID: rideID}).Return(rec, nil)
+
+		resp := doReq(support, "", "application/json")
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var body receipt.Receipt
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, rec.Number, body.Number)
+		assert.Equal(t, rec.Total, body.Total)
+	})
+
+	for _, format := range []struct{ query, accept string }{{"?format=html", ""}, {"", "text/html,*/*"}} {
+		t.Run("html "+format.query+format.accept, func(t *testing.T) {
+			setup()
+			generatorMock.On("Generate", receipt.GenerateParams{RideID: rideID}).Return(rec, nil)
+
+			resp := doReq(support, format.query, format.accept)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.True(t, strings.HasPrefix(resp.Header().Get("Content-Type"), "text/html"))
+			assert.Contains(t, resp.Body.String(), "Receipt ES-00000001")
+		})
+	}
+
+	t.Run("restricted to the rides of the caller", func(t *testing.T) {
+		testCases := []struct {
+			description    string
+			principal      api.Principal
+			expectedParams receipt.GenerateParams
+		}{
+			{
+				description:    "rider",
+				principal:      api.Principal{UserID: "u_1", Role: api.RoleRider},
+				expectedParams: receipt.GenerateParams{RideID: rideID, UserID: "u_1"},
+			},
+			{
+				description:    "partner",
+				principal:      api.Principal{Role: api.RolePartner, PartnerID: "p_1"},
+				expectedParams: receipt.GenerateParams{RideID: rideID, PartnerID: "p_1"},
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.description, func(t *testing.T) {
+				setup()
+				generatorMock.On("Generate", tc.expectedParams).Return(rec, nil)
+
+				resp := doReq(tc.principal, "", "")
+				assert.Equal(t, http.StatusOK, resp.Code)
+				generatorMock.AssertExpectations(t)
+			})
+		}
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"reby/api"
+	"reby/domain/apikey"
+	"reby/domain/payment"
 	"reby/domain/ride"
 	"reby/domain/user"
 	"reby/domain/vehicle"
@@ -14,20 +16,40 @@ import (
 )
 
 type RideHandlers struct {
-	Start  http.Handler
-	Finish http.Handler
+	Start   http.Handler
+	Finish  http.Handler
+	History http.Handler
+	Adjust  http.Handler
+	Settle  http.Handler
 }
 
-func NewRideHandlers(starter ride.Starter, finisher ride.Finisher) RideHandlers {
+func NewRideHandlers(
+	starter ride.Starter,
+	finisher ride.Finisher,
+	historyGetter ride.HistoryGetter,
+	adjuster ride.Adjuster,
+	debtSettler ride.DebtSettler,
+) RideHandlers {
 	return RideHandlers{
-		Start:  Start(starter),
-		Finish: Finish(finisher),
+		Start:   Start(starter),
+		Finish:  Finish(finisher),
+		History: History(historyGetter),
+		Adjust:  Adjust(adjuster),
+		Settle:  Settle(debtSettler),
 	}
 }
 
 func AddRideEndpoints(mx *chi.Mux, rh RideHandlers) {
-	mx.Method(http.MethodPost, "/rides", rh.Start)
-	mx.Method(http.MethodPost, "/rides/{rideID}/finish", rh.Finish)
+	riders := mx.With(api.RequireRoles(api.RoleRider, api.RolePartner), api.RequireScope(apikey.ScopeRidesWrite))
+	riders.Method(http.MethodPost, "/rides", rh.Start)
+	riders.Method(http.MethodPost, "/rides/{rideID}/finish", rh.Finish)
+	mx.With(api.RequireRoles(api.RoleOperator, api.RoleSupport, api.RoleAdmin)).
+		Method(http.MethodGet, "/rides/{rideID}/history", rh.History)
+	// Refunds move money back, so only support and admins can issue them
+	mx.With(api.RequireRoles(api.RoleSupport, api.RoleAdmin)).
+		Method(http.MethodPost, "/rides/{rideID}/adjustments", rh.Adjust)
+	mx.With(api.RequireRoles(api.RoleRider, api.RoleAdmin)).
+		Method(http.MethodPost, "/rides/{rideID}/settle", rh.Settle)
 }
 
 func Start(starter ride.Starter) http.Handler {
@@ -39,12 +61,25 @@ func Start(starter ride.Starter) http.Handler {
 				HTTPStatus: http.StatusNotFound,
 				Reason:     api.InvalidParameter,
 			})
+		case errors.Is(err, ride.ErrNotPartnerUser):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusForbidden,
+				Reason:     api.Forbidden,
+			})
 		case errors.Is(err, ride.ErrUserIsRiding) || errors.Is(err, ride.ErrVehicleIsRiding):
 			api.RespondError(w, api.Error{
 				Err:        err,
 				HTTPStatus: http.StatusLocked,
 				Reason:     api.Locked,
 			})
+		case errors.Is(err, payment.ErrDeclined) || errors.Is(err, ride.ErrUserHasDebt) ||
+			errors.Is(err, ride.ErrInsufficientBalance):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusPaymentRequired,
+				Reason:     api.PaymentRequired,
+			})
 		default:
 			api.RespondError(w, api.Error{
 				Err:        err,
@@ -55,7 +90,19 @@ func Start(starter ride.Starter) http.Handler {
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Riders can only start rides for themselves
+		principal, ok := api.PrincipalFrom(r.Context())
+		if !ok {
+			api.RespondError(w, api.Error{
+				Err:        api.ErrMissingToken,
+				HTTPStatus: http.StatusUnauthorized,
+				Reason:     api.Unauthorized,
+			})
+			return
+		}
+
 		req := struct {
+			// UserID is only read for partners, who start rides on behalf of their users
 			UserID    string `json:"user_id"`
 			VehicleID string `json:"vehicle_id"`
 		}{}
@@ -69,10 +116,16 @@ func Start(starter ride.Starter) http.Handler {
 			return
 		}
 
-		startedRide, err := starter.Start(r.Context(), ride.StartParams{
-			UserID:    req.UserID,
+		params := ride.StartParams{
+			UserID:    principal.UserID,
 			VehicleID: req.VehicleID,
-		})
+		}
+		if principal.Role == api.RolePartner {
+			params.UserID = req.UserID
+			params.PartnerID = principal.PartnerID
+		}
+
+		startedRide, err := starter.Start(r.Context(), params)
 		if err != nil {
 			handleError(w, err)
 			return
@@ -83,6 +136,10 @@ func Start(starter ride.Starter) http.Handler {
 }
 
 func Finish(finisher ride.Finisher) http.Handler {
+	return finish(finisher, ride.FinishReasonRider, ride.ActorRider)
+}
+
+func finish(finisher ride.Finisher, reason ride.FinishReason, actor ride.Actor) http.Handler {
 	handleError := func(w http.ResponseWriter, err error) {
 		switch {
 		case errors.Is(err, ride.ErrNotFound):
@@ -91,7 +148,14 @@ func Finish(finisher ride.Finisher) http.Handler {
 				HTTPStatus: http.StatusNotFound,
 				Reason:     api.InvalidParameter,
 			})
-		case errors.Is(err, ride.ErrAlreadyFinished):
+		case errors.Is(err, ride.ErrNotRideOwner):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusForbidden,
+				Reason:     api.Forbidden,
+			})
+		case errors.Is(err, ride.ErrAlreadyFinished) || errors.Is(err, ride.ErrAlreadyCancelled) ||
+			errors.Is(err, ride.ErrInvalidTransition):
 			api.RespondError(w, api.Error{
 				Err:        err,
 				HTTPStatus: http.StatusConflict,
@@ -117,7 +181,29 @@ func Finish(finisher ride.Finisher) http.Handler {
 			return
 		}
 
-		finishedRide, err := finisher.Finish(r.Context(), rideID)
+		params := ride.FinishParams{
+			RideID: rideID,
+			Reason: reason,
+			Actor:  actor,
+		}
+		// Riders can only finish their own rides and partners the rides they started
+		if actor == ride.ActorRider {
+			principal, ok := api.PrincipalFrom(r.Context())
+			if !ok {
+				api.RespondError(w, api.Error{
+					Err:        api.ErrMissingToken,
+					HTTPStatus: http.StatusUnauthorized,
+					Reason:     api.Unauthorized,
+				})
+				return
+			}
+			params.UserID = principal.UserID
+			if principal.Role == api.RolePartner {
+				params.PartnerID = principal.PartnerID
+			}
+		}
+
+		finishedRide, err := finisher.Finish(r.Context(), params)
 		if err != nil {
 			handleError(w, err)
 			return
@@ -126,3 +212,188 @@ func Finish(finisher ride.Finisher) http.Handler {
 		api.RespondOK(w, finishedRide)
 	})
 }
+
+func History(historyGetter ride.HistoryGetter) http.Handler {
+	handleError := func(w http.ResponseWriter, err error) {
+		switch {
+		case errors.Is(err, ride.ErrNotFound):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusNotFound,
+				Reason:     api.InvalidParameter,
+			})
+		default:
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusInternalServerError,
+				Reason:     api.Internal,
+			})
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rideID, err := api.GetStringURLParam(r, "rideID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		events, err := historyGetter.Get(r.Context(), rideID)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		api.RespondOK(w, events)
+	})
+}
+
+// Adjust refunds a paid ride, fully when the body has "full" set or partially by "value" otherwise.
+func Adjust(adjuster ride.Adjuster) http.Handler {
+	handleError := func(w http.ResponseWriter, err error) {
+		switch {
+		case errors.Is(err, ride.ErrNotFound):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusNotFound,
+				Reason:     api.InvalidParameter,
+			})
+		case errors.Is(err, ride.ErrInvalidAdjustParams) || errors.Is(err, ride.ErrRefundExceedsCharge):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+		case errors.Is(err, ride.ErrNotCharged):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusConflict,
+				Reason:     api.Conflict,
+			})
+		default:
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusInternalServerError,
+				Reason:     api.Internal,
+			})
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rideID, err := api.GetStringURLParam(r, "rideID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		req := struct {
+			Value  int    `json:"value"`
+			Full   bool   `json:"full"`
+			Reason string `json:"reason"`
+		}{}
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidJSON,
+			})
+			return
+		}
+
+		adjustedRide, err := adjuster.Adjust(r.Context(), ride.AdjustParams{
+			RideID: rideID,
+			Value:  req.Value,
+			Full:   req.Full,
+			Reason: req.Reason,
+			Actor:  ride.ActorOperator,
+		})
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		api.RespondOK(w, adjustedRide)
+	})
+}
+
+// Settle charges again a ride whose price could not be captured. Riders can only settle their own rides.
+func Settle(debtSettler ride.DebtSettler) http.Handler {
+	handleError := func(w http.ResponseWriter, err error) {
+		switch {
+		case errors.Is(err, ride.ErrNotFound):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusNotFound,
+				Reason:     api.InvalidParameter,
+			})
+		case errors.Is(err, ride.ErrNotRideOwner):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusForbidden,
+				Reason:     api.Forbidden,
+			})
+		case errors.Is(err, ride.ErrNoDebt):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusConflict,
+				Reason:     api.Conflict,
+			})
+		case errors.Is(err, payment.ErrDeclined):
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusPaymentRequired,
+				Reason:     api.PaymentRequired,
+			})
+		default:
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusInternalServerError,
+				Reason:     api.Internal,
+			})
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rideID, err := api.GetStringURLParam(r, "rideID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		principal, ok := api.PrincipalFrom(r.Context())
+		if !ok {
+			api.RespondError(w, api.Error{
+				Err:        api.ErrMissingToken,
+				HTTPStatus: http.StatusUnauthorized,
+				Reason:     api.Unauthorized,
+			})
+			return
+		}
+
+		params := ride.SettleParams{RideID: rideID, Actor: ride.ActorOperator}
+		if principal.Role == api.RoleRider {
+			params.Actor = ride.ActorRider
+			params.UserID = principal.UserID
+		}
+
+		settledRide, err := debtSettler.Settle(r.Context(), params)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		api.RespondOK(w, settledRide)
+	})
+}
@@ -13,31 +13,38 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"reby/api"
 	"reby/api/handlers"
 	"reby/domain/money"
+	"reby/domain/payment"
 	"reby/domain/ride"
 	"reby/domain/user"
 	"reby/domain/vehicle"
+	"reby/domain/wallet"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
 )
 
 func TestRideStart(t *testing.T) {
 	var starterMock *ride.StarterMock
 	var hd handlers.RideHandlers
-	ctx := context.Background()
+	ctx := api.WithPrincipal(context.Background(), api.Principal{UserID: "1"})
 
 	setup := func() {
 		starterMock = ride.NewStarterMock()
-		hd = handlers.NewRideHandlers(starterMock, nil)
+		hd = handlers.NewRideHandlers(starterMock, nil, nil, nil, nil)
 	}
 
-	doReq := func() *httptest.ResponseRecorder {
+	doReq := func(ctx context.Context) *httptest.ResponseRecorder {
+		// The user in the body is ignored, rides are started for the caller
 		body := struct {
 			UserID    string `json:"user_id"`
 			VehicleID string `json:"vehicle_id"`
 		}{
-			UserID:    "1",
+			UserID:    "2",
 			VehicleID: "1",
 		}
 		var buf bytes.Buffer
@@ -86,6 +93,20 @@ func TestRideStart(t *testing.T) {
 			expectedReason: string(api.Locked),
 			expectedDetail: "ERR_VEHICLE_RIDING",
 		},
+		{
+			description:    "payment declined",
+			starterErr:     payment.ErrDeclined,
+			expectedCode:   http.StatusPaymentRequired,
+			expectedReason: string(api.PaymentRequired),
+			expectedDetail: "ERR_PAYMENT_DECLINED",
+		},
+		{
+			description:    "user has debt",
+			starterErr:     ride.ErrUserHasDebt,
+			expectedCode:   http.StatusPaymentRequired,
+			expectedReason: string(api.PaymentRequired),
+			expectedDetail: "ERR_USER_HAS_DEBT",
+		},
 		{
 			description:    "internal error",
 			starterErr:     errors.New("ERR_RANDOM_ERROR"),
@@ -102,7 +123,7 @@ func TestRideStart(t *testing.T) {
 				VehicleID: "1",
 			}).Return(&ride.Ride{}, tc.starterErr)
 
-			resp := doReq()
+			resp := doReq(ctx)
 			assert.Equal(t, tc.expectedCode, resp.Code)
 
 			var errorDetail api.ErrorDetail
@@ -128,13 +149,55 @@ func TestRideStart(t *testing.T) {
 			VehicleID: "1",
 		}).Return(r, nil)
 
-		resp := doReq()
+		resp := doReq(ctx)
 		assert.Equal(t, http.StatusOK, resp.Code)
 
 		var respRide *ride.Ride
 		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respRide))
 		assert.NotEmpty(t, respRide)
 	})
+
+	t.Run("partner starts for the user in the body", func(t *testing.T) {
+		setup()
+		starterMock.On("Start", ride.StartParams{
+			UserID:    "2",
+			VehicleID: "1",
+			PartnerID: "p_1",
+		}).Return(&ride.Ride{ID: "1", UserID: "2", PartnerID: "p_1"}, nil)
+
+		resp := doReq(api.WithPrincipal(context.Background(), api.Principal{Role: api.RolePartner, PartnerID: "p_1"}))
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("partner starts for a user of another partner", func(t *testing.T) {
+		userRepoMock := user.NewRepoMock()
+		userRepoMock.On("GetByID", "2").Return(&user.User{ID: "2", PartnerID: "p_2"}, nil)
+		providerMock := payment.NewProviderMock()
+		starter := ride.NewStarter(userRepoMock, vehicle.NewRepoMock(), ride.NewRepoMock(), wallet.NewRepoMock(),
+			txn.NewMemoryManager(), providerMock, id.NewGeneratorMock(), timenow.NewRealTime(), 100, 100)
+		hd = handlers.NewRideHandlers(starter, nil, nil, nil, nil)
+
+		resp := doReq(api.WithPrincipal(context.Background(), api.Principal{Role: api.RolePartner, PartnerID: "p_1"}))
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		var errorDetail api.ErrorDetail
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+		assert.Equal(t, "ERR_NOT_PARTNER_USER", errorDetail.Detail)
+		assert.Equal(t, string(api.Forbidden), errorDetail.Reason)
+		providerMock.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		setup()
+
+		resp := doReq(context.Background())
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+		var errorDetail api.ErrorDetail
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+		assert.Equal(t, string(api.Unauthorized), errorDetail.Reason)
+		starterMock.AssertNotCalled(t, "Start", mock.Anything)
+	})
 }
 
 func TestRideFinish(t *testing.T) {
@@ -142,9 +205,18 @@ func TestRideFinish(t *testing.T) {
 	var hd handlers.RideHandlers
 	rideID := "r_1"
 
+	riderFinish := func(rideID string) ride.FinishParams {
+		return ride.FinishParams{
+			RideID: rideID,
+			Reason: ride.FinishReasonRider,
+			Actor:  ride.ActorRider,
+			UserID: "1",
+		}
+	}
+
 	setup := func() {
 		finisherMock = ride.NewFinisherMock()
-		hd = handlers.NewRideHandlers(nil, finisherMock)
+		hd = handlers.NewRideHandlers(nil, finisherMock, nil, nil, nil)
 	}
 
 	doReq := func(rideID string) *httptest.ResponseRecorder {
@@ -155,8 +227,9 @@ func TestRideFinish(t *testing.T) {
 		rctx := chi.NewRouteContext()
 		rctx.URLParams.Add("rideID", rideID)
 
+		ctx := api.WithPrincipal(context.WithValue(req.Context(), chi.RouteCtxKey, rctx), api.Principal{UserID: "1"})
 		resp := httptest.NewRecorder()
-		hd.Finish.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		hd.Finish.ServeHTTP(resp, req.WithContext(ctx))
 
 		return resp
 	}
@@ -185,6 +258,14 @@ func TestRideFinish(t *testing.T) {
 			expectedReason: string(api.InvalidParameter),
 			expectedDetail: "ERR_RIDE_NOT_FOUND",
 		},
+		{
+			description:    "ride of another user",
+			rideID:         rideID,
+			finisherErr:    ride.ErrNotRideOwner,
+			expectedCode:   http.StatusForbidden,
+			expectedReason: string(api.Forbidden),
+			expectedDetail: "ERR_NOT_RIDE_OWNER",
+		},
 		{
 			description:    "ride finished",
 			rideID:         rideID,
@@ -193,6 +274,22 @@ func TestRideFinish(t *testing.T) {
 			expectedReason: string(api.Conflict),
 			expectedDetail: "ERR_ALREADY_FINISHED",
 		},
+		{
+			description:    "ride cancelled",
+			rideID:         rideID,
+			finisherErr:    ride.ErrAlreadyCancelled,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_ALREADY_CANCELLED",
+		},
+		{
+			description:    "invalid transition",
+			rideID:         rideID,
+			finisherErr:    &ride.TransitionError{From: ride.StatusReserved, To: ride.StatusFinished},
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_INVALID_TRANSITION: RESERVED -> FINISHED",
+		},
 		{
 			description:    "internal",
 			rideID:         rideID,
@@ -206,7 +303,7 @@ func TestRideFinish(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
 			setup()
-			finisherMock.On("Finish", tc.rideID).Return(&ride.Ride{}, tc.finisherErr)
+			finisherMock.On("Finish", riderFinish(tc.rideID)).Return(&ride.Ride{}, tc.finisherErr)
 
 			resp := doReq(tc.rideID)
 			assert.Equal(t, tc.expectedCode, resp.Code)
@@ -232,7 +329,7 @@ func TestRideFinish(t *testing.T) {
 				Currency: "EUR",
 			},
 		}
-		finisherMock.On("Finish", rideID).Return(finishedRide, nil)
+		finisherMock.On("Finish", riderFinish(rideID)).Return(finishedRide, nil)
 
 		resp := doReq(rideID)
 		assert.Equal(t, http.StatusOK, resp.Code)
@@ -242,3 +339,222 @@ func TestRideFinish(t *testing.T) {
 		assert.NotEmpty(t, respRide)
 	})
 }
+
+func TestRideHistory(t *testing.T) {
+	var historyMock *ride.HistoryGetterMock
+	var hd handlers.RideHandlers
+	rideID := "r_1"
+
+	setup := func() {
+		historyMock = ride.NewHistoryGetterMock()
+		hd = handlers.NewRideHandlers(nil, nil, historyMock, nil, nil)
+	}
+
+	doReq := func() *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/rides/%s/history", rideID)
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("rideID", rideID)
+
+		resp := httptest.NewRecorder()
+		hd.History.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		return resp
+	}
+
+	t.Run("ride not found", func(t *testing.T) {
+		setup()
+		historyMock.On("Get", rideID).Return([]ride.Event(nil), ride.ErrNotFound)
+
+		resp := doReq()
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		var errorDetail api.ErrorDetail
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+		assert.Equal(t, "ERR_RIDE_NOT_FOUND", errorDetail.Detail)
+		assert.Equal(t, string(api.InvalidParameter), errorDetail.Reason)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		now := time.Now().UTC()
+		events := []ride.Event{
+			{RideID: rideID, Type: ride.EventStarted, Actor: ride.ActorRider, OccurredAt: now.Add(-5 * time.Minute)},
+			{RideID: rideID, Type: ride.EventFinished, Actor: ride.ActorRider, OccurredAt: now, Data: map[string]string{
+				"reason": string(ride.FinishReasonRider),
+			}},
+		}
+		historyMock.On("Get", rideID).Return(events, nil)
+
+		resp := doReq()
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var respEvents []ride.Event
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respEvents))
+		assert.Equal(t, events, respEvents)
+	})
+}
+
+func TestRideAdjust(t *testing.T) {
+	var adjusterMock *ride.AdjusterMock
+	var hd handlers.RideHandlers
+	rideID := "r_1"
+
+	setup := func() {
+		adjusterMock = ride.NewAdjusterMock()
+		hd = handlers.NewRideHandlers(nil, nil, nil, adjusterMock, nil)
+	}
+
+	params := ride.AdjustParams{RideID: rideID, Value: 50, Reason: "bumpy ride", Actor: ride.ActorOperator}
+
+	doReq := func() *httptest.ResponseRecorder {
+		body := map[string]interface{}{"value": params.Value, "reason": params.Reason}
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/rides/%s/adjustments", rideID), &buf)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("rideID", rideID)
+
+		resp := httptest.NewRecorder()
+		hd.Adjust.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		return resp
+	}
+
+	testCases := []struct {
+		description    string
+		adjusterErr    error
+		expectedCode   int
+		expectedReason string
+		expectedDetail string
+	}{
+		{
+			description:    "ride not found",
+			adjusterErr:    ride.ErrNotFound,
+			expectedCode:   http.StatusNotFound,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_RIDE_NOT_FOUND",
+		},
+		{
+			description:    "refund exceeds charge",
+			adjusterErr:    ride.ErrRefundExceedsCharge,
+			expectedCode:   http.StatusBadRequest,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_REFUND_EXCEEDS_CHARGE",
+		},
+		{
+			description:    "ride not charged",
+			adjusterErr:    ride.ErrNotCharged,
+			expectedCode:   http.StatusConflict,
+			expectedReason: string(api.Conflict),
+			expectedDetail: "ERR_RIDE_NOT_CHARGED",
+		},
+		{
+			description:    "internal",
+			adjusterErr:    errors.New("ERR_RANDOM"),
+			expectedCode:   http.StatusInternalServerError,
+			expectedReason: string(api.Internal),
+			expectedDetail: "ERR_RANDOM",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			adjusterMock.On("Adjust", params).Return(&ride.Ride{}, tc.adjusterErr)
+
+			resp := doReq()
+			assert.Equal(t, tc.expectedCode, resp.Code)
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, tc.expectedDetail, errorDetail.Detail)
+			assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		price := money.NewMoney(200, "EUR")
+		adjusterMock.On("Adjust", params).Return(&ride.Ride{
+			ID:     rideID,
+			Status: ride.StatusPaid,
+			Price:  &price,
+			Adjustments: []ride.Adjustment{
+				{ID: "a_1", Amount: money.NewMoney(50, "EUR"), Reason: params.Reason, Actor: ride.ActorOperator},
+			},
+		}, nil)
+
+		resp := doReq()
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		body := struct {
+			Price   money.Money `json:"price"`
+			Charged money.Money `json:"charged"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, price, body.Price)
+		assert.Equal(t, money.NewMoney(150, "EUR"), body.Charged)
+	})
+}
+
+func TestRideSettle(t *testing.T) {
+	var settlerMock *ride.DebtSettlerMock
+	var hd handlers.RideHandlers
+	rideID := "r_1"
+
+	setup := func() {
+		settlerMock = ride.NewDebtSettlerMock()
+		hd = handlers.NewRideHandlers(nil, nil, nil, nil, settlerMock)
+	}
+
+	doReq := func(principal api.Principal) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/rides/%s/settle", rideID), nil)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("rideID", rideID)
+		ctx := api.WithPrincipal(context.WithValue(req.Context(), chi.RouteCtxKey, rctx), principal)
+
+		resp := httptest.NewRecorder()
+		hd.Settle.ServeHTTP(resp, req.WithContext(ctx))
+
+		return resp
+	}
+
+	testCases := []struct {
+		description  string
+		settlerErr   error
+		expectedCode int
+	}{
+		{"ride not found", ride.ErrNotFound, http.StatusNotFound},
+		{"not the owner", ride.ErrNotRideOwner, http.StatusForbidden},
+		{"no debt", ride.ErrNoDebt, http.StatusConflict},
+		{"declined", payment.ErrDeclined, http.StatusPaymentRequired},
+		{"internal", errors.New("ERR_RANDOM"), http.StatusInternalServerError},
+		{"ok", nil, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			params := ride.SettleParams{RideID: rideID, Actor: ride.ActorRider, UserID: "u_1"}
+			settlerMock.On("Settle", params).Return(&ride.Ride{ID: rideID, Status: ride.StatusPaid}, tc.settlerErr)
+
+			resp := doReq(api.Principal{UserID: "u_1", Role: api.RoleRider})
+			assert.Equal(t, tc.expectedCode, resp.Code)
+		})
+	}
+
+	t.Run("admins settle any ride", func(t *testing.T) {
+		setup()
+		params := ride.SettleParams{RideID: rideID, Actor: ride.ActorOperator}
+		settlerMock.On("Settle", params).Return(&ride.Ride{ID: rideID, Status: ride.StatusPaid}, nil)
+
+		resp := doReq(api.Principal{UserID: "admin_1", Role: api.RoleAdmin})
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+}
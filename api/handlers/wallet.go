@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reby/api"
+	"reby/domain/payment"
+	"reby/domain/user"
+	"reby/domain/wallet"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WalletHandlers struct {
+	TopUp   http.Handler
+	Balance http.Handler
+}
+
+func NewWalletHandlers(manager wallet.Manager) WalletHandlers {
+	return WalletHandlers{
+		TopUp:   TopUp(manager),
+		Balance: Balance(manager),
+	}
+}
+
+func AddWalletEndpoints(mx *chi.Mux, wh WalletHandlers) {
+	mx.With(api.RequireRoles(api.RoleRider, api.RoleAdmin)).
+		Method(http.MethodPost, "/users/{userID}/wallet/top-ups", wh.TopUp)
+	mx.With(api.RequireRoles(api.RoleRider, api.RoleSupport, api.RoleAdmin)).
+		Method(http.MethodGet, "/users/{userID}/wallet", wh.Balance)
+}
+
+// walletUserID returns the user whose wallet is requested, or responds with an error when the caller can't use it.
+// Riders only use their own wallet.
+func walletUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, err := api.GetStringURLParam(r, "userID")
+	if err != nil {
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+			Reason:     api.InvalidParameter,
+		})
+		return "", false
+	}
+
+	principal, ok := api.PrincipalFrom(r.Context())
+	if !ok {
+		api.RespondError(w, api.Error{
+			Err:        api.ErrMissingToken,
+			HTTPStatus: http.StatusUnauthorized,
+			Reason:     api.Unauthorized,
+		})
+		return "", false
+	}
+	if principal.Role == api.RoleRider && principal.UserID != userID {
+		api.RespondError(w, api.Error{
+			Err:        api.ErrForbidden,
+			HTTPStatus: http.StatusForbidden,
+			Reason:     api.Forbidden,
+		})
+		return "", false
+	}
+
+	return userID, true
+}
+
+func handleWalletError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, user.ErrNotFound) || errors.Is(err, wallet.ErrNotFound):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusNotFound,
+			Reason:     api.InvalidParameter,
+		})
+	case errors.Is(err, wallet.ErrInvalidAmount):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+			Reason:     api.InvalidParameter,
+		})
+	case errors.Is(err, payment.ErrDeclined):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusPaymentRequired,
+			Reason:     api.PaymentRequired,
+		})
+	default:
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+			Reason:     api.Internal,
+		})
+	}
+}
+
+func TopUp(manager wallet.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := walletUserID(w, r)
+		if !ok {
+			return
+		}
+
+		req := struct {
+			Value int `json:"value"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidJSON,
+			})
+			return
+		}
+
+		wal, err := manager.TopUp(r.Context(), wallet.TopUpParams{UserID: userID, Value: req.Value})
+		if err != nil {
+			handleWalletError(w, err)
+			return
+		}
+
+		api.RespondOK(w, wal)
+	})
+}
+
+func Balance(manager wallet.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := walletUserID(w, r)
+		if !ok {
+			return
+		}
+
+		wal, err := manager.Get(r.Context(), userID)
+		if err != nil {
+			handleWalletError(w, err)
+			return
+		}
+
+		api.RespondOK(w, wal)
+	})
+}
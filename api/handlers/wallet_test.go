@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reby/api"
+	"reby/api/handlers"
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/user"
+	"reby/domain/wallet"
+)
+
+func TestWalletTopUp(t *testing.T) {
+	var managerMock *wallet.ManagerMock
+	var hd handlers.WalletHandlers
+	userID := "u_1"
+
+	setup := func() {
+		managerMock = wallet.NewManagerMock()
+		hd = handlers.NewWalletHandlers(managerMock)
+	}
+
+	doReq := func(value int) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(map[string]int{"value": value}))
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/wallet/top-ups", userID), &buf)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("userID", userID)
+
+		resp := httptest.NewRecorder()
+		ctx := api.WithPrincipal(context.WithValue(req.Context(), chi.RouteCtxKey, rctx),
+			api.Principal{UserID: userID, Role: api.RoleRider})
+		hd.TopUp.ServeHTTP(resp, req.WithContext(ctx))
+
+		return resp
+	}
+
+	testCases := []struct {
+		description    string
+		managerErr     error
+		expectedCode   int
+		expectedReason string
+		expectedDetail string
+	}{
+		{
+			description:    "user not found",
+			managerErr:     user.ErrNotFound,
+			expectedCode:   http.StatusNotFound,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_USER_NOT_FOUND",
+		},
+		{
+			description:    "invalid amount",
+			managerErr:     wallet.ErrInvalidAmount,
+			expectedCode:   http.StatusBadRequest,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_WALLET_INVALID_AMOUNT",
+		},
+		{
+			description:    "payment declined",
+			managerErr:     payment.ErrDeclined,
+			expectedCode:   http.StatusPaymentRequired,
+			expectedReason: string(api.PaymentRequired),
+			expectedDetail: "ERR_PAYMENT_DECLINED",
+		},
+		{
+			description:    "internal",
+			managerErr:     errors.New("ERR_RANDOM"),
+			expectedCode:   http.StatusInternalServerError,
+			expectedReason: string(api.Internal),
+			expectedDetail: "ERR_RANDOM",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			managerMock.On("TopUp", wallet.TopUpParams{UserID: userID, Value: 500}).Return(&wallet.Wallet{}, tc.managerErr)
+
+			resp := doReq(500)
+			assert.Equal(t, tc.expectedCode, resp.Code)
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, tc.expectedDetail, errorDetail.Detail)
+			assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		managerMock.On("TopUp", wallet.TopUpParams{UserID: userID, Value: 500}).Return(&wallet.Wallet{
+			UserID:  userID,
+			Balance: money.NewMoney(500, "EUR"),
+		}, nil)
+
+		resp := doReq(500)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var w wallet.Wallet
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&w))
+		assert.Equal(t, money.NewMoney(500, "EUR"), w.Balance)
+	})
+}
+
+func TestWalletBalance(t *testing.T) {
+	managerMock := wallet.NewManagerMock()
+	hd := handlers.NewWalletHandlers(managerMock)
+
+	doReq := func(userID string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/wallet", userID), nil)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("userID", userID)
+
+		resp := httptest.NewRecorder()
+		ctx := api.WithPrincipal(context.WithValue(req.Context(), chi.RouteCtxKey, rctx),
+			api.Principal{UserID: "s_1", Role: api.RoleSupport})
+		hd.Balance.ServeHTTP(resp, req.WithContext(ctx))
+
+		return resp
+	}
+
+	managerMock.On("Get", "u_1").Return(&wallet.Wallet{UserID: "u_1", Balance: money.NewMoney(250, "EUR")}, nil)
+	managerMock.On("Get", "u_2").Return(&wallet.Wallet{}, wallet.ErrNotFound)
+
+	resp := doReq("u_1")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var w wallet.Wallet
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&w))
+	assert.Equal(t, money.NewMoney(250, "EUR"), w.Balance)
+
+	assert.Equal(t, http.StatusNotFound, doReq("u_2").Code)
+}
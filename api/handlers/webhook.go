@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"reby/api"
+	"reby/domain/apikey"
+	"reby/domain/webhook"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandlers struct {
+	Subscribe   http.Handler
+	List        http.Handler
+	Unsubscribe http.Handler
+	DeadLetters http.Handler
+	Replay      http.Handler
+}
+
+func NewWebhookHandlers(manager webhook.Manager) WebhookHandlers {
+	return WebhookHandlers{
+		Subscribe:   Subscribe(manager),
+		List:        ListWebhooks(manager),
+		Unsubscribe: Unsubscribe(manager),
+		DeadLetters: DeadLetters(manager),
+		Replay:      Replay(manager),
+	}
+}
+
+func AddWebhookEndpoints(mx *chi.Mux, wh WebhookHandlers) {
+	// Partners manage their own subscriptions, admins the ones of every partner and the platform's own
+	owners := mx.With(api.RequireRoles(api.RoleAdmin, api.RolePartner), api.RequireScope(apikey.ScopeWebhooksManage))
+	owners.Method(http.MethodPost, "/webhooks", wh.Subscribe)
+	owners.Method(http.MethodGet, "/webhooks", wh.List)
+	owners.Method(http.MethodDelete, "/webhooks/{subscriptionID}", wh.Unsubscribe)
+	// Dead letters hold the deliveries of every partner
+	admins := mx.With(api.RequireRoles(api.RoleAdmin))
+	admins.Method(http.MethodGet, "/webhooks/dead-letters", wh.DeadLetters)
+	admins.Method(http.MethodPost, "/webhooks/dead-letters/{deliveryID}/replay", wh.Replay)
+}
+
+func handleWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrNotFound) || errors.Is(err, webhook.ErrDeliveryNotFound):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusNotFound,
+			Reason:     api.InvalidParameter,
+		})
+	case errors.Is(err, webhook.ErrInvalidURL) || errors.Is(err, webhook.ErrInvalidEvents):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+			Reason:     api.InvalidParameter,
+		})
+	case errors.Is(err, webhook.ErrDeliveryNotDead):
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusConflict,
+			Reason:     api.Conflict,
+		})
+	default:
+		api.RespondError(w, api.Error{
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+			Reason:     api.Internal,
+		})
+	}
+}
+
+// webhookOwner returns the partner whose subscriptions the caller manages, the partner itself for partners and the
+// requested one, if any, for admins.
+func webhookOwner(r *http.Request, requested string) string {
+	if principal, ok := api.PrincipalFrom(r.Context()); ok && principal.Role == api.RolePartner {
+		return principal.PartnerID
+	}
+
+	return requested
+}
+
+func Subscribe(manager webhook.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			// PartnerID is only read for admins, partners subscribe for themselves
+			PartnerID string   `json:"partner_id"`
+			URL       string   `json:"url"`
+			Events    []string `json:"events"`
+			Secret    string   `json:"secret"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidJSON,
+			})
+			return
+		}
+
+		s, err := manager.Subscribe(r.Context(), webhook.SubscribeParams{
+			PartnerID: webhookOwner(r, req.PartnerID),
+			URL:       req.URL,
+			Events:    req.Events,
+			Secret:    req.Secret,
+		})
+		if err != nil {
+			handleWebhookError(w, err)
+			return
+		}
+
+		api.RespondOK(w, s)
+	})
+}
+
+func ListWebhooks(manager webhook.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscriptions, err := manager.List(r.Context(), webhookOwner(r, r.URL.Query().Get("partner_id")))
+		if err != nil {
+			handleWebhookError(w, err)
+			return
+		}
+
+		api.RespondOK(w, subscriptions)
+	})
+}
+
+func Unsubscribe(manager webhook.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscriptionID, err := api.GetStringURLParam(r, "subscriptionID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		if err = manager.Unsubscribe(r.Context(), webhookOwner(r, ""), subscriptionID); err != nil {
+			handleWebhookError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func DeadLetters(manager webhook.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deliveries, err := manager.ListDeadLetters(r.Context())
+		if err != nil {
+			handleWebhookError(w, err)
+			return
+		}
+
+		api.RespondOK(w, deliveries)
+	})
+}
+
+func Replay(manager webhook.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deliveryID, err := api.GetStringURLParam(r, "deliveryID")
+		if err != nil {
+			api.RespondError(w, api.Error{
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+				Reason:     api.InvalidParameter,
+			})
+			return
+		}
+
+		d, err := manager.Replay(r.Context(), deliveryID)
+		if err != nil {
+			handleWebhookError(w, err)
+			return
+		}
+
+		api.RespondOK(w, d)
+	})
+}
@@ -0,0 +1,239 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reby/api"
+	"reby/api/handlers"
+	"reby/domain/ride"
+	"reby/domain/webhook"
+)
+
+func TestWebhookSubscribe(t *testing.T) {
+	var managerMock *webhook.ManagerMock
+	var hd handlers.WebhookHandlers
+
+	setup := func() {
+		managerMock = webhook.NewManagerMock()
+		hd = handlers.NewWebhookHandlers(managerMock)
+	}
+
+	params := webhook.SubscribeParams{
+		URL:    "https://partner.test/hooks",
+		Events: []string{ride.MessageRideStarted},
+	}
+
+	doReq := func() *httptest.ResponseRecorder {
+		body := struct {
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+		}{
+			URL:    params.URL,
+			Events: params.Events,
+		}
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		req, err := http.NewRequest(http.MethodPost, "/webhooks", &buf)
+		require.NoError(t, err)
+
+		resp := httptest.NewRecorder()
+		hd.Subscribe.ServeHTTP(resp, req)
+
+		return resp
+	}
+
+	testCases := []struct {
+		description    string
+		managerErr     error
+		expectedCode   int
+		expectedReason string
+		expectedDetail string
+	}{
+		{
+			description:    "invalid url",
+			managerErr:     webhook.ErrInvalidURL,
+			expectedCode:   http.StatusBadRequest,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_WEBHOOK_INVALID_URL",
+		},
+		{
+			description:    "invalid events",
+			managerErr:     webhook.ErrInvalidEvents,
+			expectedCode:   http.StatusBadRequest,
+			expectedReason: string(api.InvalidParameter),
+			expectedDetail: "ERR_WEBHOOK_INVALID_EVENTS",
+		},
+		{
+			description:    "internal",
+			managerErr:     errors.New("ERR_RANDOM"),
+			expectedCode:   http.StatusInternalServerError,
+			expectedReason: string(api.Internal),
+			expectedDetail: "ERR_RANDOM",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			managerMock.On("Subscribe", params).Return(&webhook.Subscription{}, tc.managerErr)
+
+			resp := doReq()
+			assert.Equal(t, tc.expectedCode, resp.Code)
+
+			var errorDetail api.ErrorDetail
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+			assert.Equal(t, tc.expectedDetail, errorDetail.Detail)
+			assert.Equal(t, tc.expectedReason, errorDetail.Reason)
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		managerMock.On("Subscribe", params).Return(&webhook.Subscription{
+			ID:     "wh_1",
+			URL:    params.URL,
+			Events: params.Events,
+			Secret: "generated",
+		}, nil)
+
+		resp := doReq()
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var s webhook.Subscription
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&s))
+		assert.Equal(t, "wh_1", s.ID)
+		assert.Equal(t, "generated", s.Secret)
+	})
+}
+
+func TestWebhookUnsubscribe(t *testing.T) {
+	managerMock := webhook.NewManagerMock()
+	hd := handlers.NewWebhookHandlers(managerMock)
+
+	doReq := func(subscriptionID string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("/webhooks/%s", subscriptionID), nil)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("subscriptionID", subscriptionID)
+
+		resp := httptest.NewRecorder()
+		hd.Unsubscribe.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		return resp
+	}
+
+	managerMock.On("Unsubscribe", "", "wh_1").Return(nil)
+	managerMock.On("Unsubscribe", "", "wh_2").Return(webhook.ErrNotFound)
+
+	assert.Equal(t, http.StatusNoContent, doReq("wh_1").Code)
+	assert.Equal(t, http.StatusNotFound, doReq("wh_2").Code)
+}
+
+func TestWebhookPartnerOwnsSubscriptions(t *testing.T) {
+	managerMock := webhook.NewManagerMock()
+	hd := handlers.NewWebhookHandlers(managerMock)
+	partner := api.Principal{Role: api.RolePartner, PartnerID: "p_1"}
+
+	serve := func(h http.Handler, req *http.Request, params map[string]string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		for k, v := range params {
+			rctx.URLParams.Add(k, v)
+		}
+		ctx := context.WithValue(api.WithPrincipal(req.Context(), partner), chi.RouteCtxKey, rctx)
+
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req.WithContext(ctx))
+
+		return resp
+	}
+
+	t.Run("subscribes for itself", func(t *testing.T) {
+		// The partner in the body is ignored
+		body := `{"partner_id":"p_2","url":"https://partner.test/hooks","events":["RideStarted"]}`
+		managerMock.On("Subscribe", webhook.SubscribeParams{
+			PartnerID: "p_1",
+			URL:       "https://partner.test/hooks",
+			Events:    []string{ride.MessageRideStarted},
+		}).Return(&webhook.Subscription{ID: "wh_1", PartnerID: "p_1"}, nil)
+
+		req, err := http.NewRequest(http.MethodPost, "/webhooks", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, serve(hd.Subscribe, req, nil).Code)
+	})
+
+	t.Run("lists its own", func(t *testing.T) {
+		managerMock.On("List", "p_1").Return([]*webhook.Subscription{{ID: "wh_1", PartnerID: "p_1"}}, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/webhooks?partner_id=p_2", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, serve(hd.List, req, nil).Code)
+		managerMock.AssertCalled(t, "List", "p_1")
+	})
+
+	t.Run("can't unsubscribe others", func(t *testing.T) {
+		managerMock.On("Unsubscribe", "p_1", "wh_2").Return(webhook.ErrNotFound)
+
+		req, err := http.NewRequest(http.MethodDelete, "/webhooks/wh_2", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, serve(hd.Unsubscribe, req, map[string]string{"subscriptionID": "wh_2"}).Code)
+	})
+}
+
+func TestWebhookReplay(t *testing.T) {
+	var managerMock *webhook.ManagerMock
+	var hd handlers.WebhookHandlers
+	deliveryID := "d_1"
+
+	setup := func() {
+		managerMock = webhook.NewManagerMock()
+		hd = handlers.NewWebhookHandlers(managerMock)
+	}
+
+	doReq := func() *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/webhooks/dead-letters/%s/replay", deliveryID)
+		req, err := http.NewRequest(http.MethodPost, path, nil)
+		require.NoError(t, err)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("deliveryID", deliveryID)
+
+		resp := httptest.NewRecorder()
+		hd.Replay.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		return resp
+	}
+
+	testCases := []struct {
+		description  string
+		managerErr   error
+		expectedCode int
+	}{
+		{description: "ok", managerErr: nil, expectedCode: http.StatusOK},
+		{description: "not found", managerErr: webhook.ErrDeliveryNotFound, expectedCode: http.StatusNotFound},
+		{description: "not dead", managerErr: webhook.ErrDeliveryNotDead, expectedCode: http.StatusConflict},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			managerMock.On("Replay", deliveryID).Return(&webhook.Delivery{
+				ID:     deliveryID,
+				Status: webhook.DeliveryPending,
+			}, tc.managerErr)
+
+			resp := doReq()
+			assert.Equal(t, tc.expectedCode, resp.Code)
+		})
+	}
+}
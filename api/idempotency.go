@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"reby/pkg/idempotency"
+	"reby/pkg/timenow"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on the responses replayed from a previous request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+var (
+	ErrIdempotencyKeyReused = errors.New("ERR_IDEMPOTENCY_KEY_REUSED")
+	ErrRequestInProgress    = errors.New("ERR_IDEMPOTENT_REQUEST_IN_PROGRESS")
+)
+
+// responseRecorder writes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware makes the requests with an Idempotency-Key header safe to retry. The response of the first
+// request is stored for ttl and replayed for the retries with the same body, while reusing the key with a different
+// body is refused. Server errors are not stored, so those requests can be retried.
+func IdempotencyMiddleware(store idempotency.Store, ttl time.Duration, time timenow.TimeNow) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				RespondError(w, Error{
+					Err:        err,
+					HTTPStatus: http.StatusBadRequest,
+					Reason:     InvalidParameter,
+				})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// Keys are only unique per caller, endpoint and resource
+			scopedKey := r.Method + " " + r.URL.Path + " " + key
+			if p, ok := PrincipalFrom(r.Context()); ok {
+				scopedKey = p.UserID + " " + scopedKey
+				if p.PartnerID != "" {
+					scopedKey = "PARTNER:" + p.PartnerID + " " + scopedKey
+				}
+			}
+			fingerprint := sha256.Sum256(body)
+			now := time.Now()
+			existing, err := store.Reserve(r.Context(), idempotency.Record{
+				Key:         scopedKey,
+				Fingerprint: hex.EncodeToString(fingerprint[:]),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(ttl),
+			})
+			if err != nil {
+				RespondError(w, Error{
+					Err:        err,
+					HTTPStatus: http.StatusInternalServerError,
+					Reason:     Internal,
+				})
+				return
+			}
+			if existing != nil {
+				replay(w, existing, hex.EncodeToString(fingerprint[:]))
+				return
+			}
+
+			// The outcome is stored even if the client went away, it is what a retry must get
+			ctx := context.Background()
+			defer func() {
+				if rvr := recover(); rvr != nil {
+					_ = store.Release(ctx, scopedKey)
+					panic(rvr)
+				}
+			}()
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.statusCode == 0 || rec.statusCode >= http.StatusInternalServerError {
+				_ = store.Release(ctx, scopedKey)
+				return
+			}
+			_ = store.Complete(ctx, scopedKey, rec.statusCode, rec.body.Bytes())
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, rec *idempotency.Record, fingerprint string) {
+	switch {
+	case rec.Fingerprint != fingerprint:
+		RespondError(w, Error{
+			Err:        ErrIdempotencyKeyReused,
+			HTTPStatus: http.StatusUnprocessableEntity,
+			Reason:     Unprocessable,
+		})
+	case !rec.Completed():
+		RespondError(w, Error{
+			Err:        ErrRequestInProgress,
+			HTTPStatus: http.StatusConflict,
+			Reason:     Conflict,
+		})
+	default:
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(rec.StatusCode)
+		_, _ = w.Write(rec.Body)
+	}
+}
@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"reby/api"
+	"reby/infra/mem"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	type request struct {
+		key  string
+		body string
+	}
+	tests := map[string]struct {
+		statuses     []int
+		requests     []request
+		expectCalls  int
+		expectStatus []int
+		expectReplay []bool
+	}{
+		"without key every request is served": {
+			statuses:     []int{http.StatusOK, http.StatusOK},
+			requests:     []request{{body: `{}`}, {body: `{}`}},
+			expectCalls:  2,
+			expectStatus: []int{http.StatusOK, http.StatusOK},
+			expectReplay: []bool{false, false},
+		},
+		"retry with the same body is replayed": {
+			statuses:     []int{http.StatusOK},
+			requests:     []request{{key: "k_1", body: `{}`}, {key: "k_1", body: `{}`}},
+			expectCalls:  1,
+			expectStatus: []int{http.StatusOK, http.StatusOK},
+			expectReplay: []bool{false, true},
+		},
+		"client errors are replayed": {
+			statuses:     []int{http.StatusLocked},
+			requests:     []request{{key: "k_1", body: `{}`}, {key: "k_1", body: `{}`}},
+			expectCalls:  1,
+			expectStatus: []int{http.StatusLocked, http.StatusLocked},
+			expectReplay: []bool{false, true},
+		},
+		"key reused with another body": {
+			statuses:     []int{http.StatusOK},
+			requests:     []request{{key: "k_1", body: `{}`}, {key: "k_1", body: `{"a":1}`}},
+			expectCalls:  1,
+			expectStatus: []int{http.StatusOK, http.StatusUnprocessableEntity},
+			expectReplay: []bool{false, false},
+		},
+		"server errors are not stored": {
+			statuses:     []int{http.StatusInternalServerError, http.StatusOK},
+			requests:     []request{{key: "k_1", body: `{}`}, {key: "k_1", body: `{}`}},
+			expectCalls:  2,
+			expectStatus: []int{http.StatusInternalServerError, http.StatusOK},
+			expectReplay: []bool{false, false},
+		},
+		"different keys are served": {
+			statuses:     []int{http.StatusOK, http.StatusOK},
+			requests:     []request{{key: "k_1", body: `{}`}, {key: "k_2", body: `{}`}},
+			expectCalls:  2,
+			expectStatus: []int{http.StatusOK, http.StatusOK},
+			expectReplay: []bool{false, false},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+				_, _ = w.Write([]byte(`{"id":"r_1"}`))
+			})
+			h := api.IdempotencyMiddleware(mem.NewIdempotencyStore(), time.Hour, timenow.NewFixedTime(time.Now()))(next)
+
+			for i, req := range tt.requests {
+				r := httptest.NewRequest(http.MethodPost, "/rides", strings.NewReader(req.body))
+				if req.key != "" {
+					r.Header.Set(api.IdempotencyKeyHeader, req.key)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				assert.Equal(t, tt.expectStatus[i], w.Code)
+				assert.Equal(t, tt.expectReplay[i], w.Header().Get(api.IdempotentReplayedHeader) == "true")
+				if tt.expectReplay[i] {
+					assert.Equal(t, `{"id":"r_1"}`, w.Body.String())
+				}
+			}
+			assert.Equal(t, tt.expectCalls, calls)
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareInProgress(t *testing.T) {
+	store := mem.NewIdempotencyStore()
+	idempotent := api.IdempotencyMiddleware(store, time.Hour, timenow.NewFixedTime(time.Now()))
+
+	var inner *httptest.ResponseRecorder
+	var h http.Handler
+	h = idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A retry arrives while the first request is still being served
+		retry := httptest.NewRequest(http.MethodPost, "/rides", strings.NewReader(`{}`))
+		retry.Header.Set(api.IdempotencyKeyHeader, "k_1")
+		inner = httptest.NewRecorder()
+		h.ServeHTTP(inner, retry)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/rides", strings.NewReader(`{}`))
+	r.Header.Set(api.IdempotencyKeyHeader, "k_1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusConflict, inner.Code)
+}
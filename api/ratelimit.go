@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"reby/pkg/ratelimit"
+	"reby/pkg/timenow"
+)
+
+var ErrRateLimited = errors.New("ERR_RATE_LIMITED")
+
+// RateLimitMiddleware limits the requests of every caller to limit, counting them in a bucket named after the route.
+// Callers are told apart by user, by API key or, when unauthenticated, by client IP. Rejected requests get a 429
+// with the seconds to wait in Retry-After.
+func RateLimitMiddleware(store ratelimit.Store, route string, limit ratelimit.Limit, time timenow.TimeNow) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.IsZero() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := store.Take(r.Context(), route+" "+rateLimitKey(r), limit, time.Now())
+			if err != nil {
+				// A broken shared store must not take the API down with it
+				log.Printf("rate limit store: %s", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+				RespondError(w, Error{
+					Err:        ErrRateLimited,
+					HTTPStatus: http.StatusTooManyRequests,
+					Reason:     TooManyRequests,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitKey(r *http.Request) string {
+	if p, ok := PrincipalFrom(r.Context()); ok {
+		if p.APIKeyID != "" {
+			return "KEY:" + p.APIKeyID
+		}
+		return "USER:" + p.UserID
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "IP:" + ip
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reby/api"
+	"reby/infra/mem"
+	"reby/pkg/ratelimit"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	fixedTime := timenow.NewFixedTime(time.Now())
+	limit := ratelimit.Limit{Requests: 2, Per: time.Minute, Burst: 1}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	doReq := func(h http.Handler, principal *api.Principal, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/rides", nil)
+		req.RemoteAddr = remoteAddr
+		if principal != nil {
+			req = req.WithContext(api.WithPrincipal(req.Context(), *principal))
+		}
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("limits every caller on its own", func(t *testing.T) {
+		h := api.RateLimitMiddleware(mem.NewRateLimitStore(), "start_ride", limit, fixedTime)(ok)
+		rider := &api.Principal{UserID: "u_1", Role: api.RoleRider}
+		partner := &api.Principal{Role: api.RolePartner, PartnerID: "p_1", APIKeyID: "k_1"}
+
+		assert.Equal(t, http.StatusOK, doReq(h, rider, "10.0.0.1:1234").Code)
+		assert.Equal(t, http.StatusOK, doReq(h, partner, "10.0.0.1:1234").Code)
+		assert.Equal(t, http.StatusOK, doReq(h, nil, "10.0.0.1:1234").Code)
+		assert.Equal(t, http.StatusOK, doReq(h, nil, "10.0.0.2:1234").Code)
+
+		resp := doReq(h, rider, "10.0.0.3:1234")
+		assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+		assert.Equal(t, "30", resp.Header().Get("Retry-After"))
+
+		var errorDetail api.ErrorDetail
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errorDetail))
+		assert.Equal(t, string(api.TooManyRequests), errorDetail.Reason)
+		assert.Equal(t, "ERR_RATE_LIMITED", errorDetail.Detail)
+
+		assert.Equal(t, http.StatusTooManyRequests, doReq(h, nil, "10.0.0.1:4321").Code)
+	})
+
+	t.Run("routes have their own buckets", func(t *testing.T) {
+		store := mem.NewRateLimitStore()
+		start := api.RateLimitMiddleware(store, "start_ride", limit, fixedTime)(ok)
+		finish := api.RateLimitMiddleware(store, "finish_ride", limit, fixedTime)(ok)
+		rider := &api.Principal{UserID: "u_1", Role: api.RoleRider}
+
+		assert.Equal(t, http.StatusOK, doReq(start, rider, "10.0.0.1:1234").Code)
+		assert.Equal(t, http.StatusOK, doReq(finish, rider, "10.0.0.1:1234").Code)
+	})
+
+	t.Run("store errors let requests through", func(t *testing.T) {
+		storeMock := ratelimit.NewStoreMock()
+		storeMock.On("Take", mock.Anything, limit, fixedTime.Now()).Return(ratelimit.Result{}, errors.New("ERR_RANDOM"))
+		h := api.RateLimitMiddleware(storeMock, "start_ride", limit, fixedTime)(ok)
+
+		assert.Equal(t, http.StatusOK, doReq(h, nil, "10.0.0.1:1234").Code)
+	})
+
+	t.Run("unset limit", func(t *testing.T) {
+		storeMock := ratelimit.NewStoreMock()
+		h := api.RateLimitMiddleware(storeMock, "start_ride", ratelimit.Limit{}, fixedTime)(ok)
+
+		assert.Equal(t, http.StatusOK, doReq(h, nil, "10.0.0.1:1234").Code)
+		storeMock.AssertNotCalled(t, "Take", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
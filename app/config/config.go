@@ -1,11 +1,24 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"reby/infra"
 
 	"github.com/spf13/viper"
 )
 
+// DefaultPath is the config file read when no other is given, the one for local development.
+const DefaultPath = "app/config/local.yml"
+
+// EnvPrefix prefixes the environment variables overriding the config, like APP_DB_HOST for db_host.
+const EnvPrefix = "APP"
+
 type Config struct {
 	APIURL     string `mapstructure:"api_url"`
 	APIPort    string `mapstructure:"api_port"`
@@ -16,18 +29,388 @@ type Config struct {
 	DBPassword string `mapstructure:"db_password"`
 	DBName     string `mapstructure:"db_name"`
 	Env        string `mapstructure:"env"`
+	// DBPath is the database file of SQLite.
+	DBPath string `mapstructure:"db_path"`
+	// DBMemPath keeps the rides of MEMORY across restarts, in a snapshot at the path and a log of the changes since
+	// at the path plus ".wal". They are only kept in memory when empty.
+	DBMemPath string `mapstructure:"db_mem_path"`
+	// DBMemSync is when the log is flushed to disk: ALWAYS on every change, INTERVAL every DBMemSyncInterval, or
+	// NEVER, leaving it to the operating system. A crash of the host loses the changes not flushed yet.
+	DBMemSync         string        `mapstructure:"db_mem_sync"`
+	DBMemSyncInterval time.Duration `mapstructure:"db_mem_sync_interval"`
+	// DBMemCheckpointRecords and DBMemCheckpointBytes are how long the log grows before it is folded into the
+	// snapshot, so a restart doesn't replay every change since boot. Zero leaves that limit out.
+	DBMemCheckpointRecords int   `mapstructure:"db_mem_checkpoint_records"`
+	DBMemCheckpointBytes   int64 `mapstructure:"db_mem_checkpoint_bytes"`
+	// DBPasswordFile is read into DBPassword, for secrets mounted as files.
+	DBPasswordFile string `mapstructure:"db_password_file"`
+	// DBMigrateOnStart applies the pending migrations on boot, otherwise they are applied with the migrate command.
+	DBMigrateOnStart bool `mapstructure:"db_migrate_on_start"`
+	// DBDSN connects to Postgres instead of the host, port, user, password and name above, either as a URL or as
+	// key=value pairs. The SSL settings below don't apply to it, they go in the DSN.
+	DBDSN string `mapstructure:"db_dsn"`
+	// DBSSLMode is one of the SSL modes of lib/pq: disable, require, verify-ca or verify-full. The CA certificate
+	// verifies the server, and the certificate and key authenticate the service to it.
+	DBSSLMode     string `mapstructure:"db_ssl_mode"`
+	DBSSLRootCert string `mapstructure:"db_ssl_root_cert"`
+	DBSSLCert     string `mapstructure:"db_ssl_cert"`
+	DBSSLKey      string `mapstructure:"db_ssl_key"`
+	// Pool of connections to Postgres. Zero max open connections is unlimited, and zero lifetimes keep the
+	// connections forever.
+	DBMaxOpenConns    int           `mapstructure:"db_max_open_conns"`
+	DBMaxIdleConns    int           `mapstructure:"db_max_idle_conns"`
+	DBConnMaxLifetime time.Duration `mapstructure:"db_conn_max_lifetime"`
+	DBConnMaxIdleTime time.Duration `mapstructure:"db_conn_max_idle_time"`
+	// DBStatementTimeout aborts the statements running longer, zero lets them run.
+	DBStatementTimeout time.Duration `mapstructure:"db_statement_timeout"`
+	// ShutdownTimeout is how long the in-flight requests and the background workers get to finish on shutdown.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// Country the service operates in, as an ISO 3166-1 alpha-2 code. The rides are receipted for the country of their
+	// vehicle, this one is for the vehicles that don't have one.
+	Country string `mapstructure:"country"`
+	// PaymentProvider charges the card rides. Only FAKE exists yet, which can't be used with POSTGRES unless
+	// PaymentProviderAllowFake is set, for staging and demo databases.
+	PaymentProvider          string `mapstructure:"payment_provider"`
+	PaymentProviderAllowFake bool   `mapstructure:"payment_provider_allow_fake"`
+
+	RideMaxDuration    time.Duration `mapstructure:"ride_max_duration"`
+	RideExpiryInterval time.Duration `mapstructure:"ride_expiry_interval"`
+
+	EventRelayInterval time.Duration `mapstructure:"event_relay_interval"`
+	EventWebhookURL    string        `mapstructure:"event_webhook_url"`
+	EventFilePath      string        `mapstructure:"event_file_path"`
+
+	WebhookDeliveryInterval time.Duration `mapstructure:"webhook_delivery_interval"`
+	WebhookMaxAttempts      int           `mapstructure:"webhook_max_attempts"`
+	WebhookRetryDelay       time.Duration `mapstructure:"webhook_retry_delay"`
+
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
+
+	// Keys verifying the bearer tokens, HS256 tokens are accepted when the secret is set and RS256 tokens when the
+	// PEM public key file is set.
+	JWTSecret        string `mapstructure:"jwt_secret"`
+	JWTPublicKeyFile string `mapstructure:"jwt_public_key_file"`
+	// JWTSecretFile is read into JWTSecret, for secrets mounted as files.
+	JWTSecretFile string `mapstructure:"jwt_secret_file"`
+	// JWTIssuer and JWTAudience are the "iss" and "aud" claims the bearer tokens must have, so the tokens the
+	// identity provider issues for other services aren't accepted.
+	JWTIssuer   string `mapstructure:"jwt_issuer"`
+	JWTAudience string `mapstructure:"jwt_audience"`
+
+	// APIKeyRotationGrace is how long a rotated API key keeps working, so partners can deploy the new one.
+	APIKeyRotationGrace time.Duration `mapstructure:"api_key_rotation_grace"`
+
+	// RateLimits by route name. The "default" one applies to every route by client IP, on top of its own.
+	RateLimits map[string]RateLimit `mapstructure:"rate_limits"`
+}
+
+// RateLimit allows Requests per Per to every caller, in bursts of up to Burst requests.
+type RateLimit struct {
+	Requests int           `mapstructure:"requests"`
+	Per      time.Duration `mapstructure:"per"`
+	Burst    int           `mapstructure:"burst"`
 }
 
-func Get() *Config {
-	viper.SetConfigFile("app/config/local.yml")
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatal(err)
+// defaults are the values of the keys missing from the config file and the environment. Every key needs one, even
+// if empty, for its environment variable to be read.
+var defaults = map[string]interface{}{
+	// Listens on every interface
+	"api_url":             "",
+	"api_port":            "8080",
+	"db_type":             infra.InMemory,
+	"db_host":             "",
+	"db_port":             5432,
+	"db_user":             "",
+	"db_password":         "",
+	"db_password_file":    "",
+	"db_path":             "rides.db",
+	"db_name":             "",
+	"db_migrate_on_start": false,
+	"db_dsn":              "",
+	"db_ssl_mode":         "disable",
+	"db_ssl_root_cert":    "",
+	"db_ssl_cert":         "",
+	"db_ssl_key":          "",
+
+	"db_max_open_conns":     25,
+	"db_max_idle_conns":     5,
+	"db_conn_max_lifetime":  "30m",
+	"db_conn_max_idle_time": "5m",
+	"db_statement_timeout":  "30s",
+
+	"db_mem_path":          "",
+	"db_mem_sync":          "ALWAYS",
+	"db_mem_sync_interval": "1s",
+
+	"db_mem_checkpoint_records": 10000,
+	"db_mem_checkpoint_bytes":   64 << 20,
+
+	"env":              "",
+	"shutdown_timeout": "15s",
+	"country":          "ES",
+	"payment_provider": infra.FakePaymentProvider,
+
+	"payment_provider_allow_fake": false,
+
+	"ride_max_duration":    "3h",
+	"ride_expiry_interval": "1m",
+
+	"event_relay_interval": "5s",
+	"event_webhook_url":    "",
+	"event_file_path":      "",
+
+	"webhook_delivery_interval": "5s",
+	"webhook_max_attempts":      8,
+	"webhook_retry_delay":       "30s",
+
+	"idempotency_ttl": "24h",
+
+	"jwt_secret":          "",
+	"jwt_secret_file":     "",
+	"jwt_public_key_file": "",
+	"jwt_issuer":          "reby-identity",
+	"jwt_audience":        "reby-api",
+
+	"api_key_rotation_grace": "24h",
+
+	"rate_limits.default.requests":     600,
+	"rate_limits.default.per":          "1m",
+	"rate_limits.default.burst":        100,
+	"rate_limits.start_ride.requests":  10,
+	"rate_limits.start_ride.per":       "1m",
+	"rate_limits.start_ride.burst":     5,
+	"rate_limits.finish_ride.requests": 10,
+	"rate_limits.finish_ride.per":      "1m",
+	"rate_limits.finish_ride.burst":    5,
+	"rate_limits.top_up.requests":      10,
+	"rate_limits.top_up.per":           "1h",
+	"rate_limits.top_up.burst":         5,
+}
+
+// Load reads the config from the file at path, when not empty, overridden by the environment variables, and
+// validates it.
+func Load(path string) (*Config, error) {
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, err
+		}
 	}
 
 	conf := &Config{}
-	if err := viper.Unmarshal(conf); err != nil {
-		log.Fatal(err)
+	if err := v.Unmarshal(conf); err != nil {
+		return nil, err
+	}
+	if err := conf.readSecretFiles(); err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func (c *Config) readSecretFiles() error {
+	secrets := []struct {
+		file  string
+		value *string
+	}{
+		{file: c.DBPasswordFile, value: &c.DBPassword},
+		{file: c.JWTSecretFile, value: &c.JWTSecret},
+	}
+	for _, s := range secrets {
+		if s.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return err
+		}
+		// Editors and secret managers usually end the files with a newline that isn't part of the secret
+		*s.value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return nil
+}
+
+// ValidationError lists every problem of an invalid config, so they can all be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate returns a *ValidationError with the problems of the config, if any.
+func (c *Config) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
 	}
 
-	return conf
+	if port, err := strconv.Atoi(c.APIPort); err != nil || !validPort(port) {
+		addf("api_port must be a port between 1 and 65535, got %q", c.APIPort)
+	}
+
+	switch c.DBType {
+	case infra.InMemory:
+		if c.DBMemPath != "" {
+			problems = append(problems, c.validateMemStore()...)
+		}
+	case infra.Postgres:
+		problems = append(problems, c.validatePostgres()...)
+	case infra.SQLite:
+		if c.DBPath == "" {
+			addf("db_path is required for SQLITE")
+		}
+	default:
+		addf("db_type must be MEMORY, POSTGRES or SQLITE, got %q", c.DBType)
+	}
+
+	switch c.PaymentProvider {
+	case infra.FakePaymentProvider:
+		// Rides kept in Postgres are real ones, and the fake provider would give them away for free
+		if c.DBType == infra.Postgres && !c.PaymentProviderAllowFake {
+			addf("payment_provider FAKE charges nobody and can't be used with POSTGRES unless payment_provider_allow_fake is set")
+		}
+	default:
+		addf("payment_provider must be FAKE, got %q", c.PaymentProvider)
+	}
+
+	if len(c.Country) != 2 {
+		addf("country must be an ISO 3166-1 alpha-2 code, got %q", c.Country)
+	}
+	if c.JWTSecret == "" && c.JWTPublicKeyFile == "" {
+		addf("jwt_secret or jwt_public_key_file is required")
+	}
+	if c.JWTIssuer == "" {
+		addf("jwt_issuer is required")
+	}
+	if c.JWTAudience == "" {
+		addf("jwt_audience is required")
+	}
+	if c.WebhookMaxAttempts < 1 {
+		addf("webhook_max_attempts must be at least 1, got %d", c.WebhookMaxAttempts)
+	}
+
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{key: "shutdown_timeout", value: c.ShutdownTimeout},
+		{key: "ride_max_duration", value: c.RideMaxDuration},
+		{key: "ride_expiry_interval", value: c.RideExpiryInterval},
+		{key: "event_relay_interval", value: c.EventRelayInterval},
+		{key: "webhook_delivery_interval", value: c.WebhookDeliveryInterval},
+		{key: "webhook_retry_delay", value: c.WebhookRetryDelay},
+		{key: "idempotency_ttl", value: c.IdempotencyTTL},
+		{key: "api_key_rotation_grace", value: c.APIKeyRotationGrace},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			addf("%s must be positive, got %s", d.key, d.value)
+		}
+	}
+
+	names := make([]string, 0, len(c.RateLimits))
+	for name := range c.RateLimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l := c.RateLimits[name]
+		// A limit without requests or period lets everything through, but only half of it set is a mistake
+		if l.Requests < 0 || l.Per < 0 || l.Burst < 0 || (l.Requests > 0) != (l.Per > 0) {
+			addf("rate_limits.%s needs both requests and per, or neither, and none negative", name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+func (c *Config) validateMemStore() []string {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch c.DBMemSync {
+	case "ALWAYS", "NEVER":
+	case "INTERVAL":
+		if c.DBMemSyncInterval <= 0 {
+			addf("db_mem_sync_interval must be positive, got %s", c.DBMemSyncInterval)
+		}
+	default:
+		addf("db_mem_sync must be ALWAYS, INTERVAL or NEVER, got %q", c.DBMemSync)
+	}
+	if c.DBMemCheckpointRecords < 0 {
+		addf("db_mem_checkpoint_records can't be negative, got %d", c.DBMemCheckpointRecords)
+	}
+	if c.DBMemCheckpointBytes < 0 {
+		addf("db_mem_checkpoint_bytes can't be negative, got %d", c.DBMemCheckpointBytes)
+	}
+
+	return problems
+}
+
+func (c *Config) validatePostgres() []string {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// The DSN has everything needed to connect
+	if c.DBDSN == "" {
+		if c.DBHost == "" {
+			addf("db_host is required for POSTGRES")
+		}
+		if !validPort(c.DBPort) {
+			addf("db_port must be a port between 1 and 65535, got %d", c.DBPort)
+		}
+		if c.DBUser == "" {
+			addf("db_user is required for POSTGRES")
+		}
+		if c.DBName == "" {
+			addf("db_name is required for POSTGRES")
+		}
+	}
+
+	switch c.DBSSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		addf("db_ssl_mode must be disable, require, verify-ca or verify-full, got %q", c.DBSSLMode)
+	}
+	if (c.DBSSLCert == "") != (c.DBSSLKey == "") {
+		addf("db_ssl_cert and db_ssl_key go together")
+	}
+
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 {
+		addf("db_max_open_conns and db_max_idle_conns can't be negative")
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		addf("db_max_idle_conns can't be over db_max_open_conns, got %d over %d", c.DBMaxIdleConns, c.DBMaxOpenConns)
+	}
+	if c.DBConnMaxLifetime < 0 || c.DBConnMaxIdleTime < 0 || c.DBStatementTimeout < 0 {
+		addf("db_conn_max_lifetime, db_conn_max_idle_time and db_statement_timeout can't be negative")
+	}
+
+	return problems
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
 }
@@ -0,0 +1,219 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"reby/app/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setenv(t *testing.T, key, value string) {
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() { _ = os.Unsetenv(key) })
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("local config", func(t *testing.T) {
+		conf, err := config.Load("local.yml")
+		require.NoError(t, err)
+
+		assert.Equal(t, "MEMORY", conf.DBType)
+		assert.Equal(t, 15*time.Second, conf.ShutdownTimeout)
+		assert.Equal(t, config.RateLimit{Requests: 10, Per: time.Hour, Burst: 5}, conf.RateLimits["top_up"])
+	})
+
+	t.Run("environment only", func(t *testing.T) {
+		setenv(t, "APP_JWT_SECRET", "secret")
+
+		conf, err := config.Load("")
+		require.NoError(t, err)
+
+		assert.Equal(t, "8080", conf.APIPort)
+		assert.Equal(t, "MEMORY", conf.DBType)
+		assert.Equal(t, "secret", conf.JWTSecret)
+		assert.Equal(t, "reby-identity", conf.JWTIssuer)
+		assert.Equal(t, "reby-api", conf.JWTAudience)
+		assert.Equal(t, 24*time.Hour, conf.IdempotencyTTL)
+		assert.Equal(t, config.RateLimit{Requests: 600, Per: time.Minute, Burst: 100}, conf.RateLimits["default"])
+	})
+
+	t.Run("environment overrides the file", func(t *testing.T) {
+		setenv(t, "APP_DB_TYPE", "SQLITE")
+		setenv(t, "APP_DB_PATH", "rides.db")
+		setenv(t, "APP_SHUTDOWN_TIMEOUT", "30s")
+		setenv(t, "APP_RATE_LIMITS_START_RIDE_BURST", "2")
+
+		conf, err := config.Load("local.yml")
+		require.NoError(t, err)
+
+		assert.Equal(t, "SQLITE", conf.DBType)
+		assert.Equal(t, "rides.db", conf.DBPath)
+		assert.Equal(t, 5432, conf.DBPort)
+		assert.Equal(t, 30*time.Second, conf.ShutdownTimeout)
+		assert.Equal(t, config.RateLimit{Requests: 10, Per: time.Minute, Burst: 2}, conf.RateLimits["start_ride"])
+	})
+
+	t.Run("secrets from files", func(t *testing.T) {
+		setenv(t, "APP_DB_PASSWORD_FILE", writeFile(t, "db_password", "s3cret\n"))
+		setenv(t, "APP_JWT_SECRET_FILE", writeFile(t, "jwt_secret", "signing-secret"))
+
+		conf, err := config.Load("local.yml")
+		require.NoError(t, err)
+
+		assert.Equal(t, "s3cret", conf.DBPassword)
+		assert.Equal(t, "signing-secret", conf.JWTSecret)
+	})
+
+	t.Run("missing secret file", func(t *testing.T) {
+		setenv(t, "APP_DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+
+		_, err := config.Load("local.yml")
+
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("missing config file", func(t *testing.T) {
+		_, err := config.Load(filepath.Join(t.TempDir(), "missing.yml"))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		path := writeFile(t, "conf.yml", `
+api_port: "80800"
+db_type: "POSTGRES"
+db_port: 0
+country: "ESP"
+jwt_audience: ""
+idempotency_ttl: "0s"
+rate_limits:
+  default:
+    requests: -1
+`)
+
+		_, err := config.Load(path)
+
+		var validationErr *config.ValidationError
+		require.True(t, errors.As(err, &validationErr), err)
+		assert.Equal(t, []string{
+			`api_port must be a port between 1 and 65535, got "80800"`,
+			"db_host is required for POSTGRES",
+			"db_port must be a port between 1 and 65535, got 0",
+			"db_user is required for POSTGRES",
+			"db_name is required for POSTGRES",
+			"payment_provider FAKE charges nobody and can't be used with POSTGRES unless payment_provider_allow_fake is set",
+			`country must be an ISO 3166-1 alpha-2 code, got "ESP"`,
+			"jwt_secret or jwt_public_key_file is required",
+			"jwt_audience is required",
+			"idempotency_ttl must be positive, got 0s",
+			"rate_limits.default needs both requests and per, or neither, and none negative",
+		}, validationErr.Problems)
+	})
+}
+
+func TestValidate_Postgres(t *testing.T) {
+	conf, err := config.Load("local.yml")
+	require.NoError(t, err)
+
+	conf.DBType = "POSTGRES"
+	conf.DBDSN = "postgres://rides@db.internal/rides"
+	require.NoError(t, conf.Validate(), "the DSN replaces the connection fields")
+
+	conf.DBSSLMode = "prefer"
+	conf.DBSSLCert = "/etc/ssl/client.pem"
+	conf.DBMaxOpenConns = 5
+	conf.DBMaxIdleConns = 10
+	conf.DBStatementTimeout = -time.Second
+	err = conf.Validate()
+
+	var validationErr *config.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{
+		`db_ssl_mode must be disable, require, verify-ca or verify-full, got "prefer"`,
+		"db_ssl_cert and db_ssl_key go together",
+		"db_max_idle_conns can't be over db_max_open_conns, got 10 over 5",
+		"db_conn_max_lifetime, db_conn_max_idle_time and db_statement_timeout can't be negative",
+	}, validationErr.Problems)
+}
+
+func TestValidate_FakePaymentProvider(t *testing.T) {
+	conf, err := config.Load("local.yml")
+	require.NoError(t, err)
+	assert.True(t, conf.PaymentProviderAllowFake, "allowed for local runs")
+
+	conf.DBType = "POSTGRES"
+	conf.DBDSN = "postgres://rides@db.internal/rides"
+	conf.PaymentProviderAllowFake = false
+	err = conf.Validate()
+
+	var validationErr *config.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{"payment_provider FAKE charges nobody and can't be used with POSTGRES unless payment_provider_allow_fake is set"}, validationErr.Problems)
+}
+
+func TestValidate_DBType(t *testing.T) {
+	conf, err := config.Load("local.yml")
+	require.NoError(t, err)
+
+	conf.DBType = "MYSQL"
+	err = conf.Validate()
+
+	var validationErr *config.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{`db_type must be MEMORY, POSTGRES or SQLITE, got "MYSQL"`}, validationErr.Problems)
+}
+
+func TestValidate_PaymentProvider(t *testing.T) {
+	conf, err := config.Load("local.yml")
+	require.NoError(t, err)
+	assert.Equal(t, "FAKE", conf.PaymentProvider)
+
+	conf.PaymentProvider = "STRIPE"
+	err = conf.Validate()
+
+	var validationErr *config.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{`payment_provider must be FAKE, got "STRIPE"`}, validationErr.Problems)
+}
+
+func TestValidate_MemStore(t *testing.T) {
+	conf, err := config.Load("local.yml")
+	require.NoError(t, err)
+	require.NoError(t, conf.Validate(), "kept only in memory by default")
+
+	conf.DBMemPath = "rides.json"
+	require.NoError(t, conf.Validate())
+
+	conf.DBMemSync = "INTERVAL"
+	conf.DBMemSyncInterval = 0
+	err = conf.Validate()
+	var validationErr *config.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{"db_mem_sync_interval must be positive, got 0s"}, validationErr.Problems)
+
+	conf.DBMemSync = "SOMETIMES"
+	err = conf.Validate()
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{`db_mem_sync must be ALWAYS, INTERVAL or NEVER, got "SOMETIMES"`}, validationErr.Problems)
+
+	conf.DBMemSync = "ALWAYS"
+	assert.Equal(t, 10000, conf.DBMemCheckpointRecords)
+	assert.EqualValues(t, 64<<20, conf.DBMemCheckpointBytes)
+	conf.DBMemCheckpointRecords = -1
+	conf.DBMemCheckpointBytes = 0
+	err = conf.Validate()
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{"db_mem_checkpoint_records can't be negative, got -1"}, validationErr.Problems)
+}
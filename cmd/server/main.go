@@ -1,38 +1,112 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"reby/api"
 	"reby/api/handlers"
 	"reby/app/config"
+	"reby/pkg/lifecycle"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 func main() {
-	conf := config.Get()
+	os.Exit(run())
+}
+
+// run serves until it is signalled to stop and returns the exit code, once its deferred calls are done.
+func run() int {
+	configPath := flag.String("config", config.DefaultPath, "config file, empty to configure from the environment only")
+	flag.Parse()
+
+	conf, err := config.Load(*configPath)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err = runMigrate(conf, args[1:]); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	lc := lifecycle.NewManager()
+	h := handlers.InitHandlers(conf, lc)
+
+	// The probes and the metrics are neither logged, rate limited nor authenticated
+	root := chi.NewRouter()
+	root.Use(api.JSONResponseMiddleware)
+	root.Use(api.RecovererMiddleware)
+	handlers.AddHealthEndpoints(root, h.Health)
+	handlers.AddMetricsEndpoints(root, h.Metrics)
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
-	r.Use(api.JSONResponseMiddleware)
-	r.Use(api.RecovererMiddleware)
-	h := handlers.InitHandlers(conf)
+	r.Use(h.RateLimit)
+	r.Use(h.Auth)
 
 	handlers.AddRideEndpoints(r, h.Ride)
+	handlers.AddAdminRideEndpoints(r, h.AdminRide)
+	handlers.AddWebhookEndpoints(r, h.Webhook)
+	handlers.AddWalletEndpoints(r, h.Wallet)
+	handlers.AddReceiptEndpoints(r, h.Receipt)
+	handlers.AddAPIKeyEndpoints(r, h.APIKey)
+	root.Mount("/", r)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	lc.Start(ctx)
 
 	server := &http.Server{
 		ReadTimeout:       3 * time.Second,
 		WriteTimeout:      6 * time.Second,
 		Addr:              fmt.Sprintf("%s:%s", conf.APIURL, conf.APIPort),
 		ReadHeaderTimeout: 3 * time.Second,
-		Handler:           r,
+		Handler:           root,
 	}
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed && err != nil {
-		log.Fatalf("Error starting http server <%s>", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error starting http server <%s>", err)
+			exitCode = 1
+		}
+	case <-ctx.Done():
+		log.Printf("Shutting down, draining for up to %s", conf.ShutdownTimeout)
 	}
+	stop()
+	h.Health.Readiness.Drain()
+
+	// In-flight requests finish before the workers stop and the database is closed under them
+	drainCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(drainCtx); err != nil {
+		log.Printf("Error shutting down http server <%s>", err)
+		exitCode = 1
+	}
+	if err := lc.Stop(drainCtx); err != nil {
+		log.Printf("Error stopping background workers <%s>", err)
+		exitCode = 1
+	}
+
+	return exitCode
 }
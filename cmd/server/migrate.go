@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"reby/app/config"
+	"reby/infra"
+	"reby/infra/migrate"
+	"reby/infra/pg"
+	"reby/infra/sqlite"
+)
+
+var (
+	errMigrateUsage = errors.New("usage: migrate up | down [steps] | status")
+	errNotMigrated  = errors.New("only the POSTGRES and SQLITE backends are migrated")
+)
+
+// runMigrate runs the migrate command against the configured database:
+//
+//	migrate up            applies the pending migrations
+//	migrate down [steps]  reverts the last steps migrations, 1 by default
+//	migrate status        lists the migrations and when they were applied
+func runMigrate(conf *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	var db *sql.DB
+	var migrator *migrate.Migrator
+	var err error
+	switch conf.DBType {
+	case infra.Postgres:
+		db = pg.Open(conf)
+		migrator, err = pg.NewMigrator(db)
+	case infra.SQLite:
+		if db, err = sqlite.Open(conf.DBPath); err != nil {
+			return err
+		}
+		migrator, err = sqlite.NewMigrator(db)
+	default:
+		return errNotMigrated
+	}
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errMigrateUsage
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return errMigrateUsage
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("ERR_API_KEY_NOT_FOUND")
+	ErrInvalidKey    = errors.New("ERR_INVALID_API_KEY")
+	ErrInvalidParams = errors.New("ERR_INVALID_API_KEY_PARAMS")
+	ErrRevoked       = errors.New("ERR_API_KEY_REVOKED")
+	// ErrAlreadyRotated is returned when rotating a key that was already rotated, its replacement is the one to rotate.
+	ErrAlreadyRotated = errors.New("ERR_API_KEY_ALREADY_ROTATED")
+)
+
+// Prefix starts every secret, so leaked keys are easy to recognise by secret scanners.
+const Prefix = "rk_"
+
+// Scope is what a key is allowed to do.
+type Scope string
+
+const (
+	// ScopeRidesWrite starts and finishes rides for the users of the partner.
+	ScopeRidesWrite Scope = "RIDES_WRITE"
+	// ScopeReceiptsRead gets the receipts of the rides, for the expense reports of the partner.
+	ScopeReceiptsRead Scope = "RECEIPTS_READ"
+	// ScopeWebhooksManage subscribes to the events of the rides of the partner.
+	ScopeWebhooksManage Scope = "WEBHOOKS_MANAGE"
+)
+
+func (s Scope) IsValid() bool {
+	switch s {
+	case ScopeRidesWrite, ScopeReceiptsRead, ScopeWebhooksManage:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIKey authenticates the server-to-server calls of a partner organisation. Only the hash of the secret is stored.
+type APIKey struct {
+	ID        string  `json:"id"`
+	PartnerID string  `json:"partner_id"`
+	Name      string  `json:"name"`
+	Scopes    []Scope `json:"scopes"`
+	// Hint is the start of the secret, to tell the keys of a partner apart.
+	Hint       string     `json:"hint"`
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// ExpiresAt is set on rotated keys, which keep working for a grace period.
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// HasScope tells whether the key is allowed to do s.
+func (k *APIKey) HasScope(s Scope) bool {
+	for _, scope := range k.Scopes {
+		if scope == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsActive tells whether the key authenticates calls at t.
+func (k *APIKey) IsActive(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// Hash returns the stored form of a secret. Secrets are long and random, so a plain SHA-256 is enough.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func hint(secret string) string {
+	return secret[:len(Prefix)+6]
+}
+
+func hasPrefix(secret string) bool {
+	return strings.HasPrefix(secret, Prefix) && len(secret) > len(Prefix)+6
+}
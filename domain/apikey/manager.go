@@ -0,0 +1,223 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// lastUsedResolution limits the writes of the last-used timestamp to one per key and minute.
+const lastUsedResolution = time.Minute
+
+// Manager handles the API keys of the partners and authenticates their calls.
+type Manager interface {
+	Create(ctx context.Context, params CreateParams) (*Issued, error)
+	List(ctx context.Context, partnerID string) ([]*APIKey, error)
+	// Rotate issues a new key with the same scopes. The old one keeps working for the grace period, and can't be
+	// rotated again.
+	Rotate(ctx context.Context, id string) (*Issued, error)
+	Revoke(ctx context.Context, id string) (*APIKey, error)
+	// Authenticate returns the active key of secret, or ErrInvalidKey.
+	Authenticate(ctx context.Context, secret string) (*APIKey, error)
+}
+
+type CreateParams struct {
+	PartnerID string
+	Name      string
+	Scopes    []Scope
+}
+
+// Issued is a new key together with its secret, which is not stored and can only be read here.
+type Issued struct {
+	*APIKey
+	Secret string `json:"secret"`
+}
+
+type manager struct {
+	repo            Repo
+	txManager       txn.Manager
+	idGenerator     id.Generator
+	secretGenerator id.Generator
+	time            timenow.TimeNow
+	rotationGrace   time.Duration
+}
+
+func NewManager(
+	repo Repo,
+	txManager txn.Manager,
+	idGenerator id.Generator,
+	secretGenerator id.Generator,
+	time timenow.TimeNow,
+	rotationGrace time.Duration,
+) Manager {
+	return &manager{
+		repo:            repo,
+		txManager:       txManager,
+		idGenerator:     idGenerator,
+		secretGenerator: secretGenerator,
+		time:            time,
+		rotationGrace:   rotationGrace,
+	}
+}
+
+func (m *manager) Create(ctx context.Context, params CreateParams) (*Issued, error) {
+	if params.PartnerID == "" || len(params.Scopes) == 0 {
+		return nil, ErrInvalidParams
+	}
+	for _, s := range params.Scopes {
+		if !s.IsValid() {
+			return nil, ErrInvalidParams
+		}
+	}
+
+	return m.issue(ctx, params)
+}
+
+func (m *manager) List(ctx context.Context, partnerID string) ([]*APIKey, error) {
+	return m.repo.ListByPartner(ctx, partnerID)
+}
+
+// Rotate issues the new key and shortens the old one in a unit of work, so a key is rotated once and a failure leaves
+// no key behind.
+func (m *manager) Rotate(ctx context.Context, id string) (*Issued, error) {
+	var issued *Issued
+	err := m.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		issued, err = m.rotate(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+func (m *manager) rotate(ctx context.Context, id string) (*Issued, error) {
+	old, err := m.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := m.time.Now()
+	if !old.IsActive(now) {
+		return nil, ErrRevoked
+	}
+	if old.ExpiresAt != nil {
+		return nil, ErrAlreadyRotated
+	}
+
+	issued, err := m.issue(ctx, CreateParams{PartnerID: old.PartnerID, Name: old.Name, Scopes: old.Scopes})
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(m.rotationGrace)
+	old.ExpiresAt = &expiresAt
+	if err = m.repo.Update(ctx, old); err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+func (m *manager) Revoke(ctx context.Context, id string) (*APIKey, error) {
+	k, err := m.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if k.RevokedAt != nil {
+		return k, nil
+	}
+
+	now := m.time.Now()
+	k.RevokedAt = &now
+	if err = m.repo.Update(ctx, k); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (m *manager) Authenticate(ctx context.Context, secret string) (*APIKey, error) {
+	if !hasPrefix(secret) {
+		return nil, ErrInvalidKey
+	}
+
+	k, err := m.repo.GetByHash(ctx, Hash(secret))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+	now := m.time.Now()
+	if !k.IsActive(now) {
+		return nil, ErrInvalidKey
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedResolution {
+		// Best effort, a missed last-used timestamp must not fail the call of the partner
+		if err = m.repo.Touch(ctx, k.ID, now); err == nil {
+			k.LastUsedAt = &now
+		}
+	}
+
+	return k, nil
+}
+
+func (m *manager) issue(ctx context.Context, params CreateParams) (*Issued, error) {
+	secret := Prefix + m.secretGenerator.Generate()
+	k := &APIKey{
+		ID:        m.idGenerator.Generate(),
+		PartnerID: params.PartnerID,
+		Name:      params.Name,
+		Scopes:    params.Scopes,
+		Hint:      hint(secret),
+		Hash:      Hash(secret),
+		CreatedAt: m.time.Now(),
+	}
+	if err := m.repo.Create(ctx, k); err != nil {
+		return nil, err
+	}
+
+	return &Issued{APIKey: k, Secret: secret}, nil
+}
+
+type ManagerMock struct {
+	mock.Mock
+}
+
+func NewManagerMock() *ManagerMock {
+	return new(ManagerMock)
+}
+
+func (m *ManagerMock) Create(_ context.Context, params CreateParams) (*Issued, error) {
+	args := m.Mock.Called(params)
+	return args.Get(0).(*Issued), args.Error(1)
+}
+
+func (m *ManagerMock) List(_ context.Context, partnerID string) ([]*APIKey, error) {
+	args := m.Mock.Called(partnerID)
+	return args.Get(0).([]*APIKey), args.Error(1)
+}
+
+func (m *ManagerMock) Rotate(_ context.Context, id string) (*Issued, error) {
+	args := m.Mock.Called(id)
+	return args.Get(0).(*Issued), args.Error(1)
+}
+
+func (m *ManagerMock) Revoke(_ context.Context, id string) (*APIKey, error) {
+	args := m.Mock.Called(id)
+	return args.Get(0).(*APIKey), args.Error(1)
+}
+
+func (m *ManagerMock) Authenticate(_ context.Context, secret string) (*APIKey, error) {
+	args := m.Mock.Called(secret)
+	return args.Get(0).(*APIKey), args.Error(1)
+}
@@ -0,0 +1,248 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "rk_0123456789abcdef"
+
+func TestCreate(t *testing.T) {
+	var repoMock *apikey.RepoMock
+	var manager apikey.Manager
+	fixedTime := timenow.NewFixedTime(time.Now())
+	ctx := context.Background()
+
+	setup := func() {
+		repoMock = apikey.NewRepoMock()
+		idGenMock := id.NewGeneratorMock()
+		idGenMock.On("Generate").Return("k_1")
+		secretGenMock := id.NewGeneratorMock()
+		secretGenMock.On("Generate").Return(strings.TrimPrefix(secret, apikey.Prefix))
+		manager = apikey.NewManager(repoMock, txn.NewMemoryManager(), idGenMock, secretGenMock, fixedTime, time.Hour)
+	}
+
+	testCases := []struct {
+		description string
+		params      apikey.CreateParams
+		expectedErr error
+	}{
+		{
+			description: "ok",
+			params:      apikey.CreateParams{PartnerID: "p_1", Name: "expenses", Scopes: []apikey.Scope{apikey.ScopeRidesWrite}},
+		},
+		{
+			description: "without partner",
+			params:      apikey.CreateParams{Scopes: []apikey.Scope{apikey.ScopeRidesWrite}},
+			expectedErr: apikey.ErrInvalidParams,
+		},
+		{
+			description: "without scopes",
+			params:      apikey.CreateParams{PartnerID: "p_1"},
+			expectedErr: apikey.ErrInvalidParams,
+		},
+		{
+			description: "unknown scope",
+			params:      apikey.CreateParams{PartnerID: "p_1", Scopes: []apikey.Scope{"EVERYTHING"}},
+			expectedErr: apikey.ErrInvalidParams,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			repoMock.On("Create", mock.Anything).Return(nil)
+
+			issued, err := manager.Create(ctx, tc.params)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if tc.expectedErr != nil {
+				repoMock.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+
+			assert.Equal(t, secret, issued.Secret)
+			stored := repoMock.Calls[0].Arguments.Get(0).(*apikey.APIKey)
+			assert.Equal(t, "k_1", stored.ID)
+			assert.Equal(t, "p_1", stored.PartnerID)
+			assert.Equal(t, apikey.Hash(secret), stored.Hash)
+			assert.NotContains(t, stored.Hint+stored.Hash, secret)
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	var repoMock *apikey.RepoMock
+	var manager apikey.Manager
+	fixedTime := timenow.NewFixedTime(time.Now())
+	now := fixedTime.Now()
+	ctx := context.Background()
+
+	setup := func() {
+		repoMock = apikey.NewRepoMock()
+		idGenMock := id.NewGeneratorMock()
+		idGenMock.On("Generate").Return("k_2")
+		secretGenMock := id.NewGeneratorMock()
+		secretGenMock.On("Generate").Return(strings.TrimPrefix(secret, apikey.Prefix))
+		manager = apikey.NewManager(repoMock, txn.NewMemoryManager(), idGenMock, secretGenMock, fixedTime, time.Hour)
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		old := &apikey.APIKey{ID: "k_1", PartnerID: "p_1", Name: "expenses", Scopes: []apikey.Scope{apikey.ScopeRidesWrite}}
+		repoMock.On("GetByID", "k_1").Return(old, nil)
+		repoMock.On("Create", mock.Anything).Return(nil)
+		repoMock.On("Update", mock.Anything).Return(nil)
+
+		issued, err := manager.Rotate(ctx, "k_1")
+		require.NoError(t, err)
+		assert.Equal(t, "k_2", issued.ID)
+		assert.Equal(t, "p_1", issued.PartnerID)
+		assert.Equal(t, old.Scopes, issued.Scopes)
+
+		expiresAt := now.Add(time.Hour)
+		assert.Equal(t, &expiresAt, old.ExpiresAt)
+		assert.True(t, old.IsActive(now), "rotated keys keep working during the grace period")
+		assert.False(t, old.IsActive(expiresAt))
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		setup()
+		repoMock.On("GetByID", "k_1").Return(&apikey.APIKey{ID: "k_1", RevokedAt: &now}, nil)
+
+		_, err := manager.Rotate(ctx, "k_1")
+		assert.ErrorIs(t, err, apikey.ErrRevoked)
+		repoMock.AssertNotCalled(t, "Create", mock.Anything)
+	})
+
+	t.Run("already rotated", func(t *testing.T) {
+		setup()
+		expiresAt := now.Add(time.Minute)
+		repoMock.On("GetByID", "k_1").Return(&apikey.APIKey{ID: "k_1", ExpiresAt: &expiresAt}, nil)
+
+		_, err := manager.Rotate(ctx, "k_1")
+		assert.ErrorIs(t, err, apikey.ErrAlreadyRotated)
+		repoMock.AssertNotCalled(t, "Create", mock.Anything)
+		repoMock.AssertNotCalled(t, "Update", mock.Anything)
+	})
+}
+
+func TestRevoke(t *testing.T) {
+	repoMock := apikey.NewRepoMock()
+	fixedTime := timenow.NewFixedTime(time.Now())
+	now := fixedTime.Now()
+	manager := apikey.NewManager(repoMock, txn.NewMemoryManager(), id.NewGeneratorMock(), id.NewGeneratorMock(), fixedTime, time.Hour)
+
+	repoMock.On("GetByID", "k_1").Return(&apikey.APIKey{ID: "k_1"}, nil)
+	repoMock.On("Update", mock.Anything).Return(nil)
+
+	k, err := manager.Revoke(context.Background(), "k_1")
+	require.NoError(t, err)
+	assert.Equal(t, &now, k.RevokedAt)
+	assert.False(t, k.IsActive(now))
+}
+
+func TestAuthenticate(t *testing.T) {
+	var repoMock *apikey.RepoMock
+	var manager apikey.Manager
+	fixedTime := timenow.NewFixedTime(time.Now())
+	now := fixedTime.Now()
+	ctx := context.Background()
+	recently := now.Add(-time.Second)
+	longAgo := now.Add(-time.Hour)
+	expired := now.Add(-time.Minute)
+
+	setup := func() {
+		repoMock = apikey.NewRepoMock()
+		manager = apikey.NewManager(repoMock, txn.NewMemoryManager(), id.NewGeneratorMock(), id.NewGeneratorMock(), fixedTime, time.Hour)
+	}
+
+	testCases := []struct {
+		description   string
+		secret        string
+		key           *apikey.APIKey
+		repoErr       error
+		expectedErr   error
+		expectedTouch bool
+	}{
+		{
+			description:   "first use",
+			secret:        secret,
+			key:           &apikey.APIKey{ID: "k_1"},
+			expectedTouch: true,
+		},
+		{
+			description:   "used long ago",
+			secret:        secret,
+			key:           &apikey.APIKey{ID: "k_1", LastUsedAt: &longAgo},
+			expectedTouch: true,
+		},
+		{
+			description: "used recently",
+			secret:      secret,
+			key:         &apikey.APIKey{ID: "k_1", LastUsedAt: &recently},
+		},
+		{
+			description: "not a key",
+			secret:      "Bearer abc",
+			expectedErr: apikey.ErrInvalidKey,
+		},
+		{
+			description: "unknown",
+			secret:      secret,
+			repoErr:     apikey.ErrNotFound,
+			expectedErr: apikey.ErrInvalidKey,
+		},
+		{
+			description: "revoked",
+			secret:      secret,
+			key:         &apikey.APIKey{ID: "k_1", RevokedAt: &recently},
+			expectedErr: apikey.ErrInvalidKey,
+		},
+		{
+			description: "rotated and expired",
+			secret:      secret,
+			key:         &apikey.APIKey{ID: "k_1", ExpiresAt: &expired},
+			expectedErr: apikey.ErrInvalidKey,
+		},
+		{
+			description: "repo error",
+			secret:      secret,
+			repoErr:     errors.New("ERR_RANDOM"),
+			expectedErr: errors.New("ERR_RANDOM"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			repoMock.On("GetByHash", apikey.Hash(tc.secret)).Return(tc.key, tc.repoErr)
+			repoMock.On("Touch", "k_1", now).Return(nil)
+
+			k, err := manager.Authenticate(ctx, tc.secret)
+			if tc.expectedErr != nil {
+				assert.EqualError(t, err, tc.expectedErr.Error())
+				assert.Nil(t, k)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "k_1", k.ID)
+			if tc.expectedTouch {
+				repoMock.AssertCalled(t, "Touch", "k_1", now)
+				assert.Equal(t, &now, k.LastUsedAt)
+			} else {
+				repoMock.AssertNotCalled(t, "Touch", "k_1", now)
+			}
+		})
+	}
+}
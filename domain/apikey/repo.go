@@ -0,0 +1,56 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type Repo interface {
+	Create(ctx context.Context, k *APIKey) error
+	GetByID(ctx context.Context, id string) (*APIKey, error)
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	ListByPartner(ctx context.Context, partnerID string) ([]*APIKey, error)
+	Update(ctx context.Context, k *APIKey) error
+	// Touch sets the last time the key was used.
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+type RepoMock struct {
+	mock.Mock
+}
+
+func NewRepoMock() *RepoMock {
+	return new(RepoMock)
+}
+
+func (m *RepoMock) Create(_ context.Context, k *APIKey) error {
+	args := m.Mock.Called(k)
+	return args.Error(0)
+}
+
+func (m *RepoMock) GetByID(_ context.Context, id string) (*APIKey, error) {
+	args := m.Mock.Called(id)
+	return args.Get(0).(*APIKey), args.Error(1)
+}
+
+func (m *RepoMock) GetByHash(_ context.Context, hash string) (*APIKey, error) {
+	args := m.Mock.Called(hash)
+	return args.Get(0).(*APIKey), args.Error(1)
+}
+
+func (m *RepoMock) ListByPartner(_ context.Context, partnerID string) ([]*APIKey, error) {
+	args := m.Mock.Called(partnerID)
+	return args.Get(0).([]*APIKey), args.Error(1)
+}
+
+func (m *RepoMock) Update(_ context.Context, k *APIKey) error {
+	args := m.Mock.Called(k)
+	return args.Error(0)
+}
+
+func (m *RepoMock) Touch(_ context.Context, id string, at time.Time) error {
+	args := m.Mock.Called(id, at)
+	return args.Error(0)
+}
@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"reby/domain/money"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	ErrDeclined                    = errors.New("ERR_PAYMENT_DECLINED")
+	ErrAuthorizationNotFound       = errors.New("ERR_PAYMENT_AUTHORIZATION_NOT_FOUND")
+	ErrInvalidOperation            = errors.New("ERR_PAYMENT_INVALID_OPERATION")
+	ErrRefundExceedsCapture        = errors.New("ERR_PAYMENT_REFUND_EXCEEDS_CAPTURE")
+	ErrCaptureExceedsAuthorization = errors.New("ERR_PAYMENT_CAPTURE_EXCEEDS_AUTHORIZATION")
+)
+
+// Method the user pays with.
+type Method string
+
+const (
+	MethodCard   Method = "CARD"
+	MethodWallet Method = "WALLET"
+)
+
+// Status of the payment of a ride.
+type Status string
+
+const (
+	StatusAuthorized Status = "AUTHORIZED"
+	StatusCaptured   Status = "CAPTURED"
+	// StatusFailed payments could not be captured. Their amount is owed by the user.
+	StatusFailed   Status = "FAILED"
+	StatusVoided   Status = "VOIDED"
+	StatusRefunded Status = "REFUNDED"
+)
+
+// Provider charges users through an external payment provider.
+type Provider interface {
+	// Authorize places a hold of amount on the payment method of the user and returns the authorization reference.
+	// Retrying with the same idempotencyKey returns the authorization placed before, unless it was voided. An empty
+	// idempotencyKey places a new hold every time.
+	Authorize(ctx context.Context, userID string, amount money.Money, idempotencyKey string) (string, error)
+	// Capture charges amount against an authorization. It can't charge more than the authorized amount.
+	Capture(ctx context.Context, authorizationID string, amount money.Money) error
+	// Void releases an authorization that will not be captured.
+	Void(ctx context.Context, authorizationID string) error
+	// Refund gives back up to the captured amount of an authorization. Retrying a refund with the same refundID gives
+	// the amount back only once.
+	Refund(ctx context.Context, authorizationID string, refundID string, amount money.Money) error
+}
+
+type ProviderMock struct {
+	mock.Mock
+}
+
+func NewProviderMock() *ProviderMock {
+	return new(ProviderMock)
+}
+
+func (m *ProviderMock) Authorize(_ context.Context, userID string, amount money.Money, idempotencyKey string) (string, error) {
+	args := m.Mock.Called(userID, amount, idempotencyKey)
+	return args.String(0), args.Error(1)
+}
+
+func (m *ProviderMock) Capture(_ context.Context, authorizationID string, amount money.Money) error {
+	args := m.Mock.Called(authorizationID, amount)
+	return args.Error(0)
+}
+
+func (m *ProviderMock) Void(_ context.Context, authorizationID string) error {
+	args := m.Mock.Called(authorizationID)
+	return args.Error(0)
+}
+
+func (m *ProviderMock) Refund(_ context.Context, authorizationID string, refundID string, amount money.Money) error {
+	args := m.Mock.Called(authorizationID, refundID, amount)
+	return args.Error(0)
+}
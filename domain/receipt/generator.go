@@ -0,0 +1,151 @@
+package receipt
+
+import (
+	"context"
+	"math"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Generator builds the receipt of a paid ride, issuing its number the first time it is requested. Finished rides
+// whose payment failed get no receipt until their debt is settled.
+type Generator interface {
+	Generate(ctx context.Context, params GenerateParams) (*Receipt, error)
+}
+
+type GenerateParams struct {
+	RideID string
+	// UserID restricts the receipts to the rides of this user when set.
+	UserID string
+	// PartnerID restricts the receipts to the rides started by this partner when set.
+	PartnerID string
+}
+
+type generator struct {
+	rideRepo    ride.Repo
+	repo        Repo
+	time        timenow.TimeNow
+	unlockValue int
+	minuteValue int
+	// defaultCountry is the country of the rides that don't have one.
+	defaultCountry string
+}
+
+// NewGenerator returns a Generator of receipts itemized with the same unlock and minute values used to price the rides.
+// The receipts are numbered and taxed for the country of the ride, or defaultCountry for the rides started before
+// their vehicles had one.
+func NewGenerator(
+	rideRepo ride.Repo,
+	repo Repo,
+	time timenow.TimeNow,
+	defaultCountry string,
+	unlockValue int,
+	minuteValue int,
+) Generator {
+	return &generator{
+		rideRepo:       rideRepo,
+		repo:           repo,
+		time:           time,
+		defaultCountry: defaultCountry,
+		unlockValue:    unlockValue,
+		minuteValue:    minuteValue,
+	}
+}
+
+func (g *generator) Generate(ctx context.Context, params GenerateParams) (*Receipt, error) {
+	r, err := g.rideRepo.GetByID(ctx, params.RideID)
+	if err != nil {
+		return nil, err
+	}
+	if (params.UserID != "" && r.UserID != params.UserID) || (params.PartnerID != "" && r.PartnerID != params.PartnerID) {
+		return nil, ride.ErrNotRideOwner
+	}
+	if (r.Status != ride.StatusFinished && r.Status != ride.StatusPaid) || r.Price == nil || r.FinishedAt == nil {
+		return nil, ErrRideNotFinished
+	}
+	if r.Status != ride.StatusPaid && (r.Payment == nil || r.Payment.Status != payment.StatusCaptured) {
+		return nil, ErrRideNotPaid
+	}
+
+	country := r.Country
+	if country == "" {
+		country = g.defaultCountry
+	}
+	rate, ok := TaxRates[country]
+	if !ok {
+		return nil, ErrUnsupportedCountry
+	}
+
+	issuance, err := g.repo.Issue(ctx, r.ID, country, g.time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	total := r.Charged()
+	subtotal, tax := splitTax(total, rate)
+
+	return &Receipt{
+		Number:     issuance.Number(),
+		Country:    issuance.Country,
+		RideID:     r.ID,
+		UserID:     r.UserID,
+		IssuedAt:   issuance.IssuedAt,
+		StartedAt:  r.StartedAt,
+		FinishedAt: *r.FinishedAt,
+		Lines:      g.lines(r),
+		TaxRate:    rate,
+		Subtotal:   subtotal,
+		Tax:        tax,
+		Total:      total,
+	}, nil
+}
+
+// lines itemizes the price of the ride and its adjustments.
+func (g *generator) lines(r *ride.Ride) []Line {
+	currency := r.Price.Currency.String()
+	minutes := int(math.Ceil(r.FinishedAt.Sub(r.StartedAt).Minutes()))
+
+	lines := []Line{
+		{
+			Description: "Unlock",
+			Quantity:    1,
+			UnitPrice:   money.NewMoney(g.unlockValue, currency),
+			Amount:      money.NewMoney(g.unlockValue, currency),
+		},
+		{
+			Description: "Riding minutes",
+			Quantity:    minutes,
+			UnitPrice:   money.NewMoney(g.minuteValue, currency),
+			// Whatever the price has on top of the unlock, so the lines always add up to it
+			Amount: money.NewMoney(r.Price.Value.Int()-g.unlockValue, currency),
+		},
+	}
+	for _, a := range r.Adjustments {
+		lines = append(lines, Line{
+			Description: "Refund: " + a.Reason,
+			Quantity:    1,
+			UnitPrice:   money.Money{Value: -a.Amount.Value, Currency: a.Amount.Currency},
+			Amount:      money.Money{Value: -a.Amount.Value, Currency: a.Amount.Currency},
+		})
+	}
+
+	return lines
+}
+
+type GeneratorMock struct {
+	mock.Mock
+}
+
+func NewGeneratorMock() *GeneratorMock {
+	return new(GeneratorMock)
+}
+
+func (m *GeneratorMock) Generate(_ context.Context, params GenerateParams) (*Receipt, error) {
+	args := m.Mock.Called(params)
+	return args.Get(0).(*Receipt), args.Error(1)
+}
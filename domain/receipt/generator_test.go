@@ -0,0 +1,179 @@
+package receipt_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	var rideRepoMock *ride.RepoMock
+	var repoMock *receipt.RepoMock
+	var generator receipt.Generator
+	fixedTime := timenow.NewFixedTime(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+	now := fixedTime.Now()
+	ctx := context.Background()
+	rideID := "r_1"
+
+	setup := func(country string) {
+		rideRepoMock = ride.NewRepoMock()
+		repoMock = receipt.NewRepoMock()
+		generator = receipt.NewGenerator(rideRepoMock, repoMock, fixedTime, country, 100, 18)
+	}
+
+	finishedAt := now.Add(-time.Hour)
+	// 100 unlock + 10 minutes at 18
+	price := money.NewMoney(280, "EUR")
+	paidRide := &ride.Ride{
+		ID:         rideID,
+		UserID:     "u_1",
+		Status:     ride.StatusPaid,
+		StartedAt:  finishedAt.Add(-9*time.Minute - 30*time.Second),
+		FinishedAt: &finishedAt,
+		Price:      &price,
+		Adjustments: []ride.Adjustment{
+			{ID: "a_1", Amount: money.NewMoney(38, "EUR"), Reason: "bumpy ride", Actor: ride.ActorOperator},
+		},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup("ES")
+		rideRepoMock.On("GetByID", rideID).Return(paidRide, nil)
+		repoMock.On("Issue", rideID, "ES", now).Return(&receipt.Issuance{
+			RideID: rideID, Country: "ES", Sequence: 42, IssuedAt: now,
+		}, nil)
+
+		rec, err := generator.Generate(ctx, receipt.GenerateParams{RideID: rideID})
+		require.NoError(t, err)
+		assert.Equal(t, "ES-00000042", rec.Number)
+		assert.Equal(t, []receipt.Line{
+			{Description: "Unlock", Quantity: 1, UnitPrice: money.NewMoney(100, "EUR"), Amount: money.NewMoney(100, "EUR")},
+			{Description: "Riding minutes", Quantity: 10, UnitPrice: money.NewMoney(18, "EUR"), Amount: money.NewMoney(180, "EUR")},
+			{Description: "Refund: bumpy ride", Quantity: 1, UnitPrice: money.NewMoney(-38, "EUR"), Amount: money.NewMoney(-38, "EUR")},
+		}, rec.Lines)
+		assert.Equal(t, 2100, rec.TaxRate)
+		// 242 with 21% VAT included is 200 + 42
+		assert.Equal(t, money.NewMoney(242, "EUR"), rec.Total)
+		assert.Equal(t, money.NewMoney(200, "EUR"), rec.Subtotal)
+		assert.Equal(t, money.NewMoney(42, "EUR"), rec.Tax)
+
+		var buf bytes.Buffer
+		require.NoError(t, rec.WriteHTML(&buf))
+		assert.Contains(t, buf.String(), "Receipt ES-00000042")
+		assert.Contains(t, buf.String(), "-0.38 EUR")
+		assert.Contains(t, buf.String(), "VAT 21%")
+	})
+
+	t.Run("ride not finished", func(t *testing.T) {
+		setup("ES")
+		rideRepoMock.On("GetByID", rideID).Return(&ride.Ride{ID: rideID, Status: ride.StatusActive}, nil)
+
+		_, err := generator.Generate(ctx, receipt.GenerateParams{RideID: rideID})
+		assert.ErrorIs(t, err, receipt.ErrRideNotFinished)
+		repoMock.AssertNotCalled(t, "Issue", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("ride not paid", func(t *testing.T) {
+		testCases := []struct {
+			description string
+			payment     *ride.Payment
+		}{
+			{description: "capture failed", payment: &ride.Payment{Method: payment.MethodCard, Status: payment.StatusFailed}},
+			{description: "capture pending", payment: &ride.Payment{Method: payment.MethodCard, Status: payment.StatusAuthorized}},
+			{description: "no payment"},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.description, func(t *testing.T) {
+				setup("ES")
+				unpaidRide := *paidRide
+				unpaidRide.Status = ride.StatusFinished
+				unpaidRide.Payment = tc.payment
+				rideRepoMock.On("GetByID", rideID).Return(&unpaidRide, nil)
+
+				_, err := generator.Generate(ctx, receipt.GenerateParams{RideID: rideID})
+				assert.ErrorIs(t, err, receipt.ErrRideNotPaid)
+				repoMock.AssertNotCalled(t, "Issue", mock.Anything, mock.Anything, mock.Anything)
+			})
+		}
+	})
+
+	t.Run("finished with the payment captured", func(t *testing.T) {
+		setup("ES")
+		capturedRide := *paidRide
+		capturedRide.Status = ride.StatusFinished
+		capturedRide.Payment = &ride.Payment{Method: payment.MethodCard, Status: payment.StatusCaptured}
+		rideRepoMock.On("GetByID", rideID).Return(&capturedRide, nil)
+		repoMock.On("Issue", rideID, "ES", now).Return(&receipt.Issuance{
+			RideID: rideID, Country: "ES", Sequence: 43, IssuedAt: now,
+		}, nil)
+
+		rec, err := generator.Generate(ctx, receipt.GenerateParams{RideID: rideID})
+		require.NoError(t, err)
+		assert.Equal(t, "ES-00000043", rec.Number)
+	})
+
+	t.Run("ride not found", func(t *testing.T) {
+		setup("ES")
+		rideRepoMock.On("GetByID", rideID).Return(&ride.Ride{}, ride.ErrNotFound)
+
+		_, err := generator.Generate(ctx, receipt.GenerateParams{RideID: rideID})
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+	})
+
+	t.Run("country of the ride", func(t *testing.T) {
+		setup("ES")
+		frenchRide := *paidRide
+		frenchRide.Country = "FR"
+		rideRepoMock.On("GetByID", rideID).Return(&frenchRide, nil)
+		repoMock.On("Issue", rideID, "FR", now).Return(&receipt.Issuance{
+			RideID: rideID, Country: "FR", Sequence: 7, IssuedAt: now,
+		}, nil)
+
+		rec, err := generator.Generate(ctx, receipt.GenerateParams{RideID: rideID})
+		require.NoError(t, err)
+		assert.Equal(t, "FR-00000007", rec.Number)
+		assert.Equal(t, 2000, rec.TaxRate)
+	})
+
+	t.Run("someone else's ride", func(t *testing.T) {
+		testCases := []struct {
+			description string
+			params      receipt.GenerateParams
+		}{
+			{description: "other user", params: receipt.GenerateParams{RideID: rideID, UserID: "u_2"}},
+			{description: "other partner", params: receipt.GenerateParams{RideID: rideID, PartnerID: "p_2"}},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.description, func(t *testing.T) {
+				setup("ES")
+				partnerRide := *paidRide
+				partnerRide.PartnerID = "p_1"
+				rideRepoMock.On("GetByID", rideID).Return(&partnerRide, nil)
+
+				_, err := generator.Generate(ctx, tc.params)
+				assert.ErrorIs(t, err, ride.ErrNotRideOwner)
+				repoMock.AssertNotCalled(t, "Issue", mock.Anything, mock.Anything, mock.Anything)
+			})
+		}
+	})
+
+	t.Run("unsupported country", func(t *testing.T) {
+		setup("XX")
+		rideRepoMock.On("GetByID", rideID).Return(paidRide, nil)
+
+		_, err := generator.Generate(ctx, receipt.GenerateParams{RideID: rideID})
+		assert.ErrorIs(t, err, receipt.ErrUnsupportedCountry)
+		repoMock.AssertNotCalled(t, "Issue", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,42 @@
+package receipt
+
+import (
+	_ "embed" // Receipt template
+	"fmt"
+	"html/template"
+	"io"
+
+	"reby/domain/money"
+)
+
+//go:embed receipt.html.tmpl
+var htmlTemplate string
+
+var receiptHTML = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"amount": formatAmount,
+	"rate":   formatRate,
+}).Parse(htmlTemplate))
+
+// WriteHTML renders the receipt as an HTML document.
+func (r *Receipt) WriteHTML(w io.Writer) error {
+	return receiptHTML.Execute(w, r)
+}
+
+// formatAmount formats cents as units, e.g. 1.50 EUR.
+func formatAmount(m money.Money) string {
+	v := m.Value.Int()
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, v/100, v%100, m.Currency)
+}
+
+// formatRate formats basis points as a percentage, e.g. 21%.
+func formatRate(rate int) string {
+	if rate%100 == 0 {
+		return fmt.Sprintf("%d%%", rate/100)
+	}
+	return fmt.Sprintf("%d.%02d%%", rate/100, rate%100)
+}
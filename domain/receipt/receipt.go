@@ -0,0 +1,71 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"reby/domain/money"
+)
+
+var (
+	ErrNotFound           = errors.New("ERR_RECEIPT_NOT_FOUND")
+	ErrRideNotFinished    = errors.New("ERR_RECEIPT_RIDE_NOT_FINISHED")
+	ErrRideNotPaid        = errors.New("ERR_RECEIPT_RIDE_NOT_PAID")
+	ErrUnsupportedCountry = errors.New("ERR_RECEIPT_UNSUPPORTED_COUNTRY")
+)
+
+// TaxRates are the VAT rates of the countries we operate in, in basis points.
+var TaxRates = map[string]int{
+	"ES": 2100,
+	"FR": 2000,
+	"IT": 2200,
+	"PT": 2300,
+	"DE": 1900,
+}
+
+// Issuance is the receipt number given to a ride. Numbers are sequential per country and never change once issued.
+type Issuance struct {
+	RideID   string
+	Country  string
+	Sequence int
+	IssuedAt time.Time
+}
+
+// Number formats the receipt number, e.g. ES-00000042.
+func (i Issuance) Number() string {
+	return fmt.Sprintf("%s-%08d", i.Country, i.Sequence)
+}
+
+// Line is an item of a receipt. Amounts include taxes, as the prices of the rides do.
+type Line struct {
+	Description string      `json:"description"`
+	Quantity    int         `json:"quantity"`
+	UnitPrice   money.Money `json:"unit_price"`
+	Amount      money.Money `json:"amount"`
+}
+
+type Receipt struct {
+	Number   string    `json:"number"`
+	Country  string    `json:"country"`
+	RideID   string    `json:"ride_id"`
+	UserID   string    `json:"user_id"`
+	IssuedAt time.Time `json:"issued_at"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	Lines []Line `json:"lines"`
+	// TaxRate in basis points.
+	TaxRate  int         `json:"tax_rate"`
+	Subtotal money.Money `json:"subtotal"`
+	Tax      money.Money `json:"tax"`
+	Total    money.Money `json:"total"`
+}
+
+// splitTax splits a tax-inclusive total into its net amount and tax, rounding the net amount to the nearest cent.
+func splitTax(total money.Money, rate int) (net money.Money, tax money.Money) {
+	netValue := (total.Value.Int()*10000 + (10000+rate)/2) / (10000 + rate)
+	return money.Money{Value: money.Value(netValue), Currency: total.Currency},
+		money.Money{Value: total.Value - money.Value(netValue), Currency: total.Currency}
+}
@@ -0,0 +1,28 @@
+package receipt
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Repo stores the receipt numbers of the rides.
+type Repo interface {
+	// Issue gives the next receipt number of country to a ride. When the ride already has one, that one is
+	// returned instead, so a ride never has two receipts.
+	Issue(ctx context.Context, rideID string, country string, at time.Time) (*Issuance, error)
+}
+
+type RepoMock struct {
+	mock.Mock
+}
+
+func NewRepoMock() *RepoMock {
+	return new(RepoMock)
+}
+
+func (m *RepoMock) Issue(_ context.Context, rideID string, country string, at time.Time) (*Issuance, error) {
+	args := m.Mock.Called(rideID, country, at)
+	return args.Get(0).(*Issuance), args.Error(1)
+}
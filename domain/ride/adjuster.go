@@ -0,0 +1,189 @@
+package ride
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	ErrInvalidAdjustParams = errors.New("ERR_INVALID_ADJUST_PARAMS")
+	ErrNotCharged          = errors.New("ERR_RIDE_NOT_CHARGED")
+	ErrRefundExceedsCharge = errors.New("ERR_REFUND_EXCEEDS_CHARGE")
+)
+
+// Adjustment is an amount given back to the user after the ride was charged, e.g. after a complaint.
+type Adjustment struct {
+	ID        string      `json:"id"`
+	Amount    money.Money `json:"amount"`
+	Reason    string      `json:"reason"`
+	Actor     Actor       `json:"actor"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Charged returns what the user effectively paid for the ride, the price minus its adjustments.
+func (r *Ride) Charged() money.Money {
+	if r.Price == nil {
+		return money.NewMoney(0, defaultPriceCurrency)
+	}
+
+	charged := *r.Price
+	for _, a := range r.Adjustments {
+		charged.Value -= a.Amount.Value
+	}
+
+	return charged
+}
+
+// MarshalJSON adds the effective charged amount to the ride.
+func (r Ride) MarshalJSON() ([]byte, error) {
+	type ride Ride
+	var charged *money.Money
+	if r.Price != nil {
+		c := r.Charged()
+		charged = &c
+	}
+
+	return json.Marshal(struct {
+		ride
+		Charged *money.Money `json:"charged"`
+	}{ride: ride(r), Charged: charged})
+}
+
+// Adjuster refunds fully or partially what was charged for a ride.
+type Adjuster interface {
+	Adjust(ctx context.Context, params AdjustParams) (*Ride, error)
+}
+
+// AdjustParams of a refund. Full refunds give back everything still charged and ignore Value.
+type AdjustParams struct {
+	RideID string
+	Value  int
+	Full   bool
+	Reason string
+	Actor  Actor
+}
+
+type adjuster struct {
+	rideRepo        Repo
+	txManager       txn.Manager
+	paymentProvider payment.Provider
+	idGenerator     id.Generator
+	time            timenow.TimeNow
+}
+
+func NewAdjuster(
+	rideRepo Repo,
+	txManager txn.Manager,
+	paymentProvider payment.Provider,
+	idGenerator id.Generator,
+	time timenow.TimeNow,
+) Adjuster {
+	return &adjuster{
+		rideRepo:        rideRepo,
+		txManager:       txManager,
+		paymentProvider: paymentProvider,
+		idGenerator:     idGenerator,
+		time:            time,
+	}
+}
+
+// Adjust refunds part of a paid ride, through the payment provider for card rides and to the wallet for wallet
+// rides. The price of the ride is kept, the refund is added to its adjustments.
+//
+// The ride is read and stored in a unit of work that locks it, so concurrent refunds can't give back more than was
+// charged. Card refunds are sent last in it, with the adjustment ID as idempotency key: a refund that fails rolls the
+// adjustment back, and only a failing commit can leave a refund unrecorded.
+func (a *adjuster) Adjust(ctx context.Context, params AdjustParams) (*Ride, error) {
+	if params.Reason == "" || !params.Actor.IsValid() || (!params.Full && params.Value <= 0) {
+		return nil, ErrInvalidAdjustParams
+	}
+
+	var adjusted *Ride
+	err := a.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		adjusted, err = a.adjust(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adjusted, nil
+}
+
+func (a *adjuster) adjust(ctx context.Context, params AdjustParams) (*Ride, error) {
+	r, err := a.rideRepo.GetByID(ctx, params.RideID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status != StatusPaid || r.Payment == nil {
+		return nil, ErrNotCharged
+	}
+
+	charged := r.Charged()
+	value := params.Value
+	if params.Full {
+		value = charged.Value.Int()
+	}
+	if value <= 0 || value > charged.Value.Int() {
+		return nil, ErrRefundExceedsCharge
+	}
+
+	adj := Adjustment{
+		ID:        a.idGenerator.Generate(),
+		Amount:    money.Money{Value: money.Value(value), Currency: charged.Currency},
+		Reason:    params.Reason,
+		Actor:     params.Actor,
+		CreatedAt: a.time.Now(),
+	}
+	if r.Payment.Method == payment.MethodWallet {
+		r.RefundWallet(adj)
+	}
+
+	r.Adjustments = append(r.Adjustments, adj)
+	if r.Charged().Value == 0 {
+		r.Payment.Status = payment.StatusRefunded
+	}
+	r.Record(EventRefunded, params.Actor, adj.CreatedAt, map[string]string{
+		"adjustment_id": adj.ID,
+		"value":         strconv.Itoa(value),
+		"currency":      adj.Amount.Currency.String(),
+		"reason":        adj.Reason,
+	})
+
+	adjusted, err := a.rideRepo.Update(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Payment.Method != payment.MethodWallet {
+		if err = a.paymentProvider.Refund(ctx, r.Payment.AuthorizationID, adj.ID, adj.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	return adjusted, nil
+}
+
+type AdjusterMock struct {
+	mock.Mock
+}
+
+func NewAdjusterMock() *AdjusterMock {
+	return new(AdjusterMock)
+}
+
+func (m *AdjusterMock) Adjust(_ context.Context, params AdjustParams) (*Ride, error) {
+	args := m.Mock.Called(params)
+	return args.Get(0).(*Ride), args.Error(1)
+}
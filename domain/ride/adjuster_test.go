@@ -0,0 +1,171 @@
+package ride_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/domain/wallet"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdjust(t *testing.T) {
+	var rideRepoMock *ride.RepoMock
+	var providerMock *payment.ProviderMock
+	var idGenMock *id.GeneratorMock
+	var adjuster ride.Adjuster
+	fixedTime := timenow.NewFixedTime(time.Now())
+	now := fixedTime.Now()
+	rideID := "r_1"
+	authID := "auth_1"
+	price := money.NewMoney(200, "EUR")
+	ctx := context.Background()
+
+	setup := func() {
+		rideRepoMock = ride.NewRepoMock()
+		providerMock = payment.NewProviderMock()
+		idGenMock = id.NewGeneratorMock()
+		adjuster = ride.NewAdjuster(rideRepoMock, txn.NewMemoryManager(), providerMock, idGenMock, fixedTime)
+
+		idGenMock.On("Generate").Return("a_2")
+	}
+
+	paidRide := func(method payment.Method) *ride.Ride {
+		return &ride.Ride{
+			ID:      rideID,
+			UserID:  "u_1",
+			Status:  ride.StatusPaid,
+			Price:   &price,
+			Payment: &ride.Payment{Method: method, AuthorizationID: authID, Status: payment.StatusCaptured},
+			Adjustments: []ride.Adjustment{
+				{ID: "a_1", Amount: money.NewMoney(50, "EUR"), Reason: "first complaint", Actor: ride.ActorOperator},
+			},
+		}
+	}
+
+	testCases := []struct {
+		description string
+		ride        *ride.Ride
+		params      ride.AdjustParams
+		expectedErr error
+	}{
+		{
+			description: "missing reason",
+			ride:        paidRide(payment.MethodCard),
+			params:      ride.AdjustParams{RideID: rideID, Value: 10, Actor: ride.ActorOperator},
+			expectedErr: ride.ErrInvalidAdjustParams,
+		},
+		{
+			description: "negative value",
+			ride:        paidRide(payment.MethodCard),
+			params:      ride.AdjustParams{RideID: rideID, Value: -10, Reason: "complaint", Actor: ride.ActorOperator},
+			expectedErr: ride.ErrInvalidAdjustParams,
+		},
+		{
+			description: "not charged",
+			ride:        &ride.Ride{ID: rideID, Status: ride.StatusFinished, Price: &price},
+			params:      ride.AdjustParams{RideID: rideID, Value: 10, Reason: "complaint", Actor: ride.ActorOperator},
+			expectedErr: ride.ErrNotCharged,
+		},
+		{
+			description: "refund exceeds what is left of the charge",
+			ride:        paidRide(payment.MethodCard),
+			params:      ride.AdjustParams{RideID: rideID, Value: 151, Reason: "complaint", Actor: ride.ActorOperator},
+			expectedErr: ride.ErrRefundExceedsCharge,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			rideRepoMock.On("GetByID", rideID).Return(tc.ride, nil)
+
+			_, err := adjuster.Adjust(ctx, tc.params)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			providerMock.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything, mock.Anything)
+			rideRepoMock.AssertNotCalled(t, "Update", mock.Anything)
+		})
+	}
+
+	t.Run("partial card refund", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(paidRide(payment.MethodCard), nil)
+		providerMock.On("Refund", authID, "a_2", money.NewMoney(100, "EUR")).Return(nil)
+		rideRepoMock.On("Update", mock.Anything).Return(&ride.Ride{}, nil)
+
+		_, err := adjuster.Adjust(ctx, ride.AdjustParams{
+			RideID: rideID, Value: 100, Reason: "complaint", Actor: ride.ActorOperator,
+		})
+		require.NoError(t, err)
+
+		updated := rideRepoMock.Calls[1].Arguments.Get(0).(*ride.Ride)
+		assert.Equal(t, price, *updated.Price)
+		assert.Equal(t, money.NewMoney(50, "EUR"), updated.Charged())
+		require.Len(t, updated.Adjustments, 2)
+		assert.Equal(t, ride.Adjustment{
+			ID:        "a_2",
+			Amount:    money.NewMoney(100, "EUR"),
+			Reason:    "complaint",
+			Actor:     ride.ActorOperator,
+			CreatedAt: now,
+		}, updated.Adjustments[1])
+		assert.Equal(t, payment.StatusCaptured, updated.Payment.Status)
+		assert.Nil(t, updated.PendingWalletTransaction())
+		require.Len(t, updated.PendingEvents(), 1)
+		assert.Equal(t, ride.EventRefunded, updated.PendingEvents()[0].Type)
+	})
+
+	t.Run("failed card refund isn't returned as stored", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(paidRide(payment.MethodCard), nil)
+		rideRepoMock.On("Update", mock.Anything).Return(&ride.Ride{}, nil)
+		providerMock.On("Refund", authID, "a_2", money.NewMoney(100, "EUR")).Return(payment.ErrInvalidOperation)
+
+		r, err := adjuster.Adjust(ctx, ride.AdjustParams{
+			RideID: rideID, Value: 100, Reason: "complaint", Actor: ride.ActorOperator,
+		})
+		assert.ErrorIs(t, err, payment.ErrInvalidOperation)
+		assert.Nil(t, r)
+	})
+
+	t.Run("full wallet refund", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(paidRide(payment.MethodWallet), nil)
+		rideRepoMock.On("Update", mock.Anything).Return(&ride.Ride{}, nil)
+
+		_, err := adjuster.Adjust(ctx, ride.AdjustParams{
+			RideID: rideID, Full: true, Reason: "vehicle broke", Actor: ride.ActorOperator,
+		})
+		require.NoError(t, err)
+
+		updated := rideRepoMock.Calls[1].Arguments.Get(0).(*ride.Ride)
+		assert.Equal(t, money.NewMoney(0, "EUR"), updated.Charged())
+		assert.Equal(t, payment.StatusRefunded, updated.Payment.Status)
+		refund := updated.PendingWalletTransaction()
+		require.NotNil(t, refund)
+		assert.Equal(t, wallet.KindRideRefund, refund.Kind)
+		assert.Equal(t, wallet.UserAccount("u_1"), refund.Entries[1].Account)
+		assert.Equal(t, money.NewMoney(150, "EUR"), refund.Entries[1].Amount)
+		providerMock.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("nothing left to refund", func(t *testing.T) {
+		setup()
+		r := paidRide(payment.MethodCard)
+		r.Adjustments[0].Amount = price
+		rideRepoMock.On("GetByID", rideID).Return(r, nil)
+
+		_, err := adjuster.Adjust(ctx, ride.AdjustParams{
+			RideID: rideID, Full: true, Reason: "complaint", Actor: ride.ActorOperator,
+		})
+		assert.ErrorIs(t, err, ride.ErrRefundExceedsCharge)
+	})
+}
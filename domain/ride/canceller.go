@@ -0,0 +1,135 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Canceller ends an active ride without charging it, e.g. when it was started by mistake or the vehicle is faulty.
+// A cancelled ride is kept, but it no longer holds its user and vehicle.
+type Canceller interface {
+	Cancel(ctx context.Context, params CancelParams) (*Ride, error)
+}
+
+var (
+	ErrAlreadyCancelled    = errors.New("ERR_ALREADY_CANCELLED")
+	ErrInvalidCancelParams = errors.New("ERR_INVALID_CANCEL_PARAMS")
+	// ErrMistakeWindowPassed is returned when a ride is cancelled as started by mistake after the mistake window.
+	ErrMistakeWindowPassed = errors.New("ERR_MISTAKE_WINDOW_PASSED")
+)
+
+// DefaultMistakeWindow is how long after starting a ride can be cancelled as started by mistake.
+const DefaultMistakeWindow = time.Minute
+
+type CancelParams struct {
+	RideID string
+	Reason CancelReason
+	Actor  Actor
+}
+
+type canceller struct {
+	rideRepo        Repo
+	txManager       txn.Manager
+	paymentProvider payment.Provider
+	time            timenow.TimeNow
+	mistakeWindow   time.Duration
+}
+
+// NewCanceller returns a Canceller that only takes CancelReasonMistake for rides started at most mistakeWindow ago,
+// longer rides are finished and charged instead. Each ride is read and stored in a unit of work, which locks it so a
+// cancel and a finish of it run one after the other.
+func NewCanceller(
+	rideRepo Repo,
+	txManager txn.Manager,
+	paymentProvider payment.Provider,
+	time timenow.TimeNow,
+	mistakeWindow time.Duration,
+) Canceller {
+	return &canceller{
+		rideRepo:        rideRepo,
+		txManager:       txManager,
+		paymentProvider: paymentProvider,
+		time:            time,
+		mistakeWindow:   mistakeWindow,
+	}
+}
+
+func (c *canceller) Cancel(ctx context.Context, params CancelParams) (*Ride, error) {
+	if !params.Reason.IsValid() || !params.Actor.IsValid() {
+		return nil, ErrInvalidCancelParams
+	}
+
+	// The ride is stored as cancelled before its hold is released, a hold released for a ride still active would
+	// leave its capture failing
+	var r *Ride
+	err := c.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		r, err = c.cancel(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Wallet rides have taken nothing from the wallet yet, only card holds need releasing
+	if r.Payment != nil && r.Payment.Method == payment.MethodCard {
+		// The ride is cancelled already, a hold that fails to be released expires on its own
+		_ = c.paymentProvider.Void(ctx, r.Payment.AuthorizationID)
+	}
+
+	return r, nil
+}
+
+// cancel stores the ride as cancelled, with its payment voided.
+func (c *canceller) cancel(ctx context.Context, params CancelParams) (*Ride, error) {
+	r, err := c.rideRepo.GetByID(ctx, params.RideID)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Status {
+	case StatusCancelled:
+		return nil, ErrAlreadyCancelled
+	case StatusFinished, StatusPaid:
+		return nil, ErrAlreadyFinished
+	}
+	now := c.time.Now()
+	if params.Reason == CancelReasonMistake && now.Sub(r.StartedAt) > c.mistakeWindow {
+		return nil, ErrMistakeWindowPassed
+	}
+	if err = r.TransitionTo(StatusCancelled); err != nil {
+		return nil, err
+	}
+
+	price := money.NewMoney(0, defaultPriceCurrency)
+	r.CancelledAt = &now
+	r.CancelReason = &params.Reason
+	r.CancelledBy = &params.Actor
+	r.Price = &price
+	r.Record(EventCancelled, params.Actor, now, map[string]string{"reason": string(params.Reason)})
+	if r.Payment != nil {
+		r.Payment.Status = payment.StatusVoided
+		r.Record(EventVoided, ActorSystem, now, map[string]string{"method": string(r.Payment.Method)})
+	}
+
+	return c.rideRepo.Update(ctx, r)
+}
+
+type CancellerMock struct {
+	mock.Mock
+}
+
+func NewCancellerMock() *CancellerMock {
+	return new(CancellerMock)
+}
+
+func (m *CancellerMock) Cancel(_ context.Context, params CancelParams) (*Ride, error) {
+	args := m.Mock.Called(params)
+	return args.Get(0).(*Ride), args.Error(1)
+}
@@ -0,0 +1,175 @@
+package ride_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCancel(t *testing.T) {
+	var rideRepoMock *ride.RepoMock
+	var providerMock *payment.ProviderMock
+	var canceller ride.Canceller
+	fixedTime := timenow.NewFixedTime(time.Now())
+	now := fixedTime.Now()
+	rideID := "r_1"
+	ctx := context.Background()
+
+	setup := func() {
+		rideRepoMock = ride.NewRepoMock()
+		providerMock = payment.NewProviderMock()
+		canceller = ride.NewCanceller(rideRepoMock, txn.NewMemoryManager(), providerMock, fixedTime, time.Minute)
+	}
+
+	testCases := []struct {
+		description string
+		status      ride.Status
+		expectedErr error
+	}{
+		{
+			description: "active",
+			status:      ride.StatusActive,
+			expectedErr: nil,
+		},
+		{
+			description: "reserved",
+			status:      ride.StatusReserved,
+			expectedErr: nil,
+		},
+		{
+			description: "already finished",
+			status:      ride.StatusFinished,
+			expectedErr: ride.ErrAlreadyFinished,
+		},
+		{
+			description: "already cancelled",
+			status:      ride.StatusCancelled,
+			expectedErr: ride.ErrAlreadyCancelled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			startedRide := &ride.Ride{
+				ID:        rideID,
+				VehicleID: "1",
+				UserID:    "1",
+				Status:    tc.status,
+				StartedAt: now.Add(-30 * time.Second),
+			}
+			rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+
+			reason := ride.CancelReasonVehicleFaulty
+			actor := ride.ActorOperator
+			price := money.NewMoney(0, "EUR")
+			cancelledRide := *startedRide
+			cancelledRide.Status = ride.StatusCancelled
+			cancelledRide.CancelledAt = &now
+			cancelledRide.CancelReason = &reason
+			cancelledRide.CancelledBy = &actor
+			cancelledRide.Price = &price
+			cancelledRide.Record(ride.EventCancelled, actor, now, map[string]string{"reason": string(reason)})
+
+			rideRepoMock.On("Update", &cancelledRide).Return(&cancelledRide, nil)
+
+			r, err := canceller.Cancel(ctx, ride.CancelParams{
+				RideID: rideID,
+				Reason: reason,
+				Actor:  actor,
+			})
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if err == nil {
+				assert.Equal(t, &cancelledRide, r)
+			}
+		})
+	}
+
+	t.Run("voids the payment hold", func(t *testing.T) {
+		setup()
+		authID := "auth_1"
+		startedRide := &ride.Ride{
+			ID:        rideID,
+			Status:    ride.StatusActive,
+			StartedAt: now.Add(-30 * time.Second),
+			Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusAuthorized},
+		}
+		rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+		providerMock.On("Void", authID).Return(nil)
+
+		reason := ride.CancelReasonMistake
+		actor := ride.ActorOperator
+		price := money.NewMoney(0, "EUR")
+		cancelledRide := *startedRide
+		cancelledRide.Status = ride.StatusCancelled
+		cancelledRide.CancelledAt = &now
+		cancelledRide.CancelReason = &reason
+		cancelledRide.CancelledBy = &actor
+		cancelledRide.Price = &price
+		cancelledRide.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusVoided}
+		cancelledRide.Record(ride.EventCancelled, actor, now, map[string]string{"reason": string(reason)})
+		cancelledRide.Record(ride.EventVoided, ride.ActorSystem, now, map[string]string{"method": "CARD"})
+		rideRepoMock.On("Update", &cancelledRide).Return(&cancelledRide, nil)
+
+		r, err := canceller.Cancel(ctx, ride.CancelParams{RideID: rideID, Reason: reason, Actor: actor})
+		assert.NoError(t, err)
+		assert.Equal(t, payment.StatusVoided, r.Payment.Status)
+		providerMock.AssertCalled(t, "Void", authID)
+	})
+
+	t.Run("started by mistake too long ago", func(t *testing.T) {
+		setup()
+		startedRide := &ride.Ride{ID: rideID, Status: ride.StatusActive, StartedAt: now.Add(-2 * time.Minute)}
+		rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+
+		r, err := canceller.Cancel(ctx, ride.CancelParams{
+			RideID: rideID,
+			Reason: ride.CancelReasonMistake,
+			Actor:  ride.ActorOperator,
+		})
+		assert.ErrorIs(t, err, ride.ErrMistakeWindowPassed)
+		assert.Nil(t, r)
+		rideRepoMock.AssertNotCalled(t, "Update", mock.Anything)
+	})
+
+	t.Run("keeps the hold when the ride can't be stored", func(t *testing.T) {
+		setup()
+		startedRide := &ride.Ride{
+			ID:        rideID,
+			Status:    ride.StatusActive,
+			StartedAt: now.Add(-30 * time.Second),
+			Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusAuthorized},
+		}
+		rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+		rideRepoMock.On("Update", mock.Anything).Return(&ride.Ride{}, errors.New("ERR_DB"))
+
+		r, err := canceller.Cancel(ctx, ride.CancelParams{
+			RideID: rideID,
+			Reason: ride.CancelReasonMistake,
+			Actor:  ride.ActorOperator,
+		})
+		assert.Error(t, err)
+		assert.Nil(t, r)
+		providerMock.AssertNotCalled(t, "Void", mock.Anything)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		setup()
+		r, err := canceller.Cancel(ctx, ride.CancelParams{
+			RideID: rideID,
+			Reason: "UNKNOWN",
+			Actor:  ride.ActorOperator,
+		})
+		assert.ErrorIs(t, err, ride.ErrInvalidCancelParams)
+		assert.Nil(t, r)
+	})
+}
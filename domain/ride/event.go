@@ -0,0 +1,123 @@
+package ride
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"reby/pkg/event"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// EventType is something that happened to a ride.
+type EventType string
+
+const (
+	EventStarted       EventType = "STARTED"
+	EventPaused        EventType = "PAUSED"
+	EventResumed       EventType = "RESUMED"
+	EventFinished      EventType = "FINISHED"
+	EventPriceComputed EventType = "PRICE_COMPUTED"
+	EventCancelled     EventType = "CANCELLED"
+	EventRefunded      EventType = "REFUNDED"
+	EventAuthorized    EventType = "PAYMENT_AUTHORIZED"
+	EventCaptured      EventType = "PAYMENT_CAPTURED"
+	EventCaptureFailed EventType = "PAYMENT_CAPTURE_FAILED"
+	EventVoided        EventType = "PAYMENT_VOIDED"
+)
+
+// Event is an entry of the append-only history of a ride.
+type Event struct {
+	RideID     string            `json:"ride_id"`
+	Type       EventType         `json:"type"`
+	Actor      Actor             `json:"actor"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+// Record adds an event to the ride. Recorded events are stored by the Repo together with the ride.
+func (r *Ride) Record(eventType EventType, actor Actor, at time.Time, data map[string]string) {
+	r.events = append(r.events, Event{
+		RideID:     r.ID,
+		Type:       eventType,
+		Actor:      actor,
+		OccurredAt: at,
+		Data:       data,
+	})
+}
+
+// PendingEvents returns the events recorded since the ride was loaded from the Repo.
+func (r *Ride) PendingEvents() []Event {
+	return r.events
+}
+
+// Domain events published to other teams through the outbox.
+const (
+	MessageRideStarted  = "RideStarted"
+	MessageRideFinished = "RideFinished"
+)
+
+var outboxMessageTypes = map[EventType]string{
+	EventStarted:  MessageRideStarted,
+	EventFinished: MessageRideFinished,
+}
+
+// OutboxMessages returns the domain events to publish for the pending events of the ride. The Repo writes them
+// to the outbox together with the ride change. Their payload is the ride as it is after the change.
+func (r *Ride) OutboxMessages() ([]event.Message, error) {
+	msgs := make([]event.Message, 0)
+	for _, e := range r.events {
+		msgType, ok := outboxMessageTypes[e.Type]
+		if !ok {
+			continue
+		}
+
+		payload, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, event.Message{
+			Type:        msgType,
+			AggregateID: r.ID,
+			OccurredAt:  e.OccurredAt,
+			Payload:     payload,
+		})
+	}
+
+	return msgs, nil
+}
+
+// HistoryGetter returns every event that happened to a ride, oldest first.
+type HistoryGetter interface {
+	Get(ctx context.Context, rideID string) ([]Event, error)
+}
+
+type historyGetter struct {
+	rideRepo Repo
+}
+
+func NewHistoryGetter(rideRepo Repo) HistoryGetter {
+	return &historyGetter{rideRepo: rideRepo}
+}
+
+func (h *historyGetter) Get(ctx context.Context, rideID string) ([]Event, error) {
+	if _, err := h.rideRepo.GetByID(ctx, rideID); err != nil {
+		return nil, err
+	}
+
+	return h.rideRepo.GetEvents(ctx, rideID)
+}
+
+type HistoryGetterMock struct {
+	mock.Mock
+}
+
+func NewHistoryGetterMock() *HistoryGetterMock {
+	return new(HistoryGetterMock)
+}
+
+func (m *HistoryGetterMock) Get(_ context.Context, rideID string) ([]Event, error) {
+	args := m.Mock.Called(rideID)
+	return args.Get(0).([]Event), args.Error(1)
+}
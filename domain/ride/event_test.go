@@ -0,0 +1,66 @@
+package ride_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"reby/domain/ride"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRideOutboxMessages(t *testing.T) {
+	now := time.Now()
+	r := &ride.Ride{ID: "r_1", Status: ride.StatusFinished, StartedAt: now.Add(-5 * time.Minute), FinishedAt: &now}
+	r.Record(ride.EventFinished, ride.ActorRider, now, nil)
+	r.Record(ride.EventPriceComputed, ride.ActorSystem, now, nil)
+
+	msgs, err := r.OutboxMessages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, ride.MessageRideFinished, msgs[0].Type)
+	assert.Equal(t, "r_1", msgs[0].AggregateID)
+	assert.Equal(t, now, msgs[0].OccurredAt)
+
+	var payload ride.Ride
+	require.NoError(t, json.Unmarshal(msgs[0].Payload, &payload))
+	assert.Equal(t, ride.StatusFinished, payload.Status)
+}
+
+func TestHistoryGet(t *testing.T) {
+	var rideRepoMock *ride.RepoMock
+	var historyGetter ride.HistoryGetter
+	rideID := "r_1"
+	ctx := context.Background()
+
+	setup := func() {
+		rideRepoMock = ride.NewRepoMock()
+		historyGetter = ride.NewHistoryGetter(rideRepoMock)
+	}
+
+	t.Run("ride not found", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return((*ride.Ride)(nil), ride.ErrNotFound)
+
+		events, err := historyGetter.Get(ctx, rideID)
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+		assert.Nil(t, events)
+		rideRepoMock.AssertNotCalled(t, "GetEvents", rideID)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		expected := []ride.Event{
+			{RideID: rideID, Type: ride.EventStarted, Actor: ride.ActorRider, OccurredAt: time.Now()},
+		}
+		rideRepoMock.On("GetByID", rideID).Return(&ride.Ride{ID: rideID}, nil)
+		rideRepoMock.On("GetEvents", rideID).Return(expected, nil)
+
+		events, err := historyGetter.Get(ctx, rideID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, events)
+	})
+}
@@ -0,0 +1,72 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Expirer finishes the rides that have been active for longer than the allowed maximum duration,
+// so users that forget to finish a ride stop paying for it and the vehicle is released.
+type Expirer interface {
+	Expire(ctx context.Context) (int, error)
+}
+
+type expirer struct {
+	rideRepo    Repo
+	finisher    Finisher
+	time        timenow.TimeNow
+	maxDuration time.Duration
+}
+
+func NewExpirer(rideRepo Repo, finisher Finisher, time timenow.TimeNow, maxDuration time.Duration) Expirer {
+	return &expirer{rideRepo: rideRepo, finisher: finisher, time: time, maxDuration: maxDuration}
+}
+
+// Expire finishes every overlong ride and returns how many were finished. A failure finishing one ride
+// does not prevent the rest from being finished; the first error found is returned.
+func (e *expirer) Expire(ctx context.Context) (int, error) {
+	rides, err := e.rideRepo.GetActiveStartedBefore(ctx, e.time.Now().Add(-e.maxDuration))
+	if err != nil {
+		return 0, err
+	}
+
+	var expired int
+	var firstErr error
+	for _, r := range rides {
+		if _, err = e.finisher.Finish(ctx, FinishParams{
+			RideID: r.ID,
+			Reason: FinishReasonMaxDuration,
+			Actor:  ActorSystem,
+		}); err != nil {
+			// The rider may have finished the ride since it was fetched
+			if errors.Is(err, ErrAlreadyFinished) {
+				continue
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		expired++
+	}
+
+	return expired, firstErr
+}
+
+type ExpirerMock struct {
+	mock.Mock
+}
+
+func NewExpirerMock() *ExpirerMock {
+	return new(ExpirerMock)
+}
+
+func (m *ExpirerMock) Expire(_ context.Context) (int, error) {
+	args := m.Mock.Called()
+	return args.Int(0), args.Error(1)
+}
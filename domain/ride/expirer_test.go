@@ -0,0 +1,75 @@
+package ride_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"reby/domain/ride"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpire(t *testing.T) {
+	var rideRepoMock *ride.RepoMock
+	var finisherMock *ride.FinisherMock
+	var expirer ride.Expirer
+
+	fixedTime := timenow.NewFixedTime(time.Now())
+	maxDuration := 2 * time.Hour
+	limit := fixedTime.Now().Add(-maxDuration)
+	ctx := context.Background()
+
+	expireParams := func(rideID string) ride.FinishParams {
+		return ride.FinishParams{
+			RideID: rideID,
+			Reason: ride.FinishReasonMaxDuration,
+			Actor:  ride.ActorSystem,
+		}
+	}
+
+	setup := func() {
+		rideRepoMock = ride.NewRepoMock()
+		finisherMock = ride.NewFinisherMock()
+		expirer = ride.NewExpirer(rideRepoMock, finisherMock, fixedTime, maxDuration)
+	}
+
+	t.Run("no overlong rides", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetActiveStartedBefore", limit).Return([]*ride.Ride{}, nil)
+
+		expired, err := expirer.Expire(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, expired)
+		finisherMock.AssertNotCalled(t, "Finish")
+	})
+
+	t.Run("repo error", func(t *testing.T) {
+		setup()
+		repoErr := errors.New("ERR_RANDOM")
+		rideRepoMock.On("GetActiveStartedBefore", limit).Return([]*ride.Ride{}, repoErr)
+
+		expired, err := expirer.Expire(ctx)
+		assert.ErrorIs(t, err, repoErr)
+		assert.Equal(t, 0, expired)
+	})
+
+	t.Run("finishes every overlong ride", func(t *testing.T) {
+		setup()
+		finishErr := errors.New("ERR_RANDOM")
+		rideRepoMock.On("GetActiveStartedBefore", limit).Return([]*ride.Ride{
+			{ID: "r_1"}, {ID: "r_2"}, {ID: "r_3"}, {ID: "r_4"},
+		}, nil)
+		finisherMock.On("Finish", expireParams("r_1")).Return(&ride.Ride{}, nil)
+		finisherMock.On("Finish", expireParams("r_2")).Return(&ride.Ride{}, finishErr)
+		finisherMock.On("Finish", expireParams("r_3")).Return(&ride.Ride{}, ride.ErrAlreadyFinished)
+		finisherMock.On("Finish", expireParams("r_4")).Return(&ride.Ride{}, nil)
+
+		expired, err := expirer.Expire(ctx)
+		assert.ErrorIs(t, err, finishErr)
+		assert.Equal(t, 2, expired)
+		finisherMock.AssertNumberOfCalls(t, "Finish", 4)
+	})
+}
@@ -3,48 +3,174 @@ package ride
 import (
 	"context"
 	"errors"
+	"strconv"
 
+	"reby/domain/payment"
 	"reby/pkg/timenow"
+	"reby/pkg/txn"
 
 	"github.com/stretchr/testify/mock"
 )
 
 type Finisher interface {
-	Finish(ctx context.Context, id string) (*Ride, error)
+	Finish(ctx context.Context, params FinishParams) (*Ride, error)
 }
 
 var (
-	ErrAlreadyFinished = errors.New("ERR_ALREADY_FINISHED")
+	ErrAlreadyFinished     = errors.New("ERR_ALREADY_FINISHED")
+	ErrInvalidFinishParams = errors.New("ERR_INVALID_FINISH_PARAMS")
+	ErrNotRideOwner        = errors.New("ERR_NOT_RIDE_OWNER")
 )
 
+type FinishParams struct {
+	RideID string
+	Reason FinishReason
+	Actor  Actor
+	// UserID restricts finishing to the rides of this user when set.
+	UserID string
+	// PartnerID restricts finishing to the rides started by this partner when set.
+	PartnerID string
+}
+
 type finisher struct {
 	rideRepo        Repo
+	txManager       txn.Manager
 	priceCalculator PriceCalculator
+	paymentProvider payment.Provider
 	time            timenow.TimeNow
+	holdValue       int
 }
 
-func NewFinisher(rideRepo Repo, priceCalculator PriceCalculator, time timenow.TimeNow) Finisher {
-	return &finisher{rideRepo: rideRepo, priceCalculator: priceCalculator, time: time}
+// NewFinisher returns a Finisher reading and storing each ride in a unit of work, which locks the ride so concurrent
+// finishes of it run one after the other. Card rides are charged after it, the capture can't be rolled back with it.
+// holdValue is the hold the Starter places on the card, the prices over it are charged from a new hold.
+func NewFinisher(
+	rideRepo Repo,
+	txManager txn.Manager,
+	priceCalculator PriceCalculator,
+	paymentProvider payment.Provider,
+	time timenow.TimeNow,
+	holdValue int,
+) Finisher {
+	return &finisher{
+		rideRepo:        rideRepo,
+		txManager:       txManager,
+		priceCalculator: priceCalculator,
+		paymentProvider: paymentProvider,
+		time:            time,
+		holdValue:       holdValue,
+	}
 }
 
-func (f *finisher) Finish(ctx context.Context, id string) (*Ride, error) {
-	r, err := f.rideRepo.GetByID(ctx, id)
+func (f *finisher) Finish(ctx context.Context, params FinishParams) (*Ride, error) {
+	if !params.Reason.IsValid() || !params.Actor.IsValid() {
+		return nil, ErrInvalidFinishParams
+	}
+
+	var r *Ride
+	err := f.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		r, err = f.finish(ctx, params)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	if r.FinishedAt != nil {
+	// Wallet rides are paid already
+	if r.Status == StatusPaid {
+		return r, nil
+	}
+
+	return f.charge(ctx, r)
+}
+
+// finish stores the ride as finished, and as paid when it is paid from the wallet.
+func (f *finisher) finish(ctx context.Context, params FinishParams) (*Ride, error) {
+	r, err := f.rideRepo.GetByID(ctx, params.RideID)
+	if err != nil {
+		return nil, err
+	}
+	if (params.UserID != "" && r.UserID != params.UserID) || (params.PartnerID != "" && r.PartnerID != params.PartnerID) {
+		return nil, ErrNotRideOwner
+	}
+	switch r.Status {
+	case StatusFinished, StatusPaid:
 		return nil, ErrAlreadyFinished
+	case StatusCancelled:
+		return nil, ErrAlreadyCancelled
 	}
 
 	price, err := f.priceCalculator.Calculate(*r)
 	if err != nil {
 		return nil, err
 	}
+	if err = r.TransitionTo(StatusFinished); err != nil {
+		return nil, err
+	}
 
 	now := f.time.Now()
 	r.FinishedAt = &now
+	r.FinishReason = &params.Reason
+	r.FinishedBy = &params.Actor
 	r.Price = &price
+	r.Record(EventFinished, params.Actor, now, map[string]string{"reason": string(params.Reason)})
+	r.Record(EventPriceComputed, ActorSystem, now, map[string]string{
+		"value":    strconv.Itoa(price.Value.Int()),
+		"currency": price.Currency.String(),
+	})
+
+	// Wallet rides are charged atomically with the ride update
+	if r.Payment != nil && r.Payment.Method == payment.MethodWallet {
+		if err = r.TransitionTo(StatusPaid); err != nil {
+			return nil, err
+		}
+		r.ChargeWallet(now)
+		r.Payment.Status = payment.StatusCaptured
+		r.Record(EventCaptured, ActorSystem, now, map[string]string{"method": string(payment.MethodWallet)})
+
+		return f.rideRepo.Update(ctx, r)
+	}
+
+	// The ride is stored as finished before charging it, so a failing provider never keeps it ongoing
+	return f.rideRepo.Update(ctx, r)
+}
+
+// charge captures the price of a finished card ride. A price over the hold placed at the start can't be captured
+// from it, so a hold of the whole price replaces it, as refunds are given from a single authorization. When the
+// charge fails the ride stays finished and its price becomes a debt of the user.
+func (f *finisher) charge(ctx context.Context, r *Ride) (*Ride, error) {
+	// Rides started before payments were introduced have nothing to capture
+	if r.Payment == nil {
+		return r, nil
+	}
+
+	now := f.time.Now()
+	if r.Price.Value.Int() > f.holdValue {
+		authID, err := f.paymentProvider.Authorize(ctx, r.UserID, *r.Price, "")
+		if err != nil {
+			return f.fail(ctx, r, err)
+		}
+		_ = f.paymentProvider.Void(ctx, r.Payment.AuthorizationID)
+		r.Payment.AuthorizationID = authID
+		r.Record(EventAuthorized, ActorSystem, now, map[string]string{"method": string(r.Payment.Method)})
+	}
+	if err := f.paymentProvider.Capture(ctx, r.Payment.AuthorizationID, *r.Price); err != nil {
+		return f.fail(ctx, r, err)
+	}
+
+	if err := r.TransitionTo(StatusPaid); err != nil {
+		return nil, err
+	}
+	r.Payment.Status = payment.StatusCaptured
+	r.Record(EventCaptured, ActorSystem, now, nil)
+
+	return f.rideRepo.Update(ctx, r)
+}
 
+// fail stores the charge of the ride as failed, owing its price.
+func (f *finisher) fail(ctx context.Context, r *Ride, err error) (*Ride, error) {
+	r.Payment.Status = payment.StatusFailed
+	r.Record(EventCaptureFailed, ActorSystem, f.time.Now(), map[string]string{"error": err.Error()})
 	return f.rideRepo.Update(ctx, r)
 }
 
@@ -56,7 +182,7 @@ func NewFinisherMock() *FinisherMock {
 	return new(FinisherMock)
 }
 
-func (m *FinisherMock) Finish(_ context.Context, id string) (*Ride, error) {
-	args := m.Mock.Called(id)
+func (m *FinisherMock) Finish(_ context.Context, params FinishParams) (*Ride, error) {
+	args := m.Mock.Called(params)
 	return args.Get(0).(*Ride), args.Error(1)
 }
@@ -2,19 +2,26 @@ package ride_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"reby/domain/money"
+	"reby/domain/payment"
 	"reby/domain/ride"
+	"reby/domain/wallet"
 	"reby/pkg/timenow"
+	"reby/pkg/txn"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFinish(t *testing.T) {
 	var rideRepoMock *ride.RepoMock
 	var priceMock *ride.PriceCalculatorMock
+	var providerMock *payment.ProviderMock
 	fixedTime := timenow.NewFixedTime(time.Now())
 	now := fixedTime.Now()
 	var finisher ride.Finisher
@@ -25,24 +32,46 @@ func TestFinish(t *testing.T) {
 	setup := func() {
 		rideRepoMock = ride.NewRepoMock()
 		priceMock = ride.NewPriceCalculatorMock()
-		finisher = ride.NewFinisher(rideRepoMock, priceMock, fixedTime)
+		providerMock = payment.NewProviderMock()
+		finisher = ride.NewFinisher(rideRepoMock, txn.NewMemoryManager(), priceMock, providerMock, fixedTime,
+			ride.DefaultHoldValue)
 	}
 
 	testCases := []struct {
 		description string
-		finishedAt  *time.Time
+		status      ride.Status
 		expectedErr error
 	}{
 		{
 			description: "ok",
-			finishedAt:  nil,
+			status:      ride.StatusActive,
+			expectedErr: nil,
+		},
+		{
+			description: "paused",
+			status:      ride.StatusPaused,
 			expectedErr: nil,
 		},
 		{
 			description: "already finished",
-			finishedAt:  &now,
+			status:      ride.StatusFinished,
+			expectedErr: ride.ErrAlreadyFinished,
+		},
+		{
+			description: "already paid",
+			status:      ride.StatusPaid,
 			expectedErr: ride.ErrAlreadyFinished,
 		},
+		{
+			description: "already cancelled",
+			status:      ride.StatusCancelled,
+			expectedErr: ride.ErrAlreadyCancelled,
+		},
+		{
+			description: "reserved",
+			status:      ride.StatusReserved,
+			expectedErr: ride.ErrInvalidTransition,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
@@ -51,25 +80,283 @@ func TestFinish(t *testing.T) {
 				ID:         rideID,
 				VehicleID:  "1",
 				UserID:     "1",
+				Status:     tc.status,
 				StartedAt:  now.Add(-5 * time.Minute),
-				FinishedAt: tc.finishedAt,
+				FinishedAt: nil,
 				Price:      nil,
 			}
 
 			rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
 			priceMock.On("Calculate", *startedRide).Return(price, nil)
 
+			reason := ride.FinishReasonRider
+			actor := ride.ActorRider
 			finishedRide := *startedRide
+			finishedRide.Status = ride.StatusFinished
 			finishedRide.FinishedAt = &now
+			finishedRide.FinishReason = &reason
+			finishedRide.FinishedBy = &actor
 			finishedRide.Price = &price
+			finishedRide.Record(ride.EventFinished, actor, now, map[string]string{"reason": string(reason)})
+			finishedRide.Record(ride.EventPriceComputed, ride.ActorSystem, now, map[string]string{
+				"value":    "200",
+				"currency": "EUR",
+			})
 
 			rideRepoMock.On("Update", &finishedRide).Return(&finishedRide, nil)
 
-			r, err := finisher.Finish(ctx, rideID)
-			assert.ErrorIs(t, tc.expectedErr, err)
+			r, err := finisher.Finish(ctx, ride.FinishParams{
+				RideID: rideID,
+				Reason: reason,
+				Actor:  actor,
+			})
+			assert.ErrorIs(t, err, tc.expectedErr)
 			if err == nil {
 				assert.NotEmpty(t, r)
 			}
+			providerMock.AssertNotCalled(t, "Capture", mock.Anything, mock.Anything)
 		})
 	}
+
+	paymentCases := []struct {
+		description    string
+		captureErr     error
+		expectedStatus ride.Status
+		expectedEvent  ride.EventType
+		expectedData   map[string]string
+		expectedResult payment.Status
+	}{
+		{
+			description:    "captures the price",
+			captureErr:     nil,
+			expectedStatus: ride.StatusPaid,
+			expectedEvent:  ride.EventCaptured,
+			expectedResult: payment.StatusCaptured,
+		},
+		{
+			description:    "failed capture becomes debt",
+			captureErr:     payment.ErrDeclined,
+			expectedStatus: ride.StatusFinished,
+			expectedEvent:  ride.EventCaptureFailed,
+			expectedData:   map[string]string{"error": payment.ErrDeclined.Error()},
+			expectedResult: payment.StatusFailed,
+		},
+	}
+	for _, tc := range paymentCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			authID := "auth_1"
+			reason := ride.FinishReasonRider
+			actor := ride.ActorRider
+			startedRide := &ride.Ride{
+				ID:        rideID,
+				VehicleID: "1",
+				UserID:    "1",
+				Status:    ride.StatusActive,
+				StartedAt: now.Add(-5 * time.Minute),
+				Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusAuthorized},
+			}
+			// finishedRide is the ride as returned by the repo, without pending events
+			finishedRide := func() *ride.Ride {
+				r := *startedRide
+				r.Status = ride.StatusFinished
+				r.FinishedAt = &now
+				r.FinishReason = &reason
+				r.FinishedBy = &actor
+				r.Price = &price
+				r.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusAuthorized}
+				return &r
+			}
+
+			storedRide := finishedRide()
+			storedRide.Record(ride.EventFinished, actor, now, map[string]string{"reason": string(reason)})
+			storedRide.Record(ride.EventPriceComputed, ride.ActorSystem, now, map[string]string{
+				"value":    "200",
+				"currency": "EUR",
+			})
+			chargedRide := finishedRide()
+			chargedRide.Status = tc.expectedStatus
+			chargedRide.Payment.Status = tc.expectedResult
+			chargedRide.Record(tc.expectedEvent, ride.ActorSystem, now, tc.expectedData)
+
+			rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+			priceMock.On("Calculate", *startedRide).Return(price, nil)
+			rideRepoMock.On("Update", storedRide).Return(finishedRide(), nil).Once()
+			rideRepoMock.On("Update", chargedRide).Return(chargedRide, nil).Once()
+			providerMock.On("Capture", authID, price).Return(tc.captureErr)
+
+			r, err := finisher.Finish(ctx, ride.FinishParams{
+				RideID: rideID,
+				Reason: reason,
+				Actor:  actor,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, r.Status)
+			assert.Equal(t, tc.expectedResult, r.Payment.Status)
+			rideRepoMock.AssertNumberOfCalls(t, "Update", 2)
+		})
+	}
+
+	overHoldCases := []struct {
+		description    string
+		authorizeErr   error
+		expectedStatus ride.Status
+		expectedResult payment.Status
+	}{
+		{
+			description:    "price over the hold is captured from a new hold",
+			expectedStatus: ride.StatusPaid,
+			expectedResult: payment.StatusCaptured,
+		},
+		{
+			description:    "declined hold of a price over the hold becomes debt",
+			authorizeErr:   payment.ErrDeclined,
+			expectedStatus: ride.StatusFinished,
+			expectedResult: payment.StatusFailed,
+		},
+	}
+	for _, tc := range overHoldCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			// A 60 minutes ride
+			price := money.NewMoney(1180, "EUR")
+			startedRide := &ride.Ride{
+				ID:        rideID,
+				VehicleID: "1",
+				UserID:    "1",
+				Status:    ride.StatusActive,
+				StartedAt: now.Add(-time.Hour),
+				Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusAuthorized},
+			}
+			rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+			priceMock.On("Calculate", *startedRide).Return(price, nil)
+			// The ride is updated in place
+			rideRepoMock.On("Update", startedRide).Return(startedRide, nil)
+			providerMock.On("Authorize", "1", price, "").Return("auth_2", tc.authorizeErr)
+			providerMock.On("Void", "auth_1").Return(nil)
+			providerMock.On("Capture", "auth_2", price).Return(nil)
+
+			r, err := finisher.Finish(ctx, ride.FinishParams{
+				RideID: rideID,
+				Reason: ride.FinishReasonRider,
+				Actor:  ride.ActorRider,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, r.Status)
+			assert.Equal(t, tc.expectedResult, r.Payment.Status)
+			providerMock.AssertNotCalled(t, "Capture", "auth_1", mock.Anything)
+			if tc.authorizeErr == nil {
+				assert.Equal(t, "auth_2", r.Payment.AuthorizationID)
+				providerMock.AssertCalled(t, "Void", "auth_1")
+				providerMock.AssertCalled(t, "Capture", "auth_2", price)
+			} else {
+				assert.Equal(t, "auth_1", r.Payment.AuthorizationID)
+				providerMock.AssertNotCalled(t, "Capture", mock.Anything, mock.Anything)
+			}
+		})
+	}
+
+	t.Run("charges the wallet with the ride update", func(t *testing.T) {
+		setup()
+		reason := ride.FinishReasonRider
+		actor := ride.ActorRider
+		startedRide := &ride.Ride{
+			ID:        rideID,
+			UserID:    "1",
+			Status:    ride.StatusActive,
+			StartedAt: now.Add(-5 * time.Minute),
+			Payment:   &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusAuthorized},
+		}
+		paidRide := *startedRide
+		paidRide.Status = ride.StatusPaid
+		paidRide.FinishedAt = &now
+		paidRide.FinishReason = &reason
+		paidRide.FinishedBy = &actor
+		paidRide.Price = &price
+		paidRide.Payment = &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusCaptured}
+		paidRide.Record(ride.EventFinished, actor, now, map[string]string{"reason": string(reason)})
+		paidRide.Record(ride.EventPriceComputed, ride.ActorSystem, now, map[string]string{
+			"value":    "200",
+			"currency": "EUR",
+		})
+		paidRide.Record(ride.EventCaptured, ride.ActorSystem, now, map[string]string{"method": "WALLET"})
+		paidRide.ChargeWallet(now)
+
+		rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+		priceMock.On("Calculate", *startedRide).Return(price, nil)
+		rideRepoMock.On("Update", &paidRide).Return(&paidRide, nil).Once()
+
+		r, err := finisher.Finish(ctx, ride.FinishParams{RideID: rideID, Reason: reason, Actor: actor})
+		require.NoError(t, err)
+		assert.Equal(t, ride.StatusPaid, r.Status)
+		charge := r.PendingWalletTransaction()
+		require.NotNil(t, charge)
+		assert.Equal(t, wallet.KindRideCharge, charge.Kind)
+		assert.Equal(t, rideID, charge.Reference)
+		assert.Equal(t, money.NewMoney(-200, "EUR"), charge.Entries[0].Amount)
+		providerMock.AssertNotCalled(t, "Capture", mock.Anything, mock.Anything)
+	})
+
+	t.Run("update error does not capture", func(t *testing.T) {
+		setup()
+		updateErr := errors.New("ERR_RANDOM")
+		startedRide := &ride.Ride{
+			ID:        rideID,
+			Status:    ride.StatusActive,
+			StartedAt: now.Add(-5 * time.Minute),
+			Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusAuthorized},
+		}
+		rideRepoMock.On("GetByID", rideID).Return(startedRide, nil)
+		priceMock.On("Calculate", *startedRide).Return(price, nil)
+		rideRepoMock.On("Update", mock.Anything).Return(&ride.Ride{}, updateErr)
+
+		_, err := finisher.Finish(ctx, ride.FinishParams{
+			RideID: rideID,
+			Reason: ride.FinishReasonRider,
+			Actor:  ride.ActorRider,
+		})
+		assert.ErrorIs(t, err, updateErr)
+		providerMock.AssertNotCalled(t, "Capture", mock.Anything, mock.Anything)
+	})
+
+	t.Run("ride of another user", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(&ride.Ride{ID: rideID, UserID: "1", Status: ride.StatusActive}, nil)
+
+		r, err := finisher.Finish(ctx, ride.FinishParams{
+			RideID: rideID,
+			Reason: ride.FinishReasonRider,
+			Actor:  ride.ActorRider,
+			UserID: "2",
+		})
+		assert.ErrorIs(t, err, ride.ErrNotRideOwner)
+		assert.Nil(t, r)
+		rideRepoMock.AssertNotCalled(t, "Update", mock.Anything)
+	})
+
+	t.Run("ride of another partner", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(&ride.Ride{ID: rideID, UserID: "1", PartnerID: "p_1", Status: ride.StatusActive}, nil)
+
+		_, err := finisher.Finish(ctx, ride.FinishParams{
+			RideID:    rideID,
+			Reason:    ride.FinishReasonRider,
+			Actor:     ride.ActorRider,
+			PartnerID: "p_2",
+		})
+		assert.ErrorIs(t, err, ride.ErrNotRideOwner)
+		rideRepoMock.AssertNotCalled(t, "Update", mock.Anything)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		setup()
+		r, err := finisher.Finish(ctx, ride.FinishParams{
+			RideID: rideID,
+			Reason: "UNKNOWN",
+			Actor:  ride.ActorRider,
+		})
+		assert.ErrorIs(t, err, ride.ErrInvalidFinishParams)
+		assert.Nil(t, r)
+		rideRepoMock.AssertNotCalled(t, "GetByID", rideID)
+	})
 }
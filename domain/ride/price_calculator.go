@@ -17,6 +17,7 @@ type PriceCalculator interface {
 const (
 	DefaultUnlockValue   = 100
 	DefaultMinuteValue   = 18
+	DefaultHoldValue     = 1000  // Amount held on the payment method of the user while riding
 	defaultPriceCurrency = "EUR" // To simplify things for the task, all rides are in EUR
 )
 
@@ -2,16 +2,25 @@ package ride
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
 
+// Repo stores rides. Create and Update also append the ride's pending events to its history,
+// atomically with the ride change.
 type Repo interface {
 	GetByID(ctx context.Context, id string) (*Ride, error)
 	Create(ctx context.Context, ride *Ride) error
 	IsUserRiding(ctx context.Context, userID string) (bool, error)
 	IsVehicleRiding(ctx context.Context, vehicleID string) (bool, error)
+	// HasDebt tells whether the user has finished rides whose payment failed.
+	HasDebt(ctx context.Context, userID string) (bool, error)
 	Update(ctx context.Context, ride *Ride) (*Ride, error)
+	// GetActiveStartedBefore returns the rides that are not finished and were started before t.
+	GetActiveStartedBefore(ctx context.Context, t time.Time) ([]*Ride, error)
+	// GetEvents returns the history of a ride, oldest first.
+	GetEvents(ctx context.Context, rideID string) ([]Event, error)
 }
 
 type RepoMock struct {
@@ -42,7 +51,22 @@ func (m *RepoMock) IsVehicleRiding(_ context.Context, vehicleID string) (bool, e
 	return args.Get(0).(bool), args.Error(1)
 }
 
+func (m *RepoMock) HasDebt(_ context.Context, userID string) (bool, error) {
+	args := m.Mock.Called(userID)
+	return args.Get(0).(bool), args.Error(1)
+}
+
 func (m *RepoMock) Update(_ context.Context, ride *Ride) (*Ride, error) {
 	args := m.Mock.Called(ride)
 	return args.Get(0).(*Ride), args.Error(1)
 }
+
+func (m *RepoMock) GetActiveStartedBefore(_ context.Context, t time.Time) ([]*Ride, error) {
+	args := m.Mock.Called(t)
+	return args.Get(0).([]*Ride), args.Error(1)
+}
+
+func (m *RepoMock) GetEvents(_ context.Context, rideID string) ([]Event, error) {
+	args := m.Mock.Called(rideID)
+	return args.Get(0).([]Event), args.Error(1)
+}
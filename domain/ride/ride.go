@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/wallet"
 )
 
 var (
@@ -12,11 +14,112 @@ var (
 	ErrNotFound      = errors.New("ERR_RIDE_NOT_FOUND")
 )
 
+// FinishReason tells why a ride was finished.
+type FinishReason string
+
+const (
+	FinishReasonRider       FinishReason = "RIDER_REQUEST"
+	FinishReasonOperator    FinishReason = "OPERATOR_FORCED"
+	FinishReasonMaxDuration FinishReason = "MAX_DURATION_EXCEEDED"
+)
+
+func (r FinishReason) IsValid() bool {
+	switch r {
+	case FinishReasonRider, FinishReasonOperator, FinishReasonMaxDuration:
+		return true
+	default:
+		return false
+	}
+}
+
+// CancelReason tells why a ride was cancelled.
+type CancelReason string
+
+const (
+	CancelReasonMistake       CancelReason = "STARTED_BY_MISTAKE"
+	CancelReasonVehicleFaulty CancelReason = "VEHICLE_FAULTY"
+)
+
+func (r CancelReason) IsValid() bool {
+	switch r {
+	case CancelReasonMistake, CancelReasonVehicleFaulty:
+		return true
+	default:
+		return false
+	}
+}
+
+// Actor is who performed an action over a ride.
+type Actor string
+
+const (
+	ActorRider    Actor = "RIDER"
+	ActorOperator Actor = "OPERATOR"
+	ActorSystem   Actor = "SYSTEM"
+)
+
+func (a Actor) IsValid() bool {
+	switch a {
+	case ActorRider, ActorOperator, ActorSystem:
+		return true
+	default:
+		return false
+	}
+}
+
 type Ride struct {
-	ID         string       `json:"id"`
-	VehicleID  string       `json:"vehicle_id"`
-	UserID     string       `json:"user_id"`
-	StartedAt  time.Time    `json:"started_at"`
-	FinishedAt *time.Time   `json:"finished_at"`
-	Price      *money.Money `json:"price"`
+	ID        string `json:"id"`
+	VehicleID string `json:"vehicle_id"`
+	UserID    string `json:"user_id"`
+	// PartnerID is the organisation that started the ride for the user through its API key, if any.
+	PartnerID string `json:"partner_id,omitempty"`
+	// Country of the vehicle when the ride started, if it has one. The ride is receipted for it.
+	Country      string        `json:"country,omitempty"`
+	Status       Status        `json:"status"`
+	StartedAt    time.Time     `json:"started_at"`
+	FinishedAt   *time.Time    `json:"finished_at"`
+	FinishReason *FinishReason `json:"finish_reason"`
+	FinishedBy   *Actor        `json:"finished_by"`
+	CancelledAt  *time.Time    `json:"cancelled_at"`
+	CancelReason *CancelReason `json:"cancel_reason"`
+	CancelledBy  *Actor        `json:"cancelled_by"`
+	Price        *money.Money  `json:"price"`
+	Payment      *Payment      `json:"payment"`
+	// Adjustments given back after the ride was charged. Price is never changed by them, see Charged.
+	Adjustments []Adjustment `json:"adjustments"`
+
+	events            []Event
+	walletTransaction *wallet.Transaction
+}
+
+// Payment is the charge of a ride, either through the payment provider or from the wallet of the user.
+type Payment struct {
+	Method payment.Method `json:"method"`
+	// AuthorizationID is the hold placed on the card, empty for wallet payments.
+	AuthorizationID string         `json:"authorization_id,omitempty"`
+	Status          payment.Status `json:"status"`
+}
+
+// ChargeWallet pays the price of the ride from the wallet of its user. The charge is posted by the Repo together
+// with the ride.
+func (r *Ride) ChargeWallet(at time.Time) {
+	t := wallet.NewRideCharge(r.UserID, r.ID, r.Price.Value.Int(), at)
+	r.walletTransaction = &t
+}
+
+// RefundWallet gives an adjustment of the ride back to the wallet of its user. The refund is posted by the Repo
+// together with the ride.
+func (r *Ride) RefundWallet(a Adjustment) {
+	t := wallet.NewRideRefund(a.ID, r.UserID, r.ID, a.Amount.Value.Int(), a.CreatedAt)
+	r.walletTransaction = &t
+}
+
+// PendingWalletTransaction returns the wallet charge or refund to be posted with the ride, if any.
+func (r *Ride) PendingWalletTransaction() *wallet.Transaction {
+	return r.walletTransaction
+}
+
+// HasDebt tells whether the ride was finished but its price could not be charged.
+func (r *Ride) HasDebt() bool {
+	return r.Payment != nil && r.Payment.Status == payment.StatusFailed
 }
@@ -0,0 +1,105 @@
+package ride
+
+import (
+	"context"
+	"errors"
+
+	"reby/domain/payment"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// DebtSettler charges again the finished rides whose capture failed, so their users can ride again.
+type DebtSettler interface {
+	Settle(ctx context.Context, params SettleParams) (*Ride, error)
+}
+
+var ErrNoDebt = errors.New("ERR_NO_DEBT")
+
+type SettleParams struct {
+	RideID string
+	Actor  Actor
+	// UserID restricts settling to the rides of this user when set.
+	UserID string
+}
+
+type debtSettler struct {
+	rideRepo        Repo
+	txManager       txn.Manager
+	paymentProvider payment.Provider
+	time            timenow.TimeNow
+}
+
+func NewDebtSettler(
+	rideRepo Repo,
+	txManager txn.Manager,
+	paymentProvider payment.Provider,
+	time timenow.TimeNow,
+) DebtSettler {
+	return &debtSettler{rideRepo: rideRepo, txManager: txManager, paymentProvider: paymentProvider, time: time}
+}
+
+// Settle places a new hold of the price of the ride and captures it. The failed authorization can't be captured
+// again, so the ride keeps the new one. When the capture fails the hold is released and the debt stays.
+//
+// The ride is read and stored in a unit of work that locks it, so concurrent settles charge the debt once. The hold
+// is placed with the ride ID as idempotency key: only a failing commit can leave a charge unrecorded, and settling
+// the ride again then fails on the hold captured already instead of charging the card twice.
+func (s *debtSettler) Settle(ctx context.Context, params SettleParams) (*Ride, error) {
+	var settled *Ride
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		settled, err = s.settle(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return settled, nil
+}
+
+func (s *debtSettler) settle(ctx context.Context, params SettleParams) (*Ride, error) {
+	r, err := s.rideRepo.GetByID(ctx, params.RideID)
+	if err != nil {
+		return nil, err
+	}
+	if params.UserID != "" && r.UserID != params.UserID {
+		return nil, ErrNotRideOwner
+	}
+	if !r.HasDebt() {
+		return nil, ErrNoDebt
+	}
+
+	authID, err := s.paymentProvider.Authorize(ctx, r.UserID, *r.Price, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.paymentProvider.Capture(ctx, authID, *r.Price); err != nil {
+		_ = s.paymentProvider.Void(ctx, authID)
+		return nil, err
+	}
+
+	if err = r.TransitionTo(StatusPaid); err != nil {
+		return nil, err
+	}
+	r.Payment = &Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusCaptured}
+	r.Record(EventCaptured, params.Actor, s.time.Now(), map[string]string{"settled": "true"})
+
+	return s.rideRepo.Update(ctx, r)
+}
+
+type DebtSettlerMock struct {
+	mock.Mock
+}
+
+func NewDebtSettlerMock() *DebtSettlerMock {
+	return new(DebtSettlerMock)
+}
+
+func (m *DebtSettlerMock) Settle(_ context.Context, params SettleParams) (*Ride, error) {
+	args := m.Mock.Called(params)
+	return args.Get(0).(*Ride), args.Error(1)
+}
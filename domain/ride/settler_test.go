@@ -0,0 +1,93 @@
+package ride_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettle(t *testing.T) {
+	var rideRepoMock *ride.RepoMock
+	var providerMock *payment.ProviderMock
+	var settler ride.DebtSettler
+	fixedTime := timenow.NewFixedTime(time.Now())
+	rideID := "r_1"
+	price := money.NewMoney(1200, "EUR")
+	ctx := context.Background()
+
+	setup := func() {
+		rideRepoMock = ride.NewRepoMock()
+		providerMock = payment.NewProviderMock()
+		settler = ride.NewDebtSettler(rideRepoMock, txn.NewMemoryManager(), providerMock, fixedTime)
+	}
+	rideWithDebt := func() *ride.Ride {
+		return &ride.Ride{
+			ID:      rideID,
+			UserID:  "u_1",
+			Status:  ride.StatusFinished,
+			Price:   &price,
+			Payment: &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusFailed},
+		}
+	}
+
+	t.Run("charges the debt with a new hold", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(rideWithDebt(), nil)
+		providerMock.On("Authorize", "u_1", price, "r_1").Return("auth_2", nil)
+		providerMock.On("Capture", "auth_2", price).Return(nil)
+		rideRepoMock.On("Update", mock.Anything).Return(&ride.Ride{}, nil)
+
+		_, err := settler.Settle(ctx, ride.SettleParams{RideID: rideID, Actor: ride.ActorRider, UserID: "u_1"})
+		require.NoError(t, err)
+
+		settled := rideRepoMock.Calls[1].Arguments.Get(0).(*ride.Ride)
+		assert.Equal(t, ride.StatusPaid, settled.Status)
+		assert.Equal(t, &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_2", Status: payment.StatusCaptured},
+			settled.Payment)
+		assert.False(t, settled.HasDebt())
+	})
+
+	t.Run("capture fails", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(rideWithDebt(), nil)
+		providerMock.On("Authorize", "u_1", price, "r_1").Return("auth_2", nil)
+		providerMock.On("Capture", "auth_2", price).Return(payment.ErrDeclined)
+		providerMock.On("Void", "auth_2").Return(nil)
+
+		r, err := settler.Settle(ctx, ride.SettleParams{RideID: rideID, Actor: ride.ActorRider})
+		assert.ErrorIs(t, err, payment.ErrDeclined)
+		assert.Nil(t, r)
+		providerMock.AssertCalled(t, "Void", "auth_2")
+		rideRepoMock.AssertNotCalled(t, "Update", mock.Anything)
+	})
+
+	t.Run("no debt", func(t *testing.T) {
+		setup()
+		paid := rideWithDebt()
+		paid.Status = ride.StatusPaid
+		paid.Payment.Status = payment.StatusCaptured
+		rideRepoMock.On("GetByID", rideID).Return(paid, nil)
+
+		_, err := settler.Settle(ctx, ride.SettleParams{RideID: rideID, Actor: ride.ActorRider})
+		assert.ErrorIs(t, err, ride.ErrNoDebt)
+		providerMock.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("someone else's ride", func(t *testing.T) {
+		setup()
+		rideRepoMock.On("GetByID", rideID).Return(rideWithDebt(), nil)
+
+		_, err := settler.Settle(ctx, ride.SettleParams{RideID: rideID, Actor: ride.ActorRider, UserID: "u_2"})
+		assert.ErrorIs(t, err, ride.ErrNotRideOwner)
+	})
+}
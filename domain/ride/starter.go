@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 
+	"reby/domain/money"
+	"reby/domain/payment"
 	"reby/domain/user"
 	"reby/domain/vehicle"
+	"reby/domain/wallet"
 	"reby/pkg/id"
 	"reby/pkg/timenow"
+	"reby/pkg/txn"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -19,23 +23,62 @@ type Starter interface {
 var (
 	ErrUserIsRiding    = errors.New("ERR_USER_RIDING")
 	ErrVehicleIsRiding = errors.New("ERR_VEHICLE_RIDING")
+	ErrUserHasDebt     = errors.New("ERR_USER_HAS_DEBT")
+	// ErrNotPartnerUser is returned when a partner starts a ride for a user that didn't sign up through it.
+	ErrNotPartnerUser = errors.New("ERR_NOT_PARTNER_USER")
+	// ErrInsufficientBalance is returned when the wallet of the user does not cover the unlock price.
+	ErrInsufficientBalance = errors.New("ERR_INSUFFICIENT_BALANCE")
 )
 
 type StartParams struct {
 	UserID    string
 	VehicleID string
+	// PartnerID attributes the ride to a partner organisation, which must be the one of the user.
+	PartnerID string
 }
 
 type starter struct {
-	userRepo    user.Repo
-	vehicleRepo vehicle.Repo
-	rideRepo    Repo
-	idGenerator id.Generator
-	time        timenow.TimeNow
+	userRepo        user.Repo
+	vehicleRepo     vehicle.Repo
+	rideRepo        Repo
+	walletRepo      wallet.Repo
+	txManager       txn.Manager
+	paymentProvider payment.Provider
+	idGenerator     id.Generator
+	time            timenow.TimeNow
+	holdValue       int
+	unlockValue     int
 }
 
-func NewStarter(userRepo user.Repo, vehicleRepo vehicle.Repo, rideRepo Repo, idGenerator id.Generator, time timenow.TimeNow) Starter {
-	return &starter{userRepo: userRepo, vehicleRepo: vehicleRepo, rideRepo: rideRepo, idGenerator: idGenerator, time: time}
+// NewStarter returns a Starter for rides paid from the wallet of the user, when the user has one, or by card.
+// Wallet rides need a balance of at least unlockValue. Card rides place a hold of holdValue on the card before the
+// ride starts, so the final price can be captured when it finishes. The hold is placed outside of any transaction, and
+// the checks run again with the creation of the ride in one unit of work. Two starts racing past them are told apart
+// by the Repo, which stores one ongoing ride per user and vehicle.
+func NewStarter(
+	userRepo user.Repo,
+	vehicleRepo vehicle.Repo,
+	rideRepo Repo,
+	walletRepo wallet.Repo,
+	txManager txn.Manager,
+	paymentProvider payment.Provider,
+	idGenerator id.Generator,
+	time timenow.TimeNow,
+	holdValue int,
+	unlockValue int,
+) Starter {
+	return &starter{
+		userRepo:        userRepo,
+		vehicleRepo:     vehicleRepo,
+		rideRepo:        rideRepo,
+		walletRepo:      walletRepo,
+		txManager:       txManager,
+		paymentProvider: paymentProvider,
+		idGenerator:     idGenerator,
+		time:            time,
+		holdValue:       holdValue,
+		unlockValue:     unlockValue,
+	}
 }
 
 func (s *starter) Start(ctx context.Context, params StartParams) (*Ride, error) {
@@ -43,31 +86,84 @@ func (s *starter) Start(ctx context.Context, params StartParams) (*Ride, error)
 	if err != nil {
 		return nil, err
 	}
+	if params.PartnerID != "" && u.PartnerID != params.PartnerID {
+		return nil, ErrNotPartnerUser
+	}
 
 	v, err := s.vehicleRepo.GetByID(ctx, params.VehicleID)
 	if err != nil {
 		return nil, err
 	}
 
+	// Checked before placing the hold, so a user that can't ride isn't charged for trying
 	if err = s.startChecks(ctx, u.ID, v.ID); err != nil {
 		return nil, err
 	}
 
+	p, err := s.authorize(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	r := &Ride{
 		ID:         s.idGenerator.Generate(),
 		VehicleID:  v.ID,
 		UserID:     u.ID,
+		PartnerID:  params.PartnerID,
+		Country:    v.Country,
+		Status:     StatusActive,
 		StartedAt:  s.time.Now(),
 		FinishedAt: nil,
 		Price:      nil,
+		Payment:    p,
 	}
-	if err = s.rideRepo.Create(ctx, r); err != nil {
+	r.Record(EventAuthorized, ActorSystem, r.StartedAt, map[string]string{"method": string(p.Method)})
+	var startedData map[string]string
+	if params.PartnerID != "" {
+		startedData = map[string]string{"partner_id": params.PartnerID}
+	}
+	r.Record(EventStarted, ActorRider, r.StartedAt, startedData)
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Another ride may have started while the provider answered
+		if err := s.startChecks(ctx, u.ID, v.ID); err != nil {
+			return err
+		}
+
+		return s.rideRepo.Create(ctx, r)
+	})
+	if err != nil {
+		if p.Method == payment.MethodCard {
+			// Best effort, an unreleased hold expires on its own in the provider
+			_ = s.paymentProvider.Void(ctx, p.AuthorizationID)
+		}
 		return nil, err
 	}
 
 	return r, nil
 }
 
+// authorize checks the user can pay for the ride, from the wallet when the user has one and by card otherwise.
+func (s *starter) authorize(ctx context.Context, userID string) (*Payment, error) {
+	w, err := s.walletRepo.GetByUserID(ctx, userID)
+	switch {
+	case err == nil:
+		if w.Balance.Value.Int() < s.unlockValue {
+			return nil, ErrInsufficientBalance
+		}
+		return &Payment{Method: payment.MethodWallet, Status: payment.StatusAuthorized}, nil
+	case !errors.Is(err, wallet.ErrNotFound):
+		return nil, err
+	}
+
+	authID, err := s.paymentProvider.Authorize(ctx, userID, money.NewMoney(s.holdValue, defaultPriceCurrency), "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusAuthorized}, nil
+}
+
 func (s *starter) startChecks(ctx context.Context, userID string, vehicleID string) error {
 	isUserRiding, err := s.rideRepo.IsUserRiding(ctx, userID)
 	if err != nil {
@@ -85,6 +181,14 @@ func (s *starter) startChecks(ctx context.Context, userID string, vehicleID stri
 		return ErrVehicleIsRiding
 	}
 
+	hasDebt, err := s.rideRepo.HasDebt(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if hasDebt {
+		return ErrUserHasDebt
+	}
+
 	return nil
 }
 
@@ -2,15 +2,21 @@ package ride_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"reby/domain/money"
+	"reby/domain/payment"
 	"reby/domain/ride"
 	"reby/domain/user"
 	"reby/domain/vehicle"
+	"reby/domain/wallet"
 	"reby/pkg/id"
 	"reby/pkg/timenow"
+	"reby/pkg/txn"
 )
 
 func TestStart(t *testing.T) {
@@ -18,8 +24,16 @@ func TestStart(t *testing.T) {
 	var vehicleRepoMock *vehicle.RepoMock
 	var rideRepoMock *ride.RepoMock
 	var idGenMock *id.GeneratorMock
+	var walletRepoMock *wallet.RepoMock
+	var providerMock *payment.ProviderMock
 	var starter ride.Starter
 
+	holdValue := 1000
+	unlockValue := 100
+	hold := money.NewMoney(holdValue, "EUR")
+	authID := "auth_1"
+	createErr := errors.New("ERR_RANDOM")
+
 	now := time.Now()
 	ctx := context.Background()
 	setup := func() {
@@ -27,15 +41,24 @@ func TestStart(t *testing.T) {
 		vehicleRepoMock = vehicle.NewRepoMock()
 		rideRepoMock = ride.NewRepoMock()
 		idGenMock = id.NewGeneratorMock()
+		walletRepoMock = wallet.NewRepoMock()
+		providerMock = payment.NewProviderMock()
 
 		fixedTime := timenow.NewFixedTime(now)
 
-		starter = ride.NewStarter(userRepoMock, vehicleRepoMock, rideRepoMock, idGenMock, fixedTime)
+		starter = ride.NewStarter(
+			userRepoMock, vehicleRepoMock, rideRepoMock, walletRepoMock, txn.NewMemoryManager(), providerMock, idGenMock,
+			fixedTime, holdValue, unlockValue,
+		)
 	}
 	testCases := []struct {
 		description     string
 		isUserRiding    bool
 		isVehicleRiding bool
+		hasDebt         bool
+		wallet          *wallet.Wallet
+		authorizeErr    error
+		createErr       error
 		expectedError   error
 	}{
 		{
@@ -50,6 +73,31 @@ func TestStart(t *testing.T) {
 			isVehicleRiding: true,
 			expectedError:   ride.ErrVehicleIsRiding,
 		},
+		{
+			description:   "user has debt",
+			hasDebt:       true,
+			expectedError: ride.ErrUserHasDebt,
+		},
+		{
+			description:   "wallet below unlock price",
+			wallet:        &wallet.Wallet{UserID: "u_1", Balance: money.NewMoney(unlockValue-1, "EUR")},
+			expectedError: ride.ErrInsufficientBalance,
+		},
+		{
+			description:   "paid from wallet",
+			wallet:        &wallet.Wallet{UserID: "u_1", Balance: money.NewMoney(unlockValue, "EUR")},
+			expectedError: nil,
+		},
+		{
+			description:   "payment declined",
+			authorizeErr:  payment.ErrDeclined,
+			expectedError: payment.ErrDeclined,
+		},
+		{
+			description:   "create error voids the hold",
+			createErr:     createErr,
+			expectedError: createErr,
+		},
 		{
 			description:     "ok",
 			isUserRiding:    false,
@@ -67,21 +115,42 @@ func TestStart(t *testing.T) {
 			rideID := "r_1"
 
 			userRepoMock.On("GetByID", userID).Return(&user.User{ID: userID}, nil)
-			vehicleRepoMock.On("GetByID", vehicleID).Return(&vehicle.Vehicle{ID: vehicleID}, nil)
+			vehicleRepoMock.On("GetByID", vehicleID).Return(&vehicle.Vehicle{ID: vehicleID, Country: "ES"}, nil)
 			rideRepoMock.On("IsUserRiding", userID).Return(tc.isUserRiding, nil)
 			rideRepoMock.On("IsVehicleRiding", vehicleID).Return(tc.isVehicleRiding, nil)
+			rideRepoMock.On("HasDebt", userID).Return(tc.hasDebt, nil)
+			if tc.wallet != nil {
+				walletRepoMock.On("GetByUserID", userID).Return(tc.wallet, nil)
+			} else {
+				walletRepoMock.On("GetByUserID", userID).Return(&wallet.Wallet{}, wallet.ErrNotFound)
+			}
+			providerMock.On("Authorize", userID, hold, "").Return(authID, tc.authorizeErr)
+			providerMock.On("Void", authID).Return(nil)
 			idGenMock.On("Generate").Return(rideID)
 
 			r := &ride.Ride{
 				ID:         rideID,
 				VehicleID:  vehicleID,
 				UserID:     userID,
+				Country:    "ES",
+				Status:     ride.StatusActive,
 				StartedAt:  now,
 				FinishedAt: nil,
 				Price:      nil,
+				Payment: &ride.Payment{
+					Method:          payment.MethodCard,
+					AuthorizationID: authID,
+					Status:          payment.StatusAuthorized,
+				},
 			}
+			if tc.wallet != nil {
+				r.Payment = &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusAuthorized}
+			}
+
+			r.Record(ride.EventAuthorized, ride.ActorSystem, now, map[string]string{"method": string(r.Payment.Method)})
+			r.Record(ride.EventStarted, ride.ActorRider, now, nil)
 
-			rideRepoMock.On("Create", r).Return(nil)
+			rideRepoMock.On("Create", r).Return(tc.createErr)
 
 			_, err := starter.Start(ctx, ride.StartParams{
 				UserID:    userID,
@@ -89,6 +158,58 @@ func TestStart(t *testing.T) {
 			})
 
 			assert.ErrorIs(t, err, tc.expectedError)
+			if tc.wallet != nil {
+				providerMock.AssertNotCalled(t, "Authorize", userID, hold, "")
+			}
+			if tc.createErr != nil {
+				providerMock.AssertCalled(t, "Void", authID)
+			} else {
+				providerMock.AssertNotCalled(t, "Void", authID)
+			}
 		})
 	}
+
+	t.Run("started elsewhere while authorizing", func(t *testing.T) {
+		setup()
+		userRepoMock.On("GetByID", "u_1").Return(&user.User{ID: "u_1"}, nil)
+		vehicleRepoMock.On("GetByID", "v_1").Return(&vehicle.Vehicle{ID: "v_1"}, nil)
+		rideRepoMock.On("IsUserRiding", "u_1").Return(false, nil).Once()
+		rideRepoMock.On("IsUserRiding", "u_1").Return(true, nil)
+		rideRepoMock.On("IsVehicleRiding", "v_1").Return(false, nil)
+		rideRepoMock.On("HasDebt", "u_1").Return(false, nil)
+		walletRepoMock.On("GetByUserID", "u_1").Return(&wallet.Wallet{}, wallet.ErrNotFound)
+		providerMock.On("Authorize", "u_1", hold, "").Return(authID, nil)
+		providerMock.On("Void", authID).Return(nil)
+		idGenMock.On("Generate").Return("r_1")
+
+		r, err := starter.Start(ctx, ride.StartParams{UserID: "u_1", VehicleID: "v_1"})
+
+		assert.ErrorIs(t, err, ride.ErrUserIsRiding)
+		assert.Nil(t, r)
+		providerMock.AssertCalled(t, "Void", authID)
+		rideRepoMock.AssertNotCalled(t, "Create", mock.Anything)
+	})
+
+	t.Run("partner of another user", func(t *testing.T) {
+		testCases := []struct {
+			description string
+			user        *user.User
+		}{
+			{description: "user of another partner", user: &user.User{ID: "u_1", PartnerID: "p_2"}},
+			{description: "user without partner", user: &user.User{ID: "u_1"}},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.description, func(t *testing.T) {
+				setup()
+				userRepoMock.On("GetByID", "u_1").Return(tc.user, nil)
+
+				r, err := starter.Start(ctx, ride.StartParams{UserID: "u_1", VehicleID: "v_1", PartnerID: "p_1"})
+
+				assert.ErrorIs(t, err, ride.ErrNotPartnerUser)
+				assert.Nil(t, r)
+				providerMock.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything, mock.Anything)
+				rideRepoMock.AssertNotCalled(t, "Create", mock.Anything)
+			})
+		}
+	})
 }
@@ -0,0 +1,70 @@
+package ride
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status is the state of a ride. The allowed changes between statuses are defined in transitions.
+type Status string
+
+const (
+	StatusReserved  Status = "RESERVED"
+	StatusActive    Status = "ACTIVE"
+	StatusPaused    Status = "PAUSED"
+	StatusFinished  Status = "FINISHED"
+	StatusPaid      Status = "PAID"
+	StatusCancelled Status = "CANCELLED"
+)
+
+var ErrInvalidTransition = errors.New("ERR_INVALID_TRANSITION")
+
+var transitions = map[Status][]Status{
+	StatusReserved:  {StatusActive, StatusCancelled},
+	StatusActive:    {StatusPaused, StatusFinished, StatusCancelled},
+	StatusPaused:    {StatusActive, StatusFinished, StatusCancelled},
+	StatusFinished:  {StatusPaid},
+	StatusPaid:      {},
+	StatusCancelled: {},
+}
+
+// IsOngoing tells if a ride in this status holds its user and vehicle.
+func (s Status) IsOngoing() bool {
+	return s == StatusReserved || s == StatusActive || s == StatusPaused
+}
+
+// CanTransitionTo tells if a ride in this status can be moved to the given one.
+func (s Status) CanTransitionTo(to Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TransitionError is returned when a ride is moved to a status not allowed from its current one.
+// It matches ErrInvalidTransition with errors.Is.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s: %s -> %s", ErrInvalidTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// TransitionTo moves the ride to the given status, or returns a *TransitionError if it is not allowed.
+func (r *Ride) TransitionTo(to Status) error {
+	if !r.Status.CanTransitionTo(to) {
+		return &TransitionError{From: r.Status, To: to}
+	}
+
+	r.Status = to
+	return nil
+}
@@ -0,0 +1,52 @@
+package ride_test
+
+import (
+	"errors"
+	"testing"
+
+	"reby/domain/ride"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRideTransitionTo(t *testing.T) {
+	testCases := []struct {
+		from    ride.Status
+		to      ride.Status
+		allowed bool
+	}{
+		{from: ride.StatusReserved, to: ride.StatusActive, allowed: true},
+		{from: ride.StatusReserved, to: ride.StatusCancelled, allowed: true},
+		{from: ride.StatusReserved, to: ride.StatusFinished, allowed: false},
+		{from: ride.StatusActive, to: ride.StatusPaused, allowed: true},
+		{from: ride.StatusActive, to: ride.StatusFinished, allowed: true},
+		{from: ride.StatusActive, to: ride.StatusCancelled, allowed: true},
+		{from: ride.StatusActive, to: ride.StatusPaid, allowed: false},
+		{from: ride.StatusPaused, to: ride.StatusActive, allowed: true},
+		{from: ride.StatusPaused, to: ride.StatusFinished, allowed: true},
+		{from: ride.StatusFinished, to: ride.StatusPaid, allowed: true},
+		{from: ride.StatusFinished, to: ride.StatusActive, allowed: false},
+		{from: ride.StatusFinished, to: ride.StatusCancelled, allowed: false},
+		{from: ride.StatusPaid, to: ride.StatusFinished, allowed: false},
+		{from: ride.StatusCancelled, to: ride.StatusActive, allowed: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.from)+"->"+string(tc.to), func(t *testing.T) {
+			r := &ride.Ride{Status: tc.from}
+			err := r.TransitionTo(tc.to)
+			if tc.allowed {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.to, r.Status)
+				return
+			}
+
+			assert.ErrorIs(t, err, ride.ErrInvalidTransition)
+			var transitionErr *ride.TransitionError
+			assert.True(t, errors.As(err, &transitionErr))
+			assert.Equal(t, tc.from, transitionErr.From)
+			assert.Equal(t, tc.to, transitionErr.To)
+			assert.Equal(t, tc.from, r.Status)
+		})
+	}
+}
@@ -9,4 +9,6 @@ var (
 
 type User struct {
 	ID string `json:"id"`
+	// PartnerID is the organisation the user signed up through, if any. Only it can start rides for the user.
+	PartnerID string `json:"partner_id,omitempty"`
 }
@@ -9,4 +9,6 @@ var (
 
 type Vehicle struct {
 	ID string `json:"id"`
+	// Country the vehicle operates in, as an ISO 3166-1 alpha-2 code. Its rides are receipted for it.
+	Country string `json:"country,omitempty"`
 }
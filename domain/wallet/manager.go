@@ -0,0 +1,87 @@
+package wallet
+
+import (
+	"context"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/user"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Manager handles the prepaid wallets of the users.
+type Manager interface {
+	TopUp(ctx context.Context, params TopUpParams) (*Wallet, error)
+	Get(ctx context.Context, userID string) (*Wallet, error)
+}
+
+// TopUpParams of a top-up, Value is in cents of Currency.
+type TopUpParams struct {
+	UserID string
+	Value  int
+}
+
+type manager struct {
+	repo            Repo
+	userRepo        user.Repo
+	paymentProvider payment.Provider
+	idGenerator     id.Generator
+	time            timenow.TimeNow
+}
+
+func NewManager(repo Repo, userRepo user.Repo, paymentProvider payment.Provider, idGenerator id.Generator, time timenow.TimeNow) Manager {
+	return &manager{repo: repo, userRepo: userRepo, paymentProvider: paymentProvider, idGenerator: idGenerator, time: time}
+}
+
+// TopUp charges the payment method of the user and adds the amount to the wallet.
+func (m *manager) TopUp(ctx context.Context, params TopUpParams) (*Wallet, error) {
+	if params.Value <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if _, err := m.userRepo.GetByID(ctx, params.UserID); err != nil {
+		return nil, err
+	}
+
+	amount := money.NewMoney(params.Value, Currency)
+	authID, err := m.paymentProvider.Authorize(ctx, params.UserID, amount, "")
+	if err != nil {
+		return nil, err
+	}
+	if err = m.paymentProvider.Capture(ctx, authID, amount); err != nil {
+		return nil, err
+	}
+
+	topUpID := m.idGenerator.Generate()
+	if err = m.repo.Post(ctx, NewTopUp(topUpID, params.UserID, params.Value, authID, m.time.Now())); err != nil {
+		// Best effort, the user must not pay for money that never reached the wallet
+		_ = m.paymentProvider.Refund(ctx, authID, topUpID, amount)
+		return nil, err
+	}
+
+	return m.repo.GetByUserID(ctx, params.UserID)
+}
+
+func (m *manager) Get(ctx context.Context, userID string) (*Wallet, error) {
+	return m.repo.GetByUserID(ctx, userID)
+}
+
+type ManagerMock struct {
+	mock.Mock
+}
+
+func NewManagerMock() *ManagerMock {
+	return new(ManagerMock)
+}
+
+func (m *ManagerMock) TopUp(_ context.Context, params TopUpParams) (*Wallet, error) {
+	args := m.Mock.Called(params)
+	return args.Get(0).(*Wallet), args.Error(1)
+}
+
+func (m *ManagerMock) Get(_ context.Context, userID string) (*Wallet, error) {
+	args := m.Mock.Called(userID)
+	return args.Get(0).(*Wallet), args.Error(1)
+}
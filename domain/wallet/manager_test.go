@@ -0,0 +1,101 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/user"
+	"reby/domain/wallet"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTopUp(t *testing.T) {
+	var repoMock *wallet.RepoMock
+	var userRepoMock *user.RepoMock
+	var providerMock *payment.ProviderMock
+	var idGenMock *id.GeneratorMock
+	var manager wallet.Manager
+	fixedTime := timenow.NewFixedTime(time.Now())
+	ctx := context.Background()
+
+	userID := "u_1"
+	authID := "auth_1"
+	amount := money.NewMoney(500, wallet.Currency)
+	topUp := wallet.NewTopUp("t_1", userID, 500, authID, fixedTime.Now())
+
+	setup := func() {
+		repoMock = wallet.NewRepoMock()
+		userRepoMock = user.NewRepoMock()
+		providerMock = payment.NewProviderMock()
+		idGenMock = id.NewGeneratorMock()
+		manager = wallet.NewManager(repoMock, userRepoMock, providerMock, idGenMock, fixedTime)
+
+		idGenMock.On("Generate").Return("t_1")
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		userRepoMock.On("GetByID", userID).Return(&user.User{ID: userID}, nil)
+		providerMock.On("Authorize", userID, amount, "").Return(authID, nil)
+		providerMock.On("Capture", authID, amount).Return(nil)
+		repoMock.On("Post", topUp).Return(nil)
+		repoMock.On("GetByUserID", userID).Return(&wallet.Wallet{UserID: userID, Balance: amount}, nil)
+
+		w, err := manager.TopUp(ctx, wallet.TopUpParams{UserID: userID, Value: 500})
+		assert.NoError(t, err)
+		assert.Equal(t, amount, w.Balance)
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		setup()
+		_, err := manager.TopUp(ctx, wallet.TopUpParams{UserID: userID, Value: 0})
+		assert.ErrorIs(t, err, wallet.ErrInvalidAmount)
+		providerMock.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		setup()
+		userRepoMock.On("GetByID", userID).Return(&user.User{ID: userID}, nil)
+		providerMock.On("Authorize", userID, amount, "").Return("", payment.ErrDeclined)
+
+		_, err := manager.TopUp(ctx, wallet.TopUpParams{UserID: userID, Value: 500})
+		assert.ErrorIs(t, err, payment.ErrDeclined)
+		repoMock.AssertNotCalled(t, "Post", mock.Anything)
+	})
+
+	t.Run("post error refunds the payment", func(t *testing.T) {
+		setup()
+		postErr := errors.New("ERR_RANDOM")
+		userRepoMock.On("GetByID", userID).Return(&user.User{ID: userID}, nil)
+		providerMock.On("Authorize", userID, amount, "").Return(authID, nil)
+		providerMock.On("Capture", authID, amount).Return(nil)
+		providerMock.On("Refund", authID, "t_1", amount).Return(nil)
+		repoMock.On("Post", topUp).Return(postErr)
+
+		_, err := manager.TopUp(ctx, wallet.TopUpParams{UserID: userID, Value: 500})
+		assert.ErrorIs(t, err, postErr)
+		providerMock.AssertCalled(t, "Refund", authID, "t_1", amount)
+	})
+}
+
+func TestTransactionValidate(t *testing.T) {
+	now := time.Now()
+
+	assert.NoError(t, wallet.NewTopUp("t_1", "u_1", 500, "auth_1", now).Validate())
+	assert.NoError(t, wallet.NewRideCharge("u_1", "r_1", 200, now).Validate())
+
+	unbalanced := wallet.NewTopUp("t_2", "u_1", 500, "auth_1", now)
+	unbalanced.Entries[0].Amount = money.NewMoney(-400, wallet.Currency)
+	assert.ErrorIs(t, unbalanced.Validate(), wallet.ErrUnbalanced)
+
+	single := wallet.Transaction{ID: "t_3", Entries: []wallet.Entry{{Account: wallet.AccountFunding}}}
+	assert.ErrorIs(t, single.Validate(), wallet.ErrUnbalanced)
+}
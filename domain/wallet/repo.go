@@ -0,0 +1,40 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Repo is the double-entry ledger the wallets are computed from.
+type Repo interface {
+	// GetByUserID returns the wallet of a user, ErrNotFound when the user never topped up.
+	GetByUserID(ctx context.Context, userID string) (*Wallet, error)
+	// Post stores a validated transaction.
+	Post(ctx context.Context, t Transaction) error
+	// GetTransactions returns the transactions of the wallet of a user, oldest first.
+	GetTransactions(ctx context.Context, userID string) ([]Transaction, error)
+}
+
+type RepoMock struct {
+	mock.Mock
+}
+
+func NewRepoMock() *RepoMock {
+	return new(RepoMock)
+}
+
+func (m *RepoMock) GetByUserID(_ context.Context, userID string) (*Wallet, error) {
+	args := m.Mock.Called(userID)
+	return args.Get(0).(*Wallet), args.Error(1)
+}
+
+func (m *RepoMock) Post(_ context.Context, t Transaction) error {
+	args := m.Mock.Called(t)
+	return args.Error(0)
+}
+
+func (m *RepoMock) GetTransactions(_ context.Context, userID string) ([]Transaction, error) {
+	args := m.Mock.Called(userID)
+	return args.Get(0).([]Transaction), args.Error(1)
+}
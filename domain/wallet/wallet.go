@@ -0,0 +1,115 @@
+package wallet
+
+import (
+	"errors"
+	"time"
+
+	"reby/domain/money"
+)
+
+var (
+	ErrNotFound       = errors.New("ERR_WALLET_NOT_FOUND")
+	ErrInvalidAmount  = errors.New("ERR_WALLET_INVALID_AMOUNT")
+	ErrUnbalanced     = errors.New("ERR_WALLET_UNBALANCED_TRANSACTION")
+	ErrAlreadyPosted  = errors.New("ERR_WALLET_TRANSACTION_ALREADY_POSTED")
+	ErrCurrencyChange = errors.New("ERR_WALLET_CURRENCY_MISMATCH")
+)
+
+// Currency of every wallet. To simplify things, all wallets are in EUR like the rides.
+const Currency = "EUR"
+
+// Account of the ledger. Every user wallet is an account, money comes in through AccountFunding
+// and goes out to AccountRevenue.
+type Account string
+
+const (
+	AccountFunding Account = "FUNDING"
+	AccountRevenue Account = "REVENUE"
+)
+
+// UserAccount is the account holding the wallet of a user.
+func UserAccount(userID string) Account {
+	return Account("USER:" + userID)
+}
+
+// Kind of ledger transaction.
+type Kind string
+
+const (
+	KindTopUp      Kind = "TOP_UP"
+	KindRideCharge Kind = "RIDE_CHARGE"
+	KindRideRefund Kind = "RIDE_REFUND"
+)
+
+// Entry moves Amount into Account, or out of it when the amount is negative.
+type Entry struct {
+	Account Account     `json:"account"`
+	Amount  money.Money `json:"amount"`
+}
+
+// Transaction is a set of ledger entries that are posted together. Its entries always add up to zero.
+type Transaction struct {
+	ID        string    `json:"id"`
+	Kind      Kind      `json:"kind"`
+	Reference string    `json:"reference"`
+	Entries   []Entry   `json:"entries"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the transaction can be posted to the ledger.
+func (t Transaction) Validate() error {
+	if len(t.Entries) < 2 {
+		return ErrUnbalanced
+	}
+
+	var sum money.Value
+	for _, e := range t.Entries {
+		if e.Amount.Currency != Currency {
+			return ErrCurrencyChange
+		}
+		sum += e.Amount.Value
+	}
+	if sum != 0 {
+		return ErrUnbalanced
+	}
+
+	return nil
+}
+
+// transfer returns a transaction moving value from one account to another.
+func transfer(id string, kind Kind, reference string, from, to Account, value int, at time.Time) Transaction {
+	return Transaction{
+		ID:        id,
+		Kind:      kind,
+		Reference: reference,
+		Entries: []Entry{
+			{Account: from, Amount: money.NewMoney(-value, Currency)},
+			{Account: to, Amount: money.NewMoney(value, Currency)},
+		},
+		CreatedAt: at,
+	}
+}
+
+// NewTopUp returns the transaction adding value to the wallet of a user. The reference is the payment authorization
+// that funded it.
+func NewTopUp(id string, userID string, value int, reference string, at time.Time) Transaction {
+	return transfer(id, KindTopUp, reference, AccountFunding, UserAccount(userID), value, at)
+}
+
+// NewRideCharge returns the transaction paying the price of a ride from the wallet of its user. The wallet balance
+// may become negative, which the user owes. Its ID is derived from the ride, so a ride is never charged twice.
+func NewRideCharge(userID string, rideID string, value int, at time.Time) Transaction {
+	return transfer(string(KindRideCharge)+":"+rideID, KindRideCharge, rideID, UserAccount(userID), AccountRevenue, value, at)
+}
+
+// NewRideRefund returns the transaction giving back value of a ride charge to the wallet of its user. Its ID is
+// derived from the ride adjustment, so an adjustment is never refunded twice.
+func NewRideRefund(adjustmentID string, userID string, rideID string, value int, at time.Time) Transaction {
+	return transfer(string(KindRideRefund)+":"+adjustmentID, KindRideRefund, rideID, AccountRevenue, UserAccount(userID), value, at)
+}
+
+// Wallet is the prepaid balance of a user.
+type Wallet struct {
+	UserID  string      `json:"user_id"`
+	Balance money.Money `json:"balance"`
+}
@@ -0,0 +1,23 @@
+package webhook_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"reby/domain/webhook"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	_, err := webhook.NewClient(time.Second).Get(receiver.URL)
+	assert.True(t, errors.Is(err, webhook.ErrInvalidURL), err)
+}
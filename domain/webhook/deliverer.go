@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Deliverer sends the due deliveries to their subscriptions. Failed attempts are retried with exponential backoff
+// and the deliveries that run out of attempts are moved to the dead-letter list.
+type Deliverer interface {
+	Deliver(ctx context.Context) (int, error)
+}
+
+// RetryPolicy tells how many times a delivery is attempted and how long to wait after the first failure.
+// The wait doubles after every failed attempt.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	return p.BaseDelay * time.Duration(1<<uint(attempts-1))
+}
+
+type deliverer struct {
+	repo      Repo
+	client    *http.Client
+	time      timenow.TimeNow
+	policy    RetryPolicy
+	batchSize int
+}
+
+func NewDeliverer(repo Repo, client *http.Client, time timenow.TimeNow, policy RetryPolicy, batchSize int) Deliverer {
+	return &deliverer{repo: repo, client: client, time: time, policy: policy, batchSize: batchSize}
+}
+
+// Deliver attempts a batch of due deliveries and returns how many succeeded.
+func (d *deliverer) Deliver(ctx context.Context) (int, error) {
+	deliveries, err := d.repo.GetDueDeliveries(ctx, d.time.Now(), d.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var delivered int
+	for _, dl := range deliveries {
+		sendErr := d.send(ctx, dl)
+		d.record(dl, sendErr)
+		if err = d.repo.UpdateDelivery(ctx, dl); err != nil {
+			return delivered, err
+		}
+		if sendErr == nil {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+func (d *deliverer) send(ctx context.Context, dl *Delivery) error {
+	s, err := d.repo.GetSubscription(ctx, dl.SubscriptionID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrSubscriptionDeleted
+		}
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return err
+	}
+	now := d.time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.EventType)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(s.Secret, now, dl.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("subscriber responded %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// record updates the delivery with the result of an attempt.
+func (d *deliverer) record(dl *Delivery, sendErr error) {
+	dl.Attempts++
+	if sendErr == nil {
+		dl.Status = DeliveryDelivered
+		dl.LastError = ""
+		return
+	}
+
+	dl.LastError = sendErr.Error()
+	if dl.Attempts >= d.policy.MaxAttempts || errors.Is(sendErr, ErrSubscriptionDeleted) {
+		dl.Status = DeliveryDead
+		return
+	}
+	dl.NextAttemptAt = d.time.Now().Add(d.policy.delay(dl.Attempts))
+}
+
+type DelivererMock struct {
+	mock.Mock
+}
+
+func NewDelivererMock() *DelivererMock {
+	return new(DelivererMock)
+}
+
+func (m *DelivererMock) Deliver(_ context.Context) (int, error) {
+	args := m.Mock.Called()
+	return args.Int(0), args.Error(1)
+}
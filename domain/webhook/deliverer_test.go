@@ -0,0 +1,145 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"reby/domain/ride"
+	"reby/domain/webhook"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliver(t *testing.T) {
+	fixedTime := timenow.NewFixedTime(time.Now())
+	now := fixedTime.Now()
+	policy := webhook.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute}
+	secret := "s3cr3t"
+	payload := []byte(`{"id":7,"type":"RideFinished"}`)
+	ctx := context.Background()
+
+	var status int
+	var received *http.Request
+	var receivedBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received, receivedBody = r, body
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	subscription := &webhook.Subscription{
+		ID:     "wh_1",
+		URL:    receiver.URL,
+		Events: []string{ride.MessageRideFinished},
+		Secret: secret,
+	}
+
+	testCases := []struct {
+		description      string
+		subscriptionErr  error
+		responseStatus   int
+		previousAttempts int
+		expectedStatus   webhook.DeliveryStatus
+		expectedNext     time.Time
+		expectedCount    int
+	}{
+		{
+			description:    "delivered",
+			responseStatus: http.StatusNoContent,
+			expectedStatus: webhook.DeliveryDelivered,
+			expectedNext:   now,
+			expectedCount:  1,
+		},
+		{
+			description:    "first failure is retried after the base delay",
+			responseStatus: http.StatusInternalServerError,
+			expectedStatus: webhook.DeliveryPending,
+			expectedNext:   now.Add(time.Minute),
+		},
+		{
+			description:      "delay doubles after every failure",
+			responseStatus:   http.StatusBadGateway,
+			previousAttempts: 1,
+			expectedStatus:   webhook.DeliveryPending,
+			expectedNext:     now.Add(2 * time.Minute),
+		},
+		{
+			description:      "last attempt moves it to the dead letters",
+			responseStatus:   http.StatusInternalServerError,
+			previousAttempts: 2,
+			expectedStatus:   webhook.DeliveryDead,
+			expectedNext:     now,
+		},
+		{
+			description:     "deleted subscription",
+			subscriptionErr: webhook.ErrNotFound,
+			expectedStatus:  webhook.DeliveryDead,
+			expectedNext:    now,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			status = tc.responseStatus
+			received = nil
+			repoMock := webhook.NewRepoMock()
+			deliverer := webhook.NewDeliverer(repoMock, receiver.Client(), fixedTime, policy, 10)
+
+			d := &webhook.Delivery{
+				ID:             "d_1",
+				SubscriptionID: subscription.ID,
+				MessageID:      7,
+				EventType:      ride.MessageRideFinished,
+				Payload:        payload,
+				Status:         webhook.DeliveryPending,
+				Attempts:       tc.previousAttempts,
+				NextAttemptAt:  now,
+			}
+			repoMock.On("GetDueDeliveries", now, 10).Return([]*webhook.Delivery{d}, nil)
+			repoMock.On("GetSubscription", subscription.ID).Return(subscription, tc.subscriptionErr)
+			repoMock.On("UpdateDelivery", d).Return(nil)
+
+			delivered, err := deliverer.Deliver(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCount, delivered)
+			assert.Equal(t, tc.expectedStatus, d.Status)
+			assert.Equal(t, tc.previousAttempts+1, d.Attempts)
+			assert.Equal(t, tc.expectedNext, d.NextAttemptAt)
+			if tc.expectedStatus == webhook.DeliveryDelivered {
+				assert.Empty(t, d.LastError)
+			} else {
+				assert.NotEmpty(t, d.LastError)
+			}
+
+			if tc.subscriptionErr != nil {
+				assert.Nil(t, received)
+				return
+			}
+			require.NotNil(t, received)
+			assert.Equal(t, payload, receivedBody)
+			assert.Equal(t, ride.MessageRideFinished, received.Header.Get(webhook.EventHeader))
+			assert.Equal(t, strconv.FormatInt(now.Unix(), 10), received.Header.Get(webhook.TimestampHeader))
+			assert.Equal(t, webhook.Sign(secret, now, payload), received.Header.Get(webhook.SignatureHeader))
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+
+	signature := webhook.Sign("secret", ts, body)
+	assert.Len(t, signature, 64)
+	assert.Equal(t, signature, webhook.Sign("secret", ts, body))
+	assert.NotEqual(t, signature, webhook.Sign("other", ts, body))
+	assert.NotEqual(t, signature, webhook.Sign("secret", ts.Add(time.Second), body))
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	"reby/pkg/event"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+)
+
+type dispatcher struct {
+	repo        Repo
+	idGenerator id.Generator
+	time        timenow.TimeNow
+}
+
+// NewDispatcher returns an event.Sink that schedules a delivery of every message to each subscription that wants it
+// and sees its ride. Deliveries are sent by the Deliverer, so a slow or failing subscriber does not block the outbox
+// relay.
+func NewDispatcher(repo Repo, idGenerator id.Generator, time timenow.TimeNow) event.Sink {
+	return &dispatcher{repo: repo, idGenerator: idGenerator, time: time}
+}
+
+func (d *dispatcher) Publish(ctx context.Context, msg event.Message) error {
+	subscriptions, err := d.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Every message published is a ride event, with the ride as its payload
+	var r struct {
+		PartnerID string `json:"partner_id"`
+	}
+	if err = json.Unmarshal(msg.Payload, &r); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	now := d.time.Now()
+	deliveries := make([]*Delivery, 0)
+	for _, s := range subscriptions {
+		if !s.Wants(msg.Type) || !s.Sees(r.PartnerID) {
+			continue
+		}
+		deliveries = append(deliveries, &Delivery{
+			ID:             d.idGenerator.Generate(),
+			SubscriptionID: s.ID,
+			MessageID:      msg.ID,
+			EventType:      msg.Type,
+			Payload:        payload,
+			Status:         DeliveryPending,
+			Attempts:       0,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return d.repo.CreateDeliveries(ctx, deliveries)
+}
@@ -0,0 +1,81 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"reby/domain/ride"
+	"reby/domain/webhook"
+	"reby/pkg/event"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcherPublish(t *testing.T) {
+	repoMock := webhook.NewRepoMock()
+	idGenMock := id.NewGeneratorMock()
+	fixedTime := timenow.NewFixedTime(time.Now())
+	dispatcher := webhook.NewDispatcher(repoMock, idGenMock, fixedTime)
+
+	msg := event.Message{
+		ID:          7,
+		Type:        ride.MessageRideFinished,
+		AggregateID: "r_1",
+		OccurredAt:  fixedTime.Now(),
+		Payload:     json.RawMessage(`{"id":"r_1","partner_id":"p_1"}`),
+	}
+	payload, err := json.Marshal(msg)
+	require.NoError(t, err)
+
+	repoMock.On("ListSubscriptions").Return([]*webhook.Subscription{
+		{ID: "wh_1", Events: []string{ride.MessageRideStarted}},
+		{ID: "wh_2", Events: []string{ride.MessageRideStarted, ride.MessageRideFinished}},
+		{ID: "wh_3", PartnerID: "p_1", Events: []string{ride.MessageRideFinished}},
+		// The rides of other partners are not delivered
+		{ID: "wh_4", PartnerID: "p_2", Events: []string{ride.MessageRideFinished}},
+	}, nil)
+	idGenMock.On("Generate").Return("d_1").Once()
+	idGenMock.On("Generate").Return("d_2").Once()
+	delivery := func(id, subscriptionID string) *webhook.Delivery {
+		return &webhook.Delivery{
+			ID:             id,
+			SubscriptionID: subscriptionID,
+			MessageID:      7,
+			EventType:      ride.MessageRideFinished,
+			Payload:        payload,
+			Status:         webhook.DeliveryPending,
+			NextAttemptAt:  fixedTime.Now(),
+			CreatedAt:      fixedTime.Now(),
+		}
+	}
+	repoMock.On("CreateDeliveries", []*webhook.Delivery{delivery("d_1", "wh_2"), delivery("d_2", "wh_3")}).Return(nil)
+
+	assert.NoError(t, dispatcher.Publish(context.Background(), msg))
+	repoMock.AssertExpectations(t)
+}
+
+func TestDispatcherPublishRideOfUser(t *testing.T) {
+	repoMock := webhook.NewRepoMock()
+	idGenMock := id.NewGeneratorMock()
+	dispatcher := webhook.NewDispatcher(repoMock, idGenMock, timenow.NewFixedTime(time.Now()))
+
+	// Rides started by the users themselves only reach the platform's subscriptions
+	repoMock.On("ListSubscriptions").Return([]*webhook.Subscription{
+		{ID: "wh_1", PartnerID: "p_1", Events: []string{ride.MessageRideStarted}},
+	}, nil)
+
+	err := dispatcher.Publish(context.Background(), event.Message{
+		ID:          8,
+		Type:        ride.MessageRideStarted,
+		AggregateID: "r_2",
+		Payload:     json.RawMessage(`{"id":"r_2"}`),
+	})
+	assert.NoError(t, err)
+	repoMock.AssertNotCalled(t, "CreateDeliveries", mock.Anything)
+}
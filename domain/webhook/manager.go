@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"reby/domain/ride"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// SupportedEvents are the domain events a subscription can receive.
+var SupportedEvents = []string{ride.MessageRideStarted, ride.MessageRideFinished}
+
+// Manager handles the webhook subscriptions and the deliveries that ran out of attempts.
+type Manager interface {
+	Subscribe(ctx context.Context, params SubscribeParams) (*Subscription, error)
+	// List returns the subscriptions of partnerID, or every subscription when it is empty.
+	List(ctx context.Context, partnerID string) ([]*Subscription, error)
+	// Unsubscribe deletes a subscription of partnerID, or any subscription when it is empty.
+	Unsubscribe(ctx context.Context, partnerID string, id string) error
+	ListDeadLetters(ctx context.Context) ([]*Delivery, error)
+	Replay(ctx context.Context, deliveryID string) (*Delivery, error)
+}
+
+// SubscribeParams of a new subscription. A secret is generated when none is given.
+type SubscribeParams struct {
+	// PartnerID owns the subscription, empty for the platform's own.
+	PartnerID string
+	URL       string
+	Events    []string
+	Secret    string
+}
+
+type manager struct {
+	repo            Repo
+	idGenerator     id.Generator
+	secretGenerator id.Generator
+	time            timenow.TimeNow
+}
+
+func NewManager(repo Repo, idGenerator id.Generator, secretGenerator id.Generator, time timenow.TimeNow) Manager {
+	return &manager{repo: repo, idGenerator: idGenerator, secretGenerator: secretGenerator, time: time}
+}
+
+// Subscribe creates a subscription. The returned subscription is the only one that includes the secret.
+func (m *manager) Subscribe(ctx context.Context, params SubscribeParams) (*Subscription, error) {
+	if err := validateURL(params.URL); err != nil {
+		return nil, err
+	}
+	if err := validateEvents(params.Events); err != nil {
+		return nil, err
+	}
+
+	secret := params.Secret
+	if secret == "" {
+		secret = m.secretGenerator.Generate()
+	}
+
+	s := &Subscription{
+		ID:        m.idGenerator.Generate(),
+		PartnerID: params.PartnerID,
+		URL:       params.URL,
+		Events:    params.Events,
+		Secret:    secret,
+		CreatedAt: m.time.Now(),
+	}
+	if err := m.repo.CreateSubscription(ctx, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *manager) List(ctx context.Context, partnerID string) ([]*Subscription, error) {
+	subscriptions, err := m.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make([]*Subscription, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		if partnerID != "" && s.PartnerID != partnerID {
+			continue
+		}
+		s.Secret = ""
+		owned = append(owned, s)
+	}
+
+	return owned, nil
+}
+
+func (m *manager) Unsubscribe(ctx context.Context, partnerID string, id string) error {
+	if partnerID != "" {
+		s, err := m.repo.GetSubscription(ctx, id)
+		if err != nil {
+			return err
+		}
+		// The subscriptions of other partners are not found, rather than forbidden, not to tell they exist
+		if s.PartnerID != partnerID {
+			return ErrNotFound
+		}
+	}
+
+	return m.repo.DeleteSubscription(ctx, id)
+}
+
+func (m *manager) ListDeadLetters(ctx context.Context) ([]*Delivery, error) {
+	return m.repo.ListDeliveries(ctx, DeliveryDead)
+}
+
+// Replay schedules a dead delivery to be attempted again as soon as possible, with a fresh number of attempts.
+func (m *manager) Replay(ctx context.Context, deliveryID string) (*Delivery, error) {
+	d, err := m.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != DeliveryDead {
+		return nil, ErrDeliveryNotDead
+	}
+
+	d.Status = DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = m.time.Now()
+	d.LastError = ""
+	if err = m.repo.UpdateDelivery(ctx, d); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// validateURL only takes https URLs of public hosts. Hosts named by DNS are checked again when dialled, see
+// NewClient, as they can resolve to another address by then.
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrInvalidURL
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublic(ip) {
+		return ErrInvalidURL
+	}
+
+	return nil
+}
+
+func validateEvents(events []string) error {
+	if len(events) == 0 {
+		return ErrInvalidEvents
+	}
+
+	for _, e := range events {
+		supported := false
+		for _, se := range SupportedEvents {
+			if e == se {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return ErrInvalidEvents
+		}
+	}
+
+	return nil
+}
+
+type ManagerMock struct {
+	mock.Mock
+}
+
+func NewManagerMock() *ManagerMock {
+	return new(ManagerMock)
+}
+
+func (m *ManagerMock) Subscribe(_ context.Context, params SubscribeParams) (*Subscription, error) {
+	args := m.Mock.Called(params)
+	return args.Get(0).(*Subscription), args.Error(1)
+}
+
+func (m *ManagerMock) List(_ context.Context, partnerID string) ([]*Subscription, error) {
+	args := m.Mock.Called(partnerID)
+	return args.Get(0).([]*Subscription), args.Error(1)
+}
+
+func (m *ManagerMock) Unsubscribe(_ context.Context, partnerID string, id string) error {
+	args := m.Mock.Called(partnerID, id)
+	return args.Error(0)
+}
+
+func (m *ManagerMock) ListDeadLetters(_ context.Context) ([]*Delivery, error) {
+	args := m.Mock.Called()
+	return args.Get(0).([]*Delivery), args.Error(1)
+}
+
+func (m *ManagerMock) Replay(_ context.Context, deliveryID string) (*Delivery, error) {
+	args := m.Mock.Called(deliveryID)
+	return args.Get(0).(*Delivery), args.Error(1)
+}
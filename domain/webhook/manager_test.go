@@ -0,0 +1,260 @@
+package webhook_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/ride"
+	"reby/domain/webhook"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSubscribe(t *testing.T) {
+	var repoMock *webhook.RepoMock
+	var idGenMock, secretGenMock *id.GeneratorMock
+	var manager webhook.Manager
+	fixedTime := timenow.NewFixedTime(time.Now())
+	ctx := context.Background()
+
+	setup := func() {
+		repoMock = webhook.NewRepoMock()
+		idGenMock = id.NewGeneratorMock()
+		secretGenMock = id.NewGeneratorMock()
+		manager = webhook.NewManager(repoMock, idGenMock, secretGenMock, fixedTime)
+	}
+
+	testCases := []struct {
+		description    string
+		params         webhook.SubscribeParams
+		expectedSecret string
+		expectedErr    error
+	}{
+		{
+			description: "ok",
+			params: webhook.SubscribeParams{
+				URL:    "https://partner.test/hooks",
+				Events: []string{ride.MessageRideStarted, ride.MessageRideFinished},
+				Secret: "s3cr3t",
+			},
+			expectedSecret: "s3cr3t",
+		},
+		{
+			description: "generated secret",
+			params: webhook.SubscribeParams{
+				URL:    "https://partner.test/hooks",
+				Events: []string{ride.MessageRideFinished},
+			},
+			expectedSecret: "generated",
+		},
+		{
+			description: "partner subscription",
+			params: webhook.SubscribeParams{
+				PartnerID: "p_1",
+				URL:       "https://93.184.216.34/hooks",
+				Events:    []string{ride.MessageRideFinished},
+				Secret:    "s3cr3t",
+			},
+			expectedSecret: "s3cr3t",
+		},
+		{
+			description: "invalid url",
+			params: webhook.SubscribeParams{
+				URL:    "partner.test/hooks",
+				Events: []string{ride.MessageRideFinished},
+			},
+			expectedErr: webhook.ErrInvalidURL,
+		},
+		{
+			description: "plain http",
+			params: webhook.SubscribeParams{
+				URL:    "http://partner.test/hooks",
+				Events: []string{ride.MessageRideFinished},
+			},
+			expectedErr: webhook.ErrInvalidURL,
+		},
+		{
+			description: "localhost",
+			params: webhook.SubscribeParams{
+				URL:    "https://localhost:8080/hooks",
+				Events: []string{ride.MessageRideFinished},
+			},
+			expectedErr: webhook.ErrInvalidURL,
+		},
+		{
+			description: "loopback address",
+			params: webhook.SubscribeParams{
+				URL:    "https://[::1]/hooks",
+				Events: []string{ride.MessageRideFinished},
+			},
+			expectedErr: webhook.ErrInvalidURL,
+		},
+		{
+			description: "private address",
+			params: webhook.SubscribeParams{
+				URL:    "https://10.0.0.7/hooks",
+				Events: []string{ride.MessageRideFinished},
+			},
+			expectedErr: webhook.ErrInvalidURL,
+		},
+		{
+			description: "link-local address",
+			params: webhook.SubscribeParams{
+				URL:    "https://169.254.169.254/latest/meta-data",
+				Events: []string{ride.MessageRideFinished},
+			},
+			expectedErr: webhook.ErrInvalidURL,
+		},
+		{
+			description: "no events",
+			params: webhook.SubscribeParams{
+				URL: "https://partner.test/hooks",
+			},
+			expectedErr: webhook.ErrInvalidEvents,
+		},
+		{
+			description: "unknown event",
+			params: webhook.SubscribeParams{
+				URL:    "https://partner.test/hooks",
+				Events: []string{"RidePainted"},
+			},
+			expectedErr: webhook.ErrInvalidEvents,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setup()
+			idGenMock.On("Generate").Return("wh_1")
+			secretGenMock.On("Generate").Return("generated")
+			repoMock.On("CreateSubscription", mock.Anything).Return(nil)
+
+			s, err := manager.Subscribe(ctx, tc.params)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if tc.expectedErr != nil {
+				repoMock.AssertNotCalled(t, "CreateSubscription", mock.Anything)
+				return
+			}
+			assert.Equal(t, &webhook.Subscription{
+				ID:        "wh_1",
+				PartnerID: tc.params.PartnerID,
+				URL:       tc.params.URL,
+				Events:    tc.params.Events,
+				Secret:    tc.expectedSecret,
+				CreatedAt: fixedTime.Now(),
+			}, s)
+		})
+	}
+}
+
+func TestListHidesSecrets(t *testing.T) {
+	repoMock := webhook.NewRepoMock()
+	manager := webhook.NewManager(repoMock, nil, nil, timenow.NewFixedTime(time.Now()))
+	repoMock.On("ListSubscriptions").Return([]*webhook.Subscription{{ID: "wh_1", Secret: "s3cr3t"}}, nil)
+
+	subscriptions, err := manager.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, subscriptions, 1)
+	assert.Empty(t, subscriptions[0].Secret)
+}
+
+func TestListByPartner(t *testing.T) {
+	repoMock := webhook.NewRepoMock()
+	manager := webhook.NewManager(repoMock, nil, nil, timenow.NewFixedTime(time.Now()))
+	repoMock.On("ListSubscriptions").Return([]*webhook.Subscription{
+		{ID: "wh_1"},
+		{ID: "wh_2", PartnerID: "p_1"},
+		{ID: "wh_3", PartnerID: "p_2"},
+	}, nil)
+
+	subscriptions, err := manager.List(context.Background(), "p_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []*webhook.Subscription{{ID: "wh_2", PartnerID: "p_1"}}, subscriptions)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	var repoMock *webhook.RepoMock
+	var manager webhook.Manager
+	ctx := context.Background()
+
+	setup := func() {
+		repoMock = webhook.NewRepoMock()
+		manager = webhook.NewManager(repoMock, nil, nil, timenow.NewFixedTime(time.Now()))
+		repoMock.On("GetSubscription", "wh_1").Return(&webhook.Subscription{ID: "wh_1", PartnerID: "p_1"}, nil)
+		repoMock.On("DeleteSubscription", "wh_1").Return(nil)
+	}
+
+	t.Run("own subscription", func(t *testing.T) {
+		setup()
+		assert.NoError(t, manager.Unsubscribe(ctx, "p_1", "wh_1"))
+		repoMock.AssertCalled(t, "DeleteSubscription", "wh_1")
+	})
+
+	t.Run("subscription of another partner", func(t *testing.T) {
+		setup()
+		assert.ErrorIs(t, manager.Unsubscribe(ctx, "p_2", "wh_1"), webhook.ErrNotFound)
+		repoMock.AssertNotCalled(t, "DeleteSubscription", mock.Anything)
+	})
+
+	t.Run("any subscription", func(t *testing.T) {
+		setup()
+		assert.NoError(t, manager.Unsubscribe(ctx, "", "wh_1"))
+		repoMock.AssertNotCalled(t, "GetSubscription", mock.Anything)
+	})
+}
+
+func TestReplay(t *testing.T) {
+	var repoMock *webhook.RepoMock
+	var manager webhook.Manager
+	fixedTime := timenow.NewFixedTime(time.Now())
+	ctx := context.Background()
+
+	setup := func() {
+		repoMock = webhook.NewRepoMock()
+		manager = webhook.NewManager(repoMock, nil, nil, fixedTime)
+	}
+
+	t.Run("not dead", func(t *testing.T) {
+		setup()
+		repoMock.On("GetDelivery", "d_1").Return(&webhook.Delivery{ID: "d_1", Status: webhook.DeliveryPending}, nil)
+
+		d, err := manager.Replay(ctx, "d_1")
+		assert.ErrorIs(t, err, webhook.ErrDeliveryNotDead)
+		assert.Nil(t, d)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		setup()
+		repoMock.On("GetDelivery", "d_1").Return((*webhook.Delivery)(nil), webhook.ErrDeliveryNotFound)
+
+		_, err := manager.Replay(ctx, "d_1")
+		assert.ErrorIs(t, err, webhook.ErrDeliveryNotFound)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		setup()
+		dead := &webhook.Delivery{
+			ID:            "d_1",
+			Status:        webhook.DeliveryDead,
+			Attempts:      5,
+			NextAttemptAt: fixedTime.Now().Add(-time.Hour),
+			LastError:     "subscriber responded 500",
+		}
+		repoMock.On("GetDelivery", "d_1").Return(dead, nil)
+		expected := &webhook.Delivery{
+			ID:            "d_1",
+			Status:        webhook.DeliveryPending,
+			Attempts:      0,
+			NextAttemptAt: fixedTime.Now(),
+		}
+		repoMock.On("UpdateDelivery", expected).Return(nil)
+
+		d, err := manager.Replay(ctx, "d_1")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, d)
+	})
+}
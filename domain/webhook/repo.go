@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type Repo interface {
+	CreateSubscription(ctx context.Context, s *Subscription) error
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	// CreateDeliveries stores new deliveries, ignoring the ones already stored for the same subscription and message.
+	CreateDeliveries(ctx context.Context, deliveries []*Delivery) error
+	GetDelivery(ctx context.Context, id string) (*Delivery, error)
+	// GetDueDeliveries returns up to limit pending deliveries to be attempted at or before t, oldest first.
+	GetDueDeliveries(ctx context.Context, t time.Time, limit int) ([]*Delivery, error)
+	ListDeliveries(ctx context.Context, status DeliveryStatus) ([]*Delivery, error)
+	UpdateDelivery(ctx context.Context, d *Delivery) error
+}
+
+type RepoMock struct {
+	mock.Mock
+}
+
+func NewRepoMock() *RepoMock {
+	return new(RepoMock)
+}
+
+func (m *RepoMock) CreateSubscription(_ context.Context, s *Subscription) error {
+	args := m.Mock.Called(s)
+	return args.Error(0)
+}
+
+func (m *RepoMock) GetSubscription(_ context.Context, id string) (*Subscription, error) {
+	args := m.Mock.Called(id)
+	return args.Get(0).(*Subscription), args.Error(1)
+}
+
+func (m *RepoMock) ListSubscriptions(_ context.Context) ([]*Subscription, error) {
+	args := m.Mock.Called()
+	return args.Get(0).([]*Subscription), args.Error(1)
+}
+
+func (m *RepoMock) DeleteSubscription(_ context.Context, id string) error {
+	args := m.Mock.Called(id)
+	return args.Error(0)
+}
+
+func (m *RepoMock) CreateDeliveries(_ context.Context, deliveries []*Delivery) error {
+	args := m.Mock.Called(deliveries)
+	return args.Error(0)
+}
+
+func (m *RepoMock) GetDelivery(_ context.Context, id string) (*Delivery, error) {
+	args := m.Mock.Called(id)
+	return args.Get(0).(*Delivery), args.Error(1)
+}
+
+func (m *RepoMock) GetDueDeliveries(_ context.Context, t time.Time, limit int) ([]*Delivery, error) {
+	args := m.Mock.Called(t, limit)
+	return args.Get(0).([]*Delivery), args.Error(1)
+}
+
+func (m *RepoMock) ListDeliveries(_ context.Context, status DeliveryStatus) ([]*Delivery, error) {
+	args := m.Mock.Called(status)
+	return args.Get(0).([]*Delivery), args.Error(1)
+}
+
+func (m *RepoMock) UpdateDelivery(_ context.Context, d *Delivery) error {
+	args := m.Mock.Called(d)
+	return args.Error(0)
+}
@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNotFound            = errors.New("ERR_WEBHOOK_NOT_FOUND")
+	ErrDeliveryNotFound    = errors.New("ERR_WEBHOOK_DELIVERY_NOT_FOUND")
+	ErrInvalidURL          = errors.New("ERR_WEBHOOK_INVALID_URL")
+	ErrInvalidEvents       = errors.New("ERR_WEBHOOK_INVALID_EVENTS")
+	ErrDeliveryNotDead     = errors.New("ERR_WEBHOOK_DELIVERY_NOT_DEAD")
+	ErrSubscriptionDeleted = errors.New("ERR_WEBHOOK_SUBSCRIPTION_DELETED")
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// the subscription secret, so receivers can check both the sender and the freshness of the request.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+)
+
+// Subscription is an URL that receives the given domain events.
+type Subscription struct {
+	ID string `json:"id"`
+	// PartnerID owns the subscription, which only receives the events of the rides of the partner. Subscriptions
+	// without one are the platform's own and receive the events of every ride.
+	PartnerID string    `json:"partner_id,omitempty"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants tells if the subscription receives the events of eventType.
+func (s *Subscription) Wants(eventType string) bool {
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sees tells if the subscription receives the events of the rides started by partnerID, empty for the rides started
+// by the users themselves.
+func (s *Subscription) Sees(partnerID string) bool {
+	return s.PartnerID == "" || s.PartnerID == partnerID
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "PENDING"
+	DeliveryDelivered DeliveryStatus = "DELIVERED"
+	// DeliveryDead deliveries ran out of attempts. They stay in the dead-letter list until replayed.
+	DeliveryDead DeliveryStatus = "DEAD"
+)
+
+// Delivery is a domain event to be sent to a subscription.
+type Delivery struct {
+	ID             string         `json:"id"`
+	SubscriptionID string         `json:"subscription_id"`
+	MessageID      int64          `json:"message_id"`
+	EventType      string         `json:"event_type"`
+	Payload        []byte         `json:"-"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	LastError      string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// Sign returns the signature of a delivery body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
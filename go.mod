@@ -8,4 +8,5 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/spf13/viper v1.15.0
 	github.com/stretchr/testify v1.8.3
+	modernc.org/sqlite v1.21.2
 )
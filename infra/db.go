@@ -3,4 +3,5 @@ package infra
 const (
 	InMemory = "MEMORY"
 	Postgres = "POSTGRES"
+	SQLite   = "SQLITE"
 )
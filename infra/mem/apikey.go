@@ -0,0 +1,157 @@
+package mem
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/pkg/txn"
+)
+
+type apiKeyDB struct {
+	mu   sync.RWMutex
+	keys map[string]apikey.APIKey
+	wal  *wal
+}
+
+func NewAPIKeyDB() apikey.Repo {
+	return newAPIKeyDB()
+}
+
+func newAPIKeyDB() *apiKeyDB {
+	return &apiKeyDB{keys: make(map[string]apikey.APIKey)}
+}
+
+func (m *apiKeyDB) Create(ctx context.Context, k *apikey.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.save(ctx, copyAPIKey(*k))
+}
+
+func (m *apiKeyDB) GetByID(_ context.Context, id string) (*apikey.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ok := m.keys[id]
+	if !ok {
+		return nil, apikey.ErrNotFound
+	}
+	k = copyAPIKey(k)
+
+	return &k, nil
+}
+
+func (m *apiKeyDB) GetByHash(_ context.Context, hash string) (*apikey.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.keys {
+		if k.Hash == hash {
+			k = copyAPIKey(k)
+			return &k, nil
+		}
+	}
+
+	return nil, apikey.ErrNotFound
+}
+
+func (m *apiKeyDB) ListByPartner(_ context.Context, partnerID string) ([]*apikey.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]*apikey.APIKey, 0)
+	for _, k := range m.keys {
+		if k.PartnerID == partnerID {
+			k := copyAPIKey(k)
+			keys = append(keys, &k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// Update stores the lifecycle of a key, its secret and scopes never change.
+func (m *apiKeyDB) Update(ctx context.Context, k *apikey.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kDB, ok := m.keys[k.ID]
+	if !ok {
+		return apikey.ErrNotFound
+	}
+	kDB.ExpiresAt = copyTime(k.ExpiresAt)
+	kDB.RevokedAt = copyTime(k.RevokedAt)
+
+	return m.save(ctx, kDB)
+}
+
+func (m *apiKeyDB) Touch(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.keys[id]
+	if !ok {
+		return apikey.ErrNotFound
+	}
+	k.LastUsedAt = &at
+
+	return m.save(ctx, k)
+}
+
+// save logs and stores k, holding the lock. The key it replaces is restored when the unit of work in ctx is rolled
+// back.
+func (m *apiKeyDB) save(ctx context.Context, k apikey.APIKey) error {
+	if err := m.wal.append(record{Op: opSaveAPIKey, APIKey: newAPIKeyRecord(k)}); err != nil {
+		return err
+	}
+
+	prev, existed := m.keys[k.ID]
+	m.keys[k.ID] = k
+	txn.OnRollback(ctx, func() { m.rollback(k.ID, prev, existed) })
+
+	return nil
+}
+
+// rollback restores the key of id to prev, or removes it when it didn't exist before.
+func (m *apiKeyDB) rollback(id string, prev apikey.APIKey, existed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := record{Op: opDeleteAPIKey, ID: id}
+	if existed {
+		r = record{Op: opSaveAPIKey, APIKey: newAPIKeyRecord(prev)}
+	}
+	// The change is reverted anyway, it is gone from memory even when the log keeps it
+	if err := m.wal.append(r); err != nil {
+		log.Printf("failed to log the rollback of API key %s: %v", id, err)
+	}
+
+	if existed {
+		m.keys[id] = prev
+	} else {
+		delete(m.keys, id)
+	}
+}
+
+func copyAPIKey(k apikey.APIKey) apikey.APIKey {
+	k.Scopes = append([]apikey.Scope(nil), k.Scopes...)
+	k.LastUsedAt = copyTime(k.LastUsedAt)
+	k.ExpiresAt = copyTime(k.ExpiresAt)
+	k.RevokedAt = copyTime(k.RevokedAt)
+	return k
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
@@ -0,0 +1,76 @@
+package mem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/infra/mem"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyDB(t *testing.T) {
+	db := mem.NewAPIKeyDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	k := &apikey.APIKey{
+		ID:        "k_1",
+		PartnerID: "p_1",
+		Scopes:    []apikey.Scope{apikey.ScopeRidesWrite},
+		Hash:      apikey.Hash("rk_secret"),
+		CreatedAt: now,
+	}
+	require.NoError(t, db.Create(ctx, k))
+	require.NoError(t, db.Create(ctx, &apikey.APIKey{ID: "k_2", PartnerID: "p_2", CreatedAt: now}))
+
+	byHash, err := db.GetByHash(ctx, apikey.Hash("rk_secret"))
+	require.NoError(t, err)
+	assert.Equal(t, k, byHash)
+
+	_, err = db.GetByHash(ctx, apikey.Hash("rk_other"))
+	assert.ErrorIs(t, err, apikey.ErrNotFound)
+
+	require.NoError(t, db.Touch(ctx, "k_1", now))
+	byHash.RevokedAt = &now
+	require.NoError(t, db.Update(ctx, byHash))
+
+	keys, err := db.ListByPartner(ctx, "p_1")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, &now, keys[0].LastUsedAt)
+	assert.Equal(t, &now, keys[0].RevokedAt)
+
+	assert.ErrorIs(t, db.Update(ctx, &apikey.APIKey{ID: "k_3"}), apikey.ErrNotFound)
+	assert.ErrorIs(t, db.Touch(ctx, "k_3", now), apikey.ErrNotFound)
+}
+
+func TestAPIKeyDB_Rollback(t *testing.T) {
+	db := mem.NewAPIKeyDB()
+	ctx := context.Background()
+	now := time.Now()
+	errFailed := errors.New("failed")
+	require.NoError(t, db.Create(ctx, &apikey.APIKey{ID: "k_1", PartnerID: "p_1", CreatedAt: now}))
+
+	// Like a rotation failing after issuing the new key
+	err := txn.NewMemoryManager().WithinTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, db.Create(ctx, &apikey.APIKey{ID: "k_2", PartnerID: "p_1", CreatedAt: now}))
+		old, err := db.GetByID(ctx, "k_1")
+		require.NoError(t, err)
+		old.ExpiresAt = &now
+		require.NoError(t, db.Update(ctx, old))
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	_, err = db.GetByID(ctx, "k_2")
+	assert.ErrorIs(t, err, apikey.ErrNotFound)
+	old, err := db.GetByID(ctx, "k_1")
+	require.NoError(t, err)
+	assert.Nil(t, old.ExpiresAt)
+}
@@ -0,0 +1,35 @@
+package mem_test
+
+import (
+	"testing"
+
+	"reby/infra/mem"
+	"reby/infra/repotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContract(t *testing.T) {
+	t.Run("repos", func(t *testing.T) {
+		repotest.Run(t, func(t *testing.T) repotest.Repos {
+			return repotest.Repos{
+				Users:    mem.NewUserDB(),
+				Vehicles: mem.NewVehicleDB(),
+				Rides:    mem.NewRideDB(),
+			}
+		})
+	})
+
+	t.Run("store", func(t *testing.T) {
+		repotest.Run(t, func(t *testing.T) repotest.Repos {
+			s, err := mem.OpenStore(t.TempDir() + "/db")
+			require.NoError(t, err)
+			t.Cleanup(func() { require.NoError(t, s.Close()) })
+			return repotest.Repos{
+				Users:    s.Users(),
+				Vehicles: s.Vehicles(),
+				Rides:    s.Rides(),
+			}
+		})
+	})
+}
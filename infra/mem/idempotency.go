@@ -0,0 +1,101 @@
+package mem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"reby/pkg/idempotency"
+)
+
+type idempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]idempotency.Record
+	wal     *wal
+}
+
+func NewIdempotencyStore() idempotency.Store {
+	return newIdempotencyStore()
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{records: make(map[string]idempotency.Record)}
+}
+
+func (m *idempotencyStore) Reserve(_ context.Context, rec idempotency.Record) (*idempotency.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[rec.Key]; ok && existing.ExpiresAt.After(rec.CreatedAt) {
+		return &existing, nil
+	}
+
+	return nil, m.save(rec)
+}
+
+func (m *idempotencyStore) Complete(_ context.Context, key string, statusCode int, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.records[key]
+	if !ok {
+		return nil
+	}
+	rec.StatusCode = statusCode
+	rec.Body = body
+
+	return m.save(rec)
+}
+
+func (m *idempotencyStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[key]; !ok {
+		return nil
+	}
+
+	return m.delete([]string{key})
+}
+
+func (m *idempotencyStore) DeleteExpired(_ context.Context, t time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key, rec := range m.records {
+		if !rec.ExpiresAt.After(t) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if err := m.delete(keys); err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// save logs and stores rec, holding the lock.
+func (m *idempotencyStore) save(rec idempotency.Record) error {
+	if err := m.wal.append(record{Op: opSaveIdempotencyKey, IdempotencyKey: &rec}); err != nil {
+		return err
+	}
+	m.records[rec.Key] = rec
+
+	return nil
+}
+
+// delete logs and removes the records of keys, holding the lock.
+func (m *idempotencyStore) delete(keys []string) error {
+	if err := m.wal.append(record{Op: opDeleteIdempotencyKeys, Keys: keys}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		delete(m.records, key)
+	}
+
+	return nil
+}
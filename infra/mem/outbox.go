@@ -0,0 +1,89 @@
+package mem
+
+import (
+	"context"
+	"sync"
+
+	"reby/pkg/event"
+)
+
+// Outbox is the in-memory event.Outbox. Repos write to it while holding their own lock, so messages are added
+// atomically with the change that produced them.
+type Outbox struct {
+	mu      sync.Mutex
+	lastID  int64
+	pending []event.Message
+	wal     *wal
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{pending: make([]event.Message, 0)}
+}
+
+// add appends msgs to the pending messages and returns the IDs they are given.
+func (o *Outbox) add(msgs []event.Message) []int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ids := make([]int64, 0, len(msgs))
+	for _, msg := range msgs {
+		o.lastID++
+		msg.ID = o.lastID
+		o.pending = append(o.pending, msg)
+		ids = append(ids, msg.ID)
+	}
+
+	return ids
+}
+
+// discard drops the pending messages ids, of a change rolled back. The ones delivered already are not recalled.
+func (o *Outbox) discard(ids []int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, id := range ids {
+		if i := o.indexOf(id); i >= 0 {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+		}
+	}
+}
+
+func (o *Outbox) GetPending(_ context.Context, limit int) ([]event.Message, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if limit > len(o.pending) {
+		limit = len(o.pending)
+	}
+	msgs := make([]event.Message, limit)
+	copy(msgs, o.pending[:limit])
+
+	return msgs, nil
+}
+
+func (o *Outbox) MarkDelivered(_ context.Context, id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	i := o.indexOf(id)
+	if i < 0 {
+		return nil
+	}
+	if err := o.wal.append(record{Op: opMarkDelivered, MessageID: id}); err != nil {
+		return err
+	}
+	o.pending = append(o.pending[:i], o.pending[i+1:]...)
+
+	return nil
+}
+
+// indexOf returns the index of the pending message id, or -1 when it isn't pending.
+func (o *Outbox) indexOf(id int64) int {
+	for i, msg := range o.pending {
+		if msg.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
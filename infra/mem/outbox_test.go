@@ -0,0 +1,50 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/ride"
+	"reby/infra/mem"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	outbox := mem.NewOutbox()
+	db := mem.NewRideDB(mem.WithOutbox(outbox))
+	ctx := context.Background()
+	now := time.Now()
+
+	r := &ride.Ride{ID: "1", VehicleID: "1", UserID: "1", Status: ride.StatusActive, StartedAt: now}
+	r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+	require.NoError(t, db.Create(ctx, r))
+
+	r, err := db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	r.Status = ride.StatusFinished
+	r.FinishedAt = &now
+	r.Record(ride.EventFinished, ride.ActorRider, now, nil)
+	r.Record(ride.EventPriceComputed, ride.ActorSystem, now, nil)
+	_, err = db.Update(ctx, r)
+	require.NoError(t, err)
+
+	msgs, err := outbox.GetPending(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, ride.MessageRideStarted, msgs[0].Type)
+	assert.Equal(t, ride.MessageRideFinished, msgs[1].Type)
+	assert.Less(t, msgs[0].ID, msgs[1].ID)
+
+	msgs, err = outbox.GetPending(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	require.NoError(t, outbox.MarkDelivered(ctx, msgs[0].ID))
+	msgs, err = outbox.GetPending(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, ride.MessageRideFinished, msgs[0].Type)
+}
@@ -0,0 +1,141 @@
+package mem
+
+import (
+	"context"
+	"sync"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/pkg/id"
+)
+
+type authorization struct {
+	userID   string
+	amount   money.Money
+	captured money.Value
+	refunded money.Value
+	status   payment.Status
+	// refunds are the IDs of the refunds given, so retried ones aren't given twice
+	refunds map[string]bool
+}
+
+// PaymentProvider is a fake payment.Provider for tests and local runs. Every operation succeeds unless the user was
+// set to be declined.
+type PaymentProvider struct {
+	mu             sync.Mutex
+	idGenerator    id.Generator
+	authorizations map[string]*authorization
+	declined       map[string]bool
+	// idempotencyKeys has the authorization placed for each key
+	idempotencyKeys map[string]string
+}
+
+func NewPaymentProvider(idGenerator id.Generator) *PaymentProvider {
+	return &PaymentProvider{
+		idGenerator:     idGenerator,
+		authorizations:  make(map[string]*authorization),
+		declined:        make(map[string]bool),
+		idempotencyKeys: make(map[string]string),
+	}
+}
+
+// Decline makes every following authorization and capture of the user fail.
+func (p *PaymentProvider) Decline(userID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.declined[userID] = true
+}
+
+func (p *PaymentProvider) Authorize(_ context.Context, userID string, amount money.Money, idempotencyKey string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if authID, ok := p.idempotencyKeys[idempotencyKey]; ok && p.authorizations[authID].status != payment.StatusVoided {
+		return authID, nil
+	}
+	if p.declined[userID] {
+		return "", payment.ErrDeclined
+	}
+
+	authID := p.idGenerator.Generate()
+	p.authorizations[authID] = &authorization{
+		userID:  userID,
+		amount:  amount,
+		status:  payment.StatusAuthorized,
+		refunds: make(map[string]bool),
+	}
+	if idempotencyKey != "" {
+		p.idempotencyKeys[idempotencyKey] = authID
+	}
+
+	return authID, nil
+}
+
+func (p *PaymentProvider) Capture(_ context.Context, authorizationID string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.authorizations[authorizationID]
+	if !ok {
+		return payment.ErrAuthorizationNotFound
+	}
+	if a.status != payment.StatusAuthorized {
+		return payment.ErrInvalidOperation
+	}
+	if amount.Value > a.amount.Value {
+		return payment.ErrCaptureExceedsAuthorization
+	}
+	if p.declined[a.userID] {
+		return payment.ErrDeclined
+	}
+
+	a.captured = amount.Value
+	a.status = payment.StatusCaptured
+
+	return nil
+}
+
+func (p *PaymentProvider) Void(_ context.Context, authorizationID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.authorizations[authorizationID]
+	if !ok {
+		return payment.ErrAuthorizationNotFound
+	}
+	if a.status != payment.StatusAuthorized {
+		return payment.ErrInvalidOperation
+	}
+
+	a.status = payment.StatusVoided
+
+	return nil
+}
+
+func (p *PaymentProvider) Refund(_ context.Context, authorizationID string, refundID string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.authorizations[authorizationID]
+	if !ok {
+		return payment.ErrAuthorizationNotFound
+	}
+	if a.refunds[refundID] {
+		return nil
+	}
+	if a.status != payment.StatusCaptured && a.status != payment.StatusRefunded {
+		return payment.ErrInvalidOperation
+	}
+	if a.refunded+amount.Value > a.captured {
+		return payment.ErrRefundExceedsCapture
+	}
+
+	a.refunded += amount.Value
+	a.refunds[refundID] = true
+	if a.refunded == a.captured {
+		a.status = payment.StatusRefunded
+	}
+
+	return nil
+}
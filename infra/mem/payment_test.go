@@ -0,0 +1,103 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/infra/mem"
+	"reby/pkg/id"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaymentProvider(t *testing.T) {
+	ctx := context.Background()
+	hold := money.NewMoney(1000, "EUR")
+	price := money.NewMoney(400, "EUR")
+
+	t.Run("authorize, capture and refund", func(t *testing.T) {
+		provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+
+		authID, err := provider.Authorize(ctx, "u_1", hold, "")
+		require.NoError(t, err)
+		require.NoError(t, provider.Capture(ctx, authID, price))
+		assert.ErrorIs(t, provider.Capture(ctx, authID, price), payment.ErrInvalidOperation)
+
+		require.NoError(t, provider.Refund(ctx, authID, "rf_1", money.NewMoney(300, "EUR")))
+		assert.ErrorIs(t, provider.Refund(ctx, authID, "rf_2", money.NewMoney(200, "EUR")), payment.ErrRefundExceedsCapture)
+		require.NoError(t, provider.Refund(ctx, authID, "rf_2", money.NewMoney(100, "EUR")))
+	})
+
+	t.Run("retried refund", func(t *testing.T) {
+		provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+
+		authID, err := provider.Authorize(ctx, "u_1", hold, "")
+		require.NoError(t, err)
+		require.NoError(t, provider.Capture(ctx, authID, price))
+
+		require.NoError(t, provider.Refund(ctx, authID, "rf_1", money.NewMoney(300, "EUR")))
+		require.NoError(t, provider.Refund(ctx, authID, "rf_1", money.NewMoney(300, "EUR")), "given back only once")
+		require.NoError(t, provider.Refund(ctx, authID, "rf_2", money.NewMoney(100, "EUR")))
+	})
+
+	t.Run("retried authorization", func(t *testing.T) {
+		provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+
+		authID, err := provider.Authorize(ctx, "u_1", hold, "r_1")
+		require.NoError(t, err)
+		retriedID, err := provider.Authorize(ctx, "u_1", hold, "r_1")
+		require.NoError(t, err)
+		assert.Equal(t, authID, retriedID, "held only once")
+
+		otherID, err := provider.Authorize(ctx, "u_1", hold, "")
+		require.NoError(t, err)
+		assert.NotEqual(t, authID, otherID)
+
+		// A voided hold is placed again
+		require.NoError(t, provider.Void(ctx, authID))
+		retriedID, err = provider.Authorize(ctx, "u_1", hold, "r_1")
+		require.NoError(t, err)
+		assert.NotEqual(t, authID, retriedID)
+		require.NoError(t, provider.Capture(ctx, retriedID, price))
+	})
+
+	t.Run("void", func(t *testing.T) {
+		provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+
+		authID, err := provider.Authorize(ctx, "u_1", hold, "")
+		require.NoError(t, err)
+		require.NoError(t, provider.Void(ctx, authID))
+		assert.ErrorIs(t, provider.Capture(ctx, authID, price), payment.ErrInvalidOperation)
+		assert.ErrorIs(t, provider.Refund(ctx, authID, "rf_1", price), payment.ErrInvalidOperation)
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+
+		authID, err := provider.Authorize(ctx, "u_1", hold, "")
+		require.NoError(t, err)
+		provider.Decline("u_1")
+
+		assert.ErrorIs(t, provider.Capture(ctx, authID, price), payment.ErrDeclined)
+		_, err = provider.Authorize(ctx, "u_1", hold, "")
+		assert.ErrorIs(t, err, payment.ErrDeclined)
+	})
+
+	t.Run("capture above the hold", func(t *testing.T) {
+		provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+
+		authID, err := provider.Authorize(ctx, "u_1", hold, "")
+		require.NoError(t, err)
+		assert.ErrorIs(t, provider.Capture(ctx, authID, money.NewMoney(1001, "EUR")), payment.ErrCaptureExceedsAuthorization)
+		require.NoError(t, provider.Capture(ctx, authID, hold))
+	})
+
+	t.Run("unknown authorization", func(t *testing.T) {
+		provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+
+		assert.ErrorIs(t, provider.Capture(ctx, "unknown", price), payment.ErrAuthorizationNotFound)
+	})
+}
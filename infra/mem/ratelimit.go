@@ -0,0 +1,52 @@
+package mem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"reby/pkg/ratelimit"
+)
+
+// rateLimitSweepInterval is how often the buckets that are full again are forgotten.
+const rateLimitSweepInterval = time.Minute
+
+type rateLimitBucket struct {
+	bucket ratelimit.Bucket
+	limit  ratelimit.Limit
+}
+
+type rateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]rateLimitBucket
+	sweptAt time.Time
+}
+
+// NewRateLimitStore returns a Store local to the process, every instance of the service limits on its own.
+func NewRateLimitStore() ratelimit.Store {
+	return &rateLimitStore{buckets: make(map[string]rateLimitBucket)}
+}
+
+func (m *rateLimitStore) Take(_ context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.sweptAt) >= rateLimitSweepInterval {
+		m.sweep(now)
+	}
+
+	b, res := ratelimit.Take(m.buckets[key].bucket, limit, now)
+	m.buckets[key] = rateLimitBucket{bucket: b, limit: limit}
+
+	return res, nil
+}
+
+// sweep forgets the buckets that are full at now, they are the same as new ones.
+func (m *rateLimitStore) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(ratelimit.FullAt(b.bucket, b.limit)) {
+			delete(m.buckets, key)
+		}
+	}
+	m.sweptAt = now
+}
@@ -0,0 +1,38 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/infra/mem"
+	"reby/pkg/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitStore(t *testing.T) {
+	store := mem.NewRateLimitStore()
+	ctx := context.Background()
+	limit := ratelimit.Limit{Requests: 1, Per: time.Minute, Burst: 1}
+	now := time.Now()
+
+	res, err := store.Take(ctx, "USER:1", limit, now)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = store.Take(ctx, "USER:1", limit, now)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Minute, res.RetryAfter)
+
+	res, err = store.Take(ctx, "USER:2", limit, now)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "every key has its own bucket")
+
+	// Forgotten full buckets start full again
+	res, err = store.Take(ctx, "USER:1", limit, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
@@ -0,0 +1,52 @@
+package mem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"reby/domain/receipt"
+)
+
+type receiptDB struct {
+	mu        sync.Mutex
+	issuances map[string]receipt.Issuance
+	sequences map[string]int
+	wal       *wal
+}
+
+func NewReceiptDB() receipt.Repo {
+	return newReceiptDB()
+}
+
+func newReceiptDB() *receiptDB {
+	return &receiptDB{
+		issuances: make(map[string]receipt.Issuance),
+		sequences: make(map[string]int),
+	}
+}
+
+func (m *receiptDB) Issue(_ context.Context, rideID string, country string, at time.Time) (*receipt.Issuance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i, ok := m.issuances[rideID]; ok {
+		return &i, nil
+	}
+
+	i := receipt.Issuance{RideID: rideID, Country: country, Sequence: m.sequences[country] + 1, IssuedAt: at}
+	if err := m.wal.append(record{Op: opIssueReceipt, Issuance: &i}); err != nil {
+		return nil, err
+	}
+	m.apply(i)
+
+	return &i, nil
+}
+
+// apply stores i, whose number is the next one of its country.
+func (m *receiptDB) apply(i receipt.Issuance) {
+	m.issuances[i.RideID] = i
+	if i.Sequence > m.sequences[i.Country] {
+		m.sequences[i.Country] = i.Sequence
+	}
+}
@@ -0,0 +1,34 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/infra/mem"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiptIssue(t *testing.T) {
+	db := mem.NewReceiptDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	first, err := db.Issue(ctx, "r_1", "ES", now)
+	require.NoError(t, err)
+	assert.Equal(t, "ES-00000001", first.Number())
+
+	second, err := db.Issue(ctx, "r_2", "ES", now)
+	require.NoError(t, err)
+	assert.Equal(t, "ES-00000002", second.Number())
+
+	other, err := db.Issue(ctx, "r_3", "FR", now)
+	require.NoError(t, err)
+	assert.Equal(t, "FR-00000001", other.Number())
+
+	again, err := db.Issue(ctx, "r_1", "ES", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+}
@@ -2,52 +2,226 @@ package mem
 
 import (
 	"context"
+	"log"
+	"sync"
 	"time"
 
 	"reby/domain/money"
 	"reby/domain/ride"
+	"reby/domain/wallet"
+	"reby/pkg/txn"
 )
 
 type dbRide struct {
-	id         string
-	vehicleID  string
-	userID     string
-	startedAt  time.Time
-	finishedAt *time.Time
-	price      *money.Money
+	id           string
+	vehicleID    string
+	userID       string
+	partnerID    string
+	country      string
+	status       ride.Status
+	startedAt    time.Time
+	finishedAt   *time.Time
+	finishReason *ride.FinishReason
+	finishedBy   *ride.Actor
+	cancelledAt  *time.Time
+	cancelReason *ride.CancelReason
+	cancelledBy  *ride.Actor
+	price        *money.Money
+	payment      *ride.Payment
+	adjustments  []ride.Adjustment
+}
+
+// copyPayment keeps the stored payment from being changed through the rides handed out by the repo.
+func copyPayment(p *ride.Payment) *ride.Payment {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+func copyAdjustments(adjustments []ride.Adjustment) []ride.Adjustment {
+	if adjustments == nil {
+		return nil
+	}
+	c := make([]ride.Adjustment, len(adjustments))
+	copy(c, adjustments)
+	return c
 }
 
 func (r *dbRide) toDomain() *ride.Ride {
 	return &ride.Ride{
-		ID:         r.id,
-		VehicleID:  r.vehicleID,
-		UserID:     r.userID,
-		StartedAt:  r.startedAt,
-		FinishedAt: r.finishedAt,
-		Price:      r.price,
+		ID:           r.id,
+		VehicleID:    r.vehicleID,
+		UserID:       r.userID,
+		PartnerID:    r.partnerID,
+		Country:      r.country,
+		Status:       r.status,
+		StartedAt:    r.startedAt,
+		FinishedAt:   r.finishedAt,
+		FinishReason: r.finishReason,
+		FinishedBy:   r.finishedBy,
+		CancelledAt:  r.cancelledAt,
+		CancelReason: r.cancelReason,
+		CancelledBy:  r.cancelledBy,
+		Price:        r.price,
+		Payment:      copyPayment(r.payment),
+		Adjustments:  copyAdjustments(r.adjustments),
 	}
 }
 
 func rideToDB(r *ride.Ride) *dbRide {
 	return &dbRide{
-		id:         r.ID,
-		vehicleID:  r.VehicleID,
-		userID:     r.UserID,
-		startedAt:  r.StartedAt,
-		finishedAt: r.FinishedAt,
-		price:      r.Price,
+		id:           r.ID,
+		vehicleID:    r.VehicleID,
+		userID:       r.UserID,
+		partnerID:    r.PartnerID,
+		country:      r.Country,
+		status:       r.Status,
+		startedAt:    r.StartedAt,
+		finishedAt:   r.FinishedAt,
+		finishReason: r.FinishReason,
+		finishedBy:   r.FinishedBy,
+		cancelledAt:  r.CancelledAt,
+		cancelReason: r.CancelReason,
+		cancelledBy:  r.CancelledBy,
+		price:        r.Price,
+		payment:      copyPayment(r.Payment),
+		adjustments:  copyAdjustments(r.Adjustments),
 	}
 }
 
 type rideDB struct {
-	rides map[string]*dbRide
+	mu     sync.RWMutex
+	rides  map[string]*dbRide
+	events map[string][]ride.Event
+	outbox *Outbox
+	wallet *WalletDB
+	wal    *wal
+}
+
+type RideDBOption func(db *rideDB)
+
+// WithWallet makes the repo post the wallet charges of the rides to wallet.
+func WithWallet(wallet *WalletDB) RideDBOption {
+	return func(db *rideDB) {
+		db.wallet = wallet
+	}
+}
+
+// WithOutbox makes the repo write the ride domain events to outbox.
+func WithOutbox(outbox *Outbox) RideDBOption {
+	return func(db *rideDB) {
+		db.outbox = outbox
+	}
+}
+
+func NewRideDB(opts ...RideDBOption) ride.Repo {
+	return newRideDB(opts...)
+}
+
+func newRideDB(opts ...RideDBOption) *rideDB {
+	db := &rideDB{
+		rides:  make(map[string]*dbRide),
+		events: make(map[string][]ride.Event),
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	return db
+}
+
+// save stores rDB as the new state of r, with the pending events and wallet transaction of r. The change is
+// reverted when the unit of work in ctx is rolled back. It must be called holding the write lock.
+func (m *rideDB) save(ctx context.Context, r *ride.Ride, rDB *dbRide) error {
+	msgs, err := r.OutboxMessages()
+	if err != nil {
+		return err
+	}
+	t := r.PendingWalletTransaction()
+	if t != nil {
+		if m.wallet == nil {
+			return wallet.ErrNotFound
+		}
+		m.wallet.mu.Lock()
+		defer m.wallet.mu.Unlock()
+		if err = m.wallet.check(*t); err != nil {
+			return err
+		}
+	}
+
+	c := rideChange{Ride: rDB.toDomain(), Events: r.PendingEvents(), Messages: msgs, Transaction: t}
+	if err = m.wal.append(record{Op: opSaveRide, Ride: &c}); err != nil {
+		return err
+	}
+	revert := rideRevert{RideID: rDB.id, Events: len(m.events[rDB.id])}
+	if prev, ok := m.rides[rDB.id]; ok {
+		revert.Ride = prev.toDomain()
+	}
+	if t != nil {
+		revert.TransactionID = t.ID
+	}
+	revert.MessageIDs = m.apply(c)
+	txn.OnRollback(ctx, func() { m.rollback(revert) })
+
+	return nil
+}
+
+// apply stores c, holding the write lock of the repo and of its wallet when c has a transaction. It returns the IDs
+// of the messages added to the outbox.
+func (m *rideDB) apply(c rideChange) []int64 {
+	if c.Transaction != nil {
+		m.wallet.apply(*c.Transaction)
+	}
+	var ids []int64
+	if m.outbox != nil {
+		ids = m.outbox.add(c.Messages)
+	}
+	m.events[c.Ride.ID] = append(m.events[c.Ride.ID], c.Events...)
+	m.rides[c.Ride.ID] = rideToDB(c.Ride)
+
+	return ids
+}
+
+// rollback reverts a change of a unit of work rolled back.
+func (m *rideDB) rollback(v rideRevert) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v.TransactionID != "" {
+		m.wallet.mu.Lock()
+		defer m.wallet.mu.Unlock()
+	}
+
+	// The change is reverted anyway, it is gone from memory even when the log keeps it
+	if err := m.wal.append(record{Op: opRevertRide, Revert: &v}); err != nil {
+		log.Printf("failed to log the rollback of ride %s: %v", v.RideID, err)
+	}
+	m.revert(v)
 }
 
-func NewRideDB() ride.Repo {
-	return &rideDB{rides: make(map[string]*dbRide)}
+// revert undoes the change v was taken before, holding the same locks as apply.
+func (m *rideDB) revert(v rideRevert) {
+	if v.Ride == nil {
+		delete(m.rides, v.RideID)
+	} else {
+		m.rides[v.RideID] = rideToDB(v.Ride)
+	}
+	if events := m.events[v.RideID]; v.Events < len(events) {
+		m.events[v.RideID] = events[:v.Events]
+	}
+	if m.outbox != nil {
+		m.outbox.discard(v.MessageIDs)
+	}
+	if v.TransactionID != "" {
+		m.wallet.unpost(v.TransactionID)
+	}
 }
 
 func (m *rideDB) GetByID(_ context.Context, id string) (*ride.Ride, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	r, ok := m.rides[id]
 	if !ok {
 		return nil, ride.ErrNotFound
@@ -57,34 +231,66 @@ func (m *rideDB) GetByID(_ context.Context, id string) (*ride.Ride, error) {
 }
 
 // Update updates some predefined fields of ride.
-func (m *rideDB) Update(_ context.Context, r *ride.Ride) (*ride.Ride, error) {
+func (m *rideDB) Update(ctx context.Context, r *ride.Ride) (*ride.Ride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	oldRide, ok := m.rides[r.ID]
 	if !ok {
 		return nil, ride.ErrNotFound
 	}
 
 	// We only want the possibility of updating some fields
-	oldRide.finishedAt = r.FinishedAt
-	oldRide.price = r.Price
-	m.rides[r.ID] = oldRide
+	newRide := *oldRide
+	newRide.status = r.Status
+	newRide.finishedAt = r.FinishedAt
+	newRide.finishReason = r.FinishReason
+	newRide.finishedBy = r.FinishedBy
+	newRide.cancelledAt = r.CancelledAt
+	newRide.cancelReason = r.CancelReason
+	newRide.cancelledBy = r.CancelledBy
+	newRide.price = r.Price
+	newRide.payment = copyPayment(r.Payment)
+	newRide.adjustments = copyAdjustments(r.Adjustments)
+	if err := m.save(ctx, r, &newRide); err != nil {
+		return nil, err
+	}
 
-	return oldRide.toDomain(), nil
+	return m.rides[r.ID].toDomain(), nil
 }
 
-func (m *rideDB) Create(_ context.Context, r *ride.Ride) error {
+func (m *rideDB) Create(ctx context.Context, r *ride.Ride) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	_, ok := m.rides[r.ID]
 	if ok {
 		return ride.ErrAlreadyExists
 	}
+	// Like the unique indexes of the databases, for the starts that race past the checks of the service
+	if r.Status.IsOngoing() {
+		for _, other := range m.rides {
+			if !other.status.IsOngoing() {
+				continue
+			}
+			if other.userID == r.UserID {
+				return ride.ErrUserIsRiding
+			}
+			if other.vehicleID == r.VehicleID {
+				return ride.ErrVehicleIsRiding
+			}
+		}
+	}
 
-	m.rides[r.ID] = rideToDB(r)
-
-	return nil
+	return m.save(ctx, r, rideToDB(r))
 }
 
 func (m *rideDB) IsUserRiding(_ context.Context, userID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, r := range m.rides {
-		if r.userID == userID && r.finishedAt == nil {
+		if r.userID == userID && r.status.IsOngoing() {
 			return true, nil
 		}
 	}
@@ -93,11 +299,51 @@ func (m *rideDB) IsUserRiding(_ context.Context, userID string) (bool, error) {
 }
 
 func (m *rideDB) IsVehicleRiding(_ context.Context, vehicleID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.rides {
+		if r.vehicleID == vehicleID && r.status.IsOngoing() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *rideDB) HasDebt(_ context.Context, userID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, r := range m.rides {
-		if r.vehicleID == vehicleID && r.finishedAt == nil {
+		if r.userID == userID && r.toDomain().HasDebt() {
 			return true, nil
 		}
 	}
 
 	return false, nil
 }
+
+func (m *rideDB) GetActiveStartedBefore(_ context.Context, t time.Time) ([]*ride.Ride, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rides := make([]*ride.Ride, 0)
+	for _, r := range m.rides {
+		if (r.status == ride.StatusActive || r.status == ride.StatusPaused) && r.startedAt.Before(t) {
+			rides = append(rides, r.toDomain())
+		}
+	}
+
+	return rides, nil
+}
+
+func (m *rideDB) GetEvents(_ context.Context, rideID string) ([]ride.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make([]ride.Event, len(m.events[rideID]))
+	copy(events, m.events[rideID])
+
+	return events, nil
+}
@@ -2,12 +2,16 @@ package mem_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"reby/domain/money"
+	"reby/domain/payment"
 	"reby/domain/ride"
+	"reby/domain/wallet"
 	"reby/infra/mem"
+	"reby/pkg/txn"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,6 +30,14 @@ func TestRideGetByID(t *testing.T) {
 		assert.Equal(t, "1", r.ID)
 	})
 
+	t.Run("partner ride", func(t *testing.T) {
+		require.NoError(t, db.Create(ctx, &ride.Ride{ID: "2", PartnerID: "p_1"}))
+
+		r, err := db.GetByID(ctx, "2")
+		require.NoError(t, err)
+		assert.Equal(t, "p_1", r.PartnerID)
+	})
+
 	t.Run("error", func(t *testing.T) {
 		r, err := db.GetByID(ctx, "10")
 		assert.ErrorIs(t, ride.ErrNotFound, err)
@@ -67,6 +79,7 @@ func TestIsUserRiding(t *testing.T) {
 			ID:         "1",
 			VehicleID:  "1",
 			UserID:     userID,
+			Status:     ride.StatusActive,
 			StartedAt:  time.Now(),
 			FinishedAt: nil,
 			Price:      nil,
@@ -85,6 +98,7 @@ func TestIsUserRiding(t *testing.T) {
 			ID:         "2",
 			VehicleID:  "2",
 			UserID:     userID,
+			Status:     ride.StatusFinished,
 			StartedAt:  now,
 			FinishedAt: &now,
 			Price:      nil,
@@ -95,6 +109,24 @@ func TestIsUserRiding(t *testing.T) {
 		require.NoError(t, err)
 		assert.False(t, isRiding)
 	})
+
+	t.Run("user has cancelled ride", func(t *testing.T) {
+		userID := "test_user_4"
+		now := time.Now()
+		r := &ride.Ride{
+			ID:          "3",
+			VehicleID:   "3",
+			UserID:      userID,
+			Status:      ride.StatusCancelled,
+			StartedAt:   now,
+			CancelledAt: &now,
+		}
+		require.NoError(t, db.Create(ctx, r))
+
+		isRiding, err := db.IsUserRiding(ctx, userID)
+		require.NoError(t, err)
+		assert.False(t, isRiding)
+	})
 }
 
 func TestIsVehicleRiding(t *testing.T) {
@@ -114,6 +146,7 @@ func TestIsVehicleRiding(t *testing.T) {
 			ID:         "1",
 			VehicleID:  vID,
 			UserID:     "1",
+			Status:     ride.StatusActive,
 			StartedAt:  time.Now(),
 			FinishedAt: nil,
 			Price:      nil,
@@ -132,6 +165,7 @@ func TestIsVehicleRiding(t *testing.T) {
 			ID:         "2",
 			VehicleID:  vID,
 			UserID:     "2",
+			Status:     ride.StatusFinished,
 			StartedAt:  now,
 			FinishedAt: &now,
 			Price:      nil,
@@ -142,6 +176,24 @@ func TestIsVehicleRiding(t *testing.T) {
 		require.NoError(t, err)
 		assert.False(t, isRiding)
 	})
+
+	t.Run("vehicle has cancelled ride", func(t *testing.T) {
+		vID := "test_vehicle_4"
+		now := time.Now()
+		r := &ride.Ride{
+			ID:          "3",
+			VehicleID:   vID,
+			UserID:      "3",
+			Status:      ride.StatusCancelled,
+			StartedAt:   now,
+			CancelledAt: &now,
+		}
+		require.NoError(t, db.Create(ctx, r))
+
+		isRiding, err := db.IsVehicleRiding(ctx, vID)
+		require.NoError(t, err)
+		assert.False(t, isRiding)
+	})
 }
 
 func TestRideUpdate(t *testing.T) {
@@ -164,6 +216,9 @@ func TestRideUpdate(t *testing.T) {
 
 	t.Run("update all fields", func(t *testing.T) {
 		now := time.Now()
+		reason := ride.FinishReasonOperator
+		cancelReason := ride.CancelReasonMistake
+		actor := ride.ActorOperator
 		r := &ride.Ride{
 			ID:         "1",
 			VehicleID:  "1",
@@ -175,11 +230,17 @@ func TestRideUpdate(t *testing.T) {
 		require.NoError(t, db.Create(ctx, r))
 
 		updatedRide := &ride.Ride{
-			ID:         "1",
-			VehicleID:  "2",
-			UserID:     "2",
-			StartedAt:  now.Add(-5 * time.Minute),
-			FinishedAt: &now,
+			ID:           "1",
+			VehicleID:    "2",
+			UserID:       "2",
+			Status:       ride.StatusFinished,
+			StartedAt:    now.Add(-5 * time.Minute),
+			FinishedAt:   &now,
+			FinishReason: &reason,
+			FinishedBy:   &actor,
+			CancelledAt:  &now,
+			CancelReason: &cancelReason,
+			CancelledBy:  &actor,
 			Price: &money.Money{
 				Value:    100,
 				Currency: "EUR",
@@ -192,7 +253,197 @@ func TestRideUpdate(t *testing.T) {
 		assert.Equal(t, r.VehicleID, newRide.VehicleID)
 		assert.Equal(t, r.UserID, newRide.UserID)
 		assert.Equal(t, r.StartedAt, newRide.StartedAt)
+		assert.Equal(t, updatedRide.Status, newRide.Status)
 		assert.Equal(t, updatedRide.FinishedAt, newRide.FinishedAt)
+		assert.Equal(t, updatedRide.FinishReason, newRide.FinishReason)
+		assert.Equal(t, updatedRide.FinishedBy, newRide.FinishedBy)
+		assert.Equal(t, updatedRide.CancelledAt, newRide.CancelledAt)
+		assert.Equal(t, updatedRide.CancelReason, newRide.CancelReason)
+		assert.Equal(t, updatedRide.CancelledBy, newRide.CancelledBy)
 		assert.Equal(t, updatedRide.Price, newRide.Price)
 	})
 }
+
+func TestGetActiveStartedBefore(t *testing.T) {
+	db := mem.NewRideDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	rides := []*ride.Ride{
+		{ID: "old_active", VehicleID: "1", UserID: "1", Status: ride.StatusActive, StartedAt: now.Add(-3 * time.Hour)},
+		{ID: "old_paused", VehicleID: "2", UserID: "2", Status: ride.StatusPaused, StartedAt: now.Add(-3 * time.Hour)},
+		{ID: "old_reserved", VehicleID: "3", UserID: "3", Status: ride.StatusReserved, StartedAt: now.Add(-3 * time.Hour)},
+		{ID: "old_finished", VehicleID: "4", UserID: "4", Status: ride.StatusFinished, StartedAt: now.Add(-3 * time.Hour), FinishedAt: &now},
+		{ID: "recent_active", VehicleID: "5", UserID: "5", Status: ride.StatusActive, StartedAt: now.Add(-time.Minute)},
+	}
+	for _, r := range rides {
+		require.NoError(t, db.Create(ctx, r))
+	}
+
+	result, err := db.GetActiveStartedBefore(ctx, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	ids := make([]string, 0, len(result))
+	for _, r := range result {
+		ids = append(ids, r.ID)
+	}
+	assert.ElementsMatch(t, []string{"old_active", "old_paused"}, ids)
+}
+
+func TestHasDebt(t *testing.T) {
+	db := mem.NewRideDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	rides := []*ride.Ride{
+		{ID: "paid", VehicleID: "1", UserID: "1", Status: ride.StatusPaid, StartedAt: now,
+			Payment: &ride.Payment{AuthorizationID: "a_1", Status: payment.StatusCaptured}},
+		{ID: "unpaid", VehicleID: "2", UserID: "2", Status: ride.StatusFinished, StartedAt: now,
+			Payment: &ride.Payment{AuthorizationID: "a_2", Status: payment.StatusFailed}},
+		{ID: "legacy", VehicleID: "3", UserID: "3", Status: ride.StatusFinished, StartedAt: now},
+	}
+	for _, r := range rides {
+		require.NoError(t, db.Create(ctx, r))
+	}
+
+	for userID, expected := range map[string]bool{"1": false, "2": true, "3": false, "4": false} {
+		hasDebt, err := db.HasDebt(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, expected, hasDebt, "user %s", userID)
+	}
+}
+
+func TestRideGetEvents(t *testing.T) {
+	db := mem.NewRideDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	r := &ride.Ride{ID: "1", VehicleID: "1", UserID: "1", Status: ride.StatusActive, StartedAt: now}
+	r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+	require.NoError(t, db.Create(ctx, r))
+
+	r, err := db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Empty(t, r.PendingEvents())
+
+	r.Status = ride.StatusFinished
+	r.Record(ride.EventFinished, ride.ActorRider, now, map[string]string{"reason": string(ride.FinishReasonRider)})
+	_, err = db.Update(ctx, r)
+	require.NoError(t, err)
+
+	events, err := db.GetEvents(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, ride.EventStarted, events[0].Type)
+	assert.Equal(t, ride.EventFinished, events[1].Type)
+
+	events, err = db.GetEvents(ctx, "2")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestRideRollback(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	errFailed := errors.New("failed")
+
+	var outbox *mem.Outbox
+	var walletDB *mem.WalletDB
+	var db ride.Repo
+	setup := func() {
+		outbox = mem.NewOutbox()
+		walletDB = mem.NewWalletDB()
+		db = mem.NewRideDB(mem.WithOutbox(outbox), mem.WithWallet(walletDB))
+		require.NoError(t, walletDB.Post(ctx, wallet.NewTopUp("t_1", "u_1", 500, "auth_1", now)))
+	}
+	newRide := func(id string) *ride.Ride {
+		r := &ride.Ride{
+			ID:        id,
+			VehicleID: "v_1",
+			UserID:    "u_1",
+			Status:    ride.StatusActive,
+			StartedAt: now,
+			Payment:   &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusAuthorized},
+		}
+		r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+		return r
+	}
+	pay := func(r *ride.Ride) {
+		price := money.NewMoney(118, wallet.Currency)
+		r.Status = ride.StatusPaid
+		r.FinishedAt = &now
+		r.Price = &price
+		r.Payment.Status = payment.StatusCaptured
+		r.ChargeWallet(now)
+		r.Record(ride.EventFinished, ride.ActorRider, now, nil)
+	}
+
+	t.Run("created ride", func(t *testing.T) {
+		setup()
+
+		err := txn.NewMemoryManager().WithinTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, db.Create(ctx, newRide("r_1")))
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		_, err = db.GetByID(ctx, "r_1")
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+		events, err := db.GetEvents(ctx, "r_1")
+		require.NoError(t, err)
+		assert.Empty(t, events)
+		msgs, err := outbox.GetPending(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, msgs)
+	})
+
+	t.Run("updated ride and its wallet charge", func(t *testing.T) {
+		setup()
+		require.NoError(t, db.Create(ctx, newRide("r_1")))
+
+		err := txn.NewMemoryManager().WithinTx(ctx, func(ctx context.Context) error {
+			r, err := db.GetByID(ctx, "r_1")
+			require.NoError(t, err)
+			pay(r)
+			_, err = db.Update(ctx, r)
+			require.NoError(t, err)
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		r, err := db.GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		assert.Equal(t, ride.StatusActive, r.Status)
+		assert.Nil(t, r.Price)
+		assert.Equal(t, payment.StatusAuthorized, r.Payment.Status)
+		events, err := db.GetEvents(ctx, "r_1")
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+		msgs, err := outbox.GetPending(ctx, 10)
+		require.NoError(t, err)
+		assert.Len(t, msgs, 1)
+		w, err := walletDB.GetByUserID(ctx, "u_1")
+		require.NoError(t, err)
+		assert.Equal(t, money.NewMoney(500, wallet.Currency), w.Balance)
+		transactions, err := walletDB.GetTransactions(ctx, "u_1")
+		require.NoError(t, err)
+		assert.Len(t, transactions, 1)
+
+		// The charge can be posted again once rolled back
+		r.Payment = &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusAuthorized}
+		pay(r)
+		_, err = db.Update(ctx, r)
+		assert.NoError(t, err)
+	})
+
+	t.Run("applied unit of work", func(t *testing.T) {
+		setup()
+
+		err := txn.NewMemoryManager().WithinTx(ctx, func(ctx context.Context) error {
+			return db.Create(ctx, newRide("r_1"))
+		})
+		require.NoError(t, err)
+
+		_, err = db.GetByID(ctx, "r_1")
+		assert.NoError(t, err)
+	})
+}
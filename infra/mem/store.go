@@ -0,0 +1,492 @@
+package mem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"reby/app/config"
+	"reby/domain/apikey"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+	"reby/domain/user"
+	"reby/domain/vehicle"
+	"reby/domain/wallet"
+	"reby/domain/webhook"
+	"reby/pkg/event"
+	"reby/pkg/idempotency"
+)
+
+// Store keeps the data of the memory backend across restarts, all but the rate limits. Its state is saved to a
+// snapshot file, and every change since to a write-ahead log next to it, which is replayed over the snapshot on
+// open. The log is folded into the snapshot on open, on close, and by Checkpoint once it grows past its limits.
+type Store struct {
+	path     string
+	wal      *wal
+	users    *userDB
+	vehicles *vehicleDB
+	rides    *rideDB
+	outbox   *Outbox
+	wallet   *WalletDB
+	receipts *receiptDB
+	apiKeys  *apiKeyDB
+	webhooks *webhookDB
+	// idempotency keeps the responses of the requests, to answer their retries after a restart too
+	idempotency *idempotencyStore
+
+	checkpointRecords int
+	checkpointSize    int64
+}
+
+type StoreOption func(s *storeOptions)
+
+type storeOptions struct {
+	policy   SyncPolicy
+	interval time.Duration
+
+	checkpointRecords int
+	checkpointSize    int64
+}
+
+// WithSync makes the store flush its log as policy says, every interval for SyncInterval. The default is
+// SyncAlways.
+func WithSync(policy SyncPolicy, interval time.Duration) StoreOption {
+	return func(o *storeOptions) {
+		o.policy = policy
+		o.interval = interval
+	}
+}
+
+// WithCheckpoint makes Checkpoint fold the log into the snapshot once it has more than records records or size
+// bytes. Zero leaves that limit out. Without the option, the log is only folded on open and on close.
+func WithCheckpoint(records int, size int64) StoreOption {
+	return func(o *storeOptions) {
+		o.checkpointRecords = records
+		o.checkpointSize = size
+	}
+}
+
+// snapshot is the state of the repos once the log up to Seq is applied.
+type snapshot struct {
+	Seq           uint64                  `json:"seq"`
+	Users         []string                `json:"users"`
+	Vehicles      []string                `json:"vehicles"`
+	Rides         []*ride.Ride            `json:"rides"`
+	Events        map[string][]ride.Event `json:"events"`
+	LastMessageID int64                   `json:"last_message_id"`
+	Messages      []event.Message         `json:"messages"`
+	Transactions  []wallet.Transaction    `json:"transactions"`
+	// VehicleCountries has the country of the vehicles that have one.
+	VehicleCountries map[string]string `json:"vehicle_countries,omitempty"`
+	// UserPartners has the partner of the users that signed up through one.
+	UserPartners map[string]string `json:"user_partners,omitempty"`
+	// Receipts has the issued receipts, by ride.
+	Receipts []receipt.Issuance `json:"receipts,omitempty"`
+	// APIKeys has the partner API keys, with the hash of their secret.
+	APIKeys []apiKeyRecord `json:"api_keys,omitempty"`
+	// Subscriptions and Deliveries of the webhooks, the deliveries with their payload.
+	Subscriptions []webhook.Subscription `json:"subscriptions,omitempty"`
+	Deliveries    []deliveryRecord       `json:"deliveries,omitempty"`
+	// IdempotencyKeys has the requests reserved and answered, until they expire.
+	IdempotencyKeys []idempotency.Record `json:"idempotency_keys,omitempty"`
+}
+
+// InitStore opens the store at conf.DBMemPath.
+func InitStore(conf *config.Config) *Store {
+	s, err := OpenStore(conf.DBMemPath,
+		WithSync(SyncPolicy(conf.DBMemSync), conf.DBMemSyncInterval),
+		WithCheckpoint(conf.DBMemCheckpointRecords, conf.DBMemCheckpointBytes),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return s
+}
+
+// OpenStore opens the store with its snapshot at path and its log at path.wal, creating them when missing.
+func OpenStore(path string, opts ...StoreOption) (*Store, error) {
+	o := storeOptions{policy: SyncAlways}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.policy.IsValid() {
+		return nil, fmt.Errorf("unknown sync policy %q", o.policy)
+	}
+	if o.policy == SyncInterval && o.interval <= 0 {
+		return nil, fmt.Errorf("the sync interval must be positive, got %s", o.interval)
+	}
+	if o.checkpointRecords < 0 || o.checkpointSize < 0 {
+		return nil, fmt.Errorf("the checkpoint limits can't be negative, got %d records and %d bytes", o.checkpointRecords, o.checkpointSize)
+	}
+
+	s := &Store{
+		path:     path,
+		users:    newUserDB(),
+		vehicles: newVehicleDB(),
+		outbox:   NewOutbox(),
+		wallet:   NewWalletDB(),
+		receipts: newReceiptDB(),
+		apiKeys:  newAPIKeyDB(),
+		webhooks: newWebhookDB(),
+
+		idempotency: newIdempotencyStore(),
+
+		checkpointRecords: o.checkpointRecords,
+		checkpointSize:    o.checkpointSize,
+	}
+	s.rides = newRideDB(WithOutbox(s.outbox), WithWallet(s.wallet))
+
+	snap, err := readSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	if snap != nil {
+		s.restore(snap)
+	}
+
+	s.wal, err = openWAL(path+".wal", o.policy)
+	if err != nil {
+		return nil, err
+	}
+	var seq uint64
+	if snap != nil {
+		seq = snap.Seq
+	}
+	if err = s.wal.replay(seq, s.apply); err != nil {
+		_ = s.wal.close()
+		return nil, err
+	}
+
+	s.users.wal = s.wal
+	s.vehicles.wal = s.wal
+	s.rides.wal = s.wal
+	s.outbox.wal = s.wal
+	s.wallet.wal = s.wal
+	s.receipts.wal = s.wal
+	s.apiKeys.wal = s.wal
+	s.webhooks.wal = s.wal
+	s.idempotency.wal = s.wal
+
+	if err = s.Snapshot(); err != nil {
+		_ = s.wal.close()
+		return nil, err
+	}
+	if o.policy == SyncInterval {
+		s.wal.syncEvery(o.interval)
+	}
+
+	return s, nil
+}
+
+func (s *Store) Users() user.Repo {
+	return s.users
+}
+
+func (s *Store) Vehicles() vehicle.Repo {
+	return s.vehicles
+}
+
+func (s *Store) Rides() ride.Repo {
+	return s.rides
+}
+
+func (s *Store) Outbox() *Outbox {
+	return s.outbox
+}
+
+func (s *Store) Wallet() *WalletDB {
+	return s.wallet
+}
+
+func (s *Store) Receipts() receipt.Repo {
+	return s.receipts
+}
+
+func (s *Store) APIKeys() apikey.Repo {
+	return s.apiKeys
+}
+
+func (s *Store) Webhooks() webhook.Repo {
+	return s.webhooks
+}
+
+func (s *Store) Idempotency() idempotency.Store {
+	return s.idempotency
+}
+
+// Snapshot saves the state of the repos and empties the log. The repos wait for it to finish.
+func (s *Store) Snapshot() error {
+	// Locked in the order the repos lock each other, see rideDB.save
+	s.rides.mu.RLock()
+	defer s.rides.mu.RUnlock()
+	s.users.mu.RLock()
+	defer s.users.mu.RUnlock()
+	s.vehicles.mu.RLock()
+	defer s.vehicles.mu.RUnlock()
+	s.wallet.mu.RLock()
+	defer s.wallet.mu.RUnlock()
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	s.receipts.mu.Lock()
+	defer s.receipts.mu.Unlock()
+	s.apiKeys.mu.RLock()
+	defer s.apiKeys.mu.RUnlock()
+	s.webhooks.mu.RLock()
+	defer s.webhooks.mu.RUnlock()
+	s.idempotency.mu.Lock()
+	defer s.idempotency.mu.Unlock()
+
+	return s.wal.checkpoint(func(seq uint64) error {
+		snap := s.snapshot()
+		snap.Seq = seq
+
+		return writeSnapshot(s.path, snap)
+	})
+}
+
+// Checkpoint saves a snapshot when the log has grown past the limits set WithCheckpoint, so it isn't replayed
+// whole on the next open, and tells whether it did.
+func (s *Store) Checkpoint() (bool, error) {
+	records, size := s.wal.length()
+	if (s.checkpointRecords == 0 || records <= s.checkpointRecords) && (s.checkpointSize == 0 || size <= s.checkpointSize) {
+		return false, nil
+	}
+	if err := s.Snapshot(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Close saves a last snapshot and closes the log.
+func (s *Store) Close() error {
+	if err := s.Snapshot(); err != nil {
+		_ = s.wal.close()
+		return err
+	}
+
+	return s.wal.close()
+}
+
+// snapshot returns the state of the repos, holding their locks.
+func (s *Store) snapshot() *snapshot {
+	snap := &snapshot{
+		Users:         make([]string, 0, len(s.users.users)),
+		Vehicles:      make([]string, 0, len(s.vehicles.vehicles)),
+		Rides:         make([]*ride.Ride, 0, len(s.rides.rides)),
+		Events:        s.rides.events,
+		LastMessageID: s.outbox.lastID,
+		Messages:      s.outbox.pending,
+		Transactions:  s.wallet.transactions,
+	}
+	for id, u := range s.users.users {
+		snap.Users = append(snap.Users, id)
+		if u.partnerID != "" {
+			if snap.UserPartners == nil {
+				snap.UserPartners = make(map[string]string)
+			}
+			snap.UserPartners[id] = u.partnerID
+		}
+	}
+	sort.Strings(snap.Users)
+	for id, v := range s.vehicles.vehicles {
+		snap.Vehicles = append(snap.Vehicles, id)
+		if v.country != "" {
+			if snap.VehicleCountries == nil {
+				snap.VehicleCountries = make(map[string]string)
+			}
+			snap.VehicleCountries[id] = v.country
+		}
+	}
+	sort.Strings(snap.Vehicles)
+	for _, r := range s.rides.rides {
+		snap.Rides = append(snap.Rides, r.toDomain())
+	}
+	sort.Slice(snap.Rides, func(i, j int) bool { return snap.Rides[i].ID < snap.Rides[j].ID })
+	for _, i := range s.receipts.issuances {
+		snap.Receipts = append(snap.Receipts, i)
+	}
+	sort.Slice(snap.Receipts, func(i, j int) bool { return snap.Receipts[i].RideID < snap.Receipts[j].RideID })
+	for _, k := range s.apiKeys.keys {
+		snap.APIKeys = append(snap.APIKeys, *newAPIKeyRecord(k))
+	}
+	sort.Slice(snap.APIKeys, func(i, j int) bool { return snap.APIKeys[i].ID < snap.APIKeys[j].ID })
+	for _, sub := range s.webhooks.subscriptions {
+		snap.Subscriptions = append(snap.Subscriptions, sub)
+	}
+	sort.Slice(snap.Subscriptions, func(i, j int) bool { return snap.Subscriptions[i].ID < snap.Subscriptions[j].ID })
+	for _, d := range s.webhooks.deliveries {
+		snap.Deliveries = append(snap.Deliveries, newDeliveryRecord(d))
+	}
+	sort.Slice(snap.Deliveries, func(i, j int) bool { return snap.Deliveries[i].ID < snap.Deliveries[j].ID })
+	for _, rec := range s.idempotency.records {
+		snap.IdempotencyKeys = append(snap.IdempotencyKeys, rec)
+	}
+	sort.Slice(snap.IdempotencyKeys, func(i, j int) bool { return snap.IdempotencyKeys[i].Key < snap.IdempotencyKeys[j].Key })
+
+	return snap
+}
+
+// restore replaces the state of the repos with snap, before they are handed out.
+func (s *Store) restore(snap *snapshot) {
+	s.users.users = make(map[string]dbUser, len(snap.Users))
+	for _, id := range snap.Users {
+		s.users.users[id] = dbUser{id: id, partnerID: snap.UserPartners[id]}
+	}
+	s.vehicles.vehicles = make(map[string]dbVehicle, len(snap.Vehicles))
+	for _, id := range snap.Vehicles {
+		s.vehicles.vehicles[id] = dbVehicle{id: id, country: snap.VehicleCountries[id]}
+	}
+	for _, r := range snap.Rides {
+		s.rides.rides[r.ID] = rideToDB(r)
+	}
+	if snap.Events != nil {
+		s.rides.events = snap.Events
+	}
+	s.outbox.lastID = snap.LastMessageID
+	s.outbox.pending = append(s.outbox.pending, snap.Messages...)
+	for _, t := range snap.Transactions {
+		s.wallet.apply(t)
+	}
+	for _, i := range snap.Receipts {
+		s.receipts.apply(i)
+	}
+	for _, k := range snap.APIKeys {
+		s.apiKeys.keys[k.ID] = k.withHash()
+	}
+	for _, sub := range snap.Subscriptions {
+		s.webhooks.subscriptions[sub.ID] = sub
+	}
+	for _, d := range snap.Deliveries {
+		s.webhooks.deliveries[d.ID] = d.withPayload()
+	}
+	for _, rec := range snap.IdempotencyKeys {
+		s.idempotency.records[rec.Key] = rec
+	}
+}
+
+// apply replays r over the repos, before they are handed out.
+func (s *Store) apply(r record) error {
+	switch r.Op {
+	case opCreateUser:
+		s.users.users[r.ID] = dbUser{id: r.ID, partnerID: r.PartnerID}
+	case opCreateVehicle:
+		s.vehicles.vehicles[r.ID] = dbVehicle{id: r.ID, country: r.Country}
+	case opSaveRide:
+		if r.Ride == nil || r.Ride.Ride == nil {
+			return fmt.Errorf("%w: record %d has no ride", ErrCorruptLog, r.Seq)
+		}
+		s.rides.apply(*r.Ride)
+	case opRevertRide:
+		if r.Revert == nil {
+			return fmt.Errorf("%w: record %d has no revert", ErrCorruptLog, r.Seq)
+		}
+		s.rides.revert(*r.Revert)
+	case opMarkDelivered:
+		if i := s.outbox.indexOf(r.MessageID); i >= 0 {
+			s.outbox.pending = append(s.outbox.pending[:i], s.outbox.pending[i+1:]...)
+		}
+	case opPostTransaction:
+		if r.Transaction == nil {
+			return fmt.Errorf("%w: record %d has no transaction", ErrCorruptLog, r.Seq)
+		}
+		s.wallet.apply(*r.Transaction)
+	case opIssueReceipt:
+		if r.Issuance == nil {
+			return fmt.Errorf("%w: record %d has no issuance", ErrCorruptLog, r.Seq)
+		}
+		s.receipts.apply(*r.Issuance)
+	case opSaveAPIKey:
+		if r.APIKey == nil {
+			return fmt.Errorf("%w: record %d has no API key", ErrCorruptLog, r.Seq)
+		}
+		s.apiKeys.keys[r.APIKey.ID] = r.APIKey.withHash()
+	case opDeleteAPIKey:
+		delete(s.apiKeys.keys, r.ID)
+	case opCreateSubscription:
+		if r.Subscription == nil {
+			return fmt.Errorf("%w: record %d has no subscription", ErrCorruptLog, r.Seq)
+		}
+		s.webhooks.subscriptions[r.Subscription.ID] = *r.Subscription
+	case opDeleteSubscription:
+		delete(s.webhooks.subscriptions, r.ID)
+	case opSaveDeliveries:
+		for _, d := range r.Deliveries {
+			s.webhooks.deliveries[d.ID] = d.withPayload()
+		}
+	case opSaveIdempotencyKey:
+		if r.IdempotencyKey == nil {
+			return fmt.Errorf("%w: record %d has no idempotency key", ErrCorruptLog, r.Seq)
+		}
+		s.idempotency.records[r.IdempotencyKey.Key] = *r.IdempotencyKey
+	case opDeleteIdempotencyKeys:
+		for _, key := range r.Keys {
+			delete(s.idempotency.records, key)
+		}
+	default:
+		return fmt.Errorf("%w: record %d has an unknown op %q", ErrCorruptLog, r.Seq, r.Op)
+	}
+
+	return nil
+}
+
+// readSnapshot returns the snapshot at path, nil when there is none yet.
+func readSnapshot(path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap snapshot
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("reading the snapshot %s: %w", path, err)
+	}
+
+	return &snap, nil
+}
+
+// writeSnapshot replaces the snapshot at path with snap. It is written aside and renamed over the old one, so a
+// crash leaves either of them whole.
+func writeSnapshot(path string, snap *snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// The rename is only durable once the directory is flushed
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,336 @@
+package mem_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/domain/user"
+	"reby/domain/vehicle"
+	"reby/domain/wallet"
+	"reby/domain/webhook"
+	"reby/infra/mem"
+	"reby/pkg/idempotency"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	var path string
+	setup := func() {
+		path = filepath.Join(t.TempDir(), "rides.json")
+	}
+	open := func(opts ...mem.StoreOption) *mem.Store {
+		s, err := mem.OpenStore(path, opts...)
+		require.NoError(t, err)
+		return s
+	}
+
+	// fill stores a user, a vehicle, a topped up wallet, a ride paid from it with its receipt and an API key used once,
+	// delivers the first message, subscribes to it with one delivery attempted and answers a request with a key
+	fill := func(s *mem.Store) {
+		require.NoError(t, s.Users().Create(ctx, &user.User{ID: "u_1", PartnerID: "p_1"}))
+		require.NoError(t, s.Vehicles().Create(ctx, &vehicle.Vehicle{ID: "v_1", Country: "FR"}))
+		require.NoError(t, s.Wallet().Post(ctx, wallet.NewTopUp("t_1", "u_1", 500, "auth_1", now)))
+
+		r := &ride.Ride{ID: "r_1", VehicleID: "v_1", UserID: "u_1", Country: "FR", Status: ride.StatusActive, StartedAt: now}
+		r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+		require.NoError(t, s.Rides().Create(ctx, r))
+
+		r, err := s.Rides().GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		finishedAt := now.Add(time.Minute)
+		r.Status = ride.StatusPaid
+		r.FinishedAt = &finishedAt
+		r.Price = &money.Money{Value: 118, Currency: wallet.Currency}
+		r.Payment = &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusCaptured}
+		r.ChargeWallet(finishedAt)
+		r.Record(ride.EventFinished, ride.ActorRider, finishedAt, nil)
+		_, err = s.Rides().Update(ctx, r)
+		require.NoError(t, err)
+
+		msgs, err := s.Outbox().GetPending(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+		require.NoError(t, s.Outbox().MarkDelivered(ctx, msgs[0].ID))
+
+		_, err = s.Receipts().Issue(ctx, "r_1", "FR", finishedAt)
+		require.NoError(t, err)
+
+		k := &apikey.APIKey{ID: "k_1", PartnerID: "p_1", Scopes: []apikey.Scope{apikey.ScopeRidesWrite}, Hash: "h_1", CreatedAt: now}
+		require.NoError(t, s.APIKeys().Create(ctx, k))
+		require.NoError(t, s.APIKeys().Touch(ctx, "k_1", finishedAt))
+
+		sub := &webhook.Subscription{ID: "s_1", URL: "https://partner.test/hooks", Events: []string{"ride.finished"}, Secret: "secret", CreatedAt: now}
+		require.NoError(t, s.Webhooks().CreateSubscription(ctx, sub))
+		d := &webhook.Delivery{ID: "d_1", SubscriptionID: "s_1", MessageID: 1, EventType: "ride.finished", Payload: []byte(`{"ride_id":"r_1"}`), Status: webhook.DeliveryPending, NextAttemptAt: now, CreatedAt: now}
+		require.NoError(t, s.Webhooks().CreateDeliveries(ctx, []*webhook.Delivery{d}))
+		d.Attempts = 1
+		d.LastError = "timeout"
+		require.NoError(t, s.Webhooks().UpdateDelivery(ctx, d))
+
+		_, err = s.Idempotency().Reserve(ctx, idempotency.Record{Key: "key_1", Fingerprint: "f_1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+		require.NoError(t, err)
+		require.NoError(t, s.Idempotency().Complete(ctx, "key_1", 201, []byte(`{"id":"r_1"}`)))
+	}
+
+	assertFilled := func(s *mem.Store) {
+		u, err := s.Users().GetByID(ctx, "u_1")
+		require.NoError(t, err)
+		assert.Equal(t, "p_1", u.PartnerID)
+		v, err := s.Vehicles().GetByID(ctx, "v_1")
+		require.NoError(t, err)
+		assert.Equal(t, "FR", v.Country)
+
+		r, err := s.Rides().GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		assert.Equal(t, ride.StatusPaid, r.Status)
+		assert.Equal(t, "FR", r.Country)
+		assert.True(t, now.Add(time.Minute).Equal(*r.FinishedAt))
+		assert.Equal(t, &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusCaptured}, r.Payment)
+
+		events, err := s.Rides().GetEvents(ctx, "r_1")
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, ride.EventFinished, events[1].Type)
+
+		w, err := s.Wallet().GetByUserID(ctx, "u_1")
+		require.NoError(t, err)
+		assert.Equal(t, money.NewMoney(382, wallet.Currency), w.Balance)
+
+		// The first message was delivered, the second one keeps its ID
+		msgs, err := s.Outbox().GetPending(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+		assert.EqualValues(t, 2, msgs[0].ID)
+
+		// The ride keeps its receipt, and the next one of the country gets the next number
+		i, err := s.Receipts().Issue(ctx, "r_1", "FR", now)
+		require.NoError(t, err)
+		assert.Equal(t, "FR-00000001", i.Number())
+		i, err = s.Receipts().Issue(ctx, "r_2", "FR", now)
+		require.NoError(t, err)
+		assert.Equal(t, "FR-00000002", i.Number())
+
+		k, err := s.APIKeys().GetByHash(ctx, "h_1")
+		require.NoError(t, err)
+		assert.Equal(t, "k_1", k.ID)
+		assert.Equal(t, []apikey.Scope{apikey.ScopeRidesWrite}, k.Scopes)
+		require.NotNil(t, k.LastUsedAt)
+		assert.True(t, now.Add(time.Minute).Equal(*k.LastUsedAt))
+
+		sub, err := s.Webhooks().GetSubscription(ctx, "s_1")
+		require.NoError(t, err)
+		assert.Equal(t, "secret", sub.Secret)
+		assert.Equal(t, []string{"ride.finished"}, sub.Events)
+		d, err := s.Webhooks().GetDelivery(ctx, "d_1")
+		require.NoError(t, err)
+		assert.Equal(t, `{"ride_id":"r_1"}`, string(d.Payload))
+		assert.Equal(t, 1, d.Attempts)
+		assert.Equal(t, "timeout", d.LastError)
+
+		// A retry gets the stored response
+		rec, err := s.Idempotency().Reserve(ctx, idempotency.Record{Key: "key_1", Fingerprint: "f_1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+		require.NoError(t, err)
+		require.NotNil(t, rec)
+		assert.Equal(t, 201, rec.StatusCode)
+		assert.Equal(t, `{"id":"r_1"}`, string(rec.Body))
+	}
+
+	t.Run("reopened after closing", func(t *testing.T) {
+		setup()
+		s := open()
+		fill(s)
+		require.NoError(t, s.Close())
+
+		s = open()
+		defer s.Close()
+		assertFilled(s)
+	})
+
+	t.Run("reopened after a crash", func(t *testing.T) {
+		setup()
+		// Not closed, the changes are only in the log
+		fill(open())
+
+		s := open()
+		defer s.Close()
+		assertFilled(s)
+
+		// The seeded users are kept too
+		_, err := s.Users().GetByID(ctx, "1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("torn record at the end of the log", func(t *testing.T) {
+		setup()
+		s := open()
+		fill(s)
+		// Crashes while writing the last change
+		require.NoError(t, s.Users().Create(ctx, &user.User{ID: "u_2"}))
+		info, err := os.Stat(path + ".wal")
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(path+".wal", info.Size()-5))
+
+		s = open()
+		assertFilled(s)
+		_, err = s.Users().GetByID(ctx, "u_2")
+		assert.ErrorIs(t, err, user.ErrNotFound)
+
+		// The log goes on after the record cut off
+		require.NoError(t, s.Users().Create(ctx, &user.User{ID: "u_3"}))
+		s = open()
+		defer s.Close()
+		_, err = s.Users().GetByID(ctx, "u_3")
+		assert.NoError(t, err)
+	})
+
+	t.Run("torn header at the end of the log", func(t *testing.T) {
+		setup()
+		s := open()
+		fill(s)
+		f, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = f.Write([]byte{0xff, 0xff})
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s = open()
+		defer s.Close()
+		assertFilled(s)
+	})
+
+	t.Run("damaged record in the middle of the log", func(t *testing.T) {
+		setup()
+		fill(open())
+		f, err := os.OpenFile(path+".wal", os.O_RDWR, 0)
+		require.NoError(t, err)
+		_, err = f.WriteAt([]byte("}"), 20)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		_, err = mem.OpenStore(path)
+		assert.ErrorIs(t, err, mem.ErrCorruptLog)
+	})
+
+	t.Run("crash after the snapshot, before emptying the log", func(t *testing.T) {
+		setup()
+		s := open()
+		fill(s)
+		wal, err := os.ReadFile(path + ".wal")
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+		require.NoError(t, os.WriteFile(path+".wal", wal, 0o644))
+
+		// The changes in the snapshot are not applied twice
+		s = open()
+		defer s.Close()
+		assertFilled(s)
+	})
+
+	t.Run("reopened after a crash, with a unit of work rolled back", func(t *testing.T) {
+		setup()
+		s := open()
+		fill(s)
+		err := txn.NewMemoryManager().WithinTx(ctx, func(ctx context.Context) error {
+			r := &ride.Ride{ID: "r_2", VehicleID: "v_1", UserID: "u_1", Status: ride.StatusActive, StartedAt: now}
+			r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+			require.NoError(t, s.Rides().Create(ctx, r))
+			require.NoError(t, s.APIKeys().Create(ctx, &apikey.APIKey{ID: "k_2", PartnerID: "p_1", CreatedAt: now}))
+			require.NoError(t, s.APIKeys().Touch(ctx, "k_1", now))
+			return errors.New("failed")
+		})
+		require.Error(t, err)
+
+		// Both the changes and their rollback are replayed
+		s = open()
+		defer s.Close()
+		assertFilled(s)
+		_, err = s.Rides().GetByID(ctx, "r_2")
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+		_, err = s.APIKeys().GetByID(ctx, "k_2")
+		assert.ErrorIs(t, err, apikey.ErrNotFound)
+	})
+
+	t.Run("checkpointed once the log passes its limits", func(t *testing.T) {
+		walSize := func() int64 {
+			info, err := os.Stat(path + ".wal")
+			require.NoError(t, err)
+			return info.Size()
+		}
+
+		setup()
+		s := open(mem.WithCheckpoint(1000, 0))
+		fill(s)
+		checkpointed, err := s.Checkpoint()
+		require.NoError(t, err)
+		assert.False(t, checkpointed, "under the record limit")
+		assert.NotZero(t, walSize())
+		require.NoError(t, s.Close())
+
+		setup()
+		s = open(mem.WithCheckpoint(3, 0))
+		fill(s)
+		checkpointed, err = s.Checkpoint()
+		require.NoError(t, err)
+		assert.True(t, checkpointed, "over the record limit")
+		assert.Zero(t, walSize())
+		require.NoError(t, s.Close())
+
+		setup()
+		s = open(mem.WithCheckpoint(0, 100))
+		fill(s)
+		checkpointed, err = s.Checkpoint()
+		require.NoError(t, err)
+		assert.True(t, checkpointed, "over the size limit")
+		assert.Zero(t, walSize())
+		checkpointed, err = s.Checkpoint()
+		require.NoError(t, err)
+		assert.False(t, checkpointed, "the log is empty")
+		require.NoError(t, s.Close())
+
+		setup()
+		s = open()
+		fill(s)
+		checkpointed, err = s.Checkpoint()
+		require.NoError(t, err)
+		assert.False(t, checkpointed, "without limits")
+		require.NoError(t, s.Close())
+
+		_, err = mem.OpenStore(path, mem.WithCheckpoint(-1, 0))
+		assert.Error(t, err)
+	})
+
+	t.Run("sync policies", func(t *testing.T) {
+		for _, opt := range []mem.StoreOption{
+			mem.WithSync(mem.SyncInterval, time.Millisecond),
+			mem.WithSync(mem.SyncNever, 0),
+		} {
+			setup()
+			s := open(opt)
+			fill(s)
+			require.NoError(t, s.Close())
+
+			s = open()
+			assertFilled(s)
+			require.NoError(t, s.Close())
+		}
+
+		_, err := mem.OpenStore(path, mem.WithSync(mem.SyncInterval, 0))
+		assert.Error(t, err)
+		_, err = mem.OpenStore(path, mem.WithSync("SOMETIMES", time.Second))
+		assert.Error(t, err)
+	})
+}
@@ -2,33 +2,45 @@ package mem
 
 import (
 	"context"
+	"sync"
 
 	"reby/domain/user"
 )
 
 type dbUser struct {
-	id string
+	id        string
+	partnerID string
 }
 
 func (u dbUser) toDomain() *user.User {
 	return &user.User{
-		ID: u.id,
+		ID:        u.id,
+		PartnerID: u.partnerID,
 	}
 }
 
 func toUserDB(u *user.User) dbUser {
-	return dbUser{id: u.ID}
+	return dbUser{id: u.ID, partnerID: u.PartnerID}
 }
 
 type userDB struct {
+	mu    sync.RWMutex
 	users map[string]dbUser
+	wal   *wal
 }
 
 func NewUserDB() user.Repo {
-	return &userDB{users: map[string]dbUser{"1": {"1"}, "2": {"2"}}}
+	return newUserDB()
+}
+
+func newUserDB() *userDB {
+	return &userDB{users: map[string]dbUser{"1": {id: "1"}, "2": {id: "2"}}}
 }
 
 func (m *userDB) GetByID(_ context.Context, id string) (*user.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	u, ok := m.users[id]
 	if !ok {
 		return nil, user.ErrNotFound
@@ -38,10 +50,16 @@ func (m *userDB) GetByID(_ context.Context, id string) (*user.User, error) {
 }
 
 func (m *userDB) Create(_ context.Context, u *user.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	uDB := toUserDB(u)
 	if _, ok := m.users[uDB.id]; ok {
 		return user.ErrAlreadyExists
 	}
+	if err := m.wal.append(record{Op: opCreateUser, ID: uDB.id, PartnerID: uDB.partnerID}); err != nil {
+		return err
+	}
 
 	m.users[uDB.id] = uDB
 	return nil
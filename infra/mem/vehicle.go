@@ -2,33 +2,45 @@ package mem
 
 import (
 	"context"
+	"sync"
 
 	"reby/domain/vehicle"
 )
 
 type dbVehicle struct {
-	id string
+	id      string
+	country string
 }
 
 func (v dbVehicle) toDomain() *vehicle.Vehicle {
 	return &vehicle.Vehicle{
-		ID: v.id,
+		ID:      v.id,
+		Country: v.country,
 	}
 }
 
 func toVehicleDB(v *vehicle.Vehicle) dbVehicle {
-	return dbVehicle{id: v.ID}
+	return dbVehicle{id: v.ID, country: v.Country}
 }
 
 type vehicleDB struct {
+	mu       sync.RWMutex
 	vehicles map[string]dbVehicle
+	wal      *wal
 }
 
 func NewVehicleDB() vehicle.Repo {
-	return &vehicleDB{vehicles: map[string]dbVehicle{"1": {"1"}, "2": {"2"}}}
+	return newVehicleDB()
+}
+
+func newVehicleDB() *vehicleDB {
+	return &vehicleDB{vehicles: map[string]dbVehicle{"1": {id: "1"}, "2": {id: "2"}}}
 }
 
 func (m *vehicleDB) GetByID(_ context.Context, id string) (*vehicle.Vehicle, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	v, ok := m.vehicles[id]
 	if !ok {
 		return nil, vehicle.ErrNotFound
@@ -38,10 +50,16 @@ func (m *vehicleDB) GetByID(_ context.Context, id string) (*vehicle.Vehicle, err
 }
 
 func (m *vehicleDB) Create(_ context.Context, v *vehicle.Vehicle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	vDB := toVehicleDB(v)
 	if _, ok := m.vehicles[vDB.id]; ok {
 		return vehicle.ErrAlreadyExists
 	}
+	if err := m.wal.append(record{Op: opCreateVehicle, ID: vDB.id, Country: vDB.country}); err != nil {
+		return err
+	}
 
 	m.vehicles[vDB.id] = vDB
 	return nil
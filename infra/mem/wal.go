@@ -0,0 +1,352 @@
+package mem
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+	"reby/domain/wallet"
+	"reby/domain/webhook"
+	"reby/pkg/event"
+	"reby/pkg/idempotency"
+)
+
+var ErrCorruptLog = errors.New("ERR_MEM_CORRUPT_LOG")
+
+// SyncPolicy tells when the log of a Store is flushed to disk.
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes every change before it is acknowledged, a crash loses none.
+	SyncAlways SyncPolicy = "ALWAYS"
+	// SyncInterval flushes the changes on an interval, a crash loses those of the last interval.
+	SyncInterval SyncPolicy = "INTERVAL"
+	// SyncNever leaves the flushing to the operating system, only a crash of the process loses nothing.
+	SyncNever SyncPolicy = "NEVER"
+)
+
+func (p SyncPolicy) IsValid() bool {
+	switch p {
+	case SyncAlways, SyncInterval, SyncNever:
+		return true
+	default:
+		return false
+	}
+}
+
+type op string
+
+const (
+	opCreateUser      op = "CREATE_USER"
+	opCreateVehicle   op = "CREATE_VEHICLE"
+	opSaveRide        op = "SAVE_RIDE"
+	opRevertRide      op = "REVERT_RIDE"
+	opMarkDelivered   op = "MARK_DELIVERED"
+	opPostTransaction op = "POST_TRANSACTION"
+	opIssueReceipt    op = "ISSUE_RECEIPT"
+	opSaveAPIKey      op = "SAVE_API_KEY"
+	opDeleteAPIKey    op = "DELETE_API_KEY"
+
+	opCreateSubscription    op = "CREATE_SUBSCRIPTION"
+	opDeleteSubscription    op = "DELETE_SUBSCRIPTION"
+	opSaveDeliveries        op = "SAVE_DELIVERIES"
+	opSaveIdempotencyKey    op = "SAVE_IDEMPOTENCY_KEY"
+	opDeleteIdempotencyKeys op = "DELETE_IDEMPOTENCY_KEYS"
+)
+
+// record is a change of the repos as written to the log. Only the fields of its op are set.
+type record struct {
+	Seq         uint64              `json:"seq"`
+	Op          op                  `json:"op"`
+	ID          string              `json:"id,omitempty"`
+	Country     string              `json:"country,omitempty"`
+	PartnerID   string              `json:"partner_id,omitempty"`
+	Ride        *rideChange         `json:"ride,omitempty"`
+	Revert      *rideRevert         `json:"revert,omitempty"`
+	MessageID   int64               `json:"message_id,omitempty"`
+	Transaction *wallet.Transaction `json:"transaction,omitempty"`
+	Issuance    *receipt.Issuance   `json:"issuance,omitempty"`
+	APIKey      *apiKeyRecord       `json:"api_key,omitempty"`
+
+	Subscription   *webhook.Subscription `json:"subscription,omitempty"`
+	Deliveries     []deliveryRecord      `json:"deliveries,omitempty"`
+	IdempotencyKey *idempotency.Record   `json:"idempotency_key,omitempty"`
+	Keys           []string              `json:"keys,omitempty"`
+}
+
+// apiKeyRecord is an API key as written to the log, with the hash of its secret that the key doesn't show.
+type apiKeyRecord struct {
+	apikey.APIKey
+	Hash string `json:"hash"`
+}
+
+func newAPIKeyRecord(k apikey.APIKey) *apiKeyRecord {
+	return &apiKeyRecord{APIKey: k, Hash: k.Hash}
+}
+
+// withHash returns the key with its hash.
+func (r apiKeyRecord) withHash() apikey.APIKey {
+	k := r.APIKey
+	k.Hash = r.Hash
+	return k
+}
+
+// deliveryRecord is a webhook delivery as written to the log, with the payload that the delivery doesn't show.
+type deliveryRecord struct {
+	webhook.Delivery
+	Payload []byte `json:"payload"`
+}
+
+func newDeliveryRecord(d webhook.Delivery) deliveryRecord {
+	return deliveryRecord{Delivery: d, Payload: d.Payload}
+}
+
+// withPayload returns the delivery with its payload.
+func (r deliveryRecord) withPayload() webhook.Delivery {
+	d := r.Delivery
+	d.Payload = r.Payload
+	return d
+}
+
+// rideChange is a ride as stored after a change, with the events and the wallet transaction stored with it.
+type rideChange struct {
+	Ride        *ride.Ride          `json:"ride"`
+	Events      []ride.Event        `json:"events,omitempty"`
+	Messages    []event.Message     `json:"messages,omitempty"`
+	Transaction *wallet.Transaction `json:"transaction,omitempty"`
+}
+
+// rideRevert undoes a rideChange, when its unit of work is rolled back.
+type rideRevert struct {
+	RideID string `json:"ride_id"`
+	// Ride is the ride before the change, nil when the change created it.
+	Ride *ride.Ride `json:"ride,omitempty"`
+	// Events is how many events the ride had before the change.
+	Events        int     `json:"events"`
+	MessageIDs    []int64 `json:"message_ids,omitempty"`
+	TransactionID string  `json:"transaction_id,omitempty"`
+}
+
+// Every record is framed by its length and checksum, so a record torn by a crash is told apart from a whole one.
+const frameHeaderSize = 8
+
+// wal is the write-ahead log of a Store. The repos append their changes to it before applying them, and a nil wal
+// appends nothing, for the repos that aren't persisted.
+type wal struct {
+	mu     sync.Mutex
+	file   *os.File
+	policy SyncPolicy
+	// seq is the sequence number of the last record, size the length of the log up to it.
+	seq   uint64
+	size  int64
+	dirty bool
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	// records is how many were appended since the last checkpoint.
+	records int
+}
+
+func openWAL(path string, policy SyncPolicy) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wal{file: file, policy: policy}, nil
+}
+
+// replay applies the records after the sequence number after, the ones not in the snapshot yet. A torn record at
+// the end of the log is the change a crash interrupted, it was never acknowledged and is cut off.
+func (w *wal) replay(after uint64, apply func(r record) error) error {
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	reader := bufio.NewReader(io.NewSectionReader(w.file, 0, size))
+
+	w.seq = after
+	var offset int64
+	header := make([]byte, frameHeaderSize)
+	for size-offset >= frameHeaderSize {
+		if _, err = io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		end := offset + frameHeaderSize + int64(binary.LittleEndian.Uint32(header))
+		if end > size {
+			break
+		}
+		payload := make([]byte, end-offset-frameHeaderSize)
+		if _, err = io.ReadFull(reader, payload); err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			// Only the last record can be torn, one in the middle was damaged after being written
+			if end < size {
+				return fmt.Errorf("%w: bad checksum at offset %d of %s", ErrCorruptLog, offset, w.file.Name())
+			}
+			break
+		}
+
+		var r record
+		if err = json.Unmarshal(payload, &r); err != nil {
+			return fmt.Errorf("%w: bad record at offset %d of %s: %v", ErrCorruptLog, offset, w.file.Name(), err)
+		}
+		if r.Seq > w.seq {
+			if err = apply(r); err != nil {
+				return err
+			}
+			w.seq = r.Seq
+		}
+		offset = end
+	}
+
+	if offset < size {
+		log.Printf("discarding %d bytes of a torn record at the end of %s", size-offset, w.file.Name())
+		if err = w.file.Truncate(offset); err != nil {
+			return err
+		}
+		if err = w.file.Sync(); err != nil {
+			return err
+		}
+	}
+	w.size = offset
+
+	return nil
+}
+
+// append writes r to the log, flushing it as the policy says. The repos call it holding their lock, before
+// applying r, so the log has their changes in the order they were applied.
+func (w *wal) append(r record) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	r.Seq = w.seq + 1
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(payload))
+	copy(frame[frameHeaderSize:], payload)
+
+	if _, err = w.file.Write(frame); err == nil && w.policy == SyncAlways {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		// The change is not applied, so it is cut off the log too. Otherwise a replay would apply it, or lose the
+		// records appended after a part of it.
+		if truncErr := w.file.Truncate(w.size); truncErr != nil {
+			log.Printf("failed to cut off the record %d from %s: %v", r.Seq, w.file.Name(), truncErr)
+		}
+		return err
+	}
+	w.seq = r.Seq
+	w.size += int64(len(frame))
+	w.dirty = true
+	w.records++
+
+	return nil
+}
+
+// syncEvery flushes the log every interval until it is closed.
+func (w *wal) syncEvery(interval time.Duration) {
+	w.done = make(chan struct{})
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				if err := w.sync(); err != nil {
+					log.Printf("failed to flush %s: %v", w.file.Name(), err)
+				}
+			}
+		}
+	}()
+}
+
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+
+	return nil
+}
+
+// checkpoint calls save with the sequence number of the last record and empties the log once save is done, as
+// the snapshot saved has every record in it. Nothing is appended meanwhile.
+func (w *wal) checkpoint(save func(seq uint64) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := save(w.seq); err != nil {
+		return err
+	}
+	// A crash before the log is emptied replays it over the snapshot, which skips the records already in it
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.size = 0
+	w.dirty = false
+	w.records = 0
+
+	return nil
+}
+
+// length returns the records appended since the last checkpoint and the size of the log.
+func (w *wal) length() (records int, size int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.records, w.size
+}
+
+func (w *wal) close() error {
+	if w.done != nil {
+		close(w.done)
+		w.wg.Wait()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Sync(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
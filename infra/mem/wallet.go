@@ -0,0 +1,128 @@
+package mem
+
+import (
+	"context"
+	"sync"
+
+	"reby/domain/money"
+	"reby/domain/wallet"
+)
+
+// WalletDB is an in-memory double-entry ledger. It is exported so the ride repo can post the wallet charges of
+// rides together with them, see WithWallet.
+type WalletDB struct {
+	mu           sync.RWMutex
+	transactions []wallet.Transaction
+	posted       map[string]bool
+	balances     map[wallet.Account]money.Value
+	wal          *wal
+}
+
+func NewWalletDB() *WalletDB {
+	return &WalletDB{
+		posted:   make(map[string]bool),
+		balances: make(map[wallet.Account]money.Value),
+	}
+}
+
+func (m *WalletDB) GetByUserID(_ context.Context, userID string) (*wallet.Wallet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	balance, ok := m.balances[wallet.UserAccount(userID)]
+	if !ok {
+		return nil, wallet.ErrNotFound
+	}
+
+	return &wallet.Wallet{UserID: userID, Balance: money.Money{Value: balance, Currency: wallet.Currency}}, nil
+}
+
+func (m *WalletDB) Post(_ context.Context, t wallet.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(t); err != nil {
+		return err
+	}
+	if err := m.wal.append(record{Op: opPostTransaction, Transaction: &t}); err != nil {
+		return err
+	}
+	m.apply(t)
+
+	return nil
+}
+
+// check tells whether t can be posted. It must be called holding the write lock, which is kept until t is applied.
+func (m *WalletDB) check(t wallet.Transaction) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if m.posted[t.ID] {
+		return wallet.ErrAlreadyPosted
+	}
+
+	return nil
+}
+
+// apply stores t, it is the only way entries reach the ledger.
+func (m *WalletDB) apply(t wallet.Transaction) {
+	m.posted[t.ID] = true
+	m.transactions = append(m.transactions, t)
+	for _, e := range t.Entries {
+		m.balances[e.Account] += e.Amount.Value
+	}
+}
+
+// unpost removes the transaction id from the ledger, for a change rolled back. It must be called holding the write
+// lock.
+func (m *WalletDB) unpost(id string) {
+	if !m.posted[id] {
+		return
+	}
+	delete(m.posted, id)
+
+	for i, t := range m.transactions {
+		if t.ID != id {
+			continue
+		}
+		m.transactions = append(m.transactions[:i], m.transactions[i+1:]...)
+		for _, e := range t.Entries {
+			m.balances[e.Account] -= e.Amount.Value
+			if !m.hasEntries(e.Account) {
+				// The wallet didn't exist before the transaction
+				delete(m.balances, e.Account)
+			}
+		}
+		return
+	}
+}
+
+func (m *WalletDB) hasEntries(account wallet.Account) bool {
+	for _, t := range m.transactions {
+		for _, e := range t.Entries {
+			if e.Account == account {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *WalletDB) GetTransactions(_ context.Context, userID string) ([]wallet.Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account := wallet.UserAccount(userID)
+	transactions := make([]wallet.Transaction, 0)
+	for _, t := range m.transactions {
+		for _, e := range t.Entries {
+			if e.Account == account {
+				transactions = append(transactions, t)
+				break
+			}
+		}
+	}
+
+	return transactions, nil
+}
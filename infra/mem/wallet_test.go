@@ -0,0 +1,89 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/domain/wallet"
+	"reby/infra/mem"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletDB(t *testing.T) {
+	db := mem.NewWalletDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := db.GetByUserID(ctx, "u_1")
+	assert.ErrorIs(t, err, wallet.ErrNotFound)
+
+	require.NoError(t, db.Post(ctx, wallet.NewTopUp("t_1", "u_1", 500, "auth_1", now)))
+	require.NoError(t, db.Post(ctx, wallet.NewTopUp("t_2", "u_1", 300, "auth_2", now)))
+	require.NoError(t, db.Post(ctx, wallet.NewTopUp("t_3", "u_2", 100, "auth_3", now)))
+	assert.ErrorIs(t, db.Post(ctx, wallet.NewTopUp("t_1", "u_1", 500, "auth_1", now)), wallet.ErrAlreadyPosted)
+
+	w, err := db.GetByUserID(ctx, "u_1")
+	require.NoError(t, err)
+	assert.Equal(t, money.NewMoney(800, wallet.Currency), w.Balance)
+
+	transactions, err := db.GetTransactions(ctx, "u_1")
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "t_1", transactions[0].ID)
+	assert.Equal(t, "t_2", transactions[1].ID)
+}
+
+func TestRideWalletCharge(t *testing.T) {
+	walletDB := mem.NewWalletDB()
+	db := mem.NewRideDB(mem.WithWallet(walletDB))
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, walletDB.Post(ctx, wallet.NewTopUp("t_1", "u_1", 500, "auth_1", now)))
+	r := &ride.Ride{
+		ID:        "r_1",
+		VehicleID: "v_1",
+		UserID:    "u_1",
+		Status:    ride.StatusActive,
+		StartedAt: now,
+		Payment:   &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusAuthorized},
+	}
+	require.NoError(t, db.Create(ctx, r))
+
+	price := money.NewMoney(700, "EUR")
+	r.Status = ride.StatusPaid
+	r.Price = &price
+	r.ChargeWallet(now)
+	_, err := db.Update(ctx, r)
+	require.NoError(t, err)
+
+	w, err := walletDB.GetByUserID(ctx, "u_1")
+	require.NoError(t, err)
+	assert.Equal(t, money.NewMoney(-200, wallet.Currency), w.Balance)
+
+	// A ride is never charged twice, and the failed update leaves the ride untouched
+	r.Status = ride.StatusFinished
+	_, err = db.Update(ctx, r)
+	assert.ErrorIs(t, err, wallet.ErrAlreadyPosted)
+	stored, err := db.GetByID(ctx, "r_1")
+	require.NoError(t, err)
+	assert.Equal(t, ride.StatusPaid, stored.Status)
+
+	adj := ride.Adjustment{ID: "a_1", Amount: money.NewMoney(300, "EUR"), Reason: "complaint", Actor: ride.ActorOperator}
+	stored.Adjustments = append(stored.Adjustments, adj)
+	stored.RefundWallet(adj)
+	updated, err := db.Update(ctx, stored)
+	require.NoError(t, err)
+	assert.Equal(t, []ride.Adjustment{adj}, updated.Adjustments)
+	assert.Equal(t, money.NewMoney(400, "EUR"), updated.Charged())
+
+	w, err = walletDB.GetByUserID(ctx, "u_1")
+	require.NoError(t, err)
+	assert.Equal(t, money.NewMoney(100, wallet.Currency), w.Balance)
+}
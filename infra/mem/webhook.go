@@ -0,0 +1,203 @@
+package mem
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"reby/domain/webhook"
+)
+
+type webhookDB struct {
+	mu            sync.RWMutex
+	subscriptions map[string]webhook.Subscription
+	deliveries    map[string]webhook.Delivery
+	wal           *wal
+}
+
+func NewWebhookDB() webhook.Repo {
+	return newWebhookDB()
+}
+
+func newWebhookDB() *webhookDB {
+	return &webhookDB{
+		subscriptions: make(map[string]webhook.Subscription),
+		deliveries:    make(map[string]webhook.Delivery),
+	}
+}
+
+func (m *webhookDB) CreateSubscription(_ context.Context, s *webhook.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sDB := *s
+	sDB.Events = append([]string(nil), s.Events...)
+	if err := m.wal.append(record{Op: opCreateSubscription, Subscription: &sDB}); err != nil {
+		return err
+	}
+	m.subscriptions[s.ID] = sDB
+
+	return nil
+}
+
+func (m *webhookDB) GetSubscription(_ context.Context, id string) (*webhook.Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.subscriptions[id]
+	if !ok {
+		return nil, webhook.ErrNotFound
+	}
+
+	return &s, nil
+}
+
+func (m *webhookDB) ListSubscriptions(_ context.Context) ([]*webhook.Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subscriptions := make([]*webhook.Subscription, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		s := s
+		subscriptions = append(subscriptions, &s)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+
+	return subscriptions, nil
+}
+
+func (m *webhookDB) DeleteSubscription(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subscriptions[id]; !ok {
+		return webhook.ErrNotFound
+	}
+	if err := m.wal.append(record{Op: opDeleteSubscription, ID: id}); err != nil {
+		return err
+	}
+	delete(m.subscriptions, id)
+
+	return nil
+}
+
+func (m *webhookDB) CreateDeliveries(_ context.Context, deliveries []*webhook.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var created []deliveryRecord
+	for _, d := range deliveries {
+		if m.hasDelivery(d.SubscriptionID, d.MessageID) || hasDeliveryRecord(created, d) {
+			continue
+		}
+		created = append(created, newDeliveryRecord(*d))
+	}
+
+	return m.save(created)
+}
+
+// hasDeliveryRecord tells whether records has a delivery of the message of d to its subscription.
+func hasDeliveryRecord(records []deliveryRecord, d *webhook.Delivery) bool {
+	for _, r := range records {
+		if r.SubscriptionID == d.SubscriptionID && r.MessageID == d.MessageID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// save logs and stores the deliveries, holding the lock.
+func (m *webhookDB) save(records []deliveryRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := m.wal.append(record{Op: opSaveDeliveries, Deliveries: records}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		m.deliveries[r.ID] = r.withPayload()
+	}
+
+	return nil
+}
+
+func (m *webhookDB) hasDelivery(subscriptionID string, messageID int64) bool {
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subscriptionID && d.MessageID == messageID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *webhookDB) GetDelivery(_ context.Context, id string) (*webhook.Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, webhook.ErrDeliveryNotFound
+	}
+
+	return &d, nil
+}
+
+func (m *webhookDB) GetDueDeliveries(_ context.Context, t time.Time, limit int) ([]*webhook.Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := make([]*webhook.Delivery, 0)
+	for _, d := range m.deliveries {
+		if d.Status == webhook.DeliveryPending && !d.NextAttemptAt.After(t) {
+			d := d
+			deliveries = append(deliveries, &d)
+		}
+	}
+	sortDeliveries(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (m *webhookDB) ListDeliveries(_ context.Context, status webhook.DeliveryStatus) ([]*webhook.Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := make([]*webhook.Delivery, 0)
+	for _, d := range m.deliveries {
+		if d.Status == status {
+			d := d
+			deliveries = append(deliveries, &d)
+		}
+	}
+	sortDeliveries(deliveries)
+
+	return deliveries, nil
+}
+
+func (m *webhookDB) UpdateDelivery(_ context.Context, d *webhook.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return webhook.ErrDeliveryNotFound
+	}
+
+	return m.save([]deliveryRecord{newDeliveryRecord(*d)})
+}
+
+func sortDeliveries(deliveries []*webhook.Delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].MessageID < deliveries[j].MessageID
+		}
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+}
@@ -0,0 +1,81 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/webhook"
+	"reby/infra/mem"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSubscriptions(t *testing.T) {
+	db := mem.NewWebhookDB()
+	ctx := context.Background()
+
+	s := &webhook.Subscription{ID: "wh_1", URL: "https://partner.test", Events: []string{"RideStarted"}, Secret: "s"}
+	require.NoError(t, db.CreateSubscription(ctx, s))
+
+	got, err := db.GetSubscription(ctx, "wh_1")
+	require.NoError(t, err)
+	assert.Equal(t, s, got)
+
+	list, err := db.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	require.NoError(t, db.DeleteSubscription(ctx, "wh_1"))
+	_, err = db.GetSubscription(ctx, "wh_1")
+	assert.ErrorIs(t, err, webhook.ErrNotFound)
+	assert.ErrorIs(t, db.DeleteSubscription(ctx, "wh_1"), webhook.ErrNotFound)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	db := mem.NewWebhookDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, db.CreateDeliveries(ctx, []*webhook.Delivery{
+		{ID: "d_1", SubscriptionID: "wh_1", MessageID: 1, Status: webhook.DeliveryPending, NextAttemptAt: now, CreatedAt: now},
+		{ID: "d_2", SubscriptionID: "wh_1", MessageID: 2, Status: webhook.DeliveryPending, NextAttemptAt: now.Add(time.Hour), CreatedAt: now},
+	}))
+
+	t.Run("duplicated message is ignored", func(t *testing.T) {
+		require.NoError(t, db.CreateDeliveries(ctx, []*webhook.Delivery{
+			{ID: "d_3", SubscriptionID: "wh_1", MessageID: 1, Status: webhook.DeliveryPending, NextAttemptAt: now},
+		}))
+		_, err := db.GetDelivery(ctx, "d_3")
+		assert.ErrorIs(t, err, webhook.ErrDeliveryNotFound)
+	})
+
+	t.Run("due deliveries", func(t *testing.T) {
+		due, err := db.GetDueDeliveries(ctx, now, 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		assert.Equal(t, "d_1", due[0].ID)
+	})
+
+	t.Run("dead deliveries are not due", func(t *testing.T) {
+		d, err := db.GetDelivery(ctx, "d_1")
+		require.NoError(t, err)
+		d.Status = webhook.DeliveryDead
+		require.NoError(t, db.UpdateDelivery(ctx, d))
+
+		due, err := db.GetDueDeliveries(ctx, now.Add(2*time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		assert.Equal(t, "d_2", due[0].ID)
+
+		dead, err := db.ListDeliveries(ctx, webhook.DeliveryDead)
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+		assert.Equal(t, "d_1", dead[0].ID)
+	})
+
+	t.Run("update unknown delivery", func(t *testing.T) {
+		assert.ErrorIs(t, db.UpdateDelivery(ctx, &webhook.Delivery{ID: "d_10"}), webhook.ErrDeliveryNotFound)
+	})
+}
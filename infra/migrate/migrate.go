@@ -0,0 +1,256 @@
+// Package migrate applies the numbered SQL migrations of a database, recording them in its schema_migrations table.
+// Every backend embeds its own migrations, in its own SQL dialect.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidMigration = errors.New("ERR_INVALID_MIGRATION")
+	ErrUnknownMigration = errors.New("ERR_UNKNOWN_MIGRATION")
+)
+
+// migrationFileName is <version>_<name>.<up|down>.sql, like 0001_initial_schema.up.sql.
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	// AppliedAt is nil for the pending migrations.
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations in the root of fsys, by version. Every version needs its up and its down.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		match := migrationFileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, e.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, e.Name())
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d is both %s and %s", ErrInvalidMigration, version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%w: version %d needs an up and a down", ErrInvalidMigration, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Lock keeps other processes from migrating the database through conn until unlock is called.
+type Lock func(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+
+// Migrator applies and reverts the migrations, recording the applied versions in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	lock       Lock
+}
+
+// NewMigrator returns a Migrator holding lock while migrating, nil when the database needs none.
+func NewMigrator(db *sql.DB, migrations []Migration, lock Lock) *Migrator {
+	return &Migrator{db: db, migrations: migrations, lock: lock}
+}
+
+// Up applies the pending migrations in order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := versions[mig.Version]; ok {
+				continue
+			}
+			q := `INSERT INTO "schema_migrations" (version, name, applied_at) VALUES ($1, $2, $3);`
+			if err = applyMigration(ctx, conn, mig, mig.Up, q, mig.Version, mig.Name, time.Now().UTC()); err != nil {
+				return err
+			}
+			applied = append(applied, mig)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, the latest first, and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		byVersion := make(map[int]Migration, len(m.migrations))
+		for _, mig := range m.migrations {
+			byVersion[mig.Version] = mig
+		}
+
+		applied := make([]int, 0, len(versions))
+		for v := range versions {
+			applied = append(applied, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(applied)))
+
+		for i := 0; i < steps && i < len(applied); i++ {
+			mig, ok := byVersion[applied[i]]
+			if !ok {
+				return fmt.Errorf("%w: version %d is applied but not in this binary", ErrUnknownMigration, applied[i])
+			}
+			q := `DELETE FROM "schema_migrations" WHERE version=$1;`
+			if err = applyMigration(ctx, conn, mig, mig.Down, q, mig.Version); err != nil {
+				return err
+			}
+			reverted = append(reverted, mig)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status returns every migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			s := Status{Migration: mig}
+			if appliedAt, ok := versions[mig.Version]; ok {
+				s.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, s)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// applyMigration runs script, the up or the down of mig, and records it with q in the same transaction, so a failed
+// migration leaves nothing behind.
+func applyMigration(ctx context.Context, conn *sql.Conn, mig Migration, script, q string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+	}
+	if _, err = tx.ExecContext(ctx, q, args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// locked runs fn holding the migration lock. Locks may belong to the session, so fn gets the connection holding it.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.lock != nil {
+		unlock, err := m.lock(ctx, conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	q := `CREATE TABLE IF NOT EXISTS "schema_migrations" (
+	version bigint PRIMARY KEY,
+	name varchar(255) NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+);`
+	if _, err = conn.ExecContext(ctx, q); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM "schema_migrations";`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
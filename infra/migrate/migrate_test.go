@@ -0,0 +1,192 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"reby/infra/migrate"
+	"reby/infra/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	file := func(data string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(data)} }
+
+	testCases := []struct {
+		description string
+		fsys        fstest.MapFS
+		expected    []migrate.Migration
+		expectedErr error
+	}{
+		{
+			description: "sorted by version",
+			fsys: fstest.MapFS{
+				"0010_add_index.up.sql":         file("CREATE INDEX"),
+				"0010_add_index.down.sql":       file("DROP INDEX"),
+				"0002_add_table.up.sql":         file("CREATE TABLE"),
+				"0002_add_table.down.sql":       file("DROP TABLE"),
+				"0003_backfill_column.up.sql":   file("UPDATE"),
+				"0003_backfill_column.down.sql": file("SELECT 1"),
+			},
+			expected: []migrate.Migration{
+				{Version: 2, Name: "add_table", Up: "CREATE TABLE", Down: "DROP TABLE"},
+				{Version: 3, Name: "backfill_column", Up: "UPDATE", Down: "SELECT 1"},
+				{Version: 10, Name: "add_index", Up: "CREATE INDEX", Down: "DROP INDEX"},
+			},
+		},
+		{
+			description: "missing down",
+			fsys: fstest.MapFS{
+				"0001_add_table.up.sql": file("CREATE TABLE"),
+			},
+			expectedErr: migrate.ErrInvalidMigration,
+		},
+		{
+			description: "two names for a version",
+			fsys: fstest.MapFS{
+				"0001_add_table.up.sql":   file("CREATE TABLE"),
+				"0001_add_index.down.sql": file("DROP INDEX"),
+			},
+			expectedErr: migrate.ErrInvalidMigration,
+		},
+		{
+			description: "not a migration",
+			fsys: fstest.MapFS{
+				"README.md": file("# Migrations"),
+			},
+			expectedErr: migrate.ErrInvalidMigration,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			migrations, err := migrate.Load(tc.fsys)
+
+			assert.True(t, errors.Is(err, tc.expectedErr), "expected %v, got %v", tc.expectedErr, err)
+			assert.Equal(t, tc.expected, migrations)
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	migrations := []migrate.Migration{
+		{Version: 1, Name: "add_user", Up: `CREATE TABLE "user" (id text PRIMARY KEY);`, Down: `DROP TABLE "user";`},
+		{Version: 2, Name: "add_vehicle", Up: `CREATE TABLE "vehicle" (id text PRIMARY KEY);`, Down: `DROP TABLE "vehicle";`},
+	}
+
+	var db *sql.DB
+	setup := func() {
+		var err error
+		db, err = sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+	}
+
+	tableExists := func(name string) bool {
+		var n int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=$1;`, name).Scan(&n))
+		return n == 1
+	}
+
+	t.Run("up applies the pending migrations once", func(t *testing.T) {
+		setup()
+		m := migrate.NewMigrator(db, migrations[:1], nil)
+
+		applied, err := m.Up(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, migrations[:1], applied)
+
+		m = migrate.NewMigrator(db, migrations, nil)
+		applied, err = m.Up(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, migrations[1:], applied)
+
+		applied, err = m.Up(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+		assert.True(t, tableExists("user"))
+		assert.True(t, tableExists("vehicle"))
+	})
+
+	t.Run("down reverts the latest first", func(t *testing.T) {
+		setup()
+		m := migrate.NewMigrator(db, migrations, nil)
+		_, err := m.Up(ctx)
+		require.NoError(t, err)
+
+		reverted, err := m.Down(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, migrations[1:], reverted)
+		assert.True(t, tableExists("user"))
+		assert.False(t, tableExists("vehicle"))
+
+		reverted, err = m.Down(ctx, 5)
+		require.NoError(t, err)
+		assert.Equal(t, migrations[:1], reverted)
+		assert.False(t, tableExists("user"))
+	})
+
+	t.Run("status", func(t *testing.T) {
+		setup()
+		_, err := migrate.NewMigrator(db, migrations[:1], nil).Up(ctx)
+		require.NoError(t, err)
+
+		statuses, err := migrate.NewMigrator(db, migrations, nil).Status(ctx)
+		require.NoError(t, err)
+
+		require.Len(t, statuses, 2)
+		assert.Equal(t, migrations[0], statuses[0].Migration)
+		assert.NotNil(t, statuses[0].AppliedAt)
+		assert.Equal(t, migrations[1], statuses[1].Migration)
+		assert.Nil(t, statuses[1].AppliedAt)
+	})
+
+	t.Run("failed migration leaves nothing behind", func(t *testing.T) {
+		setup()
+		broken := append(migrations[:1:1], migrate.Migration{
+			Version: 2,
+			Name:    "broken",
+			Up:      `CREATE TABLE "vehicle" (id text PRIMARY KEY); CREATE TABLE "user" (id text);`,
+			Down:    `DROP TABLE "vehicle";`,
+		})
+
+		applied, err := migrate.NewMigrator(db, broken, nil).Up(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, migrations[:1], applied)
+		assert.False(t, tableExists("vehicle"))
+
+		statuses, err := migrate.NewMigrator(db, broken, nil).Status(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, statuses[1].AppliedAt)
+	})
+
+	t.Run("applied version missing from the binary", func(t *testing.T) {
+		setup()
+		_, err := migrate.NewMigrator(db, migrations, nil).Up(ctx)
+		require.NoError(t, err)
+
+		_, err = migrate.NewMigrator(db, migrations[:1], nil).Down(ctx, 1)
+		assert.True(t, errors.Is(err, migrate.ErrUnknownMigration))
+	})
+
+	t.Run("holds the lock while migrating", func(t *testing.T) {
+		setup()
+		var locked, unlocked bool
+		lock := func(ctx context.Context, conn *sql.Conn) (func(), error) {
+			locked = true
+			return func() { unlocked = true }, nil
+		}
+
+		_, err := migrate.NewMigrator(db, migrations, lock).Up(ctx)
+		require.NoError(t, err)
+		assert.True(t, locked)
+		assert.True(t, unlocked)
+	})
+}
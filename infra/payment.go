@@ -0,0 +1,4 @@
+package infra
+
+// FakePaymentProvider charges nobody. It is the only payment provider until a real one is integrated.
+const FakePaymentProvider = "FAKE"
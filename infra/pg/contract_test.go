@@ -0,0 +1,42 @@
+package pg_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"reby/app/config"
+	"reby/infra/pg"
+	"reby/infra/repotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// dsnEnv is the variable with the DSN of a Postgres the contract runs against. Its rides, users and vehicles are
+// deleted before every test.
+const dsnEnv = "REPOTEST_POSTGRES_DSN"
+
+func TestContract(t *testing.T) {
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", dsnEnv)
+	}
+
+	db := pg.Open(&config.Config{DBDSN: dsn})
+	t.Cleanup(func() { _ = db.Close() })
+	migrator, err := pg.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		_, err := db.Exec(`TRUNCATE "user", "vehicle", "ride", "outbox" CASCADE;`)
+		require.NoError(t, err)
+
+		return repotest.Repos{
+			Users:    pg.NewUserDB(db),
+			Vehicles: pg.NewVehicleDB(db),
+			Rides:    pg.NewRideDB(db),
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"reby/infra/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key of the advisory lock held while migrating, so replicas starting together migrate one
+// after the other.
+const migrationLockID int64 = 7_301_944_181
+
+// Migrations returns the migrations embedded in the binary, by version.
+func Migrations() ([]migrate.Migration, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.Load(sub)
+}
+
+// NewMigrator returns the migrator of the Postgres schema.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.NewMigrator(db, migrations, advisoryLock), nil
+}
+
+// advisoryLock takes the migration lock. Advisory locks belong to the session, so it is released through conn.
+func advisoryLock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationLockID); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// Unlocked with a fresh context, the lock must be released even when ctx is done
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLockID)
+	}, nil
+}
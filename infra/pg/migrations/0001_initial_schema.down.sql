@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS "api_key";
+DROP TABLE IF EXISTS "idempotency_key";
+DROP TABLE IF EXISTS "ledger_entry";
+DROP TABLE IF EXISTS "wallet_transaction";
+DROP TABLE IF EXISTS "receipt";
+DROP TABLE IF EXISTS "receipt_sequence";
+DROP TABLE IF EXISTS "ride_adjustment";
+DROP TABLE IF EXISTS "webhook_delivery";
+DROP TABLE IF EXISTS "webhook_subscription";
+DROP TABLE IF EXISTS "outbox";
+DROP TABLE IF EXISTS "ride_event";
+DROP TABLE IF EXISTS "ride";
+DROP TABLE IF EXISTS "vehicle";
+DROP TABLE IF EXISTS "user";
@@ -0,0 +1,124 @@
+-- The schema initTables used to create on boot. It doesn't fail on the databases it already created, so they are
+-- migrated from this version on.
+CREATE TABLE IF NOT EXISTS "user" (id varchar(255) PRIMARY KEY);
+
+CREATE TABLE IF NOT EXISTS "vehicle" (id varchar(255) PRIMARY KEY);
+
+CREATE TABLE IF NOT EXISTS "ride" (
+	id varchar(255) PRIMARY KEY,
+	vehicle_id varchar(255) REFERENCES vehicle(id),
+	user_id varchar(255) REFERENCES "user"(id),
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP,
+	price_value int,
+	price_currency varchar(255)
+);
+
+CREATE TABLE IF NOT EXISTS "ride_event" (
+	id bigserial PRIMARY KEY,
+	ride_id varchar(255) NOT NULL REFERENCES ride(id),
+	type varchar(255) NOT NULL,
+	actor varchar(255) NOT NULL,
+	occurred_at TIMESTAMP NOT NULL,
+	data jsonb
+);
+
+CREATE TABLE IF NOT EXISTS "outbox" (
+	id bigserial PRIMARY KEY,
+	type varchar(255) NOT NULL,
+	aggregate_id varchar(255) NOT NULL,
+	occurred_at TIMESTAMP NOT NULL,
+	payload jsonb NOT NULL,
+	delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON "outbox" (id) WHERE delivered_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "webhook_subscription" (
+	id varchar(255) PRIMARY KEY,
+	url text NOT NULL,
+	events text[] NOT NULL,
+	secret varchar(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+-- Deliveries outlive their subscription so they can still be inspected in the dead-letter list
+CREATE TABLE IF NOT EXISTS "webhook_delivery" (
+	id varchar(255) PRIMARY KEY,
+	subscription_id varchar(255) NOT NULL,
+	message_id bigint NOT NULL,
+	event_type varchar(255) NOT NULL,
+	payload jsonb NOT NULL,
+	status varchar(255) NOT NULL,
+	attempts int NOT NULL,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_error text NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (subscription_id, message_id)
+);
+
+CREATE TABLE IF NOT EXISTS "ride_adjustment" (
+	id varchar(255) PRIMARY KEY,
+	ride_id varchar(255) NOT NULL REFERENCES ride(id),
+	value int NOT NULL,
+	currency varchar(255) NOT NULL,
+	reason text NOT NULL,
+	actor varchar(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "receipt_sequence" (
+	country varchar(255) PRIMARY KEY,
+	last int NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "receipt" (
+	ride_id varchar(255) PRIMARY KEY REFERENCES ride(id),
+	country varchar(255) NOT NULL,
+	sequence int NOT NULL,
+	issued_at TIMESTAMP NOT NULL,
+	UNIQUE (country, sequence)
+);
+
+-- Double-entry ledger of the wallets, the entries of a transaction always add up to zero
+CREATE TABLE IF NOT EXISTS "wallet_transaction" (
+	id varchar(255) PRIMARY KEY,
+	kind varchar(255) NOT NULL,
+	reference varchar(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "ledger_entry" (
+	id bigserial PRIMARY KEY,
+	transaction_id varchar(255) NOT NULL REFERENCES wallet_transaction(id),
+	account varchar(255) NOT NULL,
+	value int NOT NULL,
+	currency varchar(255) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entry_account_idx ON "ledger_entry" (account);
+
+CREATE TABLE IF NOT EXISTS "idempotency_key" (
+	key text PRIMARY KEY,
+	fingerprint varchar(255) NOT NULL,
+	status_code int NOT NULL,
+	body bytea,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+-- Only the hash of the secrets is stored, the secrets are shown once when the keys are issued
+CREATE TABLE IF NOT EXISTS "api_key" (
+	id varchar(255) PRIMARY KEY,
+	partner_id varchar(255) NOT NULL,
+	name text NOT NULL,
+	scopes text[] NOT NULL,
+	hint varchar(255) NOT NULL,
+	hash varchar(255) NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP,
+	expires_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_key_partner_idx ON "api_key" (partner_id);
@@ -0,0 +1,10 @@
+ALTER TABLE "ride" DROP COLUMN IF EXISTS partner_id;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS payment_method;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS payment_status;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS payment_authorization_id;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS status;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS cancelled_by;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS cancel_reason;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS finished_by;
+ALTER TABLE "ride" DROP COLUMN IF EXISTS finish_reason;
@@ -0,0 +1,15 @@
+-- Columns added after the ride table was first created
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS finish_reason varchar(255);
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS finished_by varchar(255);
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS cancel_reason varchar(255);
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS cancelled_by varchar(255);
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS status varchar(255) NOT NULL DEFAULT 'ACTIVE';
+-- Rides created before the status column existed are finished or cancelled according to their timestamps
+UPDATE "ride" SET status='FINISHED' WHERE status='ACTIVE' AND finished_at IS NOT NULL;
+UPDATE "ride" SET status='CANCELLED' WHERE status='ACTIVE' AND cancelled_at IS NOT NULL;
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS payment_authorization_id varchar(255);
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS payment_status varchar(255);
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS payment_method varchar(255);
+UPDATE "ride" SET payment_method='CARD' WHERE payment_method IS NULL AND payment_status IS NOT NULL;
+ALTER TABLE "ride" ADD COLUMN IF NOT EXISTS partner_id varchar(255);
@@ -0,0 +1 @@
+ALTER TABLE "webhook_subscription" DROP COLUMN IF EXISTS partner_id;
@@ -0,0 +1,2 @@
+-- Subscriptions created before partners could subscribe are the platform's own and keep receiving every ride
+ALTER TABLE "webhook_subscription" ADD COLUMN IF NOT EXISTS partner_id varchar(255) NOT NULL DEFAULT '';
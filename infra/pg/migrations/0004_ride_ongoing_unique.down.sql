@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ride_vehicle_ongoing_idx;
+DROP INDEX IF EXISTS ride_user_ongoing_idx;
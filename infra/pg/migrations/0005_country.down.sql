@@ -0,0 +1,2 @@
+ALTER TABLE "ride" DROP COLUMN IF EXISTS country;
+ALTER TABLE "vehicle" DROP COLUMN IF EXISTS country;
@@ -0,0 +1,2 @@
+-- The partner a user signed up through, the only one that can start rides for the user
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS partner_id varchar(255);
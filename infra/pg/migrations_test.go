@@ -0,0 +1,21 @@
+package pg_test
+
+import (
+	"testing"
+
+	"reby/infra/pg"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := pg.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	// Versions are never reused nor skipped, a gap is a migration lost in a merge
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, m.Name)
+	}
+}
@@ -1,59 +1,133 @@
 package pg
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 	"log"
+	"strconv"
+	"strings"
 
 	"reby/app/config"
+
+	"github.com/lib/pq"
 )
 
+// InitDB connects to the database, migrating it first when configured to. Otherwise it is migrated by the migrate
+// command before the deploy.
 func InitDB(conf *config.Config) *sql.DB {
-	// connection string
-	psqlconn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		conf.DBHost,
-		conf.DBPort,
-		conf.DBUser,
-		conf.DBPassword,
-		conf.DBName,
-	)
+	db := Open(conf)
+	if !conf.DBMigrateOnStart {
+		return db
+	}
 
-	// open database
-	db, err := sql.Open("postgres", psqlconn)
+	migrator, err := NewMigrator(db)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	if err = db.Ping(); err != nil {
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
 		log.Fatal(err)
 	}
+	for _, m := range applied {
+		log.Printf("applied migration %04d_%s", m.Version, m.Name)
+	}
 
-	initTables(db)
 	return db
 }
 
-func initTables(db *sql.DB) {
-	userTable := `CREATE TABLE IF NOT EXISTS "user" (id varchar(255) PRIMARY KEY);`
-	if _, err := db.Exec(userTable); err != nil {
+// Open connects to the database as it is.
+func Open(conf *config.Config) *sql.DB {
+	dsn, err := DSN(conf)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	vehicleTable := `CREATE TABLE IF NOT EXISTS "vehicle" (id varchar(255) PRIMARY KEY);`
-	if _, err := db.Exec(vehicleTable); err != nil {
+	// open database
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
 		log.Fatal(err)
 	}
+	db.SetMaxOpenConns(conf.DBMaxOpenConns)
+	db.SetMaxIdleConns(conf.DBMaxIdleConns)
+	db.SetConnMaxLifetime(conf.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(conf.DBConnMaxIdleTime)
 
-	rideTable :=
-		`CREATE TABLE IF NOT EXISTS "ride" (
-	id varchar(255) PRIMARY KEY,
-	vehicle_id varchar(255) REFERENCES vehicle(id),
-	user_id varchar(255) REFERENCES "user"(id),
-	started_at TIMESTAMP NOT NULL,
-	finished_at TIMESTAMP,
-    price_value int,
-    price_currency varchar(255)
-);`
-	if _, err := db.Exec(rideTable); err != nil {
+	if err = db.Ping(); err != nil {
 		log.Fatal(err)
 	}
+
+	return db
+}
+
+// DSN returns the connection string of conf. A configured DSN is used as is, SSL included, only the statement
+// timeout is added when it has none.
+func DSN(conf *config.Config) (string, error) {
+	var params [][2]string
+	if conf.DBStatementTimeout > 0 {
+		timeout := strconv.FormatInt(conf.DBStatementTimeout.Milliseconds(), 10)
+		params = append(params, [2]string{"statement_timeout", timeout})
+	}
+
+	if conf.DBDSN != "" {
+		dsn := conf.DBDSN
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			var err error
+			if dsn, err = pq.ParseURL(dsn); err != nil {
+				return "", err
+			}
+		}
+		if strings.Contains(dsn, "statement_timeout=") {
+			return dsn, nil
+		}
+		return joinParams(append([][2]string{{"", dsn}}, params...)), nil
+	}
+
+	connParams := [][2]string{
+		{"host", conf.DBHost},
+		{"port", strconv.Itoa(conf.DBPort)},
+		{"user", conf.DBUser},
+		{"password", conf.DBPassword},
+		{"dbname", conf.DBName},
+		{"sslmode", conf.DBSSLMode},
+		{"sslrootcert", conf.DBSSLRootCert},
+		{"sslcert", conf.DBSSLCert},
+		{"sslkey", conf.DBSSLKey},
+	}
+
+	return joinParams(append(connParams, params...)), nil
+}
+
+// joinParams writes params as key='value' pairs, skipping the empty values. A pair without key is written raw.
+func joinParams(params [][2]string) string {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		switch {
+		case p[1] == "":
+		case p[0] == "":
+			pairs = append(pairs, p[1])
+		default:
+			pairs = append(pairs, p[0]+"='"+quote.Replace(p[1])+"'")
+		}
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// isUniqueViolation tells whether err comes from inserting a row whose key is taken.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation"
+}
+
+// violatedIndex returns the name of the unique index a unique violation is about.
+func violatedIndex(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint
+	}
+
+	return ""
 }
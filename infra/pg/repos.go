@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"database/sql"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+	"reby/domain/user"
+	"reby/domain/vehicle"
+	"reby/domain/wallet"
+	"reby/domain/webhook"
+	"reby/infra/sqlrepo"
+	"reby/pkg/event"
+	"reby/pkg/idempotency"
+
+	"github.com/lib/pq"
+)
+
+// dialect runs the shared repos on Postgres, which takes the times, JSON documents and arrays as they are.
+var dialect = sqlrepo.Dialect{
+	Now:               "now()",
+	ForUpdate:         " FOR UPDATE",
+	Time:              func(t time.Time) time.Time { return t },
+	JSON:              func(doc []byte) interface{} { return doc },
+	Strings:           func(s []string) interface{} { return pq.Array(s) },
+	StringsDest:       func(s *[]string) interface{} { return pq.Array(s) },
+	IsUniqueViolation: isUniqueViolation,
+	ViolatedIndex:     violatedIndex,
+}
+
+func NewUserDB(db *sql.DB) user.Repo {
+	return sqlrepo.NewUserDB(db, dialect)
+}
+
+func NewVehicleDB(db *sql.DB) vehicle.Repo {
+	return sqlrepo.NewVehicleDB(db, dialect)
+}
+
+func NewRideDB(db *sql.DB) ride.Repo {
+	return sqlrepo.NewRideDB(db, dialect)
+}
+
+func NewOutbox(db *sql.DB) event.Outbox {
+	return sqlrepo.NewOutbox(db, dialect)
+}
+
+func NewWalletDB(db *sql.DB) wallet.Repo {
+	return sqlrepo.NewWalletDB(db, dialect)
+}
+
+func NewReceiptDB(db *sql.DB) receipt.Repo {
+	return sqlrepo.NewReceiptDB(db, dialect)
+}
+
+func NewAPIKeyDB(db *sql.DB) apikey.Repo {
+	return sqlrepo.NewAPIKeyDB(db, dialect)
+}
+
+func NewWebhookDB(db *sql.DB) webhook.Repo {
+	return sqlrepo.NewWebhookDB(db, dialect)
+}
+
+func NewIdempotencyStore(db *sql.DB) idempotency.Store {
+	return sqlrepo.NewIdempotencyStore(db, dialect)
+}
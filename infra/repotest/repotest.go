@@ -0,0 +1,371 @@
+// Package repotest is the contract of the user, vehicle and ride repos, as tests every backend runs against its
+// own repos. The in-memory repos are the reference, the others behave like them.
+//
+// Times are given in UTC and to the microsecond, the precision Postgres stores them with.
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/domain/user"
+	"reby/domain/vehicle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Repos are the repos of the backend under test.
+type Repos struct {
+	Users    user.Repo
+	Vehicles vehicle.Repo
+	Rides    ride.Repo
+}
+
+// NewRepos returns the repos of the backend, without the data stored through the ones returned before. It is
+// called once per test.
+type NewRepos func(t *testing.T) Repos
+
+// Run runs the whole contract.
+func Run(t *testing.T, newRepos NewRepos) {
+	t.Run("user repo", func(t *testing.T) { UserRepo(t, newRepos) })
+	t.Run("vehicle repo", func(t *testing.T) { VehicleRepo(t, newRepos) })
+	t.Run("ride repo", func(t *testing.T) { RideRepo(t, newRepos) })
+}
+
+func UserRepo(t *testing.T, newRepos NewRepos) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		users := newRepos(t).Users
+		require.NoError(t, users.Create(ctx, &user.User{ID: "u_1"}))
+		require.NoError(t, users.Create(ctx, &user.User{ID: "u_2", PartnerID: "p_1"}))
+
+		u, err := users.GetByID(ctx, "u_1")
+		require.NoError(t, err)
+		assert.Equal(t, &user.User{ID: "u_1"}, u)
+
+		u, err = users.GetByID(ctx, "u_2")
+		require.NoError(t, err)
+		assert.Equal(t, &user.User{ID: "u_2", PartnerID: "p_1"}, u)
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		users := newRepos(t).Users
+		require.NoError(t, users.Create(ctx, &user.User{ID: "u_1"}))
+
+		assert.ErrorIs(t, users.Create(ctx, &user.User{ID: "u_1"}), user.ErrAlreadyExists)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		u, err := newRepos(t).Users.GetByID(ctx, "u_missing")
+
+		assert.ErrorIs(t, err, user.ErrNotFound)
+		assert.Nil(t, u)
+	})
+}
+
+func VehicleRepo(t *testing.T, newRepos NewRepos) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		vehicles := newRepos(t).Vehicles
+		require.NoError(t, vehicles.Create(ctx, &vehicle.Vehicle{ID: "v_1", Country: "FR"}))
+		require.NoError(t, vehicles.Create(ctx, &vehicle.Vehicle{ID: "v_2"}))
+
+		v, err := vehicles.GetByID(ctx, "v_1")
+		require.NoError(t, err)
+		assert.Equal(t, &vehicle.Vehicle{ID: "v_1", Country: "FR"}, v)
+
+		v, err = vehicles.GetByID(ctx, "v_2")
+		require.NoError(t, err)
+		assert.Equal(t, &vehicle.Vehicle{ID: "v_2"}, v)
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		vehicles := newRepos(t).Vehicles
+		require.NoError(t, vehicles.Create(ctx, &vehicle.Vehicle{ID: "v_1"}))
+
+		assert.ErrorIs(t, vehicles.Create(ctx, &vehicle.Vehicle{ID: "v_1"}), vehicle.ErrAlreadyExists)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		v, err := newRepos(t).Vehicles.GetByID(ctx, "v_missing")
+
+		assert.ErrorIs(t, err, vehicle.ErrNotFound)
+		assert.Nil(t, v)
+	})
+}
+
+func RideRepo(t *testing.T, newRepos NewRepos) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	// newRides returns the ride repo with the users and vehicles "1" to "4" that its rides take
+	newRides := func(t *testing.T) ride.Repo {
+		repos := newRepos(t)
+		for _, id := range []string{"1", "2", "3", "4"} {
+			require.NoError(t, repos.Users.Create(ctx, &user.User{ID: "u_" + id}))
+			require.NoError(t, repos.Vehicles.Create(ctx, &vehicle.Vehicle{ID: "v_" + id}))
+		}
+
+		return repos.Rides
+	}
+	newRide := func(id, n string, status ride.Status, startedAt time.Time) *ride.Ride {
+		return &ride.Ride{ID: id, VehicleID: "v_" + n, UserID: "u_" + n, Status: status, StartedAt: startedAt}
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		rides := newRides(t)
+		r := newRide("r_1", "1", ride.StatusActive, now)
+		r.PartnerID = "p_1"
+		r.Country = "FR"
+		r.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusAuthorized}
+		require.NoError(t, rides.Create(ctx, r))
+
+		got, err := rides.GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		assertRide(t, r, got)
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		rides := newRides(t)
+		require.NoError(t, rides.Create(ctx, newRide("r_1", "1", ride.StatusActive, now)))
+
+		assert.ErrorIs(t, rides.Create(ctx, newRide("r_1", "2", ride.StatusActive, now)), ride.ErrAlreadyExists)
+	})
+
+	t.Run("one ongoing ride per user and vehicle", func(t *testing.T) {
+		rides := newRides(t)
+		require.NoError(t, rides.Create(ctx, newRide("r_1", "1", ride.StatusActive, now)))
+
+		sameUser := newRide("r_2", "2", ride.StatusActive, now)
+		sameUser.UserID = "u_1"
+		assert.ErrorIs(t, rides.Create(ctx, sameUser), ride.ErrUserIsRiding)
+
+		sameVehicle := newRide("r_3", "3", ride.StatusReserved, now)
+		sameVehicle.VehicleID = "v_1"
+		assert.ErrorIs(t, rides.Create(ctx, sameVehicle), ride.ErrVehicleIsRiding)
+
+		finished := newRide("r_4", "4", ride.StatusFinished, now)
+		finished.UserID = "u_1"
+		finished.VehicleID = "v_1"
+		assert.NoError(t, rides.Create(ctx, finished), "finished rides don't hold their user and vehicle")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		rides := newRides(t)
+
+		r, err := rides.GetByID(ctx, "r_missing")
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+		assert.Nil(t, r)
+
+		_, err = rides.Update(ctx, newRide("r_missing", "1", ride.StatusFinished, now))
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		rides := newRides(t)
+		r := newRide("r_1", "1", ride.StatusActive, now.Add(-time.Hour))
+		r.PartnerID = "p_1"
+		r.Country = "FR"
+		r.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusAuthorized}
+		require.NoError(t, rides.Create(ctx, r))
+
+		reason := ride.FinishReasonOperator
+		actor := ride.ActorOperator
+		update := *r
+		update.Status = ride.StatusPaid
+		update.FinishedAt = &now
+		update.FinishReason = &reason
+		update.FinishedBy = &actor
+		update.Price = &money.Money{Value: 1180, Currency: "EUR"}
+		update.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_2", Status: payment.StatusCaptured}
+		update.Adjustments = []ride.Adjustment{{
+			ID:        "adj_1",
+			Amount:    money.NewMoney(100, "EUR"),
+			Reason:    "bad battery",
+			Actor:     ride.ActorOperator,
+			CreatedAt: now,
+		}}
+		// Only the fields changed over the life of a ride are updated
+		update.VehicleID = "v_2"
+		update.UserID = "u_2"
+		update.PartnerID = "p_2"
+		update.StartedAt = now
+
+		updated, err := rides.Update(ctx, &update)
+		require.NoError(t, err)
+
+		expected := update
+		expected.VehicleID = r.VehicleID
+		expected.UserID = r.UserID
+		expected.PartnerID = r.PartnerID
+		expected.StartedAt = r.StartedAt
+		assertRide(t, &expected, updated)
+
+		got, err := rides.GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		assertRide(t, &expected, got)
+	})
+
+	t.Run("returned rides are copies", func(t *testing.T) {
+		rides := newRides(t)
+		r := newRide("r_1", "1", ride.StatusActive, now)
+		r.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusAuthorized}
+		require.NoError(t, rides.Create(ctx, r))
+
+		got, err := rides.GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		got.Status = ride.StatusFinished
+		got.Payment.Status = payment.StatusCaptured
+		r.Payment.Status = payment.StatusFailed
+
+		got, err = rides.GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		assert.Equal(t, ride.StatusActive, got.Status)
+		assert.Equal(t, payment.StatusAuthorized, got.Payment.Status)
+	})
+
+	t.Run("riding", func(t *testing.T) {
+		rides := newRides(t)
+		require.NoError(t, rides.Create(ctx, newRide("r_1", "1", ride.StatusReserved, now)))
+		require.NoError(t, rides.Create(ctx, newRide("r_2", "2", ride.StatusPaused, now)))
+		require.NoError(t, rides.Create(ctx, newRide("r_3", "3", ride.StatusFinished, now)))
+		require.NoError(t, rides.Create(ctx, newRide("r_4", "3", ride.StatusCancelled, now)))
+
+		for n, expected := range map[string]bool{"1": true, "2": true, "3": false, "4": false} {
+			isRiding, err := rides.IsUserRiding(ctx, "u_"+n)
+			require.NoError(t, err)
+			assert.Equal(t, expected, isRiding, "user u_%s", n)
+
+			isRiding, err = rides.IsVehicleRiding(ctx, "v_"+n)
+			require.NoError(t, err)
+			assert.Equal(t, expected, isRiding, "vehicle v_%s", n)
+		}
+
+		// Finishing the ride frees its user and vehicle
+		r, err := rides.GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		r.Status = ride.StatusFinished
+		_, err = rides.Update(ctx, r)
+		require.NoError(t, err)
+
+		isRiding, err := rides.IsUserRiding(ctx, "u_1")
+		require.NoError(t, err)
+		assert.False(t, isRiding)
+		isRiding, err = rides.IsVehicleRiding(ctx, "v_1")
+		require.NoError(t, err)
+		assert.False(t, isRiding)
+	})
+
+	t.Run("debt", func(t *testing.T) {
+		rides := newRides(t)
+		paid := newRide("r_1", "1", ride.StatusPaid, now)
+		paid.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_1", Status: payment.StatusCaptured}
+		unpaid := newRide("r_2", "2", ride.StatusFinished, now)
+		unpaid.Payment = &ride.Payment{Method: payment.MethodCard, AuthorizationID: "auth_2", Status: payment.StatusFailed}
+		require.NoError(t, rides.Create(ctx, paid))
+		require.NoError(t, rides.Create(ctx, unpaid))
+
+		for n, expected := range map[string]bool{"1": false, "2": true, "3": false} {
+			hasDebt, err := rides.HasDebt(ctx, "u_"+n)
+			require.NoError(t, err)
+			assert.Equal(t, expected, hasDebt, "user u_%s", n)
+		}
+	})
+
+	t.Run("active started before", func(t *testing.T) {
+		rides := newRides(t)
+		require.NoError(t, rides.Create(ctx, newRide("r_1", "1", ride.StatusActive, now.Add(-3*time.Hour))))
+		require.NoError(t, rides.Create(ctx, newRide("r_2", "2", ride.StatusPaused, now.Add(-3*time.Hour))))
+		require.NoError(t, rides.Create(ctx, newRide("r_3", "3", ride.StatusFinished, now.Add(-3*time.Hour))))
+		require.NoError(t, rides.Create(ctx, newRide("r_4", "4", ride.StatusActive, now.Add(-time.Minute))))
+
+		active, err := rides.GetActiveStartedBefore(ctx, now.Add(-time.Hour))
+		require.NoError(t, err)
+		ids := make([]string, 0, len(active))
+		for _, r := range active {
+			ids = append(ids, r.ID)
+		}
+		assert.ElementsMatch(t, []string{"r_1", "r_2"}, ids)
+
+		active, err = rides.GetActiveStartedBefore(ctx, now.Add(-4*time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, active)
+	})
+
+	t.Run("events", func(t *testing.T) {
+		rides := newRides(t)
+		r := newRide("r_1", "1", ride.StatusActive, now)
+		r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+		require.NoError(t, rides.Create(ctx, r))
+
+		r, err := rides.GetByID(ctx, "r_1")
+		require.NoError(t, err)
+		r.Status = ride.StatusFinished
+		r.Record(ride.EventFinished, ride.ActorRider, now.Add(time.Minute), map[string]string{"reason": "RIDER_REQUEST"})
+		_, err = rides.Update(ctx, r)
+		require.NoError(t, err)
+
+		events, err := rides.GetEvents(ctx, "r_1")
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, ride.EventStarted, events[0].Type)
+		assert.Equal(t, ride.EventFinished, events[1].Type)
+		assert.Equal(t, ride.ActorRider, events[1].Actor)
+		assert.True(t, now.Add(time.Minute).Equal(events[1].OccurredAt))
+		assert.Equal(t, map[string]string{"reason": "RIDER_REQUEST"}, events[1].Data)
+
+		events, err = rides.GetEvents(ctx, "r_missing")
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+}
+
+// assertRide asserts got is expected, with its times at the same instants.
+func assertRide(t *testing.T, expected, got *ride.Ride) {
+	t.Helper()
+
+	assert.True(t, expected.StartedAt.Equal(got.StartedAt), "started at %s, got %s", expected.StartedAt, got.StartedAt)
+	assertTimeEqual(t, expected.FinishedAt, got.FinishedAt, "finished at")
+	assertTimeEqual(t, expected.CancelledAt, got.CancelledAt, "cancelled at")
+	require.Len(t, got.Adjustments, len(expected.Adjustments))
+	for i := range expected.Adjustments {
+		assert.True(t, expected.Adjustments[i].CreatedAt.Equal(got.Adjustments[i].CreatedAt), "adjustment created at")
+	}
+
+	// The times are compared above, the rest has to be equal
+	e, g := *expected, *got
+	e.StartedAt, g.StartedAt = time.Time{}, time.Time{}
+	e.FinishedAt, g.FinishedAt = nil, nil
+	e.CancelledAt, g.CancelledAt = nil, nil
+	e.Adjustments, g.Adjustments = withoutTimes(e.Adjustments), withoutTimes(g.Adjustments)
+	assert.Equal(t, e, g)
+}
+
+func assertTimeEqual(t *testing.T, expected, got *time.Time, name string) {
+	t.Helper()
+
+	if expected == nil || got == nil {
+		assert.Equal(t, expected == nil, got == nil, "%s: expected %v, got %v", name, expected, got)
+		return
+	}
+	assert.True(t, expected.Equal(*got), "%s: expected %s, got %s", name, expected, got)
+}
+
+func withoutTimes(adjustments []ride.Adjustment) []ride.Adjustment {
+	if len(adjustments) == 0 {
+		return nil
+	}
+	c := make([]ride.Adjustment, len(adjustments))
+	for i, a := range adjustments {
+		a.CreatedAt = time.Time{}
+		c[i] = a
+	}
+	return c
+}
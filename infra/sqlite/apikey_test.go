@@ -0,0 +1,56 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/infra/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyDB(t *testing.T) {
+	db := sqlite.NewAPIKeyDB(openDB(t))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	k := &apikey.APIKey{
+		ID:        "k_1",
+		PartnerID: "p_1",
+		Scopes:    []apikey.Scope{apikey.ScopeRidesWrite, apikey.ScopeReceiptsRead},
+		Hash:      apikey.Hash("rk_secret"),
+		CreatedAt: now,
+	}
+	require.NoError(t, db.Create(ctx, k))
+	require.NoError(t, db.Create(ctx, &apikey.APIKey{ID: "k_2", PartnerID: "p_2", Scopes: []apikey.Scope{},
+		Hash: apikey.Hash("rk_other"), CreatedAt: now}))
+
+	byHash, err := db.GetByHash(ctx, apikey.Hash("rk_secret"))
+	require.NoError(t, err)
+	// Times come back at the same instant
+	assert.True(t, now.Equal(byHash.CreatedAt))
+	got := *byHash
+	got.CreatedAt = now
+	assert.Equal(t, k, &got)
+
+	_, err = db.GetByHash(ctx, apikey.Hash("rk_unknown"))
+	assert.ErrorIs(t, err, apikey.ErrNotFound)
+
+	require.NoError(t, db.Touch(ctx, "k_1", now))
+	byHash.RevokedAt = &now
+	require.NoError(t, db.Update(ctx, byHash))
+
+	keys, err := db.ListByPartner(ctx, "p_1")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+	assert.True(t, now.Equal(*keys[0].LastUsedAt))
+	require.NotNil(t, keys[0].RevokedAt)
+	assert.True(t, now.Equal(*keys[0].RevokedAt))
+
+	assert.ErrorIs(t, db.Update(ctx, &apikey.APIKey{ID: "k_3"}), apikey.ErrNotFound)
+	assert.ErrorIs(t, db.Touch(ctx, "k_3", now), apikey.ErrNotFound)
+}
@@ -0,0 +1,19 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"reby/infra/repotest"
+	"reby/infra/sqlite"
+)
+
+func TestContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db := openDB(t)
+		return repotest.Repos{
+			Users:    sqlite.NewUserDB(db),
+			Vehicles: sqlite.NewVehicleDB(db),
+			Rides:    sqlite.NewRideDB(db),
+		}
+	})
+}
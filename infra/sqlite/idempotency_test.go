@@ -0,0 +1,52 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/infra/sqlite"
+	"reby/pkg/idempotency"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	store := sqlite.NewIdempotencyStore(openDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	rec := idempotency.Record{Key: "k_1", Fingerprint: "f_1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	existing, err := store.Reserve(ctx, rec)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	existing, err = store.Reserve(ctx, rec)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.False(t, existing.Completed())
+
+	require.NoError(t, store.Complete(ctx, "k_1", 200, []byte(`{}`)))
+	existing, err = store.Reserve(ctx, rec)
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, 200, existing.StatusCode)
+	assert.Equal(t, []byte(`{}`), existing.Body)
+
+	later := rec
+	later.CreatedAt = now.Add(2 * time.Hour)
+	later.ExpiresAt = now.Add(3 * time.Hour)
+	existing, err = store.Reserve(ctx, later)
+	require.NoError(t, err)
+	assert.Nil(t, existing, "expired records can be reserved again")
+
+	require.NoError(t, store.Release(ctx, "k_1"))
+	existing, err = store.Reserve(ctx, rec)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	deleted, err := store.DeleteExpired(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
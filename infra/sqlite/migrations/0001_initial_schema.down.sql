@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS "ledger_entry";
+DROP TABLE IF EXISTS "wallet_transaction";
+DROP TABLE IF EXISTS "outbox";
+DROP TABLE IF EXISTS "ride_adjustment";
+DROP TABLE IF EXISTS "ride_event";
+DROP TABLE IF EXISTS "ride";
+DROP TABLE IF EXISTS "vehicle";
+DROP TABLE IF EXISTS "user";
@@ -0,0 +1,76 @@
+-- The tables of the Postgres schema the SQLite backend stores, as of its version 0002. Times are stored as text in
+-- UTC, and the JSON documents as text.
+CREATE TABLE "user" (id varchar(255) PRIMARY KEY);
+
+CREATE TABLE "vehicle" (id varchar(255) PRIMARY KEY);
+
+CREATE TABLE "ride" (
+	id varchar(255) PRIMARY KEY,
+	vehicle_id varchar(255) REFERENCES vehicle(id),
+	user_id varchar(255) REFERENCES "user"(id),
+	status varchar(255) NOT NULL DEFAULT 'ACTIVE',
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP,
+	finish_reason varchar(255),
+	finished_by varchar(255),
+	cancelled_at TIMESTAMP,
+	cancel_reason varchar(255),
+	cancelled_by varchar(255),
+	price_value int,
+	price_currency varchar(255),
+	payment_method varchar(255),
+	payment_authorization_id varchar(255),
+	payment_status varchar(255),
+	partner_id varchar(255)
+);
+
+CREATE INDEX ride_user_idx ON "ride" (user_id);
+CREATE INDEX ride_vehicle_idx ON "ride" (vehicle_id);
+
+CREATE TABLE "ride_event" (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	ride_id varchar(255) NOT NULL REFERENCES ride(id),
+	type varchar(255) NOT NULL,
+	actor varchar(255) NOT NULL,
+	occurred_at TIMESTAMP NOT NULL,
+	data text
+);
+
+CREATE TABLE "ride_adjustment" (
+	id varchar(255) PRIMARY KEY,
+	ride_id varchar(255) NOT NULL REFERENCES ride(id),
+	value int NOT NULL,
+	currency varchar(255) NOT NULL,
+	reason text NOT NULL,
+	actor varchar(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE "outbox" (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type varchar(255) NOT NULL,
+	aggregate_id varchar(255) NOT NULL,
+	occurred_at TIMESTAMP NOT NULL,
+	payload text NOT NULL,
+	delivered_at TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON "outbox" (id) WHERE delivered_at IS NULL;
+
+-- Double-entry ledger of the wallets, the entries of a transaction always add up to zero
+CREATE TABLE "wallet_transaction" (
+	id varchar(255) PRIMARY KEY,
+	kind varchar(255) NOT NULL,
+	reference varchar(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE "ledger_entry" (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transaction_id varchar(255) NOT NULL REFERENCES wallet_transaction(id),
+	account varchar(255) NOT NULL,
+	value int NOT NULL,
+	currency varchar(255) NOT NULL
+);
+
+CREATE INDEX ledger_entry_account_idx ON "ledger_entry" (account);
@@ -0,0 +1,3 @@
+-- A user or a vehicle can only have one ongoing ride, even when two starts race past the checks of the service
+CREATE UNIQUE INDEX IF NOT EXISTS ride_user_ongoing_idx ON "ride" (user_id) WHERE status IN ('RESERVED', 'ACTIVE', 'PAUSED');
+CREATE UNIQUE INDEX IF NOT EXISTS ride_vehicle_ongoing_idx ON "ride" (vehicle_id) WHERE status IN ('RESERVED', 'ACTIVE', 'PAUSED');
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "api_key";
+DROP TABLE IF EXISTS "receipt";
+DROP TABLE IF EXISTS "receipt_sequence";
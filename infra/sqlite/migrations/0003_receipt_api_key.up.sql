@@ -0,0 +1,28 @@
+-- Receipts and API keys, as in Postgres. The scopes of a key are a JSON array, SQLite has no arrays.
+CREATE TABLE "receipt_sequence" (
+	country varchar(255) PRIMARY KEY,
+	last int NOT NULL
+);
+
+CREATE TABLE "receipt" (
+	ride_id varchar(255) PRIMARY KEY REFERENCES ride(id),
+	country varchar(255) NOT NULL,
+	sequence int NOT NULL,
+	issued_at TIMESTAMP NOT NULL,
+	UNIQUE (country, sequence)
+);
+
+CREATE TABLE "api_key" (
+	id varchar(255) PRIMARY KEY,
+	partner_id varchar(255) NOT NULL,
+	name text NOT NULL,
+	scopes text NOT NULL,
+	hint varchar(255) NOT NULL,
+	hash varchar(255) NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP,
+	expires_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX api_key_partner_idx ON "api_key" (partner_id);
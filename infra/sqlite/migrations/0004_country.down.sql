@@ -0,0 +1,2 @@
+ALTER TABLE "ride" DROP COLUMN country;
+ALTER TABLE "vehicle" DROP COLUMN country;
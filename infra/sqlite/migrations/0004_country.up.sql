@@ -0,0 +1,3 @@
+-- The country of a ride is the one of its vehicle when it started, rides without one use the configured country
+ALTER TABLE "vehicle" ADD COLUMN country varchar(255);
+ALTER TABLE "ride" ADD COLUMN country varchar(255);
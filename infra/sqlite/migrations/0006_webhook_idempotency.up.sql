@@ -0,0 +1,34 @@
+-- Webhooks and idempotency keys, as in Postgres. The events of a subscription are a JSON array and the payload of a
+-- delivery is JSON text.
+CREATE TABLE "webhook_subscription" (
+	id varchar(255) PRIMARY KEY,
+	partner_id varchar(255) NOT NULL DEFAULT '',
+	url text NOT NULL,
+	events text NOT NULL,
+	secret varchar(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+-- Deliveries outlive their subscription so they can still be inspected in the dead-letter list
+CREATE TABLE "webhook_delivery" (
+	id varchar(255) PRIMARY KEY,
+	subscription_id varchar(255) NOT NULL,
+	message_id bigint NOT NULL,
+	event_type varchar(255) NOT NULL,
+	payload text NOT NULL,
+	status varchar(255) NOT NULL,
+	attempts int NOT NULL,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_error text NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (subscription_id, message_id)
+);
+
+CREATE TABLE "idempotency_key" (
+	key text PRIMARY KEY,
+	fingerprint varchar(255) NOT NULL,
+	status_code int NOT NULL,
+	body blob,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
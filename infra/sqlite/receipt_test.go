@@ -0,0 +1,41 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/ride"
+	"reby/infra/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiptIssue(t *testing.T) {
+	rides, db := openRideDB(t)
+	receipts := sqlite.NewReceiptDB(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, rides.Create(ctx, &ride.Ride{ID: id, UserID: id, VehicleID: id, Status: ride.StatusPaid,
+			StartedAt: now}))
+	}
+
+	first, err := receipts.Issue(ctx, "1", "ES", now)
+	require.NoError(t, err)
+	assert.Equal(t, "ES-00000001", first.Number())
+
+	second, err := receipts.Issue(ctx, "2", "ES", now)
+	require.NoError(t, err)
+	assert.Equal(t, "ES-00000002", second.Number())
+
+	other, err := receipts.Issue(ctx, "3", "FR", now)
+	require.NoError(t, err)
+	assert.Equal(t, "FR-00000001", other.Number())
+
+	again, err := receipts.Issue(ctx, "1", "ES", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, first.Number(), again.Number())
+	assert.True(t, first.IssuedAt.Equal(again.IssuedAt))
+}
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/domain/receipt"
+	"reby/domain/ride"
+	"reby/domain/user"
+	"reby/domain/vehicle"
+	"reby/domain/wallet"
+	"reby/domain/webhook"
+	"reby/infra/sqlrepo"
+	"reby/pkg/event"
+	"reby/pkg/idempotency"
+)
+
+// dialect runs the shared repos on SQLite. The times are written in UTC, see Open, and the JSON documents and lists
+// as text.
+var dialect = sqlrepo.Dialect{
+	Now:               "CURRENT_TIMESTAMP",
+	ForUpdate:         "",
+	Time:              func(t time.Time) time.Time { return t.UTC() },
+	JSON:              jsonText,
+	Strings:           func(s []string) interface{} { return jsonStrings{s: &s} },
+	StringsDest:       func(s *[]string) interface{} { return jsonStrings{s: s} },
+	IsUniqueViolation: isUniqueViolation,
+	ViolatedIndex:     violatedIndex,
+}
+
+// jsonText stores a JSON document as text, or NULL when there is none.
+func jsonText(doc []byte) interface{} {
+	if doc == nil {
+		return nil
+	}
+
+	return string(doc)
+}
+
+// jsonStrings stores a list of strings as a JSON array, SQLite has no arrays.
+type jsonStrings struct {
+	s *[]string
+}
+
+func (j jsonStrings) Value() (driver.Value, error) {
+	doc, err := json.Marshal(*j.s)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(doc), nil
+}
+
+func (j jsonStrings) Scan(src interface{}) error {
+	switch doc := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(doc), j.s)
+	case []byte:
+		return json.Unmarshal(doc, j.s)
+	default:
+		return fmt.Errorf("can't scan %T into a list of strings", src)
+	}
+}
+
+func NewUserDB(db *sql.DB) user.Repo {
+	return sqlrepo.NewUserDB(db, dialect)
+}
+
+func NewVehicleDB(db *sql.DB) vehicle.Repo {
+	return sqlrepo.NewVehicleDB(db, dialect)
+}
+
+func NewRideDB(db *sql.DB) ride.Repo {
+	return sqlrepo.NewRideDB(db, dialect)
+}
+
+func NewOutbox(db *sql.DB) event.Outbox {
+	return sqlrepo.NewOutbox(db, dialect)
+}
+
+func NewWalletDB(db *sql.DB) wallet.Repo {
+	return sqlrepo.NewWalletDB(db, dialect)
+}
+
+func NewReceiptDB(db *sql.DB) receipt.Repo {
+	return sqlrepo.NewReceiptDB(db, dialect)
+}
+
+func NewAPIKeyDB(db *sql.DB) apikey.Repo {
+	return sqlrepo.NewAPIKeyDB(db, dialect)
+}
+
+func NewWebhookDB(db *sql.DB) webhook.Repo {
+	return sqlrepo.NewWebhookDB(db, dialect)
+}
+
+func NewIdempotencyStore(db *sql.DB) idempotency.Store {
+	return sqlrepo.NewIdempotencyStore(db, dialect)
+}
@@ -0,0 +1,202 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/domain/user"
+	"reby/domain/vehicle"
+	"reby/domain/wallet"
+	"reby/infra/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openRideDB returns a ride repo with users and vehicles "1" to "5".
+func openRideDB(t *testing.T) (ride.Repo, *sql.DB) {
+	db := openDB(t)
+	ctx := context.Background()
+	users, vehicles := sqlite.NewUserDB(db), sqlite.NewVehicleDB(db)
+	for i := 1; i <= 5; i++ {
+		id := fmt.Sprint(i)
+		require.NoError(t, users.Create(ctx, &user.User{ID: id}))
+		require.NoError(t, vehicles.Create(ctx, &vehicle.Vehicle{ID: id}))
+	}
+
+	return sqlite.NewRideDB(db), db
+}
+
+func TestRideCreate(t *testing.T) {
+	db, _ := openRideDB(t)
+	ctx := context.Background()
+	// Times come back in UTC, and at the same instant
+	startedAt := time.Date(2026, 10, 19, 12, 30, 15, 500, time.FixedZone("CEST", 2*60*60))
+
+	r := &ride.Ride{
+		ID:        "1",
+		VehicleID: "1",
+		UserID:    "1",
+		PartnerID: "p_1",
+		Status:    ride.StatusActive,
+		StartedAt: startedAt,
+		Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: "a_1", Status: payment.StatusAuthorized},
+	}
+	require.NoError(t, db.Create(ctx, r))
+
+	got, err := db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.True(t, startedAt.Equal(got.StartedAt))
+	got.StartedAt = r.StartedAt
+	assert.Equal(t, r, got)
+
+	assert.ErrorIs(t, db.Create(ctx, r), ride.ErrAlreadyExists)
+
+	_, err = db.GetByID(ctx, "2")
+	assert.ErrorIs(t, err, ride.ErrNotFound)
+}
+
+func TestRideUpdate(t *testing.T) {
+	db, _ := openRideDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	reason := ride.FinishReasonOperator
+	actor := ride.ActorOperator
+
+	r := &ride.Ride{
+		ID:        "1",
+		VehicleID: "1",
+		UserID:    "1",
+		Status:    ride.StatusActive,
+		StartedAt: now.Add(-time.Hour),
+		Payment:   &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusAuthorized},
+	}
+	require.NoError(t, db.Create(ctx, r))
+
+	r.Status = ride.StatusFinished
+	r.FinishedAt = &now
+	r.FinishReason = &reason
+	r.FinishedBy = &actor
+	r.Price = &money.Money{Value: 1180, Currency: "EUR"}
+	r.Payment.Status = payment.StatusCaptured
+	r.Adjustments = []ride.Adjustment{{
+		ID:        "adj_1",
+		Amount:    money.NewMoney(100, "EUR"),
+		Reason:    "bad battery",
+		Actor:     ride.ActorOperator,
+		CreatedAt: now,
+	}}
+	updated, err := db.Update(ctx, r)
+	require.NoError(t, err)
+
+	assert.Equal(t, ride.StatusFinished, updated.Status)
+	assert.True(t, now.Equal(*updated.FinishedAt))
+	assert.Equal(t, &reason, updated.FinishReason)
+	assert.Equal(t, &actor, updated.FinishedBy)
+	assert.Equal(t, r.Price, updated.Price)
+	assert.Equal(t, r.Payment, updated.Payment)
+	require.Len(t, updated.Adjustments, 1)
+	assert.Equal(t, "adj_1", updated.Adjustments[0].ID)
+
+	// Adjustments already stored are kept as they are
+	_, err = db.Update(ctx, updated)
+	require.NoError(t, err)
+	updated, err = db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Len(t, updated.Adjustments, 1)
+}
+
+func TestRideQueries(t *testing.T) {
+	db, _ := openRideDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	rides := []*ride.Ride{
+		{ID: "old_active", VehicleID: "1", UserID: "1", Status: ride.StatusActive, StartedAt: now.Add(-3 * time.Hour)},
+		{ID: "old_paused", VehicleID: "2", UserID: "2", Status: ride.StatusPaused, StartedAt: now.Add(-3 * time.Hour)},
+		{ID: "old_finished", VehicleID: "3", UserID: "3", Status: ride.StatusFinished, StartedAt: now.Add(-3 * time.Hour),
+			Payment: &ride.Payment{Method: payment.MethodCard, AuthorizationID: "a_3", Status: payment.StatusFailed}},
+		{ID: "recent_active", VehicleID: "4", UserID: "4", Status: ride.StatusActive, StartedAt: now.Add(-time.Minute)},
+	}
+	for _, r := range rides {
+		require.NoError(t, db.Create(ctx, r))
+	}
+
+	active, err := db.GetActiveStartedBefore(ctx, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	ids := make([]string, 0, len(active))
+	for _, r := range active {
+		ids = append(ids, r.ID)
+	}
+	assert.ElementsMatch(t, []string{"old_active", "old_paused"}, ids)
+
+	for id, expected := range map[string]bool{"1": true, "3": false, "5": false} {
+		isRiding, err := db.IsUserRiding(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, expected, isRiding, "user %s", id)
+
+		isRiding, err = db.IsVehicleRiding(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, expected, isRiding, "vehicle %s", id)
+	}
+
+	for id, expected := range map[string]bool{"1": false, "3": true} {
+		hasDebt, err := db.HasDebt(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, expected, hasDebt, "user %s", id)
+	}
+}
+
+func TestRideEvents(t *testing.T) {
+	db, sqlDB := openRideDB(t)
+	outbox := sqlite.NewOutbox(sqlDB)
+	wallets := sqlite.NewWalletDB(sqlDB)
+	ctx := context.Background()
+	now := time.Now()
+
+	r := &ride.Ride{ID: "1", VehicleID: "1", UserID: "1", Status: ride.StatusActive, StartedAt: now}
+	r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+	require.NoError(t, db.Create(ctx, r))
+
+	r, err := db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	r.Status = ride.StatusPaid
+	r.Price = &money.Money{Value: 118, Currency: wallet.Currency}
+	r.Payment = &ride.Payment{Method: payment.MethodWallet, Status: payment.StatusCaptured}
+	r.ChargeWallet(now)
+	r.Record(ride.EventFinished, ride.ActorRider, now, map[string]string{"reason": string(ride.FinishReasonRider)})
+	_, err = db.Update(ctx, r)
+	require.NoError(t, err)
+
+	events, err := db.GetEvents(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, ride.EventStarted, events[0].Type)
+	assert.Equal(t, ride.EventFinished, events[1].Type)
+	assert.Equal(t, map[string]string{"reason": string(ride.FinishReasonRider)}, events[1].Data)
+
+	msgs, err := outbox.GetPending(ctx, 10)
+	require.NoError(t, err)
+	require.NotEmpty(t, msgs)
+	for _, msg := range msgs {
+		require.NoError(t, outbox.MarkDelivered(ctx, msg.ID))
+	}
+	msgs, err = outbox.GetPending(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	w, err := wallets.GetByUserID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, money.NewMoney(-118, wallet.Currency), w.Balance)
+
+	// A ride can't be charged twice, nor its change stored without the charge
+	r.ChargeWallet(now)
+	_, err = db.Update(ctx, r)
+	assert.ErrorIs(t, err, wallet.ErrAlreadyPosted)
+}
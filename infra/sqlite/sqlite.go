@@ -0,0 +1,121 @@
+// Package sqlite stores the data of the service in a SQLite file, for the demos and the edge deployments that can't
+// run Postgres. The repos are the ones of Postgres, see sqlrepo, run with the SQLite dialect.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"log"
+	"net/url"
+	"strings"
+
+	"reby/app/config"
+	"reby/infra/migrate"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// InitDB opens the database file and applies the pending migrations. A file belongs to a single process, so it is
+// always migrated on open.
+func InitDB(conf *config.Config) *sql.DB {
+	db, err := Open(conf.DBPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range applied {
+		log.Printf("applied migration %04d_%s", m.Version, m.Name)
+	}
+
+	return db
+}
+
+// Open opens the database file at path, creating it when missing.
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	// Times are written as text that sorts like the times themselves, as long as they are all in UTC
+	params.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer, one connection keeps transactions from failing to upgrade to write while another
+	// one writes
+	db.SetMaxOpenConns(1)
+
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migrations returns the migrations embedded in the binary, by version.
+func Migrations() ([]migrate.Migration, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.Load(sub)
+}
+
+// NewMigrator returns the migrator of the SQLite schema. It needs no lock, the migrations run in transactions that
+// SQLite serializes.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.NewMigrator(db, migrations, nil), nil
+}
+
+// isUniqueViolation tells whether err comes from inserting a row whose key is taken.
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || code == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// uniqueIndexes names the unique indexes by the columns SQLite reports in their violations.
+var uniqueIndexes = map[string]string{
+	"ride.user_id":    "ride_user_ongoing_idx",
+	"ride.vehicle_id": "ride_vehicle_ongoing_idx",
+}
+
+// violatedIndex returns the name of the unique index a unique violation is about, from the columns in its message.
+func violatedIndex(err error) string {
+	msg := err.Error()
+	for columns, index := range uniqueIndexes {
+		if strings.Contains(msg, "failed: "+columns) {
+			return index
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,45 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"reby/infra/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openDB returns a migrated database in a file removed after the test.
+func openDB(t *testing.T) *sql.DB {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	migrator, err := sqlite.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := sqlite.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	// Versions are never reused nor skipped, a gap is a migration lost in a merge
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, m.Name)
+	}
+
+	db := openDB(t)
+	migrator, err := sqlite.NewMigrator(db)
+	require.NoError(t, err)
+	reverted, err := migrator.Down(context.Background(), len(migrations))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(migrations), "every migration can be reverted")
+}
@@ -0,0 +1,360 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/domain/user"
+	"reby/domain/vehicle"
+	"reby/infra/mem"
+	"reby/infra/sqlite"
+	"reby/pkg/id"
+	"reby/pkg/timenow"
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLManager(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	errFailed := errors.New("failed")
+
+	var manager txn.Manager
+	var users user.Repo
+	var vehicles vehicle.Repo
+	var rides ride.Repo
+	setup := func() {
+		db := openDB(t)
+		manager = txn.NewSQLManager(db)
+		users = sqlite.NewUserDB(db)
+		vehicles = sqlite.NewVehicleDB(db)
+		rides = sqlite.NewRideDB(db)
+	}
+	// start stores a user, a vehicle and a ride of them, the ride with its events in a transaction of its own
+	start := func(ctx context.Context) error {
+		if err := users.Create(ctx, &user.User{ID: "u_1"}); err != nil {
+			return err
+		}
+		if err := vehicles.Create(ctx, &vehicle.Vehicle{ID: "v_1"}); err != nil {
+			return err
+		}
+		r := &ride.Ride{
+			ID:        "r_1",
+			VehicleID: "v_1",
+			UserID:    "u_1",
+			Status:    ride.StatusActive,
+			StartedAt: now,
+			Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: "a_1", Status: payment.StatusAuthorized},
+		}
+		r.Record(ride.EventStarted, ride.ActorRider, now, nil)
+		return rides.Create(ctx, r)
+	}
+
+	t.Run("committed", func(t *testing.T) {
+		setup()
+
+		require.NoError(t, manager.WithinTx(ctx, start))
+
+		_, err := users.GetByID(ctx, "u_1")
+		assert.NoError(t, err)
+		_, err = rides.GetByID(ctx, "r_1")
+		assert.NoError(t, err)
+		events, err := rides.GetEvents(ctx, "r_1")
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		setup()
+
+		err := manager.WithinTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, start(ctx))
+			// The changes are seen within the transaction
+			_, err := rides.GetByID(ctx, "r_1")
+			require.NoError(t, err)
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		_, err = users.GetByID(ctx, "u_1")
+		assert.ErrorIs(t, err, user.ErrNotFound)
+		_, err = rides.GetByID(ctx, "r_1")
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+		events, err := rides.GetEvents(ctx, "r_1")
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("nested units of work join the outer one", func(t *testing.T) {
+		setup()
+
+		err := manager.WithinTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, manager.WithinTx(ctx, start))
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		_, err = users.GetByID(ctx, "u_1")
+		assert.ErrorIs(t, err, user.ErrNotFound)
+		_, err = rides.GetByID(ctx, "r_1")
+		assert.ErrorIs(t, err, ride.ErrNotFound)
+	})
+}
+
+func TestSQLManager_ConcurrentAdjustments(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	rides := sqlite.NewRideDB(db)
+	provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+	adjuster := ride.NewAdjuster(rides, txn.NewSQLManager(db), provider, id.NewUUIDGenerator(), timenow.NewRealTime())
+
+	price := money.NewMoney(1000, "EUR")
+	authID, err := provider.Authorize(ctx, "u_1", price, "")
+	require.NoError(t, err)
+	require.NoError(t, provider.Capture(ctx, authID, price))
+
+	require.NoError(t, sqlite.NewUserDB(db).Create(ctx, &user.User{ID: "u_1"}))
+	require.NoError(t, sqlite.NewVehicleDB(db).Create(ctx, &vehicle.Vehicle{ID: "v_1"}))
+	require.NoError(t, rides.Create(ctx, &ride.Ride{
+		ID:        "r_1",
+		VehicleID: "v_1",
+		UserID:    "u_1",
+		Status:    ride.StatusActive,
+		StartedAt: time.Now().UTC(),
+		Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusAuthorized},
+	}))
+	paid, err := rides.GetByID(ctx, "r_1")
+	require.NoError(t, err)
+	paid.Status = ride.StatusPaid
+	paid.Price = &price
+	paid.Payment.Status = payment.StatusCaptured
+	_, err = rides.Update(ctx, paid)
+	require.NoError(t, err)
+
+	// Ten refunds of 300 race for a charge of 1000, only three of them fit
+	errs := make(chan error, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := adjuster.Adjust(ctx, ride.AdjustParams{
+				RideID: "r_1", Value: 300, Reason: "complaint", Actor: ride.ActorOperator,
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var refunded, rejected int
+	for err := range errs {
+		switch {
+		case err == nil:
+			refunded++
+		case errors.Is(err, ride.ErrRefundExceedsCharge):
+			rejected++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, 3, refunded)
+	assert.Equal(t, 7, rejected)
+
+	adjusted, err := rides.GetByID(ctx, "r_1")
+	require.NoError(t, err)
+	assert.Len(t, adjusted.Adjustments, 3)
+	assert.Equal(t, money.NewMoney(100, "EUR"), adjusted.Charged())
+	assert.NoError(t, provider.Refund(ctx, authID, "rf_last", money.NewMoney(100, "EUR")),
+		"the provider gave back the same as the adjustments")
+}
+
+func TestSQLManager_ConcurrentCancelAndFinish(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	rides := sqlite.NewRideDB(db)
+	manager := txn.NewSQLManager(db)
+	provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+	clock := timenow.NewRealTime()
+	finisher := ride.NewFinisher(rides, manager, ride.NewBasePriceCalculator(100, 18, clock), provider, clock,
+		ride.DefaultHoldValue)
+	canceller := ride.NewCanceller(rides, manager, provider, clock, time.Hour)
+
+	require.NoError(t, sqlite.NewUserDB(db).Create(ctx, &user.User{ID: "u_1"}))
+	require.NoError(t, sqlite.NewVehicleDB(db).Create(ctx, &vehicle.Vehicle{ID: "v_1"}))
+	for i := 0; i < 5; i++ {
+		authID, err := provider.Authorize(ctx, "u_1", money.NewMoney(ride.DefaultHoldValue, "EUR"), "")
+		require.NoError(t, err)
+		rideID := "r_" + strconv.Itoa(i)
+		require.NoError(t, rides.Create(ctx, &ride.Ride{
+			ID:        rideID,
+			VehicleID: "v_1",
+			UserID:    "u_1",
+			Status:    ride.StatusActive,
+			StartedAt: time.Now().UTC(),
+			Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: authID, Status: payment.StatusAuthorized},
+		}))
+
+		// A finish and a cancel race for the ride, only one of them ends it
+		var finishErr, cancelErr error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, finishErr = finisher.Finish(ctx, ride.FinishParams{
+				RideID: rideID, Reason: ride.FinishReasonRider, Actor: ride.ActorRider,
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			_, cancelErr = canceller.Cancel(ctx, ride.CancelParams{
+				RideID: rideID, Reason: ride.CancelReasonVehicleFaulty, Actor: ride.ActorOperator,
+			})
+		}()
+		wg.Wait()
+
+		r, err := rides.GetByID(ctx, rideID)
+		require.NoError(t, err)
+		if finishErr == nil {
+			assert.ErrorIs(t, cancelErr, ride.ErrAlreadyFinished)
+			assert.Equal(t, ride.StatusPaid, r.Status)
+			assert.Equal(t, payment.StatusCaptured, r.Payment.Status)
+			assert.Equal(t, money.NewMoney(118, "EUR"), *r.Price)
+		} else {
+			assert.ErrorIs(t, finishErr, ride.ErrAlreadyCancelled)
+			require.NoError(t, cancelErr)
+			assert.Equal(t, ride.StatusCancelled, r.Status)
+			assert.Equal(t, payment.StatusVoided, r.Payment.Status)
+		}
+	}
+}
+
+func TestSQLManager_ConcurrentSettles(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	rides := sqlite.NewRideDB(db)
+	provider := mem.NewPaymentProvider(id.NewUUIDGenerator())
+	settler := ride.NewDebtSettler(rides, txn.NewSQLManager(db), slowProvider{provider}, timenow.NewRealTime())
+
+	price := money.NewMoney(1180, "EUR")
+	require.NoError(t, sqlite.NewUserDB(db).Create(ctx, &user.User{ID: "u_1"}))
+	require.NoError(t, sqlite.NewVehicleDB(db).Create(ctx, &vehicle.Vehicle{ID: "v_1"}))
+	require.NoError(t, rides.Create(ctx, &ride.Ride{
+		ID:        "r_1",
+		VehicleID: "v_1",
+		UserID:    "u_1",
+		Status:    ride.StatusActive,
+		StartedAt: time.Now().UTC(),
+		Payment:   &ride.Payment{Method: payment.MethodCard, AuthorizationID: "a_1", Status: payment.StatusAuthorized},
+	}))
+	unpaid, err := rides.GetByID(ctx, "r_1")
+	require.NoError(t, err)
+	unpaid.Status = ride.StatusFinished
+	unpaid.Price = &price
+	unpaid.Payment.Status = payment.StatusFailed
+	_, err = rides.Update(ctx, unpaid)
+	require.NoError(t, err)
+
+	// Five settles race for the debt, only one of them charges it
+	errs := make(chan error, 5)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := settler.Settle(ctx, ride.SettleParams{RideID: "r_1", Actor: ride.ActorRider})
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	var settled, rejected int
+	for err := range errs {
+		switch {
+		case err == nil:
+			settled++
+		case errors.Is(err, ride.ErrNoDebt):
+			rejected++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, 1, settled)
+	assert.Equal(t, 4, rejected)
+
+	paid, err := rides.GetByID(ctx, "r_1")
+	require.NoError(t, err)
+	assert.Equal(t, ride.StatusPaid, paid.Status)
+	assert.Equal(t, payment.StatusCaptured, paid.Payment.Status)
+	assert.NoError(t, provider.Refund(ctx, paid.Payment.AuthorizationID, "rf_1", price), "the hold kept was captured")
+}
+
+// slowProvider answers the authorizations late, so the operations placing them overlap.
+type slowProvider struct {
+	payment.Provider
+}
+
+func (p slowProvider) Authorize(ctx context.Context, userID string, amount money.Money, idempotencyKey string) (string, error) {
+	time.Sleep(10 * time.Millisecond)
+	return p.Provider.Authorize(ctx, userID, amount, idempotencyKey)
+}
+
+func TestSQLManager_ConcurrentRotations(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	keys := sqlite.NewAPIKeyDB(db)
+	manager := apikey.NewManager(keys, txn.NewSQLManager(db), id.NewUUIDGenerator(), id.NewSecretGenerator(32),
+		timenow.NewRealTime(), time.Hour)
+
+	issued, err := manager.Create(ctx, apikey.CreateParams{
+		PartnerID: "p_1",
+		Scopes:    []apikey.Scope{apikey.ScopeRidesWrite},
+	})
+	require.NoError(t, err)
+
+	// Five rotations of the same key race, only one of them replaces it
+	errs := make(chan error, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := manager.Rotate(ctx, issued.ID)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var rotated, rejected int
+	for err := range errs {
+		switch {
+		case err == nil:
+			rotated++
+		case errors.Is(err, apikey.ErrAlreadyRotated):
+			rejected++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, 1, rotated)
+	assert.Equal(t, 4, rejected)
+
+	partnerKeys, err := keys.ListByPartner(ctx, "p_1")
+	require.NoError(t, err)
+	assert.Len(t, partnerKeys, 2)
+}
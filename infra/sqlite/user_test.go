@@ -0,0 +1,45 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"reby/domain/user"
+	"reby/domain/vehicle"
+	"reby/infra/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUser(t *testing.T) {
+	db := sqlite.NewUserDB(openDB(t))
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(ctx, &user.User{ID: "1"}))
+
+	u, err := db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, &user.User{ID: "1"}, u)
+
+	_, err = db.GetByID(ctx, "2")
+	assert.ErrorIs(t, err, user.ErrNotFound)
+
+	assert.ErrorIs(t, db.Create(ctx, &user.User{ID: "1"}), user.ErrAlreadyExists)
+}
+
+func TestVehicle(t *testing.T) {
+	db := sqlite.NewVehicleDB(openDB(t))
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(ctx, &vehicle.Vehicle{ID: "1"}))
+
+	v, err := db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, &vehicle.Vehicle{ID: "1"}, v)
+
+	_, err = db.GetByID(ctx, "2")
+	assert.ErrorIs(t, err, vehicle.ErrNotFound)
+
+	assert.ErrorIs(t, db.Create(ctx, &vehicle.Vehicle{ID: "1"}), vehicle.ErrAlreadyExists)
+}
@@ -0,0 +1,101 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/domain/webhook"
+	"reby/infra/sqlite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSubscriptions(t *testing.T) {
+	db := sqlite.NewWebhookDB(openDB(t))
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	s := &webhook.Subscription{
+		ID:        "wh_1",
+		PartnerID: "p_1",
+		URL:       "https://partner.test",
+		Events:    []string{"RideStarted", "RideFinished"},
+		Secret:    "s",
+		CreatedAt: now,
+	}
+	require.NoError(t, db.CreateSubscription(ctx, s))
+
+	got, err := db.GetSubscription(ctx, "wh_1")
+	require.NoError(t, err)
+	assert.True(t, now.Equal(got.CreatedAt))
+	got.CreatedAt = now
+	assert.Equal(t, s, got)
+
+	list, err := db.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, s.Events, list[0].Events)
+
+	require.NoError(t, db.DeleteSubscription(ctx, "wh_1"))
+	_, err = db.GetSubscription(ctx, "wh_1")
+	assert.ErrorIs(t, err, webhook.ErrNotFound)
+	assert.ErrorIs(t, db.DeleteSubscription(ctx, "wh_1"), webhook.ErrNotFound)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	db := sqlite.NewWebhookDB(openDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	payload := []byte(`{"ride_id":"r_1"}`)
+
+	require.NoError(t, db.CreateDeliveries(ctx, []*webhook.Delivery{
+		{ID: "d_1", SubscriptionID: "wh_1", MessageID: 1, Payload: payload, Status: webhook.DeliveryPending,
+			NextAttemptAt: now, CreatedAt: now},
+		{ID: "d_2", SubscriptionID: "wh_1", MessageID: 2, Payload: payload, Status: webhook.DeliveryPending,
+			NextAttemptAt: now.Add(time.Hour), CreatedAt: now},
+	}))
+
+	t.Run("duplicated message is ignored", func(t *testing.T) {
+		require.NoError(t, db.CreateDeliveries(ctx, []*webhook.Delivery{
+			{ID: "d_3", SubscriptionID: "wh_1", MessageID: 1, Payload: payload, Status: webhook.DeliveryPending,
+				NextAttemptAt: now, CreatedAt: now},
+		}))
+		_, err := db.GetDelivery(ctx, "d_3")
+		assert.ErrorIs(t, err, webhook.ErrDeliveryNotFound)
+	})
+
+	t.Run("due deliveries", func(t *testing.T) {
+		due, err := db.GetDueDeliveries(ctx, now, 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		assert.Equal(t, "d_1", due[0].ID)
+		assert.JSONEq(t, string(payload), string(due[0].Payload))
+	})
+
+	t.Run("dead deliveries are not due", func(t *testing.T) {
+		d, err := db.GetDelivery(ctx, "d_1")
+		require.NoError(t, err)
+		d.Status = webhook.DeliveryDead
+		d.Attempts = 8
+		d.LastError = "timeout"
+		require.NoError(t, db.UpdateDelivery(ctx, d))
+
+		due, err := db.GetDueDeliveries(ctx, now.Add(2*time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		assert.Equal(t, "d_2", due[0].ID)
+
+		dead, err := db.ListDeliveries(ctx, webhook.DeliveryDead)
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+		assert.Equal(t, "d_1", dead[0].ID)
+		assert.Equal(t, 8, dead[0].Attempts)
+		assert.Equal(t, "timeout", dead[0].LastError)
+	})
+
+	t.Run("update unknown delivery", func(t *testing.T) {
+		assert.ErrorIs(t, db.UpdateDelivery(ctx, &webhook.Delivery{ID: "d_10"}), webhook.ErrDeliveryNotFound)
+	})
+}
@@ -0,0 +1,160 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"reby/domain/apikey"
+	"reby/pkg/txn"
+)
+
+const apiKeyColumns = `id, partner_id, name, scopes, hint, hash, created_at, last_used_at, expires_at, revoked_at`
+
+type dbAPIKey struct {
+	id         string     `db:"id"`
+	partnerID  string     `db:"partner_id"`
+	name       string     `db:"name"`
+	scopes     []string   `db:"scopes"`
+	hint       string     `db:"hint"`
+	hash       string     `db:"hash"`
+	createdAt  time.Time  `db:"created_at"`
+	lastUsedAt *time.Time `db:"last_used_at"`
+	expiresAt  *time.Time `db:"expires_at"`
+	revokedAt  *time.Time `db:"revoked_at"`
+}
+
+// scanDest returns the destinations to scan a row selected with apiKeyColumns.
+func (k *dbAPIKey) scanDest(d Dialect) []interface{} {
+	return []interface{}{
+		&k.id, &k.partnerID, &k.name, d.StringsDest(&k.scopes), &k.hint, &k.hash, &k.createdAt, &k.lastUsedAt,
+		&k.expiresAt, &k.revokedAt,
+	}
+}
+
+func (k *dbAPIKey) toDomain() *apikey.APIKey {
+	scopes := make([]apikey.Scope, 0, len(k.scopes))
+	for _, s := range k.scopes {
+		scopes = append(scopes, apikey.Scope(s))
+	}
+
+	return &apikey.APIKey{
+		ID:         k.id,
+		PartnerID:  k.partnerID,
+		Name:       k.name,
+		Scopes:     scopes,
+		Hint:       k.hint,
+		Hash:       k.hash,
+		CreatedAt:  k.createdAt,
+		LastUsedAt: k.lastUsedAt,
+		ExpiresAt:  k.expiresAt,
+		RevokedAt:  k.revokedAt,
+	}
+}
+
+type apiKeyDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewAPIKeyDB(db *sql.DB, d Dialect) apikey.Repo {
+	return &apiKeyDB{db: db, d: d}
+}
+
+func (db *apiKeyDB) Create(ctx context.Context, k *apikey.APIKey) error {
+	q := `INSERT INTO "api_key" (` + apiKeyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, s := range k.Scopes {
+		scopes = append(scopes, string(s))
+	}
+	_, err := txn.From(ctx, db.db).ExecContext(ctx, q,
+		k.ID, k.PartnerID, k.Name, db.d.Strings(scopes), k.Hint, k.Hash, db.d.Time(k.CreatedAt), db.d.timePtr(k.LastUsedAt),
+		db.d.timePtr(k.ExpiresAt), db.d.timePtr(k.RevokedAt),
+	)
+
+	return err
+}
+
+// GetByID locks the key until the end of the unit of work in ctx, if any, so it is rotated once.
+func (db *apiKeyDB) GetByID(ctx context.Context, id string) (*apikey.APIKey, error) {
+	q := `SELECT ` + apiKeyColumns + ` FROM "api_key" WHERE id=$1`
+	if _, ok := txn.Tx(ctx); ok {
+		q += db.d.ForUpdate
+	}
+
+	return db.get(ctx, q, id)
+}
+
+func (db *apiKeyDB) GetByHash(ctx context.Context, hash string) (*apikey.APIKey, error) {
+	return db.get(ctx, `SELECT `+apiKeyColumns+` FROM "api_key" WHERE hash=$1;`, hash)
+}
+
+func (db *apiKeyDB) get(ctx context.Context, q string, arg string) (*apikey.APIKey, error) {
+	var kDB dbAPIKey
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, arg).Scan(kDB.scanDest(db.d)...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apikey.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return kDB.toDomain(), nil
+}
+
+func (db *apiKeyDB) ListByPartner(ctx context.Context, partnerID string) ([]*apikey.APIKey, error) {
+	q := `SELECT ` + apiKeyColumns + ` FROM "api_key" WHERE partner_id=$1 ORDER BY created_at;`
+
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q, partnerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*apikey.APIKey, 0)
+	for rows.Next() {
+		var kDB dbAPIKey
+		if err = rows.Scan(kDB.scanDest(db.d)...); err != nil {
+			return nil, err
+		}
+		keys = append(keys, kDB.toDomain())
+	}
+
+	return keys, rows.Err()
+}
+
+// Update stores the lifecycle of a key, its secret and scopes never change.
+func (db *apiKeyDB) Update(ctx context.Context, k *apikey.APIKey) error {
+	q := `UPDATE "api_key" SET expires_at=$2, revoked_at=$3 WHERE id=$1;`
+
+	res, err := txn.From(ctx, db.db).ExecContext(ctx, q, k.ID, db.d.timePtr(k.ExpiresAt), db.d.timePtr(k.RevokedAt))
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (db *apiKeyDB) Touch(ctx context.Context, id string, at time.Time) error {
+	q := `UPDATE "api_key" SET last_used_at=$2 WHERE id=$1;`
+
+	res, err := txn.From(ctx, db.db).ExecContext(ctx, q, id, db.d.Time(at))
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func expectAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apikey.ErrNotFound
+	}
+
+	return nil
+}
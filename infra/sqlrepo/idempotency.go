@@ -0,0 +1,85 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"reby/pkg/idempotency"
+	"reby/pkg/txn"
+)
+
+type idempotencyStore struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewIdempotencyStore(db *sql.DB, d Dialect) idempotency.Store {
+	return &idempotencyStore{db: db, d: d}
+}
+
+func (db *idempotencyStore) Reserve(ctx context.Context, rec idempotency.Record) (*idempotency.Record, error) {
+	var existing *idempotency.Record
+	err := WithTx(ctx, db.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM "idempotency_key" WHERE key=$1 AND expires_at <= $2;`,
+			rec.Key, db.d.Time(rec.CreatedAt),
+		); err != nil {
+			return err
+		}
+
+		q := `INSERT INTO "idempotency_key" (key, fingerprint, status_code, body, created_at, expires_at)
+		VALUES ($1, $2, 0, NULL, $3, $4) ON CONFLICT (key) DO NOTHING;`
+		res, err := tx.ExecContext(ctx, q, rec.Key, rec.Fingerprint, db.d.Time(rec.CreatedAt), db.d.Time(rec.ExpiresAt))
+		if err != nil {
+			return err
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if inserted == 1 {
+			return nil
+		}
+
+		q = `SELECT key, fingerprint, status_code, body, created_at, expires_at FROM "idempotency_key" WHERE key=$1;`
+		var r idempotency.Record
+		if err = tx.QueryRowContext(ctx, q, rec.Key).Scan(
+			&r.Key, &r.Fingerprint, &r.StatusCode, &r.Body, &r.CreatedAt, &r.ExpiresAt,
+		); err != nil {
+			return err
+		}
+		existing = &r
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+func (db *idempotencyStore) Complete(ctx context.Context, key string, statusCode int, body []byte) error {
+	q := `UPDATE "idempotency_key" SET status_code=$1, body=$2 WHERE key=$3;`
+	_, err := txn.From(ctx, db.db).ExecContext(ctx, q, statusCode, body, key)
+
+	return err
+}
+
+func (db *idempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := txn.From(ctx, db.db).ExecContext(ctx, `DELETE FROM "idempotency_key" WHERE key=$1;`, key)
+
+	return err
+}
+
+func (db *idempotencyStore) DeleteExpired(ctx context.Context, t time.Time) (int, error) {
+	res, err := txn.From(ctx, db.db).ExecContext(ctx, `DELETE FROM "idempotency_key" WHERE expires_at <= $1;`,
+		db.d.Time(t),
+	)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+
+	return int(deleted), err
+}
@@ -0,0 +1,64 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"reby/pkg/event"
+	"reby/pkg/txn"
+)
+
+type outboxDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewOutbox(db *sql.DB, d Dialect) event.Outbox {
+	return &outboxDB{db: db, d: d}
+}
+
+// insertOutboxMessages writes msgs inside tx, so they are only published if the change producing them is committed.
+func insertOutboxMessages(ctx context.Context, tx *sql.Tx, d Dialect, msgs []event.Message) error {
+	q := `INSERT INTO "outbox" (type, aggregate_id, occurred_at, payload) VALUES ($1, $2, $3, $4);`
+
+	for _, msg := range msgs {
+		if _, err := tx.ExecContext(ctx, q, msg.Type, msg.AggregateID, d.Time(msg.OccurredAt), d.JSON(msg.Payload)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *outboxDB) GetPending(ctx context.Context, limit int) ([]event.Message, error) {
+	q := `SELECT id, type, aggregate_id, occurred_at, payload FROM "outbox" WHERE delivered_at IS NULL ORDER BY id LIMIT $1;`
+
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]event.Message, 0)
+	for rows.Next() {
+		var msg event.Message
+		var payload []byte
+		if err = rows.Scan(&msg.ID, &msg.Type, &msg.AggregateID, &msg.OccurredAt, &payload); err != nil {
+			return nil, err
+		}
+		msg.Payload = payload
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, rows.Err()
+}
+
+func (db *outboxDB) MarkDelivered(ctx context.Context, id int64) error {
+	q := `UPDATE "outbox" SET delivered_at=` + db.d.Now + ` WHERE id=$1;`
+
+	if _, err := txn.From(ctx, db.db).ExecContext(ctx, q, id); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"reby/domain/receipt"
+	"reby/pkg/txn"
+)
+
+// errAlreadyIssued rolls back a sequence increment when a concurrent request issued the receipt first.
+var errAlreadyIssued = errors.New("ERR_RECEIPT_ALREADY_ISSUED")
+
+type receiptDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewReceiptDB(db *sql.DB, d Dialect) receipt.Repo {
+	return &receiptDB{db: db, d: d}
+}
+
+func (db *receiptDB) Issue(ctx context.Context, rideID string, country string, at time.Time) (*receipt.Issuance, error) {
+	i, err := db.get(ctx, rideID)
+	if err == nil {
+		return i, nil
+	}
+	if !errors.Is(err, receipt.ErrNotFound) {
+		return nil, err
+	}
+
+	i = &receipt.Issuance{RideID: rideID, Country: country, IssuedAt: db.d.Time(at)}
+	err = WithTx(ctx, db.db, func(tx *sql.Tx) error {
+		// The row lock on the country sequence keeps the numbers free of gaps and duplicates
+		q := `INSERT INTO "receipt_sequence" (country, last) VALUES ($1, 1)
+		ON CONFLICT (country) DO UPDATE SET last = receipt_sequence.last + 1 RETURNING last;`
+		if err := tx.QueryRowContext(ctx, q, country).Scan(&i.Sequence); err != nil {
+			return err
+		}
+
+		q = `INSERT INTO "receipt" (ride_id, country, sequence, issued_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ride_id) DO NOTHING;`
+		res, err := tx.ExecContext(ctx, q, i.RideID, i.Country, i.Sequence, i.IssuedAt)
+		if err != nil {
+			return err
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if inserted == 0 {
+			return errAlreadyIssued
+		}
+
+		return nil
+	})
+	if errors.Is(err, errAlreadyIssued) {
+		return db.get(ctx, rideID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (db *receiptDB) get(ctx context.Context, rideID string) (*receipt.Issuance, error) {
+	q := `SELECT ride_id, country, sequence, issued_at FROM "receipt" WHERE ride_id=$1;`
+
+	var i receipt.Issuance
+	row := txn.From(ctx, db.db).QueryRowContext(ctx, q, rideID)
+	if err := row.Scan(&i.RideID, &i.Country, &i.Sequence, &i.IssuedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, receipt.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &i, nil
+}
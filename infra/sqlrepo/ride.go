@@ -0,0 +1,361 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"reby/domain/money"
+	"reby/domain/payment"
+	"reby/domain/ride"
+	"reby/pkg/txn"
+)
+
+const rideColumns = `id, vehicle_id, user_id, status, started_at, finished_at, finish_reason, finished_by, cancelled_at, cancel_reason, cancelled_by, price_value, price_currency, payment_method, payment_authorization_id, payment_status, partner_id, country`
+
+// ongoingRide is the condition matching the rides that still hold their user and vehicle.
+const ongoingRide = `status IN ('RESERVED', 'ACTIVE', 'PAUSED')`
+
+type dbRide struct {
+	id            string     `db:"id"`
+	vehicleID     string     `db:"vehicle_id"`
+	userID        string     `db:"user_id"`
+	status        string     `db:"status"`
+	startedAt     time.Time  `db:"started_at"`
+	finishedAt    *time.Time `db:"finished_at"`
+	finishReason  *string    `db:"finish_reason"`
+	finishedBy    *string    `db:"finished_by"`
+	cancelledAt   *time.Time `db:"cancelled_at"`
+	cancelReason  *string    `db:"cancel_reason"`
+	cancelledBy   *string    `db:"cancelled_by"`
+	priceValue    *int       `db:"price_value"`
+	priceCurrency *string    `db:"price_currency"`
+	paymentMethod *string    `db:"payment_method"`
+	paymentAuthID *string    `db:"payment_authorization_id"`
+	paymentStatus *string    `db:"payment_status"`
+	partnerID     *string    `db:"partner_id"`
+	country       *string    `db:"country"`
+}
+
+// scanDest returns the destinations to scan a row selected with rideColumns.
+func (r *dbRide) scanDest() []interface{} {
+	return []interface{}{
+		&r.id, &r.vehicleID, &r.userID, &r.status, &r.startedAt, &r.finishedAt, &r.finishReason, &r.finishedBy,
+		&r.cancelledAt, &r.cancelReason, &r.cancelledBy, &r.priceValue, &r.priceCurrency,
+		&r.paymentMethod, &r.paymentAuthID, &r.paymentStatus, &r.partnerID, &r.country,
+	}
+}
+
+func (r *dbRide) toDomain() *ride.Ride {
+	var price *money.Money
+	if r.priceValue != nil && r.priceCurrency != nil {
+		p := money.NewMoney(*r.priceValue, *r.priceCurrency)
+		price = &p
+	}
+	var finishReason *ride.FinishReason
+	if r.finishReason != nil {
+		fr := ride.FinishReason(*r.finishReason)
+		finishReason = &fr
+	}
+	var cancelReason *ride.CancelReason
+	if r.cancelReason != nil {
+		cr := ride.CancelReason(*r.cancelReason)
+		cancelReason = &cr
+	}
+	var p *ride.Payment
+	if r.paymentMethod != nil && r.paymentStatus != nil {
+		p = &ride.Payment{Method: payment.Method(*r.paymentMethod), Status: payment.Status(*r.paymentStatus)}
+		if r.paymentAuthID != nil {
+			p.AuthorizationID = *r.paymentAuthID
+		}
+	}
+	var partnerID string
+	if r.partnerID != nil {
+		partnerID = *r.partnerID
+	}
+	var country string
+	if r.country != nil {
+		country = *r.country
+	}
+	return &ride.Ride{
+		ID:           r.id,
+		VehicleID:    r.vehicleID,
+		UserID:       r.userID,
+		PartnerID:    partnerID,
+		Country:      country,
+		Status:       ride.Status(r.status),
+		StartedAt:    r.startedAt,
+		FinishedAt:   r.finishedAt,
+		FinishReason: finishReason,
+		FinishedBy:   toActor(r.finishedBy),
+		CancelledAt:  r.cancelledAt,
+		CancelReason: cancelReason,
+		CancelledBy:  toActor(r.cancelledBy),
+		Price:        price,
+		Payment:      p,
+	}
+}
+
+func toActor(a *string) *ride.Actor {
+	if a == nil {
+		return nil
+	}
+	actor := ride.Actor(*a)
+	return &actor
+}
+
+func fromActor(a *ride.Actor) *string {
+	if a == nil {
+		return nil
+	}
+	actor := string(*a)
+	return &actor
+}
+
+func toRideDB(d Dialect, r *ride.Ride) *dbRide {
+	rd := &dbRide{
+		id:            r.ID,
+		vehicleID:     r.VehicleID,
+		userID:        r.UserID,
+		status:        string(r.Status),
+		startedAt:     d.Time(r.StartedAt),
+		finishedAt:    d.timePtr(r.FinishedAt),
+		finishReason:  nil,
+		finishedBy:    fromActor(r.FinishedBy),
+		cancelledAt:   d.timePtr(r.CancelledAt),
+		cancelReason:  nil,
+		cancelledBy:   fromActor(r.CancelledBy),
+		priceValue:    nil,
+		priceCurrency: nil,
+	}
+	if r.FinishReason != nil {
+		fr := string(*r.FinishReason)
+		rd.finishReason = &fr
+	}
+	if r.CancelReason != nil {
+		cr := string(*r.CancelReason)
+		rd.cancelReason = &cr
+	}
+	if r.Price != nil {
+		pv := r.Price.Value.Int()
+		rd.priceValue = &pv
+
+		pc := r.Price.Currency.String()
+		rd.priceCurrency = &pc
+	}
+	if r.PartnerID != "" {
+		rd.partnerID = &r.PartnerID
+	}
+	if r.Country != "" {
+		rd.country = &r.Country
+	}
+	if r.Payment != nil {
+		pm := string(r.Payment.Method)
+		rd.paymentMethod = &pm
+
+		if r.Payment.AuthorizationID != "" {
+			rd.paymentAuthID = &r.Payment.AuthorizationID
+		}
+
+		ps := string(r.Payment.Status)
+		rd.paymentStatus = &ps
+	}
+
+	return rd
+}
+
+type rideDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewRideDB(db *sql.DB, d Dialect) ride.Repo {
+	return &rideDB{db: db, d: d}
+}
+
+// GetByID locks the ride until the end of the unit of work in ctx, if any, so the changes of concurrent units of
+// work to the same ride run one after the other.
+func (db *rideDB) GetByID(ctx context.Context, id string) (*ride.Ride, error) {
+	q := `SELECT ` + rideColumns + ` FROM "ride" WHERE id=$1`
+	if _, ok := txn.Tx(ctx); ok {
+		q += db.d.ForUpdate
+	}
+
+	var rDB dbRide
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, id).Scan(rDB.scanDest()...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ride.ErrNotFound
+		}
+		return nil, err
+	}
+
+	r := rDB.toDomain()
+	adjustments, err := db.getAdjustments(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.Adjustments = adjustments
+
+	return r, nil
+}
+
+func (db *rideDB) Create(ctx context.Context, r *ride.Ride) error {
+	rDB := toRideDB(db.d, r)
+	q := `INSERT INTO "ride" (id, vehicle_id, user_id, status, started_at, payment_method, payment_authorization_id,
+	payment_status, partner_id, country) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (id) DO NOTHING;`
+
+	return WithTx(ctx, db.db, func(tx *sql.Tx) error {
+		// A taken id is told apart from the other unique indexes, which may be checked first
+		res, err := tx.ExecContext(ctx, q,
+			rDB.id, rDB.vehicleID, rDB.userID, rDB.status, rDB.startedAt, rDB.paymentMethod, rDB.paymentAuthID,
+			rDB.paymentStatus, rDB.partnerID, rDB.country,
+		)
+		if err != nil {
+			if db.d.IsUniqueViolation(err) {
+				return db.ongoingRideConflict(err)
+			}
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ride.ErrAlreadyExists
+		}
+
+		return insertPendingEvents(ctx, tx, db.d, r)
+	})
+}
+
+func (db *rideDB) IsUserRiding(ctx context.Context, userID string) (bool, error) {
+	q := `SELECT 1 FROM "ride" WHERE user_id=$1 AND ` + ongoingRide + `;`
+
+	var result int
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, userID).Scan(&result); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (db *rideDB) IsVehicleRiding(ctx context.Context, vehicleID string) (bool, error) {
+	q := `SELECT 1 FROM "ride" WHERE vehicle_id=$1 AND ` + ongoingRide + `;`
+
+	var result int
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, vehicleID).Scan(&result); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (db *rideDB) HasDebt(ctx context.Context, userID string) (bool, error) {
+	q := `SELECT 1 FROM "ride" WHERE user_id=$1 AND payment_status=$2 LIMIT 1;`
+
+	var result int
+	row := txn.From(ctx, db.db).QueryRowContext(ctx, q, userID, string(payment.StatusFailed))
+	if err := row.Scan(&result); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (db *rideDB) Update(ctx context.Context, r *ride.Ride) (*ride.Ride, error) {
+	q := `UPDATE "ride" SET status=$1, finished_at=$2, finish_reason=$3, finished_by=$4, cancelled_at=$5, cancel_reason=$6,
+	cancelled_by=$7, price_value=$8, price_currency=$9, payment_authorization_id=$10, payment_status=$11 WHERE ID=$12;`
+	rDB := toRideDB(db.d, r)
+
+	if err := WithTx(ctx, db.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, q,
+			rDB.status, rDB.finishedAt, rDB.finishReason, rDB.finishedBy, rDB.cancelledAt, rDB.cancelReason,
+			rDB.cancelledBy, rDB.priceValue, rDB.priceCurrency, rDB.paymentAuthID, rDB.paymentStatus, rDB.id,
+		)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ride.ErrNotFound
+		}
+
+		return insertPendingEvents(ctx, tx, db.d, r)
+	}); err != nil {
+		return nil, err
+	}
+
+	return db.GetByID(ctx, rDB.id)
+}
+
+func (db *rideDB) GetActiveStartedBefore(ctx context.Context, t time.Time) ([]*ride.Ride, error) {
+	q := `SELECT ` + rideColumns + ` FROM "ride" WHERE status IN ('ACTIVE', 'PAUSED') AND started_at < $1;`
+
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q, db.d.Time(t))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rides := make([]*ride.Ride, 0)
+	for rows.Next() {
+		var r dbRide
+		if err = rows.Scan(r.scanDest()...); err != nil {
+			return nil, err
+		}
+		rides = append(rides, r.toDomain())
+	}
+
+	return rides, rows.Err()
+}
+
+// ongoingRideConflict returns the error of a ride that can't be created because its user or its vehicle already
+// have an ongoing ride.
+func (db *rideDB) ongoingRideConflict(err error) error {
+	switch db.d.ViolatedIndex(err) {
+	case "ride_user_ongoing_idx":
+		return ride.ErrUserIsRiding
+	case "ride_vehicle_ongoing_idx":
+		return ride.ErrVehicleIsRiding
+	}
+
+	return err
+}
+
+// insertPendingEvents stores the pending events of r in its history and the outbox, its new adjustments, and
+// posts its pending wallet transaction.
+func insertPendingEvents(ctx context.Context, tx *sql.Tx, d Dialect, r *ride.Ride) error {
+	if t := r.PendingWalletTransaction(); t != nil {
+		if err := insertWalletTransaction(ctx, tx, d, *t); err != nil {
+			return err
+		}
+	}
+
+	if err := insertAdjustments(ctx, tx, d, r.ID, r.Adjustments); err != nil {
+		return err
+	}
+
+	if err := insertRideEvents(ctx, tx, d, r.PendingEvents()); err != nil {
+		return err
+	}
+
+	msgs, err := r.OutboxMessages()
+	if err != nil {
+		return err
+	}
+
+	return insertOutboxMessages(ctx, tx, d, msgs)
+}
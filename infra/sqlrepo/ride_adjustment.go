@@ -0,0 +1,54 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"reby/domain/money"
+	"reby/domain/ride"
+	"reby/pkg/txn"
+)
+
+// insertAdjustments stores the adjustments of a ride inside tx. Adjustments never change once given, so the ones
+// already stored are skipped.
+func insertAdjustments(ctx context.Context, tx *sql.Tx, d Dialect, rideID string, adjustments []ride.Adjustment) error {
+	q := `INSERT INTO "ride_adjustment" (id, ride_id, value, currency, reason, actor, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING;`
+
+	for _, a := range adjustments {
+		if _, err := tx.ExecContext(ctx, q,
+			a.ID, rideID, a.Amount.Value.Int(), a.Amount.Currency.String(), a.Reason, string(a.Actor), d.Time(a.CreatedAt),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getAdjustments returns the adjustments of a ride, oldest first, or nil when it has none.
+func (db *rideDB) getAdjustments(ctx context.Context, rideID string) ([]ride.Adjustment, error) {
+	q := `SELECT id, value, currency, reason, actor, created_at FROM "ride_adjustment" WHERE ride_id=$1
+	ORDER BY created_at, id;`
+
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q, rideID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var adjustments []ride.Adjustment
+	for rows.Next() {
+		var a ride.Adjustment
+		var value int
+		var currency, actor string
+		if err = rows.Scan(&a.ID, &value, &currency, &a.Reason, &actor, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.Amount = money.NewMoney(value, currency)
+		a.Actor = ride.Actor(actor)
+		adjustments = append(adjustments, a)
+	}
+
+	return adjustments, rows.Err()
+}
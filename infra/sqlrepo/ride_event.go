@@ -0,0 +1,96 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"reby/domain/ride"
+	"reby/pkg/txn"
+)
+
+type dbRideEvent struct {
+	rideID     string    `db:"ride_id"`
+	eventType  string    `db:"type"`
+	actor      string    `db:"actor"`
+	occurredAt time.Time `db:"occurred_at"`
+	data       []byte    `db:"data"`
+}
+
+func (e *dbRideEvent) toDomain() (ride.Event, error) {
+	var data map[string]string
+	if e.data != nil {
+		if err := json.Unmarshal(e.data, &data); err != nil {
+			return ride.Event{}, err
+		}
+	}
+
+	return ride.Event{
+		RideID:     e.rideID,
+		Type:       ride.EventType(e.eventType),
+		Actor:      ride.Actor(e.actor),
+		OccurredAt: e.occurredAt,
+		Data:       data,
+	}, nil
+}
+
+func toRideEventDB(d Dialect, e ride.Event) (*dbRideEvent, error) {
+	var data []byte
+	if e.Data != nil {
+		var err error
+		if data, err = json.Marshal(e.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dbRideEvent{
+		rideID:     e.RideID,
+		eventType:  string(e.Type),
+		actor:      string(e.Actor),
+		occurredAt: d.Time(e.OccurredAt),
+		data:       data,
+	}, nil
+}
+
+// insertRideEvents appends events to the ride history inside tx, so they are stored atomically with the ride change.
+func insertRideEvents(ctx context.Context, tx *sql.Tx, d Dialect, events []ride.Event) error {
+	q := `INSERT INTO "ride_event" (ride_id, type, actor, occurred_at, data) VALUES ($1, $2, $3, $4, $5);`
+
+	for _, e := range events {
+		eDB, err := toRideEventDB(d, e)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, q, eDB.rideID, eDB.eventType, eDB.actor, eDB.occurredAt, d.JSON(eDB.data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *rideDB) GetEvents(ctx context.Context, rideID string) ([]ride.Event, error) {
+	q := `SELECT ride_id, type, actor, occurred_at, data FROM "ride_event" WHERE ride_id=$1 ORDER BY id;`
+
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q, rideID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]ride.Event, 0)
+	for rows.Next() {
+		var eDB dbRideEvent
+		if err = rows.Scan(&eDB.rideID, &eDB.eventType, &eDB.actor, &eDB.occurredAt, &eDB.data); err != nil {
+			return nil, err
+		}
+		e, err := eDB.toDomain()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,60 @@
+// Package sqlrepo stores the users, vehicles, rides, wallets, receipts, API keys, webhooks and idempotency keys in a
+// SQL database. Postgres and SQLite run the same queries, the Dialect of each covers what they do differently.
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"reby/pkg/txn"
+)
+
+// Dialect is what a database does its own way.
+type Dialect struct {
+	// Now is the current time in the queries.
+	Now string
+	// ForUpdate is appended to the queries reading a row that the unit of work changes next, to lock it until it
+	// ends. It is empty for the databases that run a single transaction at a time.
+	ForUpdate string
+	// Time returns t as it is written. SQLite compares the times as text, so they must all be in the same location.
+	Time func(t time.Time) time.Time
+	// JSON returns a JSON document as its column takes it.
+	JSON func(doc []byte) interface{}
+	// Strings returns a list of strings as its column takes it, and StringsDest the destination to scan it into s.
+	Strings     func(s []string) interface{}
+	StringsDest func(s *[]string) interface{}
+	// IsUniqueViolation tells whether err comes from inserting a row whose key is taken.
+	IsUniqueViolation func(err error) bool
+	// ViolatedIndex returns the name of the unique index a unique violation is about, empty when it is unknown.
+	ViolatedIndex func(err error) string
+}
+
+// timePtr is Dialect.Time for the optional times.
+func (d Dialect) timePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	n := d.Time(*t)
+	return &n
+}
+
+// WithTx runs fn inside a transaction, committing it when fn succeeds and rolling it back otherwise. In a unit of
+// work fn runs in its transaction, which is committed with the rest of the unit.
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	if tx, ok := txn.Tx(ctx); ok {
+		return fn(tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
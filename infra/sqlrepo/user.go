@@ -0,0 +1,71 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"reby/domain/user"
+	"reby/pkg/txn"
+)
+
+type dbUser struct {
+	id        string  `db:"id"`
+	partnerID *string `db:"partner_id"`
+}
+
+func (u dbUser) toDomain() *user.User {
+	var partnerID string
+	if u.partnerID != nil {
+		partnerID = *u.partnerID
+	}
+	return &user.User{
+		ID:        u.id,
+		PartnerID: partnerID,
+	}
+}
+
+func toUserDB(u *user.User) dbUser {
+	uDB := dbUser{id: u.ID}
+	if u.PartnerID != "" {
+		uDB.partnerID = &u.PartnerID
+	}
+	return uDB
+}
+
+type userDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewUserDB(db *sql.DB, d Dialect) user.Repo {
+	return &userDB{db: db, d: d}
+}
+
+func (db *userDB) GetByID(ctx context.Context, id string) (*user.User, error) {
+	q := `SELECT id, partner_id FROM "user" WHERE id=$1;`
+
+	var u dbUser
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, id).Scan(&u.id, &u.partnerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, user.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return u.toDomain(), nil
+}
+
+func (db *userDB) Create(ctx context.Context, u *user.User) error {
+	uDB := toUserDB(u)
+	q := `INSERT INTO "user" (id, partner_id) VALUES ($1, $2);`
+
+	if _, err := txn.From(ctx, db.db).ExecContext(ctx, q, uDB.id, uDB.partnerID); err != nil {
+		if db.d.IsUniqueViolation(err) {
+			return user.ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"reby/domain/vehicle"
+	"reby/pkg/txn"
+)
+
+type dbVehicle struct {
+	id      string
+	country *string
+}
+
+func (v dbVehicle) toDomain() *vehicle.Vehicle {
+	var country string
+	if v.country != nil {
+		country = *v.country
+	}
+	return &vehicle.Vehicle{
+		ID:      v.id,
+		Country: country,
+	}
+}
+
+func toVehicleDB(v *vehicle.Vehicle) dbVehicle {
+	vDB := dbVehicle{id: v.ID}
+	if v.Country != "" {
+		vDB.country = &v.Country
+	}
+	return vDB
+}
+
+type vehicleDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewVehicleDB(db *sql.DB, d Dialect) vehicle.Repo {
+	return &vehicleDB{db: db, d: d}
+}
+
+func (db *vehicleDB) GetByID(ctx context.Context, id string) (*vehicle.Vehicle, error) {
+	q := `SELECT id, country FROM "vehicle" WHERE id=$1;`
+
+	var v dbVehicle
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, id).Scan(&v.id, &v.country); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, vehicle.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return v.toDomain(), nil
+}
+
+func (db *vehicleDB) Create(ctx context.Context, v *vehicle.Vehicle) error {
+	vDB := toVehicleDB(v)
+	q := `INSERT INTO "vehicle" (id, country) VALUES ($1, $2);`
+
+	if _, err := txn.From(ctx, db.db).ExecContext(ctx, q, vDB.id, vDB.country); err != nil {
+		if db.d.IsUniqueViolation(err) {
+			return vehicle.ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"reby/domain/money"
+	"reby/domain/wallet"
+	"reby/pkg/txn"
+)
+
+type walletDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewWalletDB(db *sql.DB, d Dialect) wallet.Repo {
+	return &walletDB{db: db, d: d}
+}
+
+func (db *walletDB) GetByUserID(ctx context.Context, userID string) (*wallet.Wallet, error) {
+	q := `SELECT COUNT(*), COALESCE(SUM(value), 0) FROM "ledger_entry" WHERE account=$1;`
+
+	var entries, balance int
+	row := txn.From(ctx, db.db).QueryRowContext(ctx, q, string(wallet.UserAccount(userID)))
+	if err := row.Scan(&entries, &balance); err != nil {
+		return nil, err
+	}
+	if entries == 0 {
+		return nil, wallet.ErrNotFound
+	}
+
+	return &wallet.Wallet{UserID: userID, Balance: money.NewMoney(balance, wallet.Currency)}, nil
+}
+
+func (db *walletDB) Post(ctx context.Context, t wallet.Transaction) error {
+	return WithTx(ctx, db.db, func(tx *sql.Tx) error {
+		return insertWalletTransaction(ctx, tx, db.d, t)
+	})
+}
+
+// insertWalletTransaction posts t to the ledger inside tx, so it is stored atomically with the change that caused it.
+func insertWalletTransaction(ctx context.Context, tx *sql.Tx, d Dialect, t wallet.Transaction) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	q := `INSERT INTO "wallet_transaction" (id, kind, reference, created_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id) DO NOTHING;`
+	res, err := tx.ExecContext(ctx, q, t.ID, string(t.Kind), t.Reference, d.Time(t.CreatedAt))
+	if err != nil {
+		return err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return wallet.ErrAlreadyPosted
+	}
+
+	q = `INSERT INTO "ledger_entry" (transaction_id, account, value, currency) VALUES ($1, $2, $3, $4);`
+	for _, e := range t.Entries {
+		if _, err = tx.ExecContext(ctx, q, t.ID, string(e.Account), e.Amount.Value.Int(), e.Amount.Currency.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *walletDB) GetTransactions(ctx context.Context, userID string) ([]wallet.Transaction, error) {
+	q := `SELECT t.id, t.kind, t.reference, t.created_at, e.account, e.value, e.currency
+	FROM "wallet_transaction" t JOIN "ledger_entry" e ON e.transaction_id = t.id
+	WHERE t.id IN (SELECT transaction_id FROM "ledger_entry" WHERE account=$1)
+	ORDER BY t.created_at, t.id, e.id;`
+
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q, string(wallet.UserAccount(userID)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]wallet.Transaction, 0)
+	for rows.Next() {
+		var t wallet.Transaction
+		var account, currency string
+		var value int
+		if err = rows.Scan(&t.ID, &t.Kind, &t.Reference, &t.CreatedAt, &account, &value, &currency); err != nil {
+			return nil, err
+		}
+
+		if n := len(transactions); n == 0 || transactions[n-1].ID != t.ID {
+			transactions = append(transactions, t)
+		}
+		last := &transactions[len(transactions)-1]
+		last.Entries = append(last.Entries, wallet.Entry{
+			Account: wallet.Account(account),
+			Amount:  money.NewMoney(value, currency),
+		})
+	}
+
+	return transactions, rows.Err()
+}
@@ -0,0 +1,208 @@
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"reby/domain/webhook"
+	"reby/pkg/txn"
+)
+
+const deliveryColumns = `id, subscription_id, message_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at`
+
+type dbDelivery struct {
+	id             string    `db:"id"`
+	subscriptionID string    `db:"subscription_id"`
+	messageID      int64     `db:"message_id"`
+	eventType      string    `db:"event_type"`
+	payload        []byte    `db:"payload"`
+	status         string    `db:"status"`
+	attempts       int       `db:"attempts"`
+	nextAttemptAt  time.Time `db:"next_attempt_at"`
+	lastError      string    `db:"last_error"`
+	createdAt      time.Time `db:"created_at"`
+}
+
+// scanDest returns the destinations to scan a row selected with deliveryColumns.
+func (d *dbDelivery) scanDest() []interface{} {
+	return []interface{}{
+		&d.id, &d.subscriptionID, &d.messageID, &d.eventType, &d.payload, &d.status, &d.attempts, &d.nextAttemptAt,
+		&d.lastError, &d.createdAt,
+	}
+}
+
+func (d *dbDelivery) toDomain() *webhook.Delivery {
+	return &webhook.Delivery{
+		ID:             d.id,
+		SubscriptionID: d.subscriptionID,
+		MessageID:      d.messageID,
+		EventType:      d.eventType,
+		Payload:        d.payload,
+		Status:         webhook.DeliveryStatus(d.status),
+		Attempts:       d.attempts,
+		NextAttemptAt:  d.nextAttemptAt,
+		LastError:      d.lastError,
+		CreatedAt:      d.createdAt,
+	}
+}
+
+type webhookDB struct {
+	db *sql.DB
+	d  Dialect
+}
+
+func NewWebhookDB(db *sql.DB, d Dialect) webhook.Repo {
+	return &webhookDB{db: db, d: d}
+}
+
+func (db *webhookDB) CreateSubscription(ctx context.Context, s *webhook.Subscription) error {
+	q := `INSERT INTO "webhook_subscription" (id, partner_id, url, events, secret, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6);`
+
+	_, err := txn.From(ctx, db.db).ExecContext(ctx, q,
+		s.ID, s.PartnerID, s.URL, db.d.Strings(s.Events), s.Secret, db.d.Time(s.CreatedAt),
+	)
+
+	return err
+}
+
+func (db *webhookDB) GetSubscription(ctx context.Context, id string) (*webhook.Subscription, error) {
+	q := `SELECT id, partner_id, url, events, secret, created_at FROM "webhook_subscription" WHERE id=$1;`
+
+	var s webhook.Subscription
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, id).Scan(
+		&s.ID, &s.PartnerID, &s.URL, db.d.StringsDest(&s.Events), &s.Secret, &s.CreatedAt,
+	); err != nil {
+		if errors.Is(sql.ErrNoRows, err) {
+			return nil, webhook.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (db *webhookDB) ListSubscriptions(ctx context.Context) ([]*webhook.Subscription, error) {
+	q := `SELECT id, partner_id, url, events, secret, created_at FROM "webhook_subscription" ORDER BY created_at;`
+
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := make([]*webhook.Subscription, 0)
+	for rows.Next() {
+		var s webhook.Subscription
+		if err = rows.Scan(&s.ID, &s.PartnerID, &s.URL, db.d.StringsDest(&s.Events), &s.Secret, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, &s)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (db *webhookDB) DeleteSubscription(ctx context.Context, id string) error {
+	q := `DELETE FROM "webhook_subscription" WHERE id=$1;`
+
+	res, err := txn.From(ctx, db.db).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return webhook.ErrNotFound
+	}
+
+	return nil
+}
+
+func (db *webhookDB) CreateDeliveries(ctx context.Context, deliveries []*webhook.Delivery) error {
+	q := `INSERT INTO "webhook_delivery" (` + deliveryColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (subscription_id, message_id) DO NOTHING;`
+
+	return WithTx(ctx, db.db, func(tx *sql.Tx) error {
+		for _, d := range deliveries {
+			if _, err := tx.ExecContext(ctx, q,
+				d.ID, d.SubscriptionID, d.MessageID, d.EventType, db.d.JSON(d.Payload), string(d.Status), d.Attempts,
+				db.d.Time(d.NextAttemptAt), d.LastError, db.d.Time(d.CreatedAt),
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (db *webhookDB) GetDelivery(ctx context.Context, id string) (*webhook.Delivery, error) {
+	q := `SELECT ` + deliveryColumns + ` FROM "webhook_delivery" WHERE id=$1;`
+
+	var d dbDelivery
+	if err := txn.From(ctx, db.db).QueryRowContext(ctx, q, id).Scan(d.scanDest()...); err != nil {
+		if errors.Is(sql.ErrNoRows, err) {
+			return nil, webhook.ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	return d.toDomain(), nil
+}
+
+func (db *webhookDB) GetDueDeliveries(ctx context.Context, t time.Time, limit int) ([]*webhook.Delivery, error) {
+	q := `SELECT ` + deliveryColumns + ` FROM "webhook_delivery" WHERE status=$1 AND next_attempt_at <= $2
+	ORDER BY created_at, message_id LIMIT $3;`
+
+	return db.queryDeliveries(ctx, q, string(webhook.DeliveryPending), db.d.Time(t), limit)
+}
+
+func (db *webhookDB) ListDeliveries(ctx context.Context, status webhook.DeliveryStatus) ([]*webhook.Delivery, error) {
+	q := `SELECT ` + deliveryColumns + ` FROM "webhook_delivery" WHERE status=$1 ORDER BY created_at, message_id;`
+
+	return db.queryDeliveries(ctx, q, string(status))
+}
+
+func (db *webhookDB) queryDeliveries(ctx context.Context, q string, args ...interface{}) ([]*webhook.Delivery, error) {
+	rows, err := txn.From(ctx, db.db).QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*webhook.Delivery, 0)
+	for rows.Next() {
+		var d dbDelivery
+		if err = rows.Scan(d.scanDest()...); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d.toDomain())
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (db *webhookDB) UpdateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	q := `UPDATE "webhook_delivery" SET status=$1, attempts=$2, next_attempt_at=$3, last_error=$4 WHERE id=$5;`
+
+	res, err := txn.From(ctx, db.db).ExecContext(ctx, q,
+		string(d.Status), d.Attempts, db.d.Time(d.NextAttemptAt), d.LastError, d.ID,
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return webhook.ErrDeliveryNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Message is a domain event waiting in the outbox or being delivered to the sinks.
+type Message struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID string          `json:"aggregate_id"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// Outbox holds the messages written together with the state changes that produced them until they are delivered.
+type Outbox interface {
+	// GetPending returns up to limit undelivered messages, oldest first.
+	GetPending(ctx context.Context, limit int) ([]Message, error)
+	MarkDelivered(ctx context.Context, id int64) error
+}
+
+// Sink is a destination messages are published to.
+type Sink interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+type OutboxMock struct {
+	mock.Mock
+}
+
+func NewOutboxMock() *OutboxMock {
+	return new(OutboxMock)
+}
+
+func (m *OutboxMock) GetPending(_ context.Context, limit int) ([]Message, error) {
+	args := m.Mock.Called(limit)
+	return args.Get(0).([]Message), args.Error(1)
+}
+
+func (m *OutboxMock) MarkDelivered(_ context.Context, id int64) error {
+	args := m.Mock.Called(id)
+	return args.Error(0)
+}
+
+type SinkMock struct {
+	mock.Mock
+}
+
+func NewSinkMock() *SinkMock {
+	return new(SinkMock)
+}
+
+func (m *SinkMock) Publish(_ context.Context, msg Message) error {
+	args := m.Mock.Called(msg)
+	return args.Error(0)
+}
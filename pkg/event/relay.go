@@ -0,0 +1,43 @@
+package event
+
+import (
+	"context"
+)
+
+// Relay moves the messages from the outbox to the sinks. A message is only marked as delivered once every sink
+// accepted it, so sinks may receive a message more than once but never miss one.
+type Relay interface {
+	Relay(ctx context.Context) (int, error)
+}
+
+type relay struct {
+	outbox    Outbox
+	sinks     []Sink
+	batchSize int
+}
+
+func NewRelay(outbox Outbox, batchSize int, sinks ...Sink) Relay {
+	return &relay{outbox: outbox, sinks: sinks, batchSize: batchSize}
+}
+
+// Relay delivers a batch of pending messages and returns how many were delivered. It stops at the first
+// failure so messages keep their order.
+func (r *relay) Relay(ctx context.Context) (int, error) {
+	msgs, err := r.outbox.GetPending(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, msg := range msgs {
+		for _, s := range r.sinks {
+			if err = s.Publish(ctx, msg); err != nil {
+				return i, err
+			}
+		}
+		if err = r.outbox.MarkDelivered(ctx, msg.ID); err != nil {
+			return i, err
+		}
+	}
+
+	return len(msgs), nil
+}
@@ -0,0 +1,72 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"reby/pkg/event"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelay(t *testing.T) {
+	var outboxMock *event.OutboxMock
+	var sinkMock1, sinkMock2 *event.SinkMock
+	var relay event.Relay
+	batchSize := 10
+	ctx := context.Background()
+
+	msgs := []event.Message{
+		{ID: 1, Type: "RideStarted", AggregateID: "r_1"},
+		{ID: 2, Type: "RideFinished", AggregateID: "r_1"},
+	}
+
+	setup := func() {
+		outboxMock = event.NewOutboxMock()
+		sinkMock1 = event.NewSinkMock()
+		sinkMock2 = event.NewSinkMock()
+		relay = event.NewRelay(outboxMock, batchSize, sinkMock1, sinkMock2)
+	}
+
+	t.Run("delivers to every sink", func(t *testing.T) {
+		setup()
+		outboxMock.On("GetPending", batchSize).Return(msgs, nil)
+		for _, msg := range msgs {
+			sinkMock1.On("Publish", msg).Return(nil)
+			sinkMock2.On("Publish", msg).Return(nil)
+			outboxMock.On("MarkDelivered", msg.ID).Return(nil)
+		}
+
+		delivered, err := relay.Relay(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, delivered)
+		outboxMock.AssertNumberOfCalls(t, "MarkDelivered", 2)
+	})
+
+	t.Run("sink failure stops the batch", func(t *testing.T) {
+		setup()
+		sinkErr := errors.New("ERR_SINK")
+		outboxMock.On("GetPending", batchSize).Return(msgs, nil)
+		sinkMock1.On("Publish", msgs[0]).Return(nil)
+		sinkMock2.On("Publish", msgs[0]).Return(nil)
+		outboxMock.On("MarkDelivered", msgs[0].ID).Return(nil)
+		sinkMock1.On("Publish", msgs[1]).Return(nil)
+		sinkMock2.On("Publish", msgs[1]).Return(sinkErr)
+
+		delivered, err := relay.Relay(ctx)
+		assert.ErrorIs(t, err, sinkErr)
+		assert.Equal(t, 1, delivered)
+		outboxMock.AssertNotCalled(t, "MarkDelivered", msgs[1].ID)
+	})
+
+	t.Run("outbox failure", func(t *testing.T) {
+		setup()
+		outboxErr := errors.New("ERR_OUTBOX")
+		outboxMock.On("GetPending", batchSize).Return([]event.Message{}, outboxErr)
+
+		delivered, err := relay.Relay(ctx)
+		assert.ErrorIs(t, err, outboxErr)
+		assert.Equal(t, 0, delivered)
+	})
+}
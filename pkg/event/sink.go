@@ -0,0 +1,96 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+type channelSink struct {
+	ch chan<- Message
+}
+
+// NewChannelSink returns a Sink that sends the messages to ch, for in-process consumers.
+func NewChannelSink(ch chan<- Message) Sink {
+	return &channelSink{ch: ch}
+}
+
+func (s *channelSink) Publish(ctx context.Context, msg Message) error {
+	select {
+	case s.ch <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a Sink that POSTs every message as JSON to url. Any non 2xx response is an error.
+func NewWebhookSink(url string, client *http.Client) Sink {
+	return &webhookSink{url: url, client: client}
+}
+
+func (s *webhookSink) Publish(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSink returns a Sink that appends every message as a JSON line to the file at path.
+func NewFileSink(path string) Sink {
+	return &fileSink{path: path}
+}
+
+func (s *fileSink) Publish(_ context.Context, msg Message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
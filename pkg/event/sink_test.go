@@ -0,0 +1,92 @@
+package event_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"reby/pkg/event"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessage(id int64) event.Message {
+	return event.Message{
+		ID:          id,
+		Type:        "RideStarted",
+		AggregateID: "r_1",
+		OccurredAt:  time.Now().UTC(),
+		Payload:     json.RawMessage(`{"id":"r_1"}`),
+	}
+}
+
+func TestChannelSink(t *testing.T) {
+	ch := make(chan event.Message, 1)
+	sink := event.NewChannelSink(ch)
+	msg := testMessage(1)
+
+	require.NoError(t, sink.Publish(context.Background(), msg))
+	assert.Equal(t, msg, <-ch)
+
+	t.Run("cancelled context", func(t *testing.T) {
+		full := make(chan event.Message)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, event.NewChannelSink(full).Publish(ctx, msg), context.Canceled)
+	})
+}
+
+func TestWebhookSink(t *testing.T) {
+	var status int
+	var received event.Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := event.NewWebhookSink(server.URL, server.Client())
+	msg := testMessage(1)
+
+	t.Run("ok", func(t *testing.T) {
+		status = http.StatusOK
+		require.NoError(t, sink.Publish(context.Background(), msg))
+		assert.Equal(t, msg.ID, received.ID)
+		assert.JSONEq(t, string(msg.Payload), string(received.Payload))
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		assert.Error(t, sink.Publish(context.Background(), msg))
+	})
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink := event.NewFileSink(path)
+
+	require.NoError(t, sink.Publish(context.Background(), testMessage(1)))
+	require.NoError(t, sink.Publish(context.Background(), testMessage(2)))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	ids := make([]int64, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg event.Message
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+		ids = append(ids, msg.ID)
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []int64{1, 2}, ids)
+}
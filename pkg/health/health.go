@@ -0,0 +1,101 @@
+// Package health reports whether the process can serve requests, for the probes of the orchestrator.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "UP"
+	StatusDown Status = "DOWN"
+)
+
+// Check returns an error when a dependency can't serve requests.
+type Check func(ctx context.Context) error
+
+// Report is the readiness of the process and of each of its dependencies, by name.
+type Report struct {
+	Status Status `json:"status"`
+	// Draining is set once the process is shutting down, the dependencies aren't checked then.
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Readiness checks the dependencies of the process. It is ready when all of them are, and always without any.
+type Readiness struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	timeout  time.Duration
+	draining bool
+}
+
+// NewReadiness returns a Readiness giving each check up to timeout.
+func NewReadiness(timeout time.Duration) *Readiness {
+	return &Readiness{checks: make(map[string]Check), timeout: timeout}
+}
+
+// Add registers the check of the dependency name.
+func (r *Readiness) Add(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[name] = check
+}
+
+// Drain makes the process not ready from now on, so the orchestrator stops routing requests to it while it shuts
+// down.
+func (r *Readiness) Drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.draining = true
+}
+
+// Check runs the checks concurrently and reports their results.
+func (r *Readiness) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(r.checks))}
+	if r.draining {
+		report.Status = StatusDown
+		report.Draining = true
+		return report
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range r.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+
+			result := CheckResult{Status: StatusUp}
+			if err := check(ctx); err != nil {
+				result = CheckResult{Status: StatusDown, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status == StatusDown {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
@@ -0,0 +1,66 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"reby/pkg/health"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness_Check(t *testing.T) {
+	t.Run("ready without dependencies", func(t *testing.T) {
+		r := health.NewReadiness(time.Second)
+
+		assert.Equal(t, health.Report{
+			Status: health.StatusUp,
+			Checks: map[string]health.CheckResult{},
+		}, r.Check(context.Background()))
+	})
+
+	t.Run("not ready when a dependency is down", func(t *testing.T) {
+		r := health.NewReadiness(time.Second)
+		r.Add("cache", func(ctx context.Context) error { return nil })
+		r.Add("postgres", func(ctx context.Context) error { return errors.New("connection refused") })
+
+		assert.Equal(t, health.Report{
+			Status: health.StatusDown,
+			Checks: map[string]health.CheckResult{
+				"cache":    {Status: health.StatusUp},
+				"postgres": {Status: health.StatusDown, Error: "connection refused"},
+			},
+		}, r.Check(context.Background()))
+	})
+
+	t.Run("checks time out", func(t *testing.T) {
+		r := health.NewReadiness(10 * time.Millisecond)
+		r.Add("postgres", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		report := r.Check(context.Background())
+
+		assert.Equal(t, health.StatusDown, report.Status)
+		assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["postgres"].Error)
+	})
+
+	t.Run("not ready while draining", func(t *testing.T) {
+		r := health.NewReadiness(time.Second)
+		r.Add("postgres", func(ctx context.Context) error {
+			t.Error("dependencies are not checked while draining")
+			return nil
+		})
+
+		r.Drain()
+
+		assert.Equal(t, health.Report{
+			Status:   health.StatusDown,
+			Draining: true,
+			Checks:   map[string]health.CheckResult{},
+		}, r.Check(context.Background()))
+	})
+}
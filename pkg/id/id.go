@@ -1,6 +1,9 @@
 package id
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 )
@@ -19,6 +22,24 @@ func (g *uuidGenerator) Generate() string {
 	return uuid.NewString()
 }
 
+type secretGenerator struct {
+	size int
+}
+
+// NewSecretGenerator returns a Generator of hex encoded random secrets of size bytes.
+func NewSecretGenerator(size int) Generator {
+	return &secretGenerator{size: size}
+}
+
+func (g *secretGenerator) Generate() string {
+	b := make([]byte, g.size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand only fails if the OS entropy source is broken
+	}
+
+	return hex.EncodeToString(b)
+}
+
 type GeneratorMock struct {
 	mock.Mock
 }
@@ -0,0 +1,66 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Record is the outcome of the first request made with an idempotency key.
+type Record struct {
+	Key string
+	// Fingerprint identifies the request the key was first used with.
+	Fingerprint string
+	// StatusCode and Body of the response, empty while the first request is in progress.
+	StatusCode int
+	Body       []byte
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// Completed tells whether the response of the first request is stored.
+func (r Record) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// Store keeps the records of the idempotency keys until they expire.
+type Store interface {
+	// Reserve stores rec as in progress unless a record with its key has not expired at rec.CreatedAt. In that case
+	// nothing is stored and the existing record is returned.
+	Reserve(ctx context.Context, rec Record) (*Record, error)
+	// Complete stores the response of the request that reserved key.
+	Complete(ctx context.Context, key string, statusCode int, body []byte) error
+	// Release forgets key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+	// DeleteExpired removes the records expired at t and returns how many were removed.
+	DeleteExpired(ctx context.Context, t time.Time) (int, error)
+}
+
+type StoreMock struct {
+	mock.Mock
+}
+
+func NewStoreMock() *StoreMock {
+	return new(StoreMock)
+}
+
+func (m *StoreMock) Reserve(_ context.Context, rec Record) (*Record, error) {
+	args := m.Mock.Called(rec)
+	return args.Get(0).(*Record), args.Error(1)
+}
+
+func (m *StoreMock) Complete(_ context.Context, key string, statusCode int, body []byte) error {
+	args := m.Mock.Called(key, statusCode, body)
+	return args.Error(0)
+}
+
+func (m *StoreMock) Release(_ context.Context, key string) error {
+	args := m.Mock.Called(key)
+	return args.Error(0)
+}
+
+func (m *StoreMock) DeleteExpired(_ context.Context, t time.Time) (int, error) {
+	args := m.Mock.Called(t)
+	return args.Int(0), args.Error(1)
+}
@@ -0,0 +1,250 @@
+// Package jwt verifies and signs the compact JSON Web Tokens used as bearer tokens. Only HS256 and RS256 are
+// supported, the algorithms the identity provider issues.
+package jwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+
+	"reby/pkg/timenow"
+)
+
+type Algorithm string
+
+const (
+	HS256 Algorithm = "HS256"
+	RS256 Algorithm = "RS256"
+)
+
+var (
+	ErrMalformed            = errors.New("ERR_TOKEN_MALFORMED")
+	ErrUnsupportedAlgorithm = errors.New("ERR_TOKEN_UNSUPPORTED_ALGORITHM")
+	ErrInvalidSignature     = errors.New("ERR_TOKEN_INVALID_SIGNATURE")
+	ErrExpired              = errors.New("ERR_TOKEN_EXPIRED")
+	ErrNotYetValid          = errors.New("ERR_TOKEN_NOT_YET_VALID")
+	ErrMissingSubject       = errors.New("ERR_TOKEN_MISSING_SUBJECT")
+	ErrMissingExpiry        = errors.New("ERR_TOKEN_MISSING_EXPIRY")
+	ErrInvalidIssuer        = errors.New("ERR_TOKEN_INVALID_ISSUER")
+	ErrInvalidAudience      = errors.New("ERR_TOKEN_INVALID_AUDIENCE")
+	ErrNoKeys               = errors.New("ERR_TOKEN_NO_KEYS")
+	ErrInvalidKey           = errors.New("ERR_TOKEN_INVALID_KEY")
+)
+
+// Claims are the claims the service relies on. Times are seconds since the Unix epoch and zero when absent.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	// Role of the subject, a private claim of the identity provider.
+	Role string `json:"role,omitempty"`
+}
+
+// Audience are the recipients a token is meant for. The claim is either a single string or an array of them.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// Contains tells whether recipient is one of the audience.
+func (a Audience) Contains(recipient string) bool {
+	for _, r := range a {
+		if r == recipient {
+			return true
+		}
+	}
+
+	return false
+}
+
+type header struct {
+	Algorithm Algorithm `json:"alg"`
+	Type      string    `json:"typ,omitempty"`
+}
+
+// Keys verify the tokens. A token is only accepted with an algorithm whose key is set.
+type Keys struct {
+	HMACSecret   []byte
+	RSAPublicKey *rsa.PublicKey
+}
+
+type Verifier interface {
+	// Verify checks the signature, issuer, audience and validity period of token and returns its claims.
+	Verify(token string) (Claims, error)
+}
+
+type verifier struct {
+	keys     Keys
+	issuer   string
+	audience string
+	time     timenow.TimeNow
+}
+
+// NewVerifier returns a Verifier of the tokens issued by issuer for audience. Tokens without an expiry are refused,
+// they would never stop working.
+func NewVerifier(keys Keys, issuer string, audience string, time timenow.TimeNow) (Verifier, error) {
+	if len(keys.HMACSecret) == 0 && keys.RSAPublicKey == nil {
+		return nil, ErrNoKeys
+	}
+
+	return &verifier{keys: keys, issuer: issuer, audience: audience, time: time}, nil
+}
+
+func (v *verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case h.Algorithm == HS256 && len(v.keys.HMACSecret) > 0:
+		if !hmac.Equal(signature, hmacSHA256(v.keys.HMACSecret, signed)) {
+			return Claims{}, ErrInvalidSignature
+		}
+	case h.Algorithm == RS256 && v.keys.RSAPublicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err = rsa.VerifyPKCS1v15(v.keys.RSAPublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return Claims{}, ErrInvalidSignature
+		}
+	default:
+		return Claims{}, ErrUnsupportedAlgorithm
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+
+	now := v.time.Now().Unix()
+	switch {
+	case claims.Issuer != v.issuer:
+		return Claims{}, ErrInvalidIssuer
+	case !claims.Audience.Contains(v.audience):
+		return Claims{}, ErrInvalidAudience
+	case claims.ExpiresAt == 0:
+		return Claims{}, ErrMissingExpiry
+	case now >= claims.ExpiresAt:
+		return Claims{}, ErrExpired
+	case claims.NotBefore != 0 && now < claims.NotBefore:
+		return Claims{}, ErrNotYetValid
+	case claims.Subject == "":
+		return Claims{}, ErrMissingSubject
+	}
+
+	return claims, nil
+}
+
+// SignHS256 issues a token for claims signed with secret.
+func SignHS256(claims Claims, secret []byte) (string, error) {
+	signed, err := encodeUnsigned(HS256, claims)
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(hmacSHA256(secret, []byte(signed))), nil
+}
+
+// SignRS256 issues a token for claims signed with key.
+func SignRS256(claims Claims, key *rsa.PrivateKey) (string, error) {
+	signed, err := encodeUnsigned(RS256, claims)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ParseRSAPublicKey reads a PEM encoded RSA public key, either PKIX ("PUBLIC KEY") or PKCS #1 ("RSA PUBLIC KEY").
+func ParseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	return rsaKey, nil
+}
+
+func encodeUnsigned(alg Algorithm, claims Claims) (string, error) {
+	h, err := json.Marshal(header{Algorithm: alg, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
+func hmacSHA256(secret, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
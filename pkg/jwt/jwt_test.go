@@ -0,0 +1,202 @@
+package jwt_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"reby/pkg/jwt"
+	"reby/pkg/timenow"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keys := jwt.Keys{HMACSecret: secret, RSAPublicKey: &rsaKey.PublicKey}
+	verifier, err := jwt.NewVerifier(keys, "identity", "api", timenow.NewFixedTime(now))
+	require.NoError(t, err)
+	hmacOnly, err := jwt.NewVerifier(jwt.Keys{HMACSecret: secret}, "identity", "api", timenow.NewFixedTime(now))
+	require.NoError(t, err)
+
+	valid := jwt.Claims{
+		Subject:   "u_1",
+		Issuer:    "identity",
+		Audience:  jwt.Audience{"api"},
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+	must := func(token string, err error) string {
+		require.NoError(t, err)
+		return token
+	}
+	// signed returns a token for the valid claims changed by change
+	signed := func(change func(c *jwt.Claims)) func(t *testing.T) string {
+		return func(t *testing.T) string {
+			c := valid
+			change(&c)
+			return must(jwt.SignHS256(c, secret))
+		}
+	}
+
+	testCases := []struct {
+		description string
+		verifier    jwt.Verifier
+		token       func(t *testing.T) string
+		expectedErr error
+	}{
+		{
+			description: "HS256",
+			verifier:    verifier,
+			token:       func(t *testing.T) string { return must(jwt.SignHS256(valid, secret)) },
+		},
+		{
+			description: "RS256",
+			verifier:    verifier,
+			token:       func(t *testing.T) string { return must(jwt.SignRS256(valid, rsaKey)) },
+		},
+		{
+			description: "HS256 wrong secret",
+			verifier:    verifier,
+			token:       func(t *testing.T) string { return must(jwt.SignHS256(valid, []byte("other"))) },
+			expectedErr: jwt.ErrInvalidSignature,
+		},
+		{
+			description: "RS256 wrong key",
+			verifier:    verifier,
+			token:       func(t *testing.T) string { return must(jwt.SignRS256(valid, otherKey)) },
+			expectedErr: jwt.ErrInvalidSignature,
+		},
+		{
+			description: "RS256 without public key",
+			verifier:    hmacOnly,
+			token:       func(t *testing.T) string { return must(jwt.SignRS256(valid, rsaKey)) },
+			expectedErr: jwt.ErrUnsupportedAlgorithm,
+		},
+		{
+			description: "none algorithm",
+			verifier:    verifier,
+			token: func(t *testing.T) string {
+				parts := strings.Split(must(jwt.SignHS256(valid, secret)), ".")
+				return "eyJhbGciOiJub25lIn0." + parts[1] + "."
+			},
+			expectedErr: jwt.ErrUnsupportedAlgorithm,
+		},
+		{
+			description: "tampered claims",
+			verifier:    verifier,
+			token: func(t *testing.T) string {
+				parts := strings.Split(must(jwt.SignHS256(valid, secret)), ".")
+				other := strings.Split(must(jwt.SignHS256(jwt.Claims{Subject: "u_2"}, []byte("other"))), ".")
+				return parts[0] + "." + other[1] + "." + parts[2]
+			},
+			expectedErr: jwt.ErrInvalidSignature,
+		},
+		{
+			description: "expired",
+			verifier:    verifier,
+			token:       signed(func(c *jwt.Claims) { c.ExpiresAt = now.Unix() }),
+			expectedErr: jwt.ErrExpired,
+		},
+		{
+			description: "not yet valid",
+			verifier:    verifier,
+			token:       signed(func(c *jwt.Claims) { c.NotBefore = now.Add(time.Minute).Unix() }),
+			expectedErr: jwt.ErrNotYetValid,
+		},
+		{
+			description: "without expiry",
+			verifier:    verifier,
+			token:       signed(func(c *jwt.Claims) { c.ExpiresAt = 0 }),
+			expectedErr: jwt.ErrMissingExpiry,
+		},
+		{
+			description: "other issuer",
+			verifier:    verifier,
+			token:       signed(func(c *jwt.Claims) { c.Issuer = "other" }),
+			expectedErr: jwt.ErrInvalidIssuer,
+		},
+		{
+			description: "other audience",
+			verifier:    verifier,
+			token:       signed(func(c *jwt.Claims) { c.Audience = jwt.Audience{"other", "admin"} }),
+			expectedErr: jwt.ErrInvalidAudience,
+		},
+		{
+			description: "without audience",
+			verifier:    verifier,
+			token:       signed(func(c *jwt.Claims) { c.Audience = nil }),
+			expectedErr: jwt.ErrInvalidAudience,
+		},
+		{
+			description: "without subject",
+			verifier:    verifier,
+			token:       signed(func(c *jwt.Claims) { c.Subject = "" }),
+			expectedErr: jwt.ErrMissingSubject,
+		},
+		{
+			description: "malformed",
+			verifier:    verifier,
+			token:       func(t *testing.T) string { return "not-a-token" },
+			expectedErr: jwt.ErrMalformed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			claims, err := tc.verifier.Verify(tc.token(t))
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if tc.expectedErr == nil {
+				assert.Equal(t, valid, claims)
+			}
+		})
+	}
+}
+
+func TestAudience(t *testing.T) {
+	var single, several jwt.Claims
+	require.NoError(t, json.Unmarshal([]byte(`{"aud":"api"}`), &single))
+	require.NoError(t, json.Unmarshal([]byte(`{"aud":["admin","api"]}`), &several))
+
+	assert.Equal(t, jwt.Audience{"api"}, single.Audience)
+	assert.True(t, several.Audience.Contains("api"))
+	assert.False(t, several.Audience.Contains("other"))
+
+	data, err := json.Marshal(jwt.Claims{Audience: jwt.Audience{"api"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sub":"","aud":"api"}`, string(data))
+}
+
+func TestNewVerifierWithoutKeys(t *testing.T) {
+	_, err := jwt.NewVerifier(jwt.Keys{}, "identity", "api", timenow.NewRealTime())
+	assert.ErrorIs(t, err, jwt.ErrNoKeys)
+}
+
+func TestParseRSAPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	parsed, err := jwt.ParseRSAPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}))
+	require.NoError(t, err)
+	assert.Equal(t, &key.PublicKey, parsed)
+
+	pkcs1 := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	parsed, err = jwt.ParseRSAPublicKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pkcs1}))
+	require.NoError(t, err)
+	assert.Equal(t, &key.PublicKey, parsed)
+
+	_, err = jwt.ParseRSAPublicKey([]byte("garbage"))
+	assert.ErrorIs(t, err, jwt.ErrInvalidKey)
+}
@@ -0,0 +1,90 @@
+// Package lifecycle starts the background workers of the process and stops them, and then the resources they use,
+// when the process shuts down.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"reby/pkg/worker"
+)
+
+var ErrStopTimeout = errors.New("ERR_LIFECYCLE_STOP_TIMEOUT")
+
+type Manager struct {
+	mu      sync.Mutex
+	workers []worker.Worker
+	closers []io.Closer
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Go registers a worker to run from Start until Stop.
+func (m *Manager) Go(w worker.Worker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.workers = append(m.workers, w)
+}
+
+// OnStop registers a resource to be closed by Stop once the workers are done. Resources are closed in reverse order
+// of registration, like deferred calls.
+func (m *Manager) OnStop(c io.Closer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closers = append(m.closers, c)
+}
+
+// Start runs the workers until Stop or until ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	for _, w := range m.workers {
+		m.wg.Add(1)
+		go func(w worker.Worker) {
+			defer m.wg.Done()
+			w.Run(ctx)
+		}(w)
+	}
+}
+
+// Stop cancels the workers and waits for them to return before closing the resources. When ctx is done first the
+// resources are left open, the workers may still be using them, and ErrStopTimeout is returned.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ErrStopTimeout
+	}
+
+	var firstErr error
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		if err := m.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	m.closers = nil
+
+	return firstErr
+}
@@ -0,0 +1,71 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"reby/pkg/lifecycle"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type workerFunc func(ctx context.Context)
+
+func (f workerFunc) Run(ctx context.Context) { f(ctx) }
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func TestManager_Stop(t *testing.T) {
+	m := lifecycle.NewManager()
+
+	var order []string
+	stopped := false
+	m.Go(workerFunc(func(ctx context.Context) {
+		<-ctx.Done()
+		stopped = true
+	}))
+	errClose := errors.New("close failed")
+	m.OnStop(closerFunc(func() error {
+		assert.True(t, stopped, "closed before the worker stopped")
+		order = append(order, "db")
+		return errClose
+	}))
+	m.OnStop(closerFunc(func() error {
+		order = append(order, "cache")
+		return nil
+	}))
+
+	m.Start(context.Background())
+	err := m.Stop(context.Background())
+
+	assert.Equal(t, errClose, err)
+	assert.True(t, stopped)
+	assert.Equal(t, []string{"cache", "db"}, order)
+}
+
+func TestManager_StopTimeout(t *testing.T) {
+	m := lifecycle.NewManager()
+
+	release := make(chan struct{})
+	defer close(release)
+	m.Go(workerFunc(func(ctx context.Context) {
+		<-release
+	}))
+	closed := false
+	m.OnStop(closerFunc(func() error {
+		closed = true
+		return nil
+	}))
+
+	m.Start(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := m.Stop(ctx)
+
+	assert.Equal(t, lifecycle.ErrStopTimeout, err)
+	assert.False(t, closed, "resources are left open while a worker may use them")
+}
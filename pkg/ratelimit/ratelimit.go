@@ -0,0 +1,92 @@
+// Package ratelimit limits the rate of requests with token buckets: a bucket holds up to Burst tokens, every request
+// takes one and they are refilled at Requests per Per.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// IsZero tells whether the limit is unset, which lets every request through.
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// interval is the time it takes to refill one token.
+func (l Limit) interval() time.Duration {
+	return l.Per / time.Duration(l.Requests)
+}
+
+func (l Limit) burst() int {
+	if l.Burst <= 0 {
+		return 1
+	}
+	return l.Burst
+}
+
+// Bucket is the state of the bucket of a key.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Result of taking a token.
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available when the request was not allowed.
+	RetryAfter time.Duration
+}
+
+// Take takes a token from b at now, starting from a full bucket when b is new.
+func Take(b Bucket, limit Limit, now time.Time) (Bucket, Result) {
+	burst := float64(limit.burst())
+	if b.UpdatedAt.IsZero() {
+		b = Bucket{Tokens: burst, UpdatedAt: now}
+	}
+
+	if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+float64(elapsed)/float64(limit.interval()))
+		b.UpdatedAt = now
+	}
+
+	if b.Tokens < 1 {
+		retryAfter := time.Duration((1 - b.Tokens) * float64(limit.interval()))
+		return b, Result{Allowed: false, RetryAfter: retryAfter}
+	}
+	b.Tokens--
+
+	return b, Result{Allowed: true}
+}
+
+// FullAt returns when b is full again, so it can be forgotten.
+func FullAt(b Bucket, limit Limit) time.Time {
+	missing := float64(limit.burst()) - b.Tokens
+	return b.UpdatedAt.Add(time.Duration(missing * float64(limit.interval())))
+}
+
+// Store keeps the buckets. Stores shared by every instance of the service make the limits global.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+type StoreMock struct {
+	mock.Mock
+}
+
+func NewStoreMock() *StoreMock {
+	return new(StoreMock)
+}
+
+func (m *StoreMock) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	args := m.Mock.Called(key, limit, now)
+	return args.Get(0).(Result), args.Error(1)
+}
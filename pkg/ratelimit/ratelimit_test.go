@@ -0,0 +1,45 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"reby/pkg/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTake(t *testing.T) {
+	limit := ratelimit.Limit{Requests: 60, Per: time.Minute, Burst: 3}
+	now := time.Now()
+
+	var b ratelimit.Bucket
+	var res ratelimit.Result
+	for i := 0; i < 3; i++ {
+		b, res = ratelimit.Take(b, limit, now)
+		assert.True(t, res.Allowed, "burst request %d", i)
+	}
+
+	b, res = ratelimit.Take(b, limit, now)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	b, res = ratelimit.Take(b, limit, now.Add(500*time.Millisecond))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	b, res = ratelimit.Take(b, limit, now.Add(time.Second))
+	assert.True(t, res.Allowed, "a token is refilled every second")
+
+	assert.Equal(t, now.Add(4*time.Second), ratelimit.FullAt(b, limit))
+
+	// Buckets never hold more than the burst
+	b, _ = ratelimit.Take(b, limit, now.Add(time.Hour))
+	assert.Equal(t, 2.0, b.Tokens)
+}
+
+func TestLimitIsZero(t *testing.T) {
+	assert.True(t, ratelimit.Limit{}.IsZero())
+	assert.True(t, ratelimit.Limit{Requests: 10}.IsZero())
+	assert.False(t, ratelimit.Limit{Requests: 10, Per: time.Second}.IsZero())
+}
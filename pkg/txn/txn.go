@@ -0,0 +1,126 @@
+// Package txn runs calls to several repos as a unit of work, applying all of their changes or none. The unit of
+// work travels in the context, and the repos given that context join it.
+package txn
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Manager runs units of work.
+type Manager interface {
+	// WithinTx runs fn in a unit of work, applied when fn succeeds and rolled back when it fails. When ctx is
+	// already in a unit of work fn joins it, and it is applied or rolled back with the rest.
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// DBTX is what *sql.DB and *sql.Tx have in common, so the repos run the same queries in and out of a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+type sqlManager struct {
+	db *sql.DB
+}
+
+// NewSQLManager returns a Manager running each unit of work in a transaction of db.
+func NewSQLManager(db *sql.DB) Manager {
+	return &sqlManager{db: db}
+}
+
+func (m *sqlManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := Tx(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Tx returns the transaction of the unit of work in ctx, if any.
+func Tx(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// From returns the transaction of the unit of work in ctx, or db outside of one.
+func From(ctx context.Context, db *sql.DB) DBTX {
+	if tx, ok := Tx(ctx); ok {
+		return tx
+	}
+
+	return db
+}
+
+type unitOfWorkKey struct{}
+
+// unitOfWork is a unit of work of the memory repos, which undo their changes when it is rolled back.
+type unitOfWork struct {
+	mu   sync.Mutex
+	undo []func()
+}
+
+type memoryManager struct {
+	mu sync.Mutex
+}
+
+// NewMemoryManager returns a Manager for the memory repos. The units of work run one at a time, but the calls
+// outside of them see their changes before they are applied. Only the repos registering OnRollback are rolled back.
+func NewMemoryManager() Manager {
+	return &memoryManager{}
+}
+
+func (m *memoryManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork); ok {
+		return fn(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := &unitOfWork{}
+	if err := fn(context.WithValue(ctx, unitOfWorkKey{}, u)); err != nil {
+		u.rollback()
+		return err
+	}
+
+	return nil
+}
+
+// rollback undoes the changes, the latest first.
+func (u *unitOfWork) rollback() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for i := len(u.undo) - 1; i >= 0; i-- {
+		u.undo[i]()
+	}
+	u.undo = nil
+}
+
+// OnRollback makes undo run when the memory unit of work in ctx is rolled back. It does nothing outside of one.
+func OnRollback(ctx context.Context, undo func()) {
+	u, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork)
+	if !ok {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.undo = append(u.undo, undo)
+}
@@ -0,0 +1,79 @@
+package txn_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"reby/pkg/txn"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryManager(t *testing.T) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	var undone []string
+	var manager txn.Manager
+	setup := func() {
+		undone = nil
+		manager = txn.NewMemoryManager()
+	}
+	change := func(ctx context.Context, name string) {
+		txn.OnRollback(ctx, func() { undone = append(undone, name) })
+	}
+
+	t.Run("applied", func(t *testing.T) {
+		setup()
+
+		err := manager.WithinTx(ctx, func(ctx context.Context) error {
+			change(ctx, "1")
+			change(ctx, "2")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, undone)
+	})
+
+	t.Run("rolled back, the latest change first", func(t *testing.T) {
+		setup()
+
+		err := manager.WithinTx(ctx, func(ctx context.Context) error {
+			change(ctx, "1")
+			change(ctx, "2")
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+		assert.Equal(t, []string{"2", "1"}, undone)
+	})
+
+	t.Run("nested units of work join the outer one", func(t *testing.T) {
+		setup()
+
+		err := manager.WithinTx(ctx, func(ctx context.Context) error {
+			change(ctx, "1")
+			if err := manager.WithinTx(ctx, func(ctx context.Context) error {
+				change(ctx, "2")
+				return nil
+			}); err != nil {
+				return err
+			}
+			assert.Empty(t, undone)
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+		assert.Equal(t, []string{"2", "1"}, undone)
+	})
+
+	t.Run("changes outside of a unit of work are never undone", func(t *testing.T) {
+		setup()
+
+		change(ctx, "1")
+		err := manager.WithinTx(ctx, func(ctx context.Context) error {
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+		assert.Empty(t, undone)
+	})
+}
@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrInvalidInterval = errors.New("ERR_WORKER_INVALID_INTERVAL")
+
+// Worker is a background process that runs until its context is cancelled.
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+type periodic struct {
+	name     string
+	interval time.Duration
+	job      func(ctx context.Context) error
+}
+
+// NewPeriodic returns a Worker that runs job every interval. Job errors are logged and do not stop the worker. The
+// interval must be positive.
+func NewPeriodic(name string, interval time.Duration, job func(ctx context.Context) error) (Worker, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: worker %s runs every %s", ErrInvalidInterval, name, interval)
+	}
+
+	return &periodic{name: name, interval: interval, job: job}, nil
+}
+
+func (p *periodic) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.job(ctx); err != nil {
+				log.Printf("worker %s: %s", p.name, err)
+			}
+		}
+	}
+}
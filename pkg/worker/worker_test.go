@@ -0,0 +1,45 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"reby/pkg/worker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPeriodic(t *testing.T) {
+	job := func(ctx context.Context) error { return nil }
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		w, err := worker.NewPeriodic("test", interval, job)
+		assert.ErrorIs(t, err, worker.ErrInvalidInterval)
+		assert.Nil(t, w)
+	}
+}
+
+func TestPeriodicRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 1)
+	w, err := worker.NewPeriodic("test", time.Millisecond, func(ctx context.Context) error {
+		select {
+		case runs <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	<-runs
+	cancel()
+	<-done
+}